@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+// usageError 参数错误，退出码为 2
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+func newFlagSet(name string, env *env) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.stderr)
+	return fs
+}
+
+// parse 解析参数，允许参数和选项交替出现（如 get KEY -version 2），返回位置参数
+func parse(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) != want {
+		return nil, usagef("expected %d argument(s), got %d", want, len(positional))
+	}
+	return positional, nil
+}
+
+// subscriptionFlags 定位订阅版本的公共选项
+type subscriptionFlags struct {
+	subType string
+	version uint
+}
+
+func (f *subscriptionFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.subType, "type", "A", "订阅类型")
+	fs.UintVar(&f.version, "version", 0, "版本号")
+}
+
+func (f *subscriptionFlags) requireVersion() (uint32, error) {
+	if f.version == 0 {
+		return 0, usagef("-version is required")
+	}
+	return uint32(f.version), nil
+}
+
+// variablesFlag 可重复的 -var NAME=VALUE，值按 JSON 解析（数字、布尔、数组），失败时作为字符串
+type variablesFlag map[string]interface{}
+
+func (v variablesFlag) String() string {
+	return ""
+}
+
+func (v variablesFlag) Set(s string) error {
+	name, raw, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected NAME=VALUE, got %q", s)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	v[name] = value
+	return nil
+}
+
+// readDocument 读取 YAML 或 JSON 文件（- 表示标准输入）并解码到 out
+func readDocument(path string, out interface{}) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	// YAML 是 JSON 的超集，统一按 YAML 解析后转为 JSON，extra_config 可以写成嵌套结构
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := json.Unmarshal(encoded, out); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func runList(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("list", env)
+	var opts client.ListOptions
+	fs.StringVar(&opts.Status, "status", "", "按状态筛选")
+	fs.StringVar(&opts.SubKey, "key", "", "按订阅 key 筛选")
+	fs.StringVar(&opts.Title, "title", "", "按标题筛选")
+	fs.IntVar(&opts.Limit, "limit", 20, "每页条数")
+	fs.IntVar(&opts.Offset, "offset", 0, "偏移量")
+	output := fs.String("o", "table", "输出格式：table、json、yaml")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	list, err := env.client.ListSubscriptions(ctx, opts)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "table":
+		return writeSubscriptions(env.stdout, list.Items)
+	case "json":
+		return writeJSON(env.stdout, list)
+	case "yaml":
+		return writeYAML(env.stdout, list)
+	default:
+		return usagef("unsupported output %q", *output)
+	}
+}
+
+func runGet(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("get", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	output := fs.String("o", "yaml", "输出格式：yaml、json、table")
+	positional, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	subscription, err := env.client.GetSubscription(ctx, sub.subType, positional[0], uint32(sub.version))
+	if err != nil {
+		return err
+	}
+	return writeSubscription(env.stdout, *output, subscription)
+}
+
+func runCreate(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("create", env)
+	file := fs.String("f", "", "订阅定义文件（YAML 或 JSON，- 表示标准输入）")
+	force := fs.Bool("force", false, "输出结构与生效版本不兼容时仍然激活")
+	output := fs.String("o", "table", "输出格式：table、json、yaml")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return usagef("-f is required")
+	}
+
+	var req models.CreateSubscriptionRequest
+	if err := readDocument(*file, &req); err != nil {
+		return err
+	}
+	req.Force = req.Force || *force
+
+	subscription, err := env.client.CreateSubscription(ctx, &req)
+	if err != nil {
+		return err
+	}
+	return writeSubscription(env.stdout, *output, subscription)
+}
+
+func runUpdate(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("update", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	file := fs.String("f", "", "订阅定义文件（YAML 或 JSON，- 表示标准输入），只更新其中出现的字段")
+	force := fs.Bool("force", false, "输出结构与生效版本不兼容时仍然激活")
+	output := fs.String("o", "table", "输出格式：table、json、yaml")
+	positional, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	version, err := sub.requireVersion()
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return usagef("-f is required")
+	}
+
+	var req models.UpdateSubscriptionRequest
+	if err := readDocument(*file, &req); err != nil {
+		return err
+	}
+	req.Force = req.Force || *force
+
+	subscription, err := env.client.UpdateSubscription(ctx, sub.subType, positional[0], version, &req)
+	if err != nil {
+		return err
+	}
+	return writeSubscription(env.stdout, *output, subscription)
+}
+
+func runStatus(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("status", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	force := fs.Bool("force", false, "输出结构与生效版本不兼容时仍然激活")
+	positional, err := parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	version, err := sub.requireVersion()
+	if err != nil {
+		return err
+	}
+
+	key, status := positional[0], strings.ToUpper(positional[1])
+	if err := env.client.UpdateStatus(ctx, sub.subType, key, version, status, *force); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "%s version %d status changed to %s\n", key, version, status)
+	return nil
+}
+
+func runFork(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("fork", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	file := fs.String("f", "", "覆盖来源版本的字段（可选，YAML 或 JSON）")
+	output := fs.String("o", "table", "输出格式：table、json、yaml")
+	positional, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	version, err := sub.requireVersion()
+	if err != nil {
+		return err
+	}
+
+	var req models.ForkSubscriptionRequest
+	if *file != "" {
+		if err := readDocument(*file, &req); err != nil {
+			return err
+		}
+	}
+
+	subscription, err := env.client.ForkSubscription(ctx, sub.subType, positional[0], version, &req)
+	if err != nil {
+		return err
+	}
+	return writeSubscription(env.stdout, *output, subscription)
+}
+
+func runDelete(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("delete", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	positional, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	version, err := sub.requireVersion()
+	if err != nil {
+		return err
+	}
+
+	if err := env.client.DeleteSubscription(ctx, sub.subType, positional[0], version); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stdout, "%s version %d deleted\n", positional[0], version)
+	return nil
+}
+
+func runExec(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("exec", env)
+	var sub subscriptionFlags
+	sub.register(fs)
+	variables := variablesFlag{}
+	fs.Var(variables, "var", "变量 NAME=VALUE，可重复")
+	varsFile := fs.String("vars", "", "变量文件（YAML 或 JSON 对象），-var 优先")
+	dataSource := fs.String("data-source", "", "数据源，须在订阅的 allowed_data_sources 中")
+	timeout := fs.Duration("timeout", 0, "服务端执行超时，默认 120s")
+	pageSize := fs.Int("page-size", 0, "分页大小，按订阅的 page_keys 游标分页，仅用于 -o json")
+	cursor := fs.String("cursor", "", "上一页返回的 next_cursor，仅用于 -o json")
+	output := fs.String("o", "table", "输出格式：table、csv、json、ndjson")
+	positional, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	// 流式导出不分页，next_cursor 只在 JSON 结果中返回
+	if (*pageSize != 0 || *cursor != "") && *output != "json" {
+		return usagef("-page-size and -cursor require -o json")
+	}
+
+	req := &models.ExecuteSubscriptionRequest{
+		Variables:  map[string]interface{}{},
+		DataSource: *dataSource,
+		Timeout:    int(*timeout / time.Millisecond),
+		PageSize:   *pageSize,
+		Cursor:     *cursor,
+	}
+	if *varsFile != "" {
+		if err := readDocument(*varsFile, &req.Variables); err != nil {
+			return err
+		}
+	}
+	for name, value := range variables {
+		req.Variables[name] = value
+	}
+
+	key, version := positional[0], uint32(sub.version)
+	switch *output {
+	case "json":
+		result, err := env.client.Execute(ctx, sub.subType, key, version, req)
+		if err != nil {
+			return err
+		}
+		return writeJSON(env.stdout, result)
+	case models.FormatCSV, models.FormatNDJSON:
+		_, err := env.client.Stream(ctx, sub.subType, key, version, req, *output, env.stdout)
+		return err
+	case "table":
+		var buf bytes.Buffer
+		if _, err := env.client.Stream(ctx, sub.subType, key, version, req, models.FormatCSV, &buf); err != nil {
+			return err
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			return fmt.Errorf("decode result: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return writeTable(env.stdout, records[0], records[1:])
+	default:
+		return usagef("unsupported output %q", *output)
+	}
+}
+
+func runStats(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("stats", env)
+	var q client.StatsQuery
+	fs.StringVar(&q.StartTime, "start", "", "开始日期 YYYY-MM-DD，默认 7 天前")
+	fs.StringVar(&q.EndTime, "end", "", "结束日期 YYYY-MM-DD（含），默认今天")
+	fs.IntVar(&q.Limit, "limit", 20, "条数，最多 100")
+	fs.IntVar(&q.Offset, "offset", 0, "偏移量")
+	output := fs.String("o", "table", "输出格式：table、json")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	stats, err := env.client.Stats(ctx, q)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "table":
+		rows := make([][]string, len(stats))
+		for i, s := range stats {
+			rows[i] = []string{
+				s.SubKey,
+				strconv.FormatUint(uint64(s.Version), 10),
+				strconv.FormatInt(s.CallCount, 10),
+				strconv.FormatFloat(s.AvgExecutionTime, 'f', 1, 64),
+				strconv.FormatUint(uint64(s.MinExecutionTime), 10),
+				strconv.FormatUint(uint64(s.MaxExecutionTime), 10),
+			}
+		}
+		return writeTable(env.stdout, []string{"KEY", "VERSION", "CALLS", "AVG_MS", "MIN_MS", "MAX_MS"}, rows)
+	case "json":
+		return writeJSON(env.stdout, stats)
+	default:
+		return usagef("unsupported output %q", *output)
+	}
+}
+
+func runLogs(ctx context.Context, env *env, args []string) error {
+	fs := newFlagSet("logs", env)
+	var req models.OperationLogRequest
+	fs.StringVar(&req.StartTime, "start", "", "开始时间")
+	fs.StringVar(&req.EndTime, "end", "", "结束时间")
+	fs.StringVar(&req.Username, "user", "", "操作用户")
+	fs.StringVar(&req.Operation, "operation", "", "操作类型")
+	fs.StringVar(&req.Resource, "resource", "", "资源")
+	fs.StringVar(&req.Status, "status", "", "操作状态")
+	fs.IntVar(&req.Limit, "limit", 20, "条数，最多 100")
+	fs.IntVar(&req.Offset, "offset", 0, "偏移量")
+	output := fs.String("o", "table", "输出格式：table、json")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	list, err := env.client.OperationLogs(ctx, req)
+	if err != nil {
+		return err
+	}
+	switch *output {
+	case "table":
+		rows := make([][]string, len(list.Items))
+		for i, l := range list.Items {
+			rows[i] = []string{
+				l.CreatedAt.Format(time.DateTime),
+				l.Username,
+				l.Operation,
+				l.Resource,
+				l.ResourceID,
+				l.Status,
+				strconv.FormatUint(uint64(l.Duration), 10),
+				l.ErrorMsg,
+			}
+		}
+		return writeTable(env.stdout, []string{"TIME", "USER", "OPERATION", "RESOURCE", "RESOURCE_ID", "STATUS", "DURATION_MS", "ERROR"}, rows)
+	case "json":
+		return writeJSON(env.stdout, list)
+	default:
+		return usagef("unsupported output %q", *output)
+	}
+}
@@ -0,0 +1,135 @@
+// bisubctl go-bisub 的命令行客户端，通过 HTTP API 管理和执行订阅
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/client"
+)
+
+// 退出码：0 成功，1 请求失败，2 参数错误
+const (
+	exitError = 1
+	exitUsage = 2
+)
+
+// command 子命令
+type command struct {
+	usage string
+	short string
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+// env 子命令的运行环境
+type env struct {
+	client *client.Client
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]command{
+	"list":   {usage: "list [-status S] [-key K] [-title T] [-limit N] [-offset N] [-o table|json|yaml]", short: "列出订阅", run: runList},
+	"get":    {usage: "get KEY [-version N] [-type A] [-o yaml|json|table]", short: "查看订阅，未指定版本时为当前生效版本", run: runGet},
+	"create": {usage: "create -f FILE [-force] [-o table|json|yaml]", short: "由 YAML/JSON 文件创建订阅", run: runCreate},
+	"update": {usage: "update KEY -version N -f FILE [-force] [-o table|json|yaml]", short: "由 YAML/JSON 文件更新订阅版本", run: runUpdate},
+	"status": {usage: "status KEY STATUS -version N [-force]", short: "变更版本状态（A 待生效、B 生效、C 强制兼容、D 失效）", run: runStatus},
+	"fork":   {usage: "fork KEY -version N [-f FILE] [-o table|json|yaml]", short: "由已有版本派生新版本", run: runFork},
+	"delete": {usage: "delete KEY -version N", short: "删除订阅版本", run: runDelete},
+	"exec":   {usage: "exec KEY [-version N] [-var NAME=VALUE]... [-vars FILE] [-data-source DS] [-timeout D] [-page-size N] [-cursor C] [-o table|csv|json|ndjson]", short: "执行订阅并输出结果", run: runExec},
+	"stats":  {usage: "stats [-start YYYY-MM-DD] [-end YYYY-MM-DD] [-limit N] [-offset N] [-o table|json]", short: "查询调用统计", run: runStats},
+	"logs":   {usage: "logs [-start T] [-end T] [-user U] [-operation OP] [-resource R] [-status S] [-limit N] [-offset N] [-o table|json]", short: "查询操作日志", run: runLogs},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("bisubctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	configPath := global.String("config", client.DefaultProfilePath(), "profile 文件路径（环境变量 "+client.EnvConfig+"）")
+	profileName := global.String("profile", "", "使用的 profile，默认为文件中的 current（环境变量 "+client.EnvProfile+"）")
+	global.Usage = func() { usage(stderr, global) }
+	if err := global.Parse(args); err != nil {
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		usage(stderr, global)
+		return exitUsage
+	}
+
+	name := global.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", name)
+		usage(stderr, global)
+		return exitUsage
+	}
+
+	profile, err := client.LoadProfile(*configPath, *profileName)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return exitUsage
+	}
+	c, err := client.New(profile)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd.run(ctx, &env{client: c, stdout: stdout, stderr: stderr}, global.Args()[1:])
+	return report(stderr, name, cmd, err)
+}
+
+// report 输出错误并返回退出码，接口返回的校验明细（如SQL策略违规）一并输出
+func report(stderr io.Writer, name string, cmd command, err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) || errors.Is(err, flag.ErrHelp) {
+		if usageErr != nil {
+			fmt.Fprintln(stderr, "error:", usageErr.msg)
+		}
+		fmt.Fprintln(stderr, "usage: bisubctl", cmd.usage)
+		return exitUsage
+	}
+
+	fmt.Fprintln(stderr, "error:", err)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && len(apiErr.Data) > 0 && string(apiErr.Data) != "null" {
+		writeJSON(stderr, apiErr.Data)
+	}
+	return exitError
+}
+
+func usage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: bisubctl [-config FILE] [-profile NAME] COMMAND [ARGS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].short)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "global flags:")
+	global.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "environment: %s, %s, %s override the profile\n", client.EnvServer, client.EnvToken, client.EnvAPIKey)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// writeTable 以对齐的列输出，单元格中的换行和制表符替换为空格
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML 经 JSON 转换后输出，json.RawMessage（如 extra_config）输出为嵌套结构
+func writeYAML(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func writeSubscriptions(w io.Writer, subscriptions []*models.Subscription) error {
+	rows := make([][]string, len(subscriptions))
+	for i, s := range subscriptions {
+		rows[i] = []string{
+			s.Type,
+			s.SubKey,
+			strconv.FormatUint(uint64(s.Version), 10),
+			s.Status,
+			s.Title,
+			s.UpdatedAt.Format(time.DateTime),
+		}
+	}
+	return writeTable(w, []string{"TYPE", "KEY", "VERSION", "STATUS", "TITLE", "UPDATED"}, rows)
+}
+
+func writeSubscription(w io.Writer, output string, subscription *models.Subscription) error {
+	switch output {
+	case "table":
+		return writeSubscriptions(w, []*models.Subscription{subscription})
+	case "json":
+		return writeJSON(w, subscription)
+	case "yaml":
+		return writeYAML(w, subscription)
+	default:
+		return usagef("unsupported output %q", output)
+	}
+}
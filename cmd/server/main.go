@@ -2,19 +2,37 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
 	fxmodules "git.uhomes.net/uhs-go/go-bisub/internal/pkg/fx"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
 	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 	"go.uber.org/fx"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check-config":
+			os.Exit(checkConfig(os.Args[2:]))
+		case "sync":
+			os.Exit(syncDefinitions(os.Args[2:]))
+		}
+	}
+
 	app := fx.New(
 		fxmodules.ConfigModule,
 		fxmodules.LoggerModule,
@@ -32,6 +50,176 @@ func main() {
 	app.Run()
 }
 
+// checkConfig 离线校验配置文件，不连接数据库和Redis；校验通过返回0
+func checkConfig(args []string) int {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	file := fs.String("config", "", "配置文件路径，默认查找 ./config.yaml 和 ./config/config.yaml")
+	printConfig := fs.Bool("print", false, "打印生效的配置（含环境变量覆盖），密钥和密码以 ****** 代替")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *printConfig {
+		out, err := cfg.Redacted().YAML()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		os.Stdout.Write(out)
+	}
+	fmt.Fprintf(os.Stderr, "config OK: %s\n", viper.ConfigFileUsed())
+	return 0
+}
+
+// syncPrincipal sync 子命令写入修订时使用的身份
+var syncPrincipal = &auth.Principal{Kind: auth.KindSystem, Username: "gitops", Admin: true}
+
+// syncDefinitions 按定义目录同步订阅，默认只输出计划；成功返回0
+// 只连接元数据库、Redis 和数据源，不启动 HTTP 服务、异步任务和调度器
+func syncDefinitions(args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	file := fs.String("config", "", "配置文件路径，默认查找 ./config.yaml 和 ./config/config.yaml")
+	dir := fs.String("dir", "", "订阅定义目录，默认 gitops.definitions_dir")
+	apply := fs.Bool("apply", false, "在同一事务中执行计划，默认只输出计划")
+	prune := fs.Bool("prune", false, "删除定义中不存在的版本")
+	force := fs.Bool("force", false, "输出结构与生效版本不兼容时仍然激活")
+	output := fs.String("o", "text", "输出格式：text、json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported output %q\n", *output)
+		return 2
+	}
+
+	cfg, err := config.LoadFile(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *dir == "" {
+		*dir = cfg.GitOps.DefinitionsDir
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "definitions directory is required: use -dir or set gitops.definitions_dir")
+		return 2
+	}
+
+	var subscriptions *service.SubscriptionService
+	var registry *service.DataSourceRegistry
+	app := fx.New(
+		fx.Supply(cfg),
+		fxmodules.DatabaseModule,
+		fxmodules.RedisModule,
+		fxmodules.RepositoryModule,
+		fxmodules.ServiceModule,
+		fx.Invoke(initSnowflake),
+		fx.Populate(&subscriptions, &registry),
+		fx.RecoverFromPanics(),
+		fx.NopLogger,
+	)
+	if err := app.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx := auth.WithPrincipal(context.Background(), syncPrincipal)
+	if err := registry.Reload(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to load data source registry:", err)
+		return 1
+	}
+	defer registry.Stop(ctx)
+
+	plan, err := subscriptions.SyncDirectory(ctx, *dir, &models.SyncRequest{Apply: *apply, Prune: *prune, Force: *force})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(plan)
+		return 0
+	}
+	printSyncPlan(os.Stdout, plan)
+	return 0
+}
+
+// printSyncPlan 逐行输出计划：+ 创建、~ 修改、> 状态、- 删除、! 带外修改、? 未纳管
+func printSyncPlan(w io.Writer, plan *models.SyncPlan) {
+	for _, d := range plan.Drift {
+		what := "changed"
+		if d.Deleted {
+			what = "deleted"
+		}
+		fmt.Fprintf(w, "! drift     %s/%s v%d %s by %s at %s (%s, revision %d)\n",
+			d.Type, d.SubKey, d.Version, what, d.ChangedBy, d.ChangedAt.Format(time.DateTime), d.Action, d.Revision)
+	}
+
+	counts := make(map[string]int)
+	symbols := map[string]string{models.SyncCreate: "+", models.SyncUpdate: "~", models.SyncStatus: ">", models.SyncPrune: "-"}
+	for _, c := range plan.Changes {
+		counts[c.Action]++
+		var details []string
+		for _, f := range c.Fields {
+			if f.Field == "status" {
+				details = append(details, strings.TrimSpace(fmt.Sprintf("status %s -> %s", f.From, f.To)))
+			} else {
+				details = append(details, f.Field)
+			}
+		}
+		if e := c.ExtraConfig; e != nil {
+			if len(e.SQL) > 0 {
+				details = append(details, "sql")
+			}
+			for _, name := range e.AddedVariables {
+				details = append(details, "+var "+name)
+			}
+			for _, name := range e.RemovedVariables {
+				details = append(details, "-var "+name)
+			}
+			for _, name := range e.ChangedVariables {
+				details = append(details, "~var "+name)
+			}
+			for _, f := range e.Fields {
+				details = append(details, f.Field)
+			}
+		}
+		if c.Drift {
+			details = append(details, "overwrites drift")
+		}
+		line := fmt.Sprintf("%s %-8s %s/%s v%d", symbols[c.Action], c.Action, c.Type, c.SubKey, c.Version)
+		if len(details) > 0 {
+			line += ": " + strings.Join(details, ", ")
+		}
+		fmt.Fprintln(w, line)
+	}
+	for _, u := range plan.Unmanaged {
+		fmt.Fprintf(w, "? unmanaged %s/%s v%d (%s)\n", u.Type, u.SubKey, u.Version, u.Status)
+	}
+
+	fmt.Fprintf(w, "\n%d to create, %d to update, %d status change(s), %d to prune",
+		counts[models.SyncCreate], counts[models.SyncUpdate], counts[models.SyncStatus], counts[models.SyncPrune])
+	if len(plan.Unmanaged) > 0 {
+		fmt.Fprintf(w, ", %d unmanaged (use -prune to delete)", len(plan.Unmanaged))
+	}
+	switch {
+	case plan.Applied:
+		fmt.Fprintln(w, ". Applied.")
+	case len(plan.Changes) > 0:
+		fmt.Fprintln(w, ". Dry run, use -apply to apply.")
+	default:
+		fmt.Fprintln(w, ". Up to date.")
+	}
+}
+
 // initSnowflake 初始化 Snowflake ID 生成器
 func initSnowflake(cfg *config.Config) error {
 	nodeID := int64(1) // 默认节点 ID
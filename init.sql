@@ -10,12 +10,13 @@ CREATE TABLE IF NOT EXISTS `sub_subscription_theme` (
 	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
 	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型 [ref:sub_refs] ref_field:SUBSCRIPTION_TYPE',
 	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
-	`version` tinyint unsigned NOT NULL DEFAULT 1 COMMENT '版本号',
+	`version` int unsigned NOT NULL DEFAULT 1 COMMENT '版本号',
 	`title` varchar(240) NOT NULL COMMENT '订阅标题',
 	`abstract` tinytext NOT NULL COMMENT '订阅简介',
 	`status` char(1) NOT NULL DEFAULT '' COMMENT '状态[ref:sub_refs] ref_field:SUBSCRIPTION_STATUS',
 	`created_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '创建人ID uhomse_sso[ref:sso_user]',
 	`extra_config` json NOT NULL COMMENT '订阅扩展配置{"sql_content":"订阅数据SQL","sql_replace":"SQL替换变量说明","example":"示例说明"}',
+	`parent_version` int unsigned NOT NULL DEFAULT 0 COMMENT '派生来源版本，0表示直接创建',
 	PRIMARY KEY (`id`),
 	UNIQUE KEY `uk_type_subkey_version` (`type`,`sub_key`,`version`),
 	KEY `idx_title` (`title`)
@@ -27,7 +28,7 @@ CREATE TABLE IF NOT EXISTS `sub_logs_bidata_response` (
 	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
 	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
 	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
-	`version` tinyint unsigned NOT NULL DEFAULT 1 COMMENT '订阅版本号',
+	`version` int unsigned NOT NULL DEFAULT 1 COMMENT '订阅版本号',
 	`execution_duration` mediumint unsigned NOT NULL DEFAULT 0 COMMENT '执行耗时 单位：毫秒',
 	`request_url` varchar(1000) NOT NULL DEFAULT '' COMMENT '请求链接',
 	`request_response` json NOT NULL COMMENT '请求详情json {"params":"请求参数","instance_sql":"执行实例SQL","instance_source":"实例来源","request_ip":"请求来源IP","version":"版本号"}',
@@ -80,6 +81,174 @@ CREATE TABLE IF NOT EXISTS `sub_logs_operation` (
   KEY `idx_created_at` (`created_at`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='操作日志表';
 
+-- 异步执行任务表
+CREATE TABLE IF NOT EXISTS `sub_execution_job` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`version` int unsigned NOT NULL DEFAULT 1 COMMENT '版本号',
+	`data_source` varchar(120) NOT NULL DEFAULT '' COMMENT '数据源',
+	`status` varchar(20) NOT NULL DEFAULT '' COMMENT '任务状态 pending/running/succeeded/failed/canceled',
+	`params` json DEFAULT NULL COMMENT '执行参数',
+	`row_count` bigint NOT NULL DEFAULT 0 COMMENT '结果行数',
+	`error_msg` text COMMENT '失败原因',
+	`request_ip` varchar(45) NOT NULL DEFAULT '' COMMENT '请求来源IP',
+	`instance` varchar(120) NOT NULL DEFAULT '' COMMENT '执行任务的实例',
+	`heartbeat_at` timestamp NULL DEFAULT NULL COMMENT '实例最近一次确认仍持有该任务的时间',
+	`started_at` timestamp NULL DEFAULT NULL COMMENT '开始执行时间',
+	`finished_at` timestamp NULL DEFAULT NULL COMMENT '结束时间',
+	PRIMARY KEY (`id`),
+	KEY `idx_sub_key` (`sub_key`),
+	KEY `idx_status` (`status`),
+	KEY `idx_instance` (`instance`),
+	KEY `idx_heartbeat_at` (`heartbeat_at`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='异步执行任务表';
+
+-- 定时投递计划表
+CREATE TABLE IF NOT EXISTS `sub_subscription_schedule` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`name` varchar(120) NOT NULL DEFAULT '' COMMENT '计划名称',
+	`cron_expr` varchar(120) NOT NULL COMMENT 'cron表达式',
+	`timezone` varchar(64) NOT NULL DEFAULT '' COMMENT '时区',
+	`variables` json DEFAULT NULL COMMENT '固定执行变量',
+	`data_source` varchar(120) NOT NULL DEFAULT '' COMMENT '数据源',
+	`target` json NOT NULL COMMENT '投递目标{"type":"webhook|email|file"}',
+	`enabled` tinyint(1) NOT NULL DEFAULT 1 COMMENT '是否启用',
+	`next_run_at` timestamp NULL DEFAULT NULL COMMENT '下次触发时间',
+	`last_run_at` timestamp NULL DEFAULT NULL COMMENT '上次触发时间',
+	`created_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '创建人ID',
+	`run_as` json DEFAULT NULL COMMENT '触发时使用的身份',
+	PRIMARY KEY (`id`),
+	KEY `idx_sub_key` (`sub_key`),
+	KEY `idx_next_run_at` (`next_run_at`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='定时投递计划表';
+
+-- 定时投递执行记录表
+CREATE TABLE IF NOT EXISTS `sub_schedule_run` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`schedule_id` bigint unsigned NOT NULL COMMENT '计划ID',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`version` int unsigned NOT NULL DEFAULT 0 COMMENT '执行版本',
+	`status` varchar(20) NOT NULL DEFAULT '' COMMENT '状态 running/succeeded/failed',
+	`attempts` int NOT NULL DEFAULT 0 COMMENT '尝试次数',
+	`row_count` bigint NOT NULL DEFAULT 0 COMMENT '结果行数',
+	`error_msg` text COMMENT '最后一次失败原因',
+	`scheduled_at` timestamp NOT NULL COMMENT '计划触发时间',
+	`finished_at` timestamp NULL DEFAULT NULL COMMENT '结束时间',
+	PRIMARY KEY (`id`),
+	KEY `idx_schedule_id` (`schedule_id`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='定时投递执行记录表';
+
+-- 订阅访问控制表
+CREATE TABLE IF NOT EXISTS `sub_subscription_acl` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`subject_type` varchar(20) NOT NULL COMMENT '授权对象类型 user/role/client',
+	`subject` varchar(120) NOT NULL COMMENT '授权对象',
+	`permission` varchar(20) NOT NULL COMMENT '权限 view/execute/edit/admin',
+	`created_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '创建人ID',
+	PRIMARY KEY (`id`),
+	KEY `idx_type_subkey` (`type`, `sub_key`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='订阅访问控制表';
+
+-- API Key表
+CREATE TABLE IF NOT EXISTS `sub_api_key` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`name` varchar(120) NOT NULL DEFAULT '' COMMENT '名称',
+	`client_id` varchar(120) NOT NULL COMMENT '调用方标识',
+	`prefix` varchar(20) NOT NULL COMMENT '密钥前缀',
+	`key_hash` varchar(64) NOT NULL COMMENT '密钥SHA-256摘要',
+	`roles` json DEFAULT NULL COMMENT '角色',
+	`sub_keys` json DEFAULT NULL COMMENT '允许访问的订阅key',
+	`data_sources` json DEFAULT NULL COMMENT '允许使用的数据源',
+	`rate_limit` int NOT NULL DEFAULT 0 COMMENT '每分钟请求上限',
+	`expires_at` timestamp NULL DEFAULT NULL COMMENT '过期时间',
+	`revoked_at` timestamp NULL DEFAULT NULL COMMENT '吊销时间',
+	`last_used_at` timestamp NULL DEFAULT NULL COMMENT '最近使用时间',
+	`created_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '创建人ID',
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `uk_key_hash` (`key_hash`),
+	KEY `idx_client_id` (`client_id`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='API Key表';
+
+CREATE TABLE IF NOT EXISTS `sub_subscription_revision` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`subscription_id` bigint unsigned NOT NULL DEFAULT 0 COMMENT '订阅ID',
+	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`version` int unsigned NOT NULL DEFAULT 1 COMMENT '版本号',
+	`revision` int unsigned NOT NULL DEFAULT 1 COMMENT '修订号',
+	`action` varchar(20) NOT NULL DEFAULT '' COMMENT '变更类型',
+	`title` varchar(240) NOT NULL COMMENT '标题',
+	`abstract` tinytext NOT NULL COMMENT '摘要',
+	`status` char(1) NOT NULL DEFAULT '' COMMENT '状态',
+	`extra_config` json NOT NULL COMMENT '扩展配置',
+	`changed_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '操作人ID',
+	`changed_by_name` varchar(120) NOT NULL DEFAULT '' COMMENT '操作人',
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `uk_version_revision` (`type`, `sub_key`, `version`, `revision`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='订阅修订表';
+
+CREATE TABLE IF NOT EXISTS `sub_subscription_review` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`type` char(1) NOT NULL DEFAULT '' COMMENT '订阅类型',
+	`sub_key` varchar(120) NOT NULL DEFAULT '' COMMENT '订阅key',
+	`version` int unsigned NOT NULL DEFAULT 1 COMMENT '版本号',
+	`content_hash` varchar(64) NOT NULL DEFAULT '' COMMENT '提交时extra_config摘要',
+	`status` varchar(20) NOT NULL DEFAULT '' COMMENT '审核状态 pending/approved/rejected/superseded',
+	`comment` text COMMENT '提交说明',
+	`submitted_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '提交人ID',
+	`submitted_by_name` varchar(120) NOT NULL DEFAULT '' COMMENT '提交人',
+	`review_comment` text COMMENT '审核意见',
+	`reviewed_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '审核人ID',
+	`reviewed_by_name` varchar(120) NOT NULL DEFAULT '' COMMENT '审核人',
+	`reviewed_at` timestamp NULL DEFAULT NULL COMMENT '审核时间',
+	PRIMARY KEY (`id`),
+	KEY `idx_version` (`type`, `sub_key`, `version`),
+	KEY `idx_status` (`status`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='订阅审核表';
+
+CREATE TABLE IF NOT EXISTS `sub_data_source` (
+	`id` bigint unsigned NOT NULL COMMENT '主键ID',
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+	`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP on update CURRENT_TIMESTAMP COMMENT '更新时间',
+	`name` varchar(120) NOT NULL COMMENT '数据源名称',
+	`driver` varchar(20) NOT NULL DEFAULT 'mysql' COMMENT '驱动：mysql/postgres/clickhouse/sqlite',
+	`host` varchar(255) NOT NULL DEFAULT '' COMMENT '主机',
+	`port` int NOT NULL DEFAULT 0 COMMENT '端口',
+	`database` varchar(255) NOT NULL DEFAULT '' COMMENT '库名，SQLite 为文件路径',
+	`username` varchar(120) NOT NULL DEFAULT '' COMMENT '用户名',
+	`password_encrypted` text COMMENT '加密后的密码',
+	`max_idle_conns` int NOT NULL DEFAULT 0 COMMENT '最大空闲连接数',
+	`max_open_conns` int NOT NULL DEFAULT 0 COMMENT '最大连接数',
+	`conn_max_lifetime` int NOT NULL DEFAULT 0 COMMENT '连接最长存活秒数',
+	`allowed_tables` json DEFAULT NULL COMMENT '允许访问的表',
+	`denied_tables` json DEFAULT NULL COMMENT '禁止访问的表',
+	`guardrails` json DEFAULT NULL COMMENT '查询成本护栏',
+	`replicas` json DEFAULT NULL COMMENT '熔断或不可用时切换的备用数据源',
+	`status` varchar(20) NOT NULL DEFAULT 'enabled' COMMENT '状态 enabled/disabled',
+	`created_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '创建人ID',
+	`updated_by` bigint unsigned NOT NULL DEFAULT 0 COMMENT '修改人ID',
+	PRIMARY KEY (`id`),
+	UNIQUE KEY `uk_name` (`name`)
+) DEFAULT CHARACTER SET=utf8mb4 COMMENT='数据源登记表';
+
 -- 插入测试数据
 INSERT INTO `sub_refs` (`id`, `ref_field`, `ref_value`, `ref_name`, `ref_name_en`, `sort`)
 VALUES
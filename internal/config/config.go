@@ -14,42 +14,88 @@ type Config struct {
 	Redis     RedisConfig     `mapstructure:"redis"`
 	WebUI     WebUIConfig     `mapstructure:"web_ui"`
 	Snowflake SnowflakeConfig `mapstructure:"snowflake"`
+	Jobs      JobConfig       `mapstructure:"jobs"`
+	Scheduler SchedulerConfig `mapstructure:"scheduler"`
+	Execution ExecutionConfig `mapstructure:"execution"`
+	GitOps    GitOpsConfig    `mapstructure:"gitops"`
 }
 
 type ServerConfig struct {
+	Mode      string        `mapstructure:"mode"` // development（默认）或 production，production 下拒绝示例密钥和默认密码
 	Port      int           `mapstructure:"port"`
 	Timeout   time.Duration `mapstructure:"timeout"`
 	RateLimit int           `mapstructure:"rate_limit"`
 }
 
 type DatabaseConfig struct {
-	Primary     DBConfig            `mapstructure:"primary"`
-	DataSources map[string]DBConfig `mapstructure:"data_sources"`
+	Primary         DBConfig            `mapstructure:"primary"`
+	DataSources     map[string]DBConfig `mapstructure:"data_sources"`
+	RegistryRefresh time.Duration       `mapstructure:"registry_refresh"` // 重新加载库中数据源定义的间隔，默认30s
+	Health          HealthConfig        `mapstructure:"health"`
+}
+
+// HealthConfig 数据源健康检查和熔断配置，未配置的项使用默认值
+type HealthConfig struct {
+	CheckInterval    time.Duration `mapstructure:"check_interval"`    // 定期 ping 的间隔，默认15s
+	PingTimeout      time.Duration `mapstructure:"ping_timeout"`      // 单次 ping 超时，默认3s
+	FailureThreshold int           `mapstructure:"failure_threshold"` // 连续失败多少次后熔断，默认3
+	OpenDuration     time.Duration `mapstructure:"open_duration"`     // 熔断后多久放行一次探测，默认30s
+	SlowThreshold    time.Duration `mapstructure:"slow_threshold"`    // 查询首行返回超过该时长计为失败，0表示不按延迟判断
 }
 
 type DBConfig struct {
-	Host            string        `mapstructure:"host"`
-	Port            int           `mapstructure:"port"`
-	Database        string        `mapstructure:"database"`
-	Username        string        `mapstructure:"username"`
-	Password        string        `mapstructure:"password"`
-	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
-	MaxOpenConns    int           `mapstructure:"max_open_conns"`
-	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	Driver          string          `mapstructure:"driver"` // mysql（默认）、postgres、clickhouse、sqlite
+	Host            string          `mapstructure:"host"`
+	Port            int             `mapstructure:"port"`
+	Database        string          `mapstructure:"database"`
+	Username        string          `mapstructure:"username"`
+	Password        string          `mapstructure:"password"`
+	MaxIdleConns    int             `mapstructure:"max_idle_conns"`
+	MaxOpenConns    int             `mapstructure:"max_open_conns"`
+	ConnMaxLifetime time.Duration   `mapstructure:"conn_max_lifetime"`
+	AllowedTables   []string        `mapstructure:"allowed_tables"` // 订阅SQL可访问的表，支持 schema.table 和通配符
+	DeniedTables    []string        `mapstructure:"denied_tables"`  // 订阅SQL禁止访问的表
+	Guardrails      GuardrailConfig `mapstructure:"guardrails"`     // 查询成本护栏，仅 MySQL 数据源生效
+	Replicas        []string        `mapstructure:"replicas"`       // 熔断或不可用时按顺序切换的备用数据源
+}
+
+// GuardrailConfig 按 EXPLAIN 估算结果拦截高成本查询，零值表示不限制
+type GuardrailConfig struct {
+	MaxEstimatedRows int64    `mapstructure:"max_estimated_rows"`  // 估算扫描行数上限
+	NoFullScanTables []string `mapstructure:"no_full_scan_tables"` // 禁止全表扫描的表，支持 schema.table 和通配符
 }
 
 type SecurityConfig struct {
-	JWTSecret       string   `mapstructure:"jwt_secret"`
-	AllowedSQLTypes []string `mapstructure:"allowed_sql_types"`
+	JWTSecret              string    `mapstructure:"jwt_secret"`
+	JWT                    JWTConfig `mapstructure:"jwt"`
+	AllowedSQLTypes        []string  `mapstructure:"allowed_sql_types"`
+	DeniedSQLFunctions     []string  `mapstructure:"denied_sql_functions"`      // 在内置禁用函数之外额外禁用的函数
+	AdminRoles             []string  `mapstructure:"admin_roles"`               // 拥有这些角色的用户跳过订阅ACL，默认 admin
+	ACLDefaultPermission   string    `mapstructure:"acl_default_permission"`    // 未配置ACL的订阅对所有已认证调用方开放的权限，默认不开放
+	RequireReview          bool      `mapstructure:"require_review"`            // 版本激活前必须经他人审核通过
+	AllowPrimaryDataSource bool      `mapstructure:"allow_primary_data_source"` // 是否允许订阅在服务自身的元数据库 primary 上执行，默认不允许
+	DataSourceKey          string    `mapstructure:"data_source_key"`           // 加密数据源密码的密钥，base64 编码的32字节
+}
+
+// JWTConfig JWT校验配置，未配置JWKS时使用 jwt_secret 校验HMAC签名
+type JWTConfig struct {
+	Algorithms     []string      `mapstructure:"algorithms"`      // 允许的签名算法，默认 HS256，配置JWKS时默认 RS256/ES256
+	Issuer         string        `mapstructure:"issuer"`          // 期望的 iss，为空不校验
+	Audience       string        `mapstructure:"audience"`        // 期望的 aud，为空不校验
+	ClockSkew      time.Duration `mapstructure:"clock_skew"`      // 时钟偏差容忍，默认 30s
+	RequiredClaims []string      `mapstructure:"required_claims"` // 必须存在的声明，默认 exp
+	JWKSFile       string        `mapstructure:"jwks_file"`       // JWKS文件，与 jwks_url 二选一
+	JWKSURL        string        `mapstructure:"jwks_url"`        // JWKS地址
+	JWKSRefresh    time.Duration `mapstructure:"jwks_refresh"`    // JWKS刷新间隔，默认 5m
 }
 
 type LoggingConfig struct {
-	Level          string `mapstructure:"level"`
-	Format         string `mapstructure:"format"`
-	FileLogEnabled bool   `mapstructure:"file_log_enabled"`
-	FileLogDir     string `mapstructure:"file_log_dir"`
-	LogRequestBody bool   `mapstructure:"log_request_body"`
-	LogResponseBody bool  `mapstructure:"log_response_body"`
+	Level           string `mapstructure:"level"`
+	Format          string `mapstructure:"format"`
+	FileLogEnabled  bool   `mapstructure:"file_log_enabled"`
+	FileLogDir      string `mapstructure:"file_log_dir"`
+	LogRequestBody  bool   `mapstructure:"log_request_body"`
+	LogResponseBody bool   `mapstructure:"log_response_body"`
 }
 
 type RedisConfig struct {
@@ -68,59 +114,139 @@ type SnowflakeConfig struct {
 	NodeID int64 `mapstructure:"node_id"`
 }
 
+// JobConfig 异步执行任务配置，未配置的项使用默认值
+type JobConfig struct {
+	Workers       int           `mapstructure:"workers"`         // 并发执行的任务数，默认4
+	QueueSize     int           `mapstructure:"queue_size"`      // 排队任务上限，默认100
+	Timeout       time.Duration `mapstructure:"timeout"`         // 单个任务默认超时，默认30m
+	ResultTTL     time.Duration `mapstructure:"result_ttl"`      // 结果在Redis中的保留时间，默认24h
+	MaxResultRows int64         `mapstructure:"max_result_rows"` // 单个任务最多保存的结果行数，默认100000
+	Instance      string        `mapstructure:"instance"`        // 实例标识，重启后回收该实例遗留的任务，默认主机名
+}
+
+// ExecutionConfig 同步执行（JSON 响应）的结果限制，未配置的项使用默认值
+type ExecutionConfig struct {
+	MaxRows          int   `mapstructure:"max_rows"`           // 单次响应最多行数，默认10000
+	MaxResponseBytes int64 `mapstructure:"max_response_bytes"` // 单次响应结果的最大字节数，默认16MB
+	MaxPageSize      int   `mapstructure:"max_page_size"`      // 分页时每页最多行数，默认1000
+}
+
+// GitOpsConfig 按 git 中维护的定义目录声明式同步订阅
+type GitOpsConfig struct {
+	DefinitionsDir string `mapstructure:"definitions_dir"` // 订阅定义目录，同步接口和 sync 子命令默认读取；为空时同步接口不可用
+}
+
+// SchedulerConfig 定时投递配置，未配置的项使用默认值
+type SchedulerConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`       // 是否在本实例运行调度器，多实例时通过Redis选主
+	TickInterval time.Duration `mapstructure:"tick_interval"` // 检查到期计划的间隔，默认15s
+	MaxAttempts  int           `mapstructure:"max_attempts"`  // 每次触发最多尝试次数，默认3
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"` // 首次重试间隔，之后翻倍，默认30s
+	MaxRows      int64         `mapstructure:"max_rows"`      // 单次投递最多行数，默认100000
+	OutputDir    string        `mapstructure:"output_dir"`    // file 目标的输出目录
+	Webhook      WebhookConfig `mapstructure:"webhook"`
+	SMTP         SMTPConfig    `mapstructure:"smtp"`
+}
+
+type WebhookConfig struct {
+	Timeout      time.Duration `mapstructure:"timeout"`       // 默认30s
+	AllowedHosts []string      `mapstructure:"allowed_hosts"` // 允许投递的主机，支持 *.example.com；为空时不限主机，但拒绝内网、回环和链路本地地址
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+}
+
+// Load 从工作目录或 ./config 下的 config.yaml 加载配置并校验
 func Load() (*Config, error) {
-	viper.SetConfigName("config")
+	return LoadFile("")
+}
+
+// LoadFile 从指定文件加载配置并校验，path 为空时按默认位置查找
+func LoadFile(path string) (*Config, error) {
+	if path != "" {
+		viper.SetConfigFile(path)
+	} else {
+		viper.SetConfigName("config")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("./config")
+	}
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./config")
 
 	// 启用环境变量支持
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("") // 不使用前缀
-	
+
 	// 绑定环境变量到配置项
 	// 数据库配置
+	viper.BindEnv("database.primary.driver", "DB_DRIVER")
 	viper.BindEnv("database.primary.host", "DB_HOST")
 	viper.BindEnv("database.primary.port", "DB_PORT")
 	viper.BindEnv("database.primary.username", "DB_USER")
 	viper.BindEnv("database.primary.password", "DB_PASSWORD")
 	viper.BindEnv("database.primary.database", "DB_NAME")
-	
+
 	// 数据源配置
+	viper.BindEnv("database.data_sources.default.driver", "DATASOURCE_DEFAULT_DRIVER")
 	viper.BindEnv("database.data_sources.default.host", "DATASOURCE_DEFAULT_HOST")
 	viper.BindEnv("database.data_sources.default.port", "DATASOURCE_DEFAULT_PORT")
 	viper.BindEnv("database.data_sources.default.username", "DATASOURCE_DEFAULT_USER")
 	viper.BindEnv("database.data_sources.default.password", "DATASOURCE_DEFAULT_PASS")
 	viper.BindEnv("database.data_sources.default.database", "DATASOURCE_DEFAULT_NAME")
-	
+
 	viper.BindEnv("database.data_sources.dbcfg_adb_uhomes.host", "DATASOURCE_UHOMES_HOST")
 	viper.BindEnv("database.data_sources.dbcfg_adb_uhomes.port", "DATASOURCE_UHOMES_PORT")
 	viper.BindEnv("database.data_sources.dbcfg_adb_uhomes.username", "DATASOURCE_UHOMES_USER")
 	viper.BindEnv("database.data_sources.dbcfg_adb_uhomes.password", "DATASOURCE_UHOMES_PASS")
 	viper.BindEnv("database.data_sources.dbcfg_adb_uhomes.database", "DATASOURCE_UHOMES_NAME")
-	
+
 	// Redis 配置
 	viper.BindEnv("redis.host", "REDIS_HOST")
 	viper.BindEnv("redis.port", "REDIS_PORT")
 	viper.BindEnv("redis.password", "REDIS_PASSWORD")
 	viper.BindEnv("redis.db", "REDIS_DB")
-	
+
 	// JWT 配置
 	viper.BindEnv("security.jwt_secret", "JWT_SECRET")
-	
+	viper.BindEnv("security.data_source_key", "DATASOURCE_ENCRYPTION_KEY")
+
 	// 日志配置
 	viper.BindEnv("logging.level", "LOG_LEVEL")
-	
+
 	// Snowflake 配置
 	viper.BindEnv("snowflake.node_id", "SNOWFLAKE_NODE_ID")
-	
+
 	// 服务器配置
 	viper.BindEnv("server.port", "SERVER_PORT")
+	viper.BindEnv("server.mode", "APP_MODE")
+
+	// 声明式同步
+	viper.BindEnv("gitops.definitions_dir", "GITOPS_DEFINITIONS_DIR")
 
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	config, err := decode()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// decode 将 viper 中已读取的配置解析为新的 Config，存在未知配置项时返回错误
+func decode() (*Config, error) {
+	if err := checkKeys(viper.AllSettings()); err != nil {
+		return nil, err
+	}
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, err
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue 替换密钥和密码的占位值
+const redactedValue = "******"
+
+// Redacted 返回隐去密钥和密码的副本，用于打印生效的配置
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Database.Primary.Password = redact(out.Database.Primary.Password)
+	if len(c.Database.DataSources) > 0 {
+		out.Database.DataSources = make(map[string]DBConfig, len(c.Database.DataSources))
+		for name, ds := range c.Database.DataSources {
+			ds.Password = redact(ds.Password)
+			out.Database.DataSources[name] = ds
+		}
+	}
+	out.Security.JWTSecret = redact(out.Security.JWTSecret)
+	out.Security.DataSourceKey = redact(out.Security.DataSourceKey)
+	out.Redis.Password = redact(out.Redis.Password)
+	out.WebUI.Password = redact(out.WebUI.Password)
+	out.Scheduler.SMTP.Password = redact(out.Scheduler.SMTP.Password)
+	return &out
+}
+
+// redact 未配置的值保持为空，便于看出缺失项
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// YAML 按配置文件的键名和字段顺序输出配置
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(toNode(reflect.ValueOf(*c))); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toNode(v reflect.Value) *yaml.Node {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: d.String()}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			tag := v.Type().Field(i).Tag.Get("mapstructure")
+			if tag == "" {
+				continue
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: tag}, toNode(v.Field(i)))
+		}
+		return node
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, toNode(v.MapIndex(reflect.ValueOf(key))))
+		}
+		return node
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, toNode(v.Index(i)))
+		}
+		return node
+	case reflect.String:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}
+	case reflect.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatBool(v.Bool())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatInt(v.Int(), 10)}
+	default:
+		node := &yaml.Node{}
+		node.Encode(v.Interface())
+		return node
+	}
+}
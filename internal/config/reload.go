@@ -0,0 +1,184 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// 重新加载的触发方式
+const (
+	ReloadTriggerFile   = "file"
+	ReloadTriggerSignal = "signal"
+)
+
+// reloadDebounce 合并编辑器保存文件时产生的连续事件
+const reloadDebounce = 500 * time.Millisecond
+
+// Reloader 监听配置文件变化和 SIGHUP，新配置校验通过后原子替换并通知订阅方
+// 订阅方各自原子地应用新值，执行中的请求继续使用开始时读取的配置
+type Reloader struct {
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex // 串行执行重新加载，viper 不是并发安全的
+	subscribers []func(*Config)
+	read        func() (*Config, error) // 读取并解析配置文件，测试时替换
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewReloader(cfg *Config) *Reloader {
+	r := &Reloader{read: readConfig}
+	r.current.Store(cfg)
+	return r
+}
+
+func readConfig() (*Config, error) {
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return decode()
+}
+
+// Current 当前生效的配置，返回的配置不会再被修改
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// OnReload 注册新配置生效后的回调，回调按注册顺序同步执行
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Start 开始监听配置文件所在目录和 SIGHUP
+func (r *Reloader) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听目录而不是文件，编辑器和 ConfigMap 通过替换文件保存时也能收到事件
+	file := viper.ConfigFileUsed()
+	if file != "" {
+		if err := watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go r.loop(watcher, signals, file)
+	return nil
+}
+
+// Stop 停止监听
+func (r *Reloader) Stop(ctx context.Context) error {
+	if r.stop != nil {
+		close(r.stop)
+		r.wg.Wait()
+	}
+	return nil
+}
+
+func (r *Reloader) loop(watcher *fsnotify.Watcher, signals chan os.Signal, file string) {
+	defer r.wg.Done()
+	defer watcher.Close()
+	defer signal.Stop(signals)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-signals:
+			r.Reload(ReloadTriggerSignal)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(file) && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(reloadDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			r.Reload(ReloadTriggerFile)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Config watcher error", "error", err)
+		}
+	}
+}
+
+// Reload 重新读取配置文件，校验失败时保留当前配置
+func (r *Reloader) Reload(trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.read()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		slog.Error("Config reload rejected, keeping current config", "trigger", trigger, "error", err)
+		metrics.RecordConfigReload("go-bisub", trigger, err)
+		return fmt.Errorf("config reload rejected: %w", err)
+	}
+
+	previous := r.current.Swap(next)
+	if fields := restartRequired(previous, next); len(fields) > 0 {
+		slog.Warn("Config changes require restart to take effect", "fields", fields)
+	}
+	for _, fn := range r.subscribers {
+		fn(next)
+	}
+
+	slog.Info("Config reloaded", "trigger", trigger,
+		"rate_limit", next.Server.RateLimit, "allowed_sql_types", next.Security.AllowedSQLTypes, "log_level", next.Logging.Level)
+	metrics.RecordConfigReload("go-bisub", trigger, nil)
+	return nil
+}
+
+// restartRequired 返回变化了但只在启动时生效的配置项
+func restartRequired(previous, next *Config) []string {
+	var fields []string
+	check := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			fields = append(fields, name)
+		}
+	}
+	check("server.port", previous.Server.Port, next.Server.Port)
+	check("server.timeout", previous.Server.Timeout, next.Server.Timeout)
+	check("database.primary", previous.Database.Primary, next.Database.Primary)
+	check("redis", previous.Redis, next.Redis)
+	check("snowflake", previous.Snowflake, next.Snowflake)
+	check("jobs", previous.Jobs, next.Jobs)
+	check("scheduler", previous.Scheduler, next.Scheduler)
+	check("logging.file_log_enabled", previous.Logging.FileLogEnabled, next.Logging.FileLogEnabled)
+
+	// SQL策略之外的安全配置（JWT、ACL、审核等）在启动时读取
+	prevSecurity, nextSecurity := previous.Security, next.Security
+	prevSecurity.AllowedSQLTypes, prevSecurity.DeniedSQLFunctions = nil, nil
+	nextSecurity.AllowedSQLTypes, nextSecurity.DeniedSQLFunctions = nil, nil
+	check("security", prevSecurity, nextSecurity)
+	return fields
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloaderReload(t *testing.T) {
+	current := validConfig()
+	r := NewReloader(current)
+
+	var applied []*Config
+	r.OnReload(func(cfg *Config) { applied = append(applied, cfg) })
+
+	// 校验失败时保留当前配置，不通知订阅方
+	invalid := validConfig()
+	invalid.Logging.Level = "verbose"
+	r.read = func() (*Config, error) { return invalid, nil }
+	assert.Error(t, r.Reload(ReloadTriggerSignal))
+	assert.Same(t, current, r.Current())
+	assert.Empty(t, applied)
+
+	r.read = func() (*Config, error) { return nil, errors.New("yaml: line 3: did not find expected key") }
+	assert.Error(t, r.Reload(ReloadTriggerFile))
+	assert.Same(t, current, r.Current())
+
+	next := validConfig()
+	next.Server.RateLimit = 10
+	r.read = func() (*Config, error) { return next, nil }
+	require.NoError(t, r.Reload(ReloadTriggerFile))
+	assert.Same(t, next, r.Current())
+	assert.Equal(t, []*Config{next}, applied)
+}
+
+func TestRestartRequired(t *testing.T) {
+	previous := validConfig()
+	next := validConfig()
+	next.Server.RateLimit = 10
+	next.Security.AllowedSQLTypes = []string{"SELECT", "WITH"}
+	assert.Empty(t, restartRequired(previous, next))
+
+	next.Server.Port = 9090
+	next.Security.RequireReview = true
+	assert.Equal(t, []string{"server.port", "security"}, restartRequired(previous, next))
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/secret"
+)
+
+// 运行模式，production 下拒绝示例密钥和默认密码
+const (
+	ModeDevelopment = "development"
+	ModeProduction  = "production"
+)
+
+// FieldError 某个配置项的校验错误，Path 为 YAML 路径
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError 配置校验发现的全部问题
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		lines[i] = f.Error()
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// validator 收集校验错误
+type validator struct {
+	fields []FieldError
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.fields = append(v.fields, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+func (v *validator) required(path, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(path, "is required")
+	}
+}
+
+func (v *validator) port(path string, port int) {
+	if port < 1 || port > 65535 {
+		v.add(path, "must be between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) nonNegative(path string, value int64) {
+	if value < 0 {
+		v.add(path, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validator) duration(path string, value time.Duration) {
+	if value < 0 {
+		v.add(path, "must not be negative, got %s", value)
+	}
+}
+
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// drivers 支持的数据源驱动及别名，与 dialect 包一致（dialect 依赖本包，不能反向引用）
+var drivers = map[string]bool{"": true, "mysql": true, "postgres": true, "postgresql": true, "clickhouse": true, "sqlite": true, "sqlite3": true}
+
+// sampleSecrets 示例配置和文档中的 JWT 密钥，生产模式下不允许使用
+var sampleSecrets = []string{"your-secret-key-change-in-production", "your-jwt-secret", "your-secret-key", "secret"}
+
+// minProductionSecretLength 生产模式下 HMAC 密钥的最小长度
+const minProductionSecretLength = 32
+
+// Validate 校验配置的必填项、取值范围和生产模式下的不安全默认值，启动和重新加载时执行
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("server.mode", c.Server.Mode, "", ModeDevelopment, ModeProduction)
+	v.port("server.port", c.Server.Port)
+	v.duration("server.timeout", c.Server.Timeout)
+	v.nonNegative("server.rate_limit", int64(c.Server.RateLimit))
+
+	v.dbConfig("database.primary", c.Database.Primary)
+	names := make([]string, 0, len(c.Database.DataSources))
+	for name := range c.Database.DataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := "database.data_sources." + name
+		ds := c.Database.DataSources[name]
+		v.dbConfig(path, ds)
+		for i, replica := range ds.Replicas {
+			if replica == name {
+				v.add(fmt.Sprintf("%s.replicas[%d]", path, i), "must not reference the data source itself")
+			}
+		}
+	}
+	v.duration("database.registry_refresh", c.Database.RegistryRefresh)
+	v.duration("database.health.check_interval", c.Database.Health.CheckInterval)
+	v.duration("database.health.ping_timeout", c.Database.Health.PingTimeout)
+	v.nonNegative("database.health.failure_threshold", int64(c.Database.Health.FailureThreshold))
+	v.duration("database.health.open_duration", c.Database.Health.OpenDuration)
+	v.duration("database.health.slow_threshold", c.Database.Health.SlowThreshold)
+
+	jwks := c.Security.JWT.JWKSFile != "" || c.Security.JWT.JWKSURL != ""
+	if !jwks {
+		v.required("security.jwt_secret", c.Security.JWTSecret)
+	}
+	if c.Security.JWT.JWKSFile != "" && c.Security.JWT.JWKSURL != "" {
+		v.add("security.jwt.jwks_file", "must not be set together with security.jwt.jwks_url")
+	}
+	v.duration("security.jwt.clock_skew", c.Security.JWT.ClockSkew)
+	v.duration("security.jwt.jwks_refresh", c.Security.JWT.JWKSRefresh)
+	if len(c.Security.AllowedSQLTypes) == 0 {
+		v.add("security.allowed_sql_types", "must not be empty")
+	}
+	v.oneOf("security.acl_default_permission", c.Security.ACLDefaultPermission, "", "view", "execute", "edit", "admin")
+	if _, err := secret.NewCipher(c.Security.DataSourceKey); err != nil {
+		v.add("security.data_source_key", "%v", err)
+	}
+
+	v.oneOf("logging.level", strings.ToLower(c.Logging.Level), "", "debug", "info", "warn", "error")
+
+	v.required("redis.host", c.Redis.Host)
+	v.port("redis.port", c.Redis.Port)
+	v.nonNegative("redis.db", int64(c.Redis.DB))
+
+	if c.Snowflake.NodeID < 0 || c.Snowflake.NodeID > 1023 {
+		v.add("snowflake.node_id", "must be between 0 and 1023, got %d", c.Snowflake.NodeID)
+	}
+
+	v.nonNegative("jobs.workers", int64(c.Jobs.Workers))
+	v.nonNegative("jobs.queue_size", int64(c.Jobs.QueueSize))
+	v.duration("jobs.timeout", c.Jobs.Timeout)
+	v.duration("jobs.result_ttl", c.Jobs.ResultTTL)
+	v.nonNegative("jobs.max_result_rows", c.Jobs.MaxResultRows)
+
+	v.duration("scheduler.tick_interval", c.Scheduler.TickInterval)
+	v.nonNegative("scheduler.max_attempts", int64(c.Scheduler.MaxAttempts))
+	v.duration("scheduler.retry_backoff", c.Scheduler.RetryBackoff)
+	v.nonNegative("scheduler.max_rows", c.Scheduler.MaxRows)
+	v.duration("scheduler.webhook.timeout", c.Scheduler.Webhook.Timeout)
+	if c.Scheduler.SMTP.Host != "" {
+		v.port("scheduler.smtp.port", c.Scheduler.SMTP.Port)
+		v.required("scheduler.smtp.from", c.Scheduler.SMTP.From)
+	}
+
+	v.nonNegative("execution.max_rows", int64(c.Execution.MaxRows))
+	v.nonNegative("execution.max_response_bytes", c.Execution.MaxResponseBytes)
+	v.nonNegative("execution.max_page_size", int64(c.Execution.MaxPageSize))
+
+	if c.Server.Mode == ModeProduction {
+		v.production(c, jwks)
+	}
+
+	return v.err()
+}
+
+// dbConfig 校验数据库连接配置，SQLite 的 database 为文件路径，不需要主机和端口
+func (v *validator) dbConfig(path string, db DBConfig) {
+	driver := strings.ToLower(strings.TrimSpace(db.Driver))
+	if !drivers[driver] {
+		v.add(path+".driver", "unsupported driver %q, must be one of mysql, postgres, clickhouse, sqlite", db.Driver)
+	}
+	if driver != "sqlite" && driver != "sqlite3" {
+		v.required(path+".host", db.Host)
+		v.port(path+".port", db.Port)
+	}
+	v.required(path+".database", db.Database)
+	v.nonNegative(path+".max_idle_conns", int64(db.MaxIdleConns))
+	v.nonNegative(path+".max_open_conns", int64(db.MaxOpenConns))
+	v.duration(path+".conn_max_lifetime", db.ConnMaxLifetime)
+	v.nonNegative(path+".guardrails.max_estimated_rows", db.Guardrails.MaxEstimatedRows)
+	// 护栏依赖 MySQL 的 EXPLAIN FORMAT=JSON
+	if (db.Guardrails.MaxEstimatedRows > 0 || len(db.Guardrails.NoFullScanTables) > 0) && driver != "" && driver != "mysql" {
+		v.add(path+".guardrails", "only supported on mysql data sources, got driver %q", db.Driver)
+	}
+}
+
+// production 生产模式下拒绝示例密钥、弱密钥和默认管理界面密码
+func (v *validator) production(c *Config, jwks bool) {
+	if !jwks && c.Security.JWTSecret != "" {
+		for _, sample := range sampleSecrets {
+			if c.Security.JWTSecret == sample {
+				v.add("security.jwt_secret", "must not use the sample secret in production mode")
+				break
+			}
+		}
+		if len(c.Security.JWTSecret) < minProductionSecretLength {
+			v.add("security.jwt_secret", "must be at least %d characters in production mode", minProductionSecretLength)
+		}
+	}
+	if c.WebUI.Password == "" || c.WebUI.Password == "admin123" {
+		v.add("web_ui.password", "must be changed from the default in production mode")
+	}
+}
+
+// checkKeys 检查配置文件中不对应任何配置项的键，通常是拼写错误或已不支持的配置
+func checkKeys(settings map[string]interface{}) error {
+	v := &validator{}
+	unknownKeys(v, settings, reflect.TypeOf(Config{}), "")
+	return v.err()
+}
+
+func unknownKeys(v *validator, settings map[string]interface{}, t reflect.Type, prefix string) {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" {
+			fields[tag] = t.Field(i).Type
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := prefix + key
+		fieldType, ok := fields[key]
+		if !ok {
+			v.add(path, "unknown config key")
+			continue
+		}
+		nested, ok := settings[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case fieldType.Kind() == reflect.Struct && fieldType != reflect.TypeOf(time.Duration(0)):
+			unknownKeys(v, nested, fieldType, path+".")
+		case fieldType.Kind() == reflect.Map && fieldType.Elem().Kind() == reflect.Struct:
+			names := make([]string, 0, len(nested))
+			for name := range nested {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if entry, ok := nested[name].(map[string]interface{}); ok {
+					unknownKeys(v, entry, fieldType.Elem(), path+"."+name+".")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() *Config {
+	cfg := &Config{}
+	cfg.Server.Port = 8080
+	cfg.Server.RateLimit = 100
+	cfg.Database.Primary = DBConfig{Host: "127.0.0.1", Port: 3306, Database: "go_sub"}
+	cfg.Security.JWTSecret = "your-jwt-secret"
+	cfg.Security.AllowedSQLTypes = []string{"SELECT"}
+	cfg.Logging.Level = "info"
+	cfg.Redis = RedisConfig{Host: "127.0.0.1", Port: 6379}
+	return cfg
+}
+
+// fieldPaths 校验错误涉及的配置路径
+func fieldPaths(t *testing.T, err error) []string {
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr), "expected ValidationError, got %v", err)
+	paths := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, validConfig().Validate())
+
+	cfg := validConfig()
+	cfg.Server.RateLimit = -1
+	cfg.Database.Primary.Port = 0
+	cfg.Database.DataSources = map[string]DBConfig{
+		"bi":       {Driver: "oracle", Host: "db", Port: 1521, Database: "bi", MaxOpenConns: -1},
+		"fixtures": {Driver: "sqlite", Database: "./fixtures.db", Guardrails: GuardrailConfig{MaxEstimatedRows: 1000}},
+	}
+	cfg.Security.JWTSecret = ""
+	cfg.Security.AllowedSQLTypes = nil
+	cfg.Security.DataSourceKey = "short"
+	cfg.Logging.Level = "verbose"
+	err := cfg.Validate()
+	assert.Equal(t, []string{
+		"server.rate_limit",
+		"database.primary.port",
+		"database.data_sources.bi.driver",
+		"database.data_sources.bi.max_open_conns",
+		"database.data_sources.fixtures.guardrails",
+		"security.jwt_secret",
+		"security.allowed_sql_types",
+		"security.data_source_key",
+		"logging.level",
+	}, fieldPaths(t, err))
+	assert.Contains(t, err.Error(), "database.primary.port: must be between 1 and 65535, got 0")
+
+	// 配置 JWKS 时不需要 jwt_secret
+	cfg = validConfig()
+	cfg.Security.JWTSecret = ""
+	cfg.Security.JWT.JWKSURL = "http://sso.internal/.well-known/jwks.json"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateProduction(t *testing.T) {
+	cfg := validConfig()
+	cfg.WebUI.Password = "admin123"
+	require.NoError(t, cfg.Validate())
+
+	cfg.Server.Mode = ModeProduction
+	assert.Equal(t, []string{"security.jwt_secret", "security.jwt_secret", "web_ui.password"}, fieldPaths(t, cfg.Validate()))
+
+	cfg.Security.JWTSecret = strings.Repeat("k", minProductionSecretLength)
+	cfg.WebUI.Password = "s3cure-ui-password"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestDecodeUnknownKeys(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+server:
+  host: 0.0.0.0
+  port: 8080
+database:
+  data_sources:
+    default:
+      host: db
+      max_open_conn: 10
+      guardrails:
+        max_rows: 1
+logging:
+  output: stdout
+`)))
+
+	_, err := decode()
+	assert.Equal(t, []string{
+		"database.data_sources.default.guardrails.max_rows",
+		"database.data_sources.default.max_open_conn",
+		"logging.output",
+		"server.host",
+	}, fieldPaths(t, err))
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	cfg.Database.Primary.Password = "primary-pass"
+	cfg.Database.DataSources = map[string]DBConfig{"bi": {Password: "bi-pass"}, "fixtures": {}}
+	cfg.Security.DataSourceKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	cfg.Redis.Password = "redis-pass"
+
+	out, err := cfg.Redacted().YAML()
+	require.NoError(t, err)
+	for _, secret := range []string{"primary-pass", "bi-pass", "your-jwt-secret", cfg.Security.DataSourceKey, "redis-pass"} {
+		assert.NotContains(t, string(out), secret)
+	}
+	assert.Contains(t, string(out), "jwt_secret: '******'")
+	// 原配置不受影响，未配置的密码保持为空
+	assert.Equal(t, "bi-pass", cfg.Database.DataSources["bi"].Password)
+	assert.Equal(t, "", cfg.Redacted().Database.DataSources["fixtures"].Password)
+}
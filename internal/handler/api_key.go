@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	service    *service.APIKeyService
+	logService *service.OperationLogService
+}
+
+func NewAPIKeyHandler(service *service.APIKeyService, logService *service.OperationLogService) *APIKeyHandler {
+	return &APIKeyHandler{
+		service:    service,
+		logService: logService,
+	}
+}
+
+// ListAPIKeys 获取API Key列表，可按 client_id 过滤
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.service.ListKeys(c.Request.Context(), c.Query("client_id"))
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      keys,
+	})
+}
+
+// CreateAPIKey 签发API Key，明文只在响应中返回一次
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	issued, err := h.service.CreateKey(c.Request.Context(), &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeCreate, "api_key", req.ClientID, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	// 日志中只记录密钥元数据，不记录明文
+	logOperation(c, h.logService, models.OpTypeCreate, "api_key", strconv.FormatUint(issued.ID, 10), models.OpStatusSuccess, time.Since(startTime), "", req, issued.APIKey)
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Code:      "OK",
+		Message:   "API Key创建成功，请妥善保存，密钥不会再次显示",
+		RequestID: getRequestID(c),
+		Data:      issued,
+	})
+}
+
+// RotateAPIKey 轮换API Key，旧密钥立即失效
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	startTime := time.Now()
+	id, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	issued, err := h.service.RotateKey(c.Request.Context(), id)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "api_key", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), nil, nil)
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "api_key", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", nil, issued.APIKey)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "API Key已轮换，请妥善保存，密钥不会再次显示",
+		RequestID: getRequestID(c),
+		Data:      issued,
+	})
+}
+
+// RevokeAPIKey 吊销API Key
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	startTime := time.Now()
+	id, ok := parseAPIKeyID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.service.RevokeKey(c.Request.Context(), id)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeDelete, "api_key", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), nil, nil)
+		respondAPIKeyError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeDelete, "api_key", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", nil, key)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "API Key已吊销",
+		RequestID: getRequestID(c),
+		Data:      key,
+	})
+}
+
+func parseAPIKeyID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "invalid api key id",
+			RequestID: getRequestID(c),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondAPIKeyError(c *gin.Context, err error) {
+	if respondAccessDenied(c, err) {
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, service.ErrInvalidExpiry):
+		status, code = http.StatusBadRequest, "INVALID_PARAMETER"
+	}
+
+	c.JSON(status, APIResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: getRequestID(c),
+	})
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/bundle"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBundleBytes 导入包大小上限
+const maxBundleBytes = 32 << 20
+
+// ExportSubscriptions 导出订阅key的全部版本，keys 可重复或以逗号分隔，format 为 json（默认）或 tar
+func (h *SubscriptionHandler) ExportSubscriptions(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A")
+	encoding := c.DefaultQuery("format", bundle.EncodingJSON)
+	var keys []string
+	for _, value := range c.QueryArray("keys") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if encoding != bundle.EncodingJSON && encoding != bundle.EncodingTar {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "format must be json or tar",
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	b, err := h.service.ExportBundle(c.Request.Context(), subType, keys)
+	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		switch {
+		case errors.Is(err, bundle.ErrInvalid):
+			status, code = http.StatusBadRequest, "INVALID_PARAMETER"
+		case errors.Is(err, service.ErrSubscriptionNotFound):
+			status, code = http.StatusNotFound, "NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf, b, encoding); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Code:      "INTERNAL_ERROR",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	contentType := "application/json; charset=utf-8"
+	if encoding == bundle.EncodingTar {
+		contentType = "application/x-tar"
+	}
+	filename := fmt.Sprintf("bisub-bundle-%s.%s", b.ExportedAt.Format("20060102150405"), encoding)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Bundle-Checksum", b.Checksum)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+
+	summary := map[string]interface{}{"type": subType, "keys": keys, "format": encoding, "checksum": b.Checksum}
+	logOperation(c, h.logService, models.OpTypeQuery, "subscription_bundle", "", models.OpStatusSuccess, time.Since(startTime), "", nil, summary)
+}
+
+// ImportSubscriptions 导入导出包（JSON 或 tar），strategy 指定同版本号内容不同时的处理方式，dry_run 时只返回报告
+func (h *SubscriptionHandler) ImportSubscriptions(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.ImportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	b, err := bundle.Read(http.MaxBytesReader(c.Writer, c.Request.Body, maxBundleBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		status, code := http.StatusBadRequest, "INVALID_BUNDLE"
+		switch {
+		case errors.As(err, &tooLarge):
+			status, code = http.StatusRequestEntityTooLarge, "BUNDLE_TOO_LARGE"
+		case errors.Is(err, bundle.ErrChecksumMismatch):
+			code = "BUNDLE_CHECKSUM_MISMATCH"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	report, err := h.service.ImportBundle(c.Request.Context(), b, &req)
+	if err != nil {
+		if !req.DryRun {
+			logOperation(c, h.logService, models.OpTypeCreate, "subscription_bundle", b.Checksum, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		}
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		switch {
+		case errors.Is(err, service.ErrInvalidImportStrategy):
+			status, code = http.StatusBadRequest, "INVALID_PARAMETER"
+		case errors.Is(err, service.ErrSubscriptionTypeNotFound):
+			status, code = http.StatusBadRequest, "SUBSCRIPTION_TYPE_NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	message := "导入预览"
+	if !report.DryRun {
+		message = "导入完成"
+		logOperation(c, h.logService, models.OpTypeCreate, "subscription_bundle", b.Checksum, models.OpStatusSuccess, time.Since(startTime), "", req, report)
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   message,
+		RequestID: getRequestID(c),
+		Data:      report,
+	})
+}
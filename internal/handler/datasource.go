@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/secret"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type DataSourceHandler struct {
+	service    *service.DataSourceService
+	logService *service.OperationLogService
+}
+
+func NewDataSourceHandler(service *service.DataSourceService, logService *service.OperationLogService) *DataSourceHandler {
+	return &DataSourceHandler{
+		service:    service,
+		logService: logService,
+	}
+}
+
+// ListDataSources 获取配置文件和库中登记的数据源列表
+func (h *DataSourceHandler) ListDataSources(c *gin.Context) {
+	sources, err := h.service.ListDataSources(c.Request.Context())
+	if err != nil {
+		respondDataSourceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      sources,
+	})
+}
+
+// GetDataSource 获取数据源定义，不返回密码
+func (h *DataSourceHandler) GetDataSource(c *gin.Context) {
+	source, err := h.service.GetDataSource(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondDataSourceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      source,
+	})
+}
+
+// CreateDataSource 登记数据源
+func (h *DataSourceHandler) CreateDataSource(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.DataSourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	source, err := h.service.CreateDataSource(c.Request.Context(), &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeCreate, "data_source", req.Name, models.OpStatusFailed, time.Since(startTime), err.Error(), redactDataSourceRequest(req), nil)
+		respondDataSourceError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeCreate, "data_source", req.Name, models.OpStatusSuccess, time.Since(startTime), "", redactDataSourceRequest(req), source)
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Code:      "OK",
+		Message:   "数据源创建成功",
+		RequestID: getRequestID(c),
+		Data:      source,
+	})
+}
+
+// UpdateDataSource 修改数据源定义，密码为空时保留原密码
+func (h *DataSourceHandler) UpdateDataSource(c *gin.Context) {
+	startTime := time.Now()
+	name := c.Param("name")
+
+	var req models.DataSourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	source, err := h.service.UpdateDataSource(c.Request.Context(), name, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "data_source", name, models.OpStatusFailed, time.Since(startTime), err.Error(), redactDataSourceRequest(req), nil)
+		respondDataSourceError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "data_source", name, models.OpStatusSuccess, time.Since(startTime), "", redactDataSourceRequest(req), source)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "数据源更新成功",
+		RequestID: getRequestID(c),
+		Data:      source,
+	})
+}
+
+// EnableDataSource 启用数据源
+func (h *DataSourceHandler) EnableDataSource(c *gin.Context) {
+	h.setStatus(c, models.DataSourceEnabled, "数据源已启用")
+}
+
+// DisableDataSource 停用数据源，使用该数据源的执行立即失败
+func (h *DataSourceHandler) DisableDataSource(c *gin.Context) {
+	h.setStatus(c, models.DataSourceDisabled, "数据源已停用")
+}
+
+func (h *DataSourceHandler) setStatus(c *gin.Context, status, message string) {
+	startTime := time.Now()
+	name := c.Param("name")
+
+	source, err := h.service.SetDataSourceStatus(c.Request.Context(), name, status)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "data_source", name, models.OpStatusFailed, time.Since(startTime), err.Error(), gin.H{"status": status}, nil)
+		respondDataSourceError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "data_source", name, models.OpStatusSuccess, time.Since(startTime), "", gin.H{"status": status}, source)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   message,
+		RequestID: getRequestID(c),
+		Data:      source,
+	})
+}
+
+// TestDataSource 测试数据源连通性，连接失败时仍返回 200，结果中 reachable 为 false
+func (h *DataSourceHandler) TestDataSource(c *gin.Context) {
+	result, err := h.service.TestDataSource(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondDataSourceError(c, err)
+		return
+	}
+
+	message := "连接成功"
+	if !result.Reachable {
+		message = "连接失败"
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   message,
+		RequestID: getRequestID(c),
+		Data:      result,
+	})
+}
+
+// DataSourceHealth 数据源健康状态，无需认证，不返回错误详情；存在不健康的数据源时 status 为 degraded
+func (h *DataSourceHandler) DataSourceHealth(c *gin.Context) {
+	health := h.service.Health()
+	status := "ok"
+	for i := range health {
+		if !health[i].Healthy {
+			status = "degraded"
+		}
+		// 错误信息可能包含主机地址，只在管理接口中返回
+		health[i].LastError = ""
+		health[i].LastErrorAt = nil
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       status,
+		"data_sources": health,
+	})
+}
+
+// redactDataSourceRequest 操作日志中不记录密码
+func redactDataSourceRequest(req models.DataSourceRequest) models.DataSourceRequest {
+	if req.Password != "" {
+		req.Password = "******"
+	}
+	return req
+}
+
+func respondDataSourceError(c *gin.Context, err error) {
+	if respondAccessDenied(c, err) {
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrDataSourceNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, service.ErrDataSourceExists):
+		status, code = http.StatusConflict, "DATA_SOURCE_EXISTS"
+	case errors.Is(err, service.ErrDataSourceReadOnly):
+		status, code = http.StatusConflict, "DATA_SOURCE_READ_ONLY"
+	case errors.Is(err, service.ErrInvalidDataSource):
+		status, code = http.StatusBadRequest, "INVALID_PARAMETER"
+	case errors.Is(err, secret.ErrKeyMissing):
+		status, code = http.StatusInternalServerError, "ENCRYPTION_KEY_MISSING"
+	}
+
+	c.JSON(status, APIResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: getRequestID(c),
+	})
+}
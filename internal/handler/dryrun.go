@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// DryRunSubscription 试运行订阅，返回 EXPLAIN 执行计划和成本护栏评估结果，不执行查询
+func (h *SubscriptionHandler) DryRunSubscription(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+
+	var version *uint32
+	if c.Param("version") != "" {
+		v, ok := parseVersionParam(c)
+		if !ok {
+			return
+		}
+		version = &v
+	}
+
+	var req models.ExecuteSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	result, err := h.service.DryRun(c.Request.Context(), subType, key, version, &req)
+	if err != nil {
+		if respondAccessDenied(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		if errors.Is(err, service.ErrExplainUnsupported) {
+			status, code = http.StatusBadRequest, "EXPLAIN_UNSUPPORTED"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "试运行成功",
+		RequestID: getRequestID(c),
+		Data:      result,
+	})
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	service    *service.JobService
+	logService *service.OperationLogService
+}
+
+func NewJobHandler(service *service.JobService, logService *service.OperationLogService) *JobHandler {
+	return &JobHandler{
+		service:    service,
+		logService: logService,
+	}
+}
+
+// SubmitJob 创建异步执行任务
+func (h *JobHandler) SubmitJob(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A") // 默认为分析数据
+	key := c.Param("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "subscription key is required",
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	var version *uint32
+	if versionStr := c.Param("version"); versionStr != "" {
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			ver := uint32(v)
+			version = &ver
+		}
+	}
+
+	var req models.ExecuteSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	job, err := h.service.SubmitJob(c.Request.Context(), subType, key, version, &req, c.ClientIP(), c.Request.URL.String())
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeExecute, "job", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		if respondAccessDenied(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+		if errors.Is(err, service.ErrJobQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, APIResponse{
+				Code:      "JOB_QUEUE_FULL",
+				Message:   err.Error(),
+				RequestID: getRequestID(c),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Code:      "INTERNAL_ERROR",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeExecute, "job", key, models.OpStatusSuccess, time.Since(startTime), "", req, job)
+
+	c.JSON(http.StatusAccepted, APIResponse{
+		Code:      "OK",
+		Message:   "任务已提交",
+		RequestID: getRequestID(c),
+		Data:      job,
+	})
+}
+
+// GetJob 查询任务状态
+func (h *JobHandler) GetJob(c *gin.Context) {
+	id, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.service.GetJob(c.Request.Context(), id)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      job,
+	})
+}
+
+// GetJobResults 分页获取任务结果
+func (h *JobHandler) GetJobResults(c *gin.Context) {
+	id, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	var req models.JobResultsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	page, err := h.service.GetJobResults(c.Request.Context(), id, &req)
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      page.Rows,
+		Metadata: map[string]interface{}{
+			"columns": page.Columns,
+			"total":   page.Total,
+			"offset":  page.Offset,
+			"limit":   page.Limit,
+		},
+	})
+}
+
+// CancelJob 取消任务
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	startTime := time.Now()
+	id, ok := parseJobID(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.service.CancelJob(c.Request.Context(), id)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "job", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), nil, nil)
+		respondJobError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "job", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", nil, job)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "已请求取消",
+		RequestID: getRequestID(c),
+		Data:      job,
+	})
+}
+
+func parseJobID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "invalid job id",
+			RequestID: getRequestID(c),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondJobError 将任务相关错误映射为对应的HTTP状态
+func respondJobError(c *gin.Context, err error) {
+	if respondAccessDenied(c, err) {
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, service.ErrJobNotFinished):
+		status, code = http.StatusConflict, "JOB_NOT_FINISHED"
+	case errors.Is(err, service.ErrJobNotSucceeded):
+		status, code = http.StatusConflict, "JOB_NOT_SUCCEEDED"
+	case errors.Is(err, service.ErrJobFinished):
+		status, code = http.StatusConflict, "JOB_FINISHED"
+	case errors.Is(err, service.ErrJobResultExpired):
+		status, code = http.StatusGone, "JOB_RESULT_EXPIRED"
+	}
+
+	c.JSON(status, APIResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: getRequestID(c),
+	})
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+)
+
+// streamFlushRows 每写出多少行刷新一次到客户端
+const streamFlushRows = 500
+
+// negotiateFormat 优先使用请求体中的 format，否则按 Accept 头选择输出格式
+func negotiateFormat(format, accept string) string {
+	if format != "" {
+		return format
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mediaType {
+		case "application/x-ndjson", "application/ndjson", "application/jsonl":
+			return models.FormatNDJSON
+		case "text/csv":
+			return models.FormatCSV
+		case "application/json":
+			return models.FormatJSON
+		}
+	}
+	return models.FormatJSON
+}
+
+// streamWriter 流式写出的公共部分：延迟提交响应头，定期 flush
+type streamWriter struct {
+	w           http.ResponseWriter
+	buf         *bufio.Writer
+	contentType string
+	rows        int
+}
+
+func newStreamWriter(w http.ResponseWriter, contentType string) streamWriter {
+	return streamWriter{w: w, buf: bufio.NewWriter(w), contentType: contentType}
+}
+
+// begin 在第一次写出前提交响应头，此前发生的错误仍可返回普通JSON错误响应
+func (s *streamWriter) begin() {
+	header := s.w.Header()
+	header.Set("Content-Type", s.contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Trailer", "X-Row-Count, X-Stream-Error")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *streamWriter) rowWritten() error {
+	s.rows++
+	if s.rows%streamFlushRows == 0 {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *streamWriter) flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// ndjsonWriter 每行输出一个JSON对象，字段顺序与SQL列顺序一致
+type ndjsonWriter struct {
+	streamWriter
+	keys [][]byte
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	return &ndjsonWriter{streamWriter: newStreamWriter(w, "application/x-ndjson; charset=utf-8")}
+}
+
+func (n *ndjsonWriter) WriteHeader(columns []string) error {
+	n.keys = make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		n.keys[i] = key
+	}
+	n.begin()
+	return nil
+}
+
+func (n *ndjsonWriter) WriteRow(values []interface{}) error {
+	n.buf.WriteByte('{')
+	for i, val := range values {
+		if i > 0 {
+			n.buf.WriteByte(',')
+		}
+		n.buf.Write(n.keys[i])
+		n.buf.WriteByte(':')
+		data, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		n.buf.Write(data)
+	}
+	if _, err := n.buf.WriteString("}\n"); err != nil {
+		return err
+	}
+	return n.rowWritten()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.flush()
+}
+
+// csvWriter 输出带表头的CSV
+type csvWriter struct {
+	streamWriter
+	csv    *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w http.ResponseWriter) *csvWriter {
+	c := &csvWriter{streamWriter: newStreamWriter(w, "text/csv; charset=utf-8")}
+	c.csv = csv.NewWriter(c.buf)
+	return c
+}
+
+func (c *csvWriter) WriteHeader(columns []string) error {
+	c.record = make([]string, len(columns))
+	c.begin()
+	return c.csv.Write(columns)
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	for i, val := range values {
+		c.record[i] = utils.FormatCSVValue(val)
+	}
+	if err := c.csv.Write(c.record); err != nil {
+		return err
+	}
+	if (c.rows+1)%streamFlushRows == 0 {
+		c.csv.Flush()
+	}
+	return c.rowWritten()
+}
+
+func (c *csvWriter) Close() error {
+	c.csv.Flush()
+	if err := c.csv.Error(); err != nil {
+		return err
+	}
+	return c.flush()
+}
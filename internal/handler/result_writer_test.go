@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	assert.Equal(t, models.FormatCSV, negotiateFormat(models.FormatCSV, "application/json"))
+	assert.Equal(t, models.FormatNDJSON, negotiateFormat("", "application/x-ndjson"))
+	assert.Equal(t, models.FormatCSV, negotiateFormat("", "text/csv;q=0.9, */*"))
+	assert.Equal(t, models.FormatJSON, negotiateFormat("", "*/*"))
+	assert.Equal(t, models.FormatJSON, negotiateFormat("", ""))
+}
+
+func TestNDJSONWriterPreservesColumnOrder(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newNDJSONWriter(rec)
+
+	require.NoError(t, w.WriteHeader([]string{"z", "a", "m"}))
+	require.NoError(t, w.WriteRow([]interface{}{int64(1), "x", nil}))
+	require.NoError(t, w.WriteRow([]interface{}{int64(2), "y", 1.5}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "application/x-ndjson; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "{\"z\":1,\"a\":\"x\",\"m\":null}\n{\"z\":2,\"a\":\"y\",\"m\":1.5}\n", rec.Body.String())
+}
+
+func TestCSVWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := newCSVWriter(rec)
+
+	ts := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, w.WriteHeader([]string{"id", "name", "created_at"}))
+	require.NoError(t, w.WriteRow([]interface{}{int64(1), "O'Brien, Jr.", ts}))
+	require.NoError(t, w.WriteRow([]interface{}{int64(2), nil, nil}))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "id,name,created_at\n1,\"O'Brien, Jr.\",2025-01-02 03:04:05\n2,,\n", rec.Body.String())
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ReviewHandler struct {
+	service    *service.ReviewService
+	logService *service.OperationLogService
+}
+
+func NewReviewHandler(service *service.ReviewService, logService *service.OperationLogService) *ReviewHandler {
+	return &ReviewHandler{
+		service:    service,
+		logService: logService,
+	}
+}
+
+// SubmitReview 提交订阅版本审核
+func (h *ReviewHandler) SubmitReview(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.SubmitReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	review, err := h.service.Submit(c.Request.Context(), subType, key, version, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeCreate, "review", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		respondReviewError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeCreate, "review", strconv.FormatUint(review.ID, 10), models.OpStatusSuccess, time.Since(startTime), "", req, review)
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Code:      "OK",
+		Message:   "已提交审核",
+		RequestID: getRequestID(c),
+		Data:      review,
+	})
+}
+
+// ListVersionReviews 获取订阅版本的审核记录
+func (h *ReviewHandler) ListVersionReviews(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	reviews, err := h.service.ListByVersion(c.Request.Context(), subType, c.Param("key"), version)
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      reviews,
+	})
+}
+
+// ListReviews 获取审核列表，默认只返回待审核的
+func (h *ReviewHandler) ListReviews(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	reviews, total, err := h.service.List(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data: map[string]interface{}{
+			"items": reviews,
+			"total": total,
+		},
+	})
+}
+
+// GetReview 获取审核详情及相对生效版本的差异
+func (h *ReviewHandler) GetReview(c *gin.Context) {
+	id, ok := parseReviewID(c)
+	if !ok {
+		return
+	}
+
+	review, err := h.service.Get(c.Request.Context(), id)
+	if err != nil {
+		respondReviewError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      review,
+	})
+}
+
+// ApproveReview 审核通过
+func (h *ReviewHandler) ApproveReview(c *gin.Context) {
+	h.decide(c, h.service.Approve, "审核已通过")
+}
+
+// RejectReview 驳回审核
+func (h *ReviewHandler) RejectReview(c *gin.Context) {
+	h.decide(c, h.service.Reject, "审核已驳回")
+}
+
+func (h *ReviewHandler) decide(c *gin.Context, decide func(ctx context.Context, id uint64, req *models.ReviewDecisionRequest) (*models.SubscriptionReview, error), message string) {
+	startTime := time.Now()
+	id, ok := parseReviewID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReviewDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	review, err := decide(c.Request.Context(), id, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "review", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		respondReviewError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "review", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", req, review)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   message,
+		RequestID: getRequestID(c),
+		Data:      review,
+	})
+}
+
+func parseReviewID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "invalid review id",
+			RequestID: getRequestID(c),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondReviewError(c *gin.Context, err error) {
+	if respondAccessDenied(c, err) || respondLifecycleError(c, err) {
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+	var reviewErr *service.ReviewError
+	switch {
+	case errors.As(err, &reviewErr):
+		status, code = http.StatusBadRequest, "INVALID_PARAMETER"
+	case errors.Is(err, service.ErrReviewNotFound), errors.Is(err, service.ErrSubscriptionNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, service.ErrSelfReview):
+		status, code = http.StatusForbidden, "SELF_REVIEW"
+	case errors.Is(err, service.ErrSharedReviewer):
+		status, code = http.StatusForbidden, "PERSONAL_IDENTITY_REQUIRED"
+	case errors.Is(err, service.ErrReviewClosed):
+		status, code = http.StatusConflict, "REVIEW_CLOSED"
+	case errors.Is(err, service.ErrReviewOutdated):
+		status, code = http.StatusConflict, "REVIEW_OUTDATED"
+	}
+
+	c.JSON(status, APIResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: getRequestID(c),
+	})
+}
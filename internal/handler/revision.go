@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ListRevisions 获取订阅版本的修订历史及差异
+func (h *SubscriptionHandler) ListRevisions(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	revisions, total, err := h.service.ListRevisions(c.Request.Context(), subType, key, version, limit, offset)
+	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Code:      "INTERNAL_ERROR",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data: map[string]interface{}{
+			"items": revisions,
+			"total": total,
+		},
+	})
+}
+
+// RollbackSubscription 将订阅版本内容回滚到指定修订
+func (h *SubscriptionHandler) RollbackSubscription(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.RollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	subscription, err := h.service.Rollback(c.Request.Context(), subType, key, version, &req)
+	if err != nil {
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		if errors.Is(err, service.ErrRevisionNotFound) {
+			status, code = http.StatusNotFound, "NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "回滚成功",
+		RequestID: getRequestID(c),
+		Data:      subscription,
+	})
+}
+
+// parseVersionParam 解析路径中的版本号，失败时写入 400 响应
+func parseVersionParam(c *gin.Context) (uint32, bool) {
+	v, err := strconv.ParseUint(c.Param("version"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "invalid version",
+			RequestID: getRequestID(c),
+		})
+		return 0, false
+	}
+	return uint32(v), true
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleHandler struct {
+	service    *service.ScheduleService
+	logService *service.OperationLogService
+}
+
+func NewScheduleHandler(service *service.ScheduleService, logService *service.OperationLogService) *ScheduleHandler {
+	return &ScheduleHandler{
+		service:    service,
+		logService: logService,
+	}
+}
+
+// ListSchedules 获取订阅的定时投递计划
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+
+	schedules, err := h.service.ListSchedules(c.Request.Context(), subType, key)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      schedules,
+	})
+}
+
+// CreateSchedule 为订阅创建定时投递计划
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	schedule, err := h.service.CreateSchedule(c.Request.Context(), subType, key, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeCreate, "schedule", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		respondScheduleError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeCreate, "schedule", key, models.OpStatusSuccess, time.Since(startTime), "", req, schedule)
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Code:      "OK",
+		Message:   "定时投递创建成功",
+		RequestID: getRequestID(c),
+		Data:      schedule,
+	})
+}
+
+// GetSchedule 获取定时投递计划
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	id, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.GetSchedule(c.Request.Context(), id)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      schedule,
+	})
+}
+
+// UpdateSchedule 更新定时投递计划
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	startTime := time.Now()
+	id, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	schedule, err := h.service.UpdateSchedule(c.Request.Context(), id, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "schedule", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		respondScheduleError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "schedule", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", req, schedule)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "更新成功",
+		RequestID: getRequestID(c),
+		Data:      schedule,
+	})
+}
+
+// DeleteSchedule 删除定时投递计划
+func (h *ScheduleHandler) DeleteSchedule(c *gin.Context) {
+	startTime := time.Now()
+	id, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteSchedule(c.Request.Context(), id); err != nil {
+		logOperation(c, h.logService, models.OpTypeDelete, "schedule", c.Param("id"), models.OpStatusFailed, time.Since(startTime), err.Error(), nil, nil)
+		respondScheduleError(c, err)
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeDelete, "schedule", c.Param("id"), models.OpStatusSuccess, time.Since(startTime), "", nil, nil)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "删除成功",
+		RequestID: getRequestID(c),
+	})
+}
+
+// ListScheduleRuns 获取定时投递执行记录
+func (h *ScheduleHandler) ListScheduleRuns(c *gin.Context) {
+	id, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ScheduleRunsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	runs, total, err := h.service.ListRuns(c.Request.Context(), id, &req)
+	if err != nil {
+		respondScheduleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "获取成功",
+		RequestID: getRequestID(c),
+		Data:      runs,
+		Metadata: map[string]interface{}{
+			"total":  total,
+			"limit":  req.Limit,
+			"offset": req.Offset,
+		},
+	})
+}
+
+func parseScheduleID(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   "invalid schedule id",
+			RequestID: getRequestID(c),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondScheduleError(c *gin.Context, err error) {
+	if respondAccessDenied(c, err) {
+		return
+	}
+
+	status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+
+	var scheduleErr *service.ScheduleError
+	switch {
+	case errors.As(err, &scheduleErr):
+		status, code = http.StatusBadRequest, "INVALID_SCHEDULE"
+	case errors.Is(err, service.ErrScheduleNotFound):
+		status, code = http.StatusNotFound, "NOT_FOUND"
+	}
+
+	c.JSON(status, APIResponse{
+		Code:      code,
+		Message:   err.Error(),
+		RequestID: getRequestID(c),
+	})
+}
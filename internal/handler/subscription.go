@@ -1,11 +1,17 @@
 package handler
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/queryplan"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
 	"git.uhomes.net/uhs-go/go-bisub/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -38,7 +44,7 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	var req models.CreateSubscriptionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		// 记录操作日志
-		h.logOperation(c, models.OpTypeCreate, "subscription", "", models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		logOperation(c, h.logService, models.OpTypeCreate, "subscription", "", models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
 		c.JSON(http.StatusBadRequest, APIResponse{
 			Code:      "INVALID_PARAMETER",
 			Message:   err.Error(),
@@ -47,13 +53,17 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 		return
 	}
 
-	// 从JWT中获取用户ID（简化实现）
-	creatorID := uint64(1) // 实际应该从JWT token中解析
-
-	subscription, err := h.service.CreateSubscription(c.Request.Context(), &req, creatorID)
+	// 创建者从认证身份中获取
+	subscription, err := h.service.CreateSubscription(c.Request.Context(), &req)
 	if err != nil {
 		// 记录操作日志
-		h.logOperation(c, models.OpTypeCreate, "subscription", req.SubKey, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		logOperation(c, h.logService, models.OpTypeCreate, "subscription", req.SubKey, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) {
+			return
+		}
+		if respondInvalidSQL(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -63,7 +73,7 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	}
 
 	// 记录操作日志
-	h.logOperation(c, models.OpTypeCreate, "subscription", req.SubKey, models.OpStatusSuccess, time.Since(startTime), "", req, subscription)
+	logOperation(c, h.logService, models.OpTypeCreate, "subscription", req.SubKey, models.OpStatusSuccess, time.Since(startTime), "", req, subscription)
 
 	c.JSON(http.StatusCreated, APIResponse{
 		Code:      "OK",
@@ -73,6 +83,54 @@ func (h *SubscriptionHandler) CreateSubscription(c *gin.Context) {
 	})
 }
 
+// ForkSubscription 由已有版本派生新的待生效版本，请求体可省略
+func (h *SubscriptionHandler) ForkSubscription(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+	version, ok := parseVersionParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ForkSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	subscription, err := h.service.ForkSubscription(c.Request.Context(), subType, key, version, &req)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeCreate, "subscription", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		if respondAccessDenied(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		if errors.Is(err, service.ErrSubscriptionNotFound) {
+			status, code = http.StatusNotFound, "NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeCreate, "subscription", key, models.OpStatusSuccess, time.Since(startTime), "", req, subscription)
+
+	c.JSON(http.StatusCreated, APIResponse{
+		Code:      "OK",
+		Message:   "新版本创建成功",
+		RequestID: getRequestID(c),
+		Data:      subscription,
+	})
+}
+
 // ExecuteSubscription 执行订阅
 func (h *SubscriptionHandler) ExecuteSubscription(c *gin.Context) {
 	startTime := time.Now()
@@ -87,10 +145,10 @@ func (h *SubscriptionHandler) ExecuteSubscription(c *gin.Context) {
 		return
 	}
 
-	var version *uint8
+	var version *uint32
 	if versionStr := c.Param("version"); versionStr != "" {
-		if v, err := strconv.ParseUint(versionStr, 10, 8); err == nil {
-			ver := uint8(v)
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			ver := uint32(v)
 			version = &ver
 		}
 	}
@@ -113,8 +171,20 @@ func (h *SubscriptionHandler) ExecuteSubscription(c *gin.Context) {
 	clientIP := c.ClientIP()
 	apiURL := c.Request.URL.String()
 
-	results, err := h.service.ExecuteSubscription(c.Request.Context(), subType, key, version, &req, clientIP, apiURL)
+	// NDJSON/CSV 逐行写出，不在内存中保留结果集
+	if format := negotiateFormat(req.Format, c.GetHeader("Accept")); format != models.FormatJSON {
+		h.streamSubscription(c, format, subType, key, version, &req, startTime)
+		return
+	}
+
+	result, err := h.service.ExecuteSubscription(c.Request.Context(), subType, key, version, &req, clientIP, apiURL)
 	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
+		if respondInvalidSQL(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -124,16 +194,84 @@ func (h *SubscriptionHandler) ExecuteSubscription(c *gin.Context) {
 	}
 
 	// 记录操作日志
-	h.logOperation(c, models.OpTypeExecute, "subscription", key, models.OpStatusSuccess, time.Since(startTime), "", req, results)
+	logOperation(c, h.logService, models.OpTypeExecute, "subscription", key, models.OpStatusSuccess, time.Since(startTime), "", req, result.Rows)
+
+	cacheStatus := "MISS"
+	if result.CacheHit {
+		cacheStatus = "HIT"
+	}
+	c.Header("X-Cache", cacheStatus)
+
+	metadata := map[string]interface{}{
+		"cache_hit": result.CacheHit,
+		"truncated": result.Truncated,
+	}
+	if len(result.SchemaWarnings) > 0 {
+		metadata["schema_warnings"] = result.SchemaWarnings
+	}
+	if result.ServedBy != "" {
+		metadata["served_by"] = result.ServedBy
+	}
+	if result.Truncated {
+		metadata["truncated_by"] = result.TruncatedBy
+		c.Header("X-Result-Truncated", result.TruncatedBy)
+	}
+	if req.PageSize != 0 || req.Cursor != "" {
+		metadata["has_more"] = result.HasMore
+		metadata["next_cursor"] = result.NextCursor
+	}
 
 	c.JSON(http.StatusOK, APIResponse{
 		Code:      "OK",
 		Message:   "执行成功",
 		RequestID: getRequestID(c),
-		Data:      results,
+		Data:      result.Rows,
+		Metadata:  metadata,
 	})
 }
 
+// streamSubscription 以流式格式输出执行结果，行数和输出中途的错误通过 HTTP trailer 返回
+func (h *SubscriptionHandler) streamSubscription(c *gin.Context, format, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest, startTime time.Time) {
+	var writer service.RowWriter
+	if format == models.FormatCSV {
+		writer = newCSVWriter(c.Writer)
+	} else {
+		writer = newNDJSONWriter(c.Writer)
+	}
+
+	rowCount, err := h.service.StreamSubscription(c.Request.Context(), subType, key, version, req, c.ClientIP(), c.Request.URL.String(), writer)
+	if err != nil && !c.Writer.Written() {
+		// 尚未输出任何数据，撤销流式响应头并返回普通错误响应
+		header := c.Writer.Header()
+		header.Del("Content-Type")
+		header.Del("Trailer")
+		header.Del("X-Content-Type-Options")
+		if respondAccessDenied(c, err) {
+			return
+		}
+		if respondInvalidSQL(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Code:      "INTERNAL_ERROR",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	c.Writer.Header().Set("X-Row-Count", strconv.FormatInt(rowCount, 10))
+	summary := map[string]interface{}{"format": format, "row_count": rowCount}
+	if err != nil {
+		c.Writer.Header().Set("X-Stream-Error", strings.ReplaceAll(err.Error(), "\n", " "))
+		logOperation(c, h.logService, models.OpTypeExecute, "subscription", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, summary)
+		return
+	}
+
+	// 记录操作日志
+	logOperation(c, h.logService, models.OpTypeExecute, "subscription", key, models.OpStatusSuccess, time.Since(startTime), "", req, summary)
+}
+
 // GetSubscriptions 获取订阅列表
 func (h *SubscriptionHandler) GetSubscriptions(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -146,6 +284,9 @@ func (h *SubscriptionHandler) GetSubscriptions(c *gin.Context) {
 
 	subscriptions, total, err := h.service.GetSubscriptions(c.Request.Context(), limit, offset, subKey, title, status)
 	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -184,16 +325,19 @@ func (h *SubscriptionHandler) GetSubscription(c *gin.Context) {
 		return
 	}
 
-	var version *uint8
+	var version *uint32
 	if versionStr := c.Param("version"); versionStr != "" {
-		if v, err := strconv.ParseUint(versionStr, 10, 8); err == nil {
-			ver := uint8(v)
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			ver := uint32(v)
 			version = &ver
 		}
 	}
 
 	subscription, err := h.service.GetSubscription(c.Request.Context(), subType, key, version)
 	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
 		c.JSON(http.StatusNotFound, APIResponse{
 			Code:      "NOT_FOUND",
 			Message:   "订阅不存在",
@@ -223,10 +367,10 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 		return
 	}
 
-	var version uint8
+	var version uint32
 	if versionStr := c.Param("version"); versionStr != "" {
-		if v, err := strconv.ParseUint(versionStr, 10, 8); err == nil {
-			version = uint8(v)
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			version = uint32(v)
 		} else {
 			c.JSON(http.StatusBadRequest, APIResponse{
 				Code:      "INVALID_PARAMETER",
@@ -256,6 +400,9 @@ func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
 
 	subscription, err := h.service.UpdateSubscription(c.Request.Context(), subType, key, version, &req)
 	if err != nil {
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -285,10 +432,10 @@ func (h *SubscriptionHandler) UpdateSubscriptionStatus(c *gin.Context) {
 		return
 	}
 
-	var version uint8
+	var version uint32
 	if versionStr := c.Param("version"); versionStr != "" {
-		if v, err := strconv.ParseUint(versionStr, 10, 8); err == nil {
-			version = uint8(v)
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			version = uint32(v)
 		} else {
 			c.JSON(http.StatusBadRequest, APIResponse{
 				Code:      "INVALID_PARAMETER",
@@ -316,7 +463,10 @@ func (h *SubscriptionHandler) UpdateSubscriptionStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateStatus(c.Request.Context(), subType, key, version, req.Status); err != nil {
+	if err := h.service.UpdateStatus(c.Request.Context(), subType, key, version, req.Status, req.Force); err != nil {
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -345,10 +495,10 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 		return
 	}
 
-	var version uint8
+	var version uint32
 	if versionStr := c.Param("version"); versionStr != "" {
-		if v, err := strconv.ParseUint(versionStr, 10, 8); err == nil {
-			version = uint8(v)
+		if v, err := strconv.ParseUint(versionStr, 10, 32); err == nil {
+			version = uint32(v)
 		} else {
 			c.JSON(http.StatusBadRequest, APIResponse{
 				Code:      "INVALID_PARAMETER",
@@ -367,6 +517,38 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 	}
 
 	if err := h.service.DeleteSubscription(c.Request.Context(), subType, key, version); err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		if errors.Is(err, service.ErrSubscriptionNotFound) {
+			status, code = http.StatusNotFound, "NOT_FOUND"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "删除成功",
+		RequestID: getRequestID(c),
+	})
+}
+
+// GetACL 获取订阅访问控制列表
+func (h *SubscriptionHandler) GetACL(c *gin.Context) {
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+
+	acl, err := h.service.GetACL(c.Request.Context(), subType, key)
+	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -377,8 +559,49 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 
 	c.JSON(http.StatusOK, APIResponse{
 		Code:      "OK",
-		Message:   "删除成功",
+		Message:   "获取成功",
 		RequestID: getRequestID(c),
+		Data:      acl,
+	})
+}
+
+// SetACL 整体替换订阅访问控制列表
+func (h *SubscriptionHandler) SetACL(c *gin.Context) {
+	startTime := time.Now()
+	subType := c.DefaultQuery("type", "A")
+	key := c.Param("key")
+
+	var req models.SetACLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	acl, err := h.service.SetACL(c.Request.Context(), subType, key, req.Entries)
+	if err != nil {
+		logOperation(c, h.logService, models.OpTypeUpdate, "subscription_acl", key, models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		if respondAccessDenied(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Code:      "INTERNAL_ERROR",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	logOperation(c, h.logService, models.OpTypeUpdate, "subscription_acl", key, models.OpStatusSuccess, time.Since(startTime), "", req, acl)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   "更新成功",
+		RequestID: getRequestID(c),
+		Data:      acl,
 	})
 }
 
@@ -396,6 +619,9 @@ func (h *SubscriptionHandler) GetStats(c *gin.Context) {
 
 	stats, err := h.service.GetStats(c.Request.Context(), &req)
 	if err != nil {
+		if respondAccessDenied(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Code:      "INTERNAL_ERROR",
 			Message:   err.Error(),
@@ -412,6 +638,142 @@ func (h *SubscriptionHandler) GetStats(c *gin.Context) {
 	})
 }
 
+// respondInvalidSQL 将变量、分页参数和SQL策略校验失败映射为 400，超出成本护栏和结果不符合声明的输出结构映射为 422，
+// 数据源不存在、不在订阅允许的列表中、已停用、不可用或熔断分别映射为 400/403/409/503，返回是否已写入响应
+func respondInvalidSQL(c *gin.Context, err error) bool {
+	var varErr *service.VariableError
+	if errors.As(err, &varErr) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_VARIABLE",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return true
+	}
+
+	var sqlErr *sqlguard.ValidationError
+	if errors.As(err, &sqlErr) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "SQL_POLICY_VIOLATION",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+			Data:      sqlErr.Violations,
+		})
+		return true
+	}
+
+	var pageErr *service.PaginationError
+	if errors.As(err, &pageErr) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PAGINATION",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return true
+	}
+
+	var schemaErr *service.SchemaMismatchError
+	if errors.As(err, &schemaErr) {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Code:      "SCHEMA_MISMATCH",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+			Data:      schemaErr.Violations,
+		})
+		return true
+	}
+
+	var guardrailErr *queryplan.GuardrailError
+	if errors.As(err, &guardrailErr) {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Code:      "GUARDRAIL_VIOLATION",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+			Data:      guardrailErr.Violations,
+		})
+		return true
+	}
+
+	var sourceErr *service.DataSourceError
+	if errors.As(err, &sourceErr) {
+		status, code := http.StatusServiceUnavailable, "DATA_SOURCE_UNAVAILABLE"
+		switch {
+		case errors.Is(err, service.ErrDataSourceNotFound):
+			status, code = http.StatusBadRequest, "DATA_SOURCE_NOT_FOUND"
+		case errors.Is(err, service.ErrDataSourceNotAllowed):
+			status, code = http.StatusForbidden, "DATA_SOURCE_NOT_ALLOWED"
+		case errors.Is(err, service.ErrDataSourceDisabled):
+			status, code = http.StatusConflict, "DATA_SOURCE_DISABLED"
+		case errors.Is(err, service.ErrCircuitOpen):
+			code = "DATA_SOURCE_CIRCUIT_OPEN"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return true
+	}
+
+	return false
+}
+
+// respondLifecycleError 将非法状态迁移、缺少审核和不兼容的输出结构变化映射为 409，激活试执行失败映射为 422，返回是否已写入响应
+func respondLifecycleError(c *gin.Context, err error) bool {
+	var schemaErr *service.SchemaChangeError
+	switch {
+	case errors.As(err, &schemaErr):
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:      "BREAKING_SCHEMA_CHANGE",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+			Data:      schemaErr.Changes,
+		})
+	case errors.Is(err, service.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:      "INVALID_STATUS_TRANSITION",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+	case errors.Is(err, service.ErrReviewRequired):
+		c.JSON(http.StatusConflict, APIResponse{
+			Code:      "REVIEW_REQUIRED",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+	case errors.Is(err, service.ErrActivationFailed):
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{
+			Code:      "ACTIVATION_FAILED",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+// respondAccessDenied 将未认证和无权限映射为 401/403，返回是否已写入响应
+func respondAccessDenied(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrUnauthenticated):
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Code:      "UNAUTHORIZED",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return true
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, APIResponse{
+			Code:      "FORBIDDEN",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return true
+	}
+	return false
+}
+
 func getRequestID(c *gin.Context) string {
 	if requestID := c.GetHeader("X-Request-Id"); requestID != "" {
 		return requestID
@@ -419,16 +781,24 @@ func getRequestID(c *gin.Context) string {
 	return uuid.New().String()
 }
 
-// logOperation 记录操作日志
-func (h *SubscriptionHandler) logOperation(c *gin.Context, operation, resource, resourceID, status string, duration time.Duration, errorMsg string, requestData, responseData interface{}) {
-	if h.logService == nil {
+// operator 当前调用方的用户ID和名称，用于操作日志
+func operator(c *gin.Context) (uint64, string) {
+	p, ok := auth.Current(c)
+	if !ok {
+		return 0, ""
+	}
+	return p.UserID, p.Name()
+}
+
+// logOperation 记录操作日志，resource 为资源类型；各处理器共用，未配置日志服务时不记录
+func logOperation(c *gin.Context, logService *service.OperationLogService, operation, resource, resourceID, status string, duration time.Duration, errorMsg string, requestData, responseData interface{}) {
+	if logService == nil {
 		return
 	}
 
-	userID := uint64(1) // 从上下文获取
-	username := "admin" // 从上下文获取
+	userID, username := operator(c)
 
-	log := h.logService.CreateOperationLog(
+	log := logService.CreateOperationLog(
 		userID,
 		username,
 		operation,
@@ -445,5 +815,5 @@ func (h *SubscriptionHandler) logOperation(c *gin.Context, operation, resource,
 		responseData,
 	)
 
-	h.logService.LogOperation(c.Request.Context(), log)
+	logService.LogOperation(c.Request.Context(), log)
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/definition"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// SyncSubscriptions 按 gitops.definitions_dir 中的定义同步订阅，apply 为 false 时只返回计划；需要管理员权限
+func (h *SubscriptionHandler) SyncSubscriptions(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.SyncRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Code:      "INVALID_PARAMETER",
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	plan, err := h.service.SyncDefinitions(c.Request.Context(), &req)
+	if err != nil {
+		if req.Apply {
+			logOperation(c, h.logService, models.OpTypeUpdate, "subscription_sync", "", models.OpStatusFailed, time.Since(startTime), err.Error(), req, nil)
+		}
+		if respondAccessDenied(c, err) || respondLifecycleError(c, err) || respondInvalidSQL(c, err) {
+			return
+		}
+
+		var defErr *definition.ValidationError
+		if errors.As(err, &defErr) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Code:      "INVALID_DEFINITIONS",
+				Message:   err.Error(),
+				RequestID: getRequestID(c),
+				Data:      defErr.Problems,
+			})
+			return
+		}
+
+		status, code := http.StatusInternalServerError, "INTERNAL_ERROR"
+		if errors.Is(err, service.ErrSyncNotConfigured) {
+			status, code = http.StatusConflict, "SYNC_NOT_CONFIGURED"
+		}
+		c.JSON(status, APIResponse{
+			Code:      code,
+			Message:   err.Error(),
+			RequestID: getRequestID(c),
+		})
+		return
+	}
+
+	message := "同步计划"
+	if plan.Applied {
+		message = "同步完成"
+		logOperation(c, h.logService, models.OpTypeUpdate, "subscription_sync", "", models.OpStatusSuccess, time.Since(startTime), "", req, plan)
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Code:      "OK",
+		Message:   message,
+		RequestID: getRequestID(c),
+		Data:      plan,
+	})
+}
@@ -1,20 +1,137 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/service"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
+// APIKeyHeader 传递API Key的请求头
+const APIKeyHeader = "X-API-Key"
+
 type AuthMiddleware struct {
-	config *config.Config
+	config     *config.Config
+	verifier   *auth.JWTVerifier
+	apiKeys    *service.APIKeyService
+	logService *service.OperationLogService
 }
 
-func NewAuthMiddleware(config *config.Config) *AuthMiddleware {
-	return &AuthMiddleware{config: config}
+func NewAuthMiddleware(config *config.Config, apiKeys *service.APIKeyService, logService *service.OperationLogService) (*AuthMiddleware, error) {
+	jwtCfg := config.Security.JWT
+	if jwtCfg.ClockSkew <= 0 {
+		jwtCfg.ClockSkew = 30 * time.Second
+	}
+	if jwtCfg.RequiredClaims == nil {
+		jwtCfg.RequiredClaims = []string{"exp"}
+	}
+
+	verifier, err := auth.NewJWTVerifier(context.Background(), auth.JWTOptions{
+		Secret:         config.Security.JWTSecret,
+		JWKSFile:       jwtCfg.JWKSFile,
+		JWKSURL:        jwtCfg.JWKSURL,
+		JWKSRefresh:    jwtCfg.JWKSRefresh,
+		Algorithms:     jwtCfg.Algorithms,
+		Issuer:         jwtCfg.Issuer,
+		Audience:       jwtCfg.Audience,
+		ClockSkew:      jwtCfg.ClockSkew,
+		RequiredClaims: jwtCfg.RequiredClaims,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthMiddleware{
+		config:     config,
+		verifier:   verifier,
+		apiKeys:    apiKeys,
+		logService: logService,
+	}, nil
+}
+
+// Authenticate 同时接受 X-API-Key、Bearer API Key 和 Bearer JWT
+func (m *AuthMiddleware) Authenticate() gin.HandlerFunc {
+	jwtAuth := m.JWTAuth()
+	return func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			m.apiKeyAuth(c, key)
+			return
+		}
+		if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); strings.HasPrefix(token, service.APIKeyPrefix) {
+			m.apiKeyAuth(c, token)
+			return
+		}
+		jwtAuth(c)
+	}
+}
+
+// apiKeyAuth 校验API Key，请求结束后将调用记录写入操作日志
+func (m *AuthMiddleware) apiKeyAuth(c *gin.Context, key string) {
+	startTime := time.Now()
+
+	p, err := m.apiKeys.Authenticate(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, service.ErrAPIKeyInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code":    "UNAUTHORIZED",
+				"message": "Invalid API key",
+			})
+		} else {
+			slog.Error("API key authentication failed", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "API key authentication failed",
+			})
+		}
+		c.Abort()
+		return
+	}
+
+	setPrincipal(c, p)
+
+	c.Next()
+
+	m.logAPIKeyUsage(c, p, time.Since(startTime))
+}
+
+// logAPIKeyUsage 记录API Key调用，resource 固定为 api_key，resource_id 为密钥ID
+func (m *AuthMiddleware) logAPIKeyUsage(c *gin.Context, p *auth.Principal, duration time.Duration) {
+	if m.logService == nil {
+		return
+	}
+
+	status, errorMsg := models.OpStatusSuccess, ""
+	if c.Writer.Status() >= http.StatusBadRequest {
+		status = models.OpStatusFailed
+		errorMsg = http.StatusText(c.Writer.Status())
+	}
+
+	log := m.logService.CreateOperationLog(
+		0,
+		p.Name(),
+		getOperationType(c.Request.Method, c.FullPath()),
+		"api_key",
+		strconv.FormatUint(p.APIKeyID, 10),
+		status,
+		c.ClientIP(),
+		c.GetHeader("User-Agent"),
+		c.Request.URL.String(),
+		c.Request.Method,
+		uint32(duration.Milliseconds()),
+		errorMsg,
+		nil,
+		nil,
+	)
+	m.logService.LogOperation(c.Request.Context(), log)
 }
 
 // JWTAuth JWT认证中间件
@@ -40,11 +157,9 @@ func (m *AuthMiddleware) JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(m.config.Security.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := m.verifier.Verify(c.Request.Context(), tokenString)
+		if err != nil {
+			slog.Debug("JWT verification failed", "error", err, "client_ip", c.ClientIP())
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":    "UNAUTHORIZED",
 				"message": "Invalid token",
@@ -53,18 +168,58 @@ func (m *AuthMiddleware) JWTAuth() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("username", claims["username"])
-		}
+		setPrincipal(c, m.principalFromClaims(claims))
 
 		c.Next()
 	}
 }
 
-// BasicAuth 基础认证中间件（用于Web UI）
+// BasicAuth 基础认证中间件（用于Web UI），Web UI 账号视为管理员
 func (m *AuthMiddleware) BasicAuth() gin.HandlerFunc {
-	return gin.BasicAuth(gin.Accounts{
+	basic := gin.BasicAuth(gin.Accounts{
 		m.config.WebUI.Username: m.config.WebUI.Password,
 	})
+	return func(c *gin.Context) {
+		basic(c)
+		if c.IsAborted() {
+			return
+		}
+		setPrincipal(c, &auth.Principal{
+			Kind:     auth.KindUser,
+			Username: c.GetString(gin.AuthUserKey),
+			Admin:    true,
+			Shared:   true,
+		})
+	}
+}
+
+// principalFromClaims 从JWT声明构造调用方：client_id 表示API客户端，否则为用户
+func (m *AuthMiddleware) principalFromClaims(claims *auth.Claims) *auth.Principal {
+	p := &auth.Principal{
+		Kind:     auth.KindUser,
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		Roles:    claims.Roles,
+	}
+	if claims.ClientID != "" {
+		p.Kind = auth.KindClient
+		p.ClientID = claims.ClientID
+	}
+
+	adminRoles := m.config.Security.AdminRoles
+	if len(adminRoles) == 0 {
+		adminRoles = []string{"admin"}
+	}
+	for _, role := range adminRoles {
+		if p.HasRole(role) {
+			p.Admin = true
+			break
+		}
+	}
+	return p
+}
+
+// setPrincipal 将调用方写入请求 context，通过 auth.Current 读取
+func setPrincipal(c *gin.Context, p *auth.Principal) {
+	c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
 }
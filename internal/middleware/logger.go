@@ -18,8 +18,17 @@ type responseWriter struct {
 	body *bytes.Buffer
 }
 
+// maxCapturedBody 最多捕获的响应体字节数，避免流式输出的大结果集全部缓存在内存中
+const maxCapturedBody = 1 << 20
+
 func (w *responseWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
+	if remaining := maxCapturedBody - w.body.Len(); remaining > 0 {
+		if len(b) > remaining {
+			w.body.Write(b[:remaining])
+		} else {
+			w.body.Write(b)
+		}
+	}
 	return w.ResponseWriter.Write(b)
 }
 
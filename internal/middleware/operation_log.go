@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
 	"git.uhomes.net/uhs-go/go-bisub/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -78,24 +79,17 @@ func OperationLogMiddleware(logService *service.OperationLogService) gin.Handler
 }
 
 func getUserID(c *gin.Context) uint64 {
-	// 从JWT token或session中获取用户ID
-	// 这里简化实现，实际应该从认证中间件设置的上下文中获取
-	if userID, exists := c.Get("user_id"); exists {
-		if id, ok := userID.(uint64); ok {
-			return id
-		}
+	if p, ok := auth.Current(c); ok {
+		return p.UserID
 	}
-	return 1 // 默认用户ID
+	return 0
 }
 
 func getUsername(c *gin.Context) string {
-	// 从JWT token或session中获取用户名
-	if username, exists := c.Get("username"); exists {
-		if name, ok := username.(string); ok {
-			return name
-		}
+	if p, ok := auth.Current(c); ok {
+		return p.Name()
 	}
-	return "admin" // 默认用户名
+	return ""
 }
 
 func getOperationType(method, path string) string {
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -14,20 +16,25 @@ import (
 
 type RateLimiter struct {
 	redis *redis.Client
-	limit int
+	limit atomic.Int64 // 每个IP每分钟请求上限，配置重新加载时更新
 }
 
 func NewRateLimiter(redisClient *redis.Client, limit int) *RateLimiter {
-	return &RateLimiter{
-		redis: redisClient,
-		limit: limit,
-	}
+	rl := &RateLimiter{redis: redisClient}
+	rl.limit.Store(int64(limit))
+	return rl
+}
+
+// SetLimit 更新每个IP每分钟请求上限，下一个请求开始生效
+func (rl *RateLimiter) SetLimit(limit int) {
+	rl.limit.Store(int64(limit))
 }
 
 // RateLimit 限流中间件
 func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := fmt.Sprintf("rate_limit:%s", c.ClientIP())
+		limit := rl.limit.Load()
 
 		ctx := context.Background()
 
@@ -64,15 +71,15 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		count := results[2].(*redis.IntCmd).Val()
 
 		// 设置响应头
-		c.Header("X-RateLimit-Limit", strconv.Itoa(rl.limit))
-		c.Header("X-RateLimit-Remaining", strconv.FormatInt(int64(rl.limit)-count, 10))
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(limit-count, 10))
 		c.Header("X-RateLimit-Reset", strconv.FormatInt(now+window, 10))
 
-		if count > int64(rl.limit) {
+		if count > limit {
 			logrus.WithFields(logrus.Fields{
 				"client_ip": c.ClientIP(),
 				"count":     count,
-				"limit":     rl.limit,
+				"limit":     limit,
 				"path":      c.Request.URL.Path,
 			}).Warn("rate limit exceeded")
 			
@@ -88,3 +95,63 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// APIKeyRateLimit 按API Key配置的每分钟上限限流，需在认证之后使用
+func (rl *RateLimiter) APIKeyRateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := auth.FromContext(c.Request.Context())
+		if !ok || p.APIKeyID == 0 || p.RateLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		// 固定窗口计数，窗口按分钟对齐
+		now := time.Now().Unix()
+		window := int64(60)
+		windowStart := now - now%window
+		key := fmt.Sprintf("rate_limit:api_key:%d:%d", p.APIKeyID, windowStart)
+
+		ctx := context.Background()
+		pipe := rl.redis.Pipeline()
+		incr := pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, time.Duration(window)*time.Second)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logrus.WithError(err).WithField("api_key_id", p.APIKeyID).Error("api key rate limit check failed")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    "INTERNAL_ERROR",
+				"message": "Rate limit check failed",
+			})
+			c.Abort()
+			return
+		}
+
+		count := incr.Val()
+		remaining := int64(p.RateLimit) - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(p.RateLimit))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(windowStart+window, 10))
+
+		if count > int64(p.RateLimit) {
+			logrus.WithFields(logrus.Fields{
+				"api_key_id": p.APIKeyID,
+				"client_id":  p.ClientID,
+				"count":      count,
+				"limit":      p.RateLimit,
+				"path":       c.Request.URL.Path,
+			}).Warn("api key rate limit exceeded")
+
+			c.Header("Retry-After", strconv.FormatInt(windowStart+window-now, 10))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"code":    "RATE_LIMITED",
+				"message": "Too many requests",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
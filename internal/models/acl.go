@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// Permission 订阅权限，按 view < execute < edit < admin 逐级包含
+const (
+	PermView    = "view"    // 查看订阅定义
+	PermExecute = "execute" // 执行订阅
+	PermEdit    = "edit"    // 修改订阅、发布新版本
+	PermAdmin   = "admin"   // 删除订阅、管理ACL
+)
+
+// ACLSubjectType 授权对象类型
+const (
+	SubjectUser   = "user"   // 用户ID
+	SubjectRole   = "role"   // 角色名
+	SubjectClient = "client" // API客户端ID
+)
+
+// PermissionLevel 权限等级，未知权限为0
+func PermissionLevel(permission string) int {
+	switch permission {
+	case PermView:
+		return 1
+	case PermExecute:
+		return 2
+	case PermEdit:
+		return 3
+	case PermAdmin:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// SubscriptionACL 订阅访问控制，按 type+sub_key 授权，对所有版本生效
+type SubscriptionACL struct {
+	ID          uint64    `json:"id,string" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Type        string    `json:"type" gorm:"column:type;size:1;not null;default:'';index:idx_type_subkey"`
+	SubKey      string    `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:'';index:idx_type_subkey"`
+	SubjectType string    `json:"subject_type" gorm:"column:subject_type;size:20;not null"`
+	Subject     string    `json:"subject" gorm:"column:subject;size:120;not null"`
+	Permission  string    `json:"permission" gorm:"column:permission;size:20;not null"`
+	CreatedBy   uint64    `json:"created_by" gorm:"column:created_by;not null;default:0"`
+}
+
+func (SubscriptionACL) TableName() string {
+	return "sub_subscription_acl"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (a *SubscriptionACL) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == 0 {
+		a.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// ACLEntry 授权条目
+type ACLEntry struct {
+	SubjectType string `json:"subject_type" binding:"required,oneof=user role client"`
+	Subject     string `json:"subject" binding:"required,max=120"`
+	Permission  string `json:"permission" binding:"required,oneof=view execute edit admin"`
+}
+
+// SetACLRequest 整体替换订阅ACL
+type SetACLRequest struct {
+	Entries []ACLEntry `json:"entries" binding:"dive"`
+}
+
+// AccessFilter 列表查询的可见性过滤，nil 表示不限制
+type AccessFilter struct {
+	Subjects            map[string][]string // subject_type -> 调用方匹配的授权对象
+	IncludeUnrestricted bool                // 是否包含未配置ACL的订阅
+	SubKeys             []string            // 调用方作用域内的订阅key，空表示不限制
+}
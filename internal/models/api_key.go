@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// APIKey 机器调用方使用的API Key，只保存密钥的SHA-256摘要
+type APIKey struct {
+	ID          uint64          `json:"id,string" gorm:"primaryKey"`
+	CreatedAt   time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt   time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Name        string          `json:"name" gorm:"column:name;size:120;not null;default:''"`
+	ClientID    string          `json:"client_id" gorm:"column:client_id;size:120;not null;index:idx_client_id"` // 调用方标识，对应ACL中的 client 授权对象
+	Prefix      string          `json:"prefix" gorm:"column:prefix;size:20;not null"`                            // 密钥前缀，用于识别
+	KeyHash     string          `json:"-" gorm:"column:key_hash;size:64;not null;uniqueIndex:uk_key_hash"`       // 密钥SHA-256摘要
+	Roles       json.RawMessage `json:"roles" gorm:"column:roles;type:json"`                                     // 角色，参与ACL匹配
+	SubKeys     json.RawMessage `json:"sub_keys" gorm:"column:sub_keys;type:json"`                               // 允许访问的订阅key，空表示不限制
+	DataSources json.RawMessage `json:"data_sources" gorm:"column:data_sources;type:json"`                       // 允许使用的数据源，空表示不限制
+	RateLimit   int             `json:"rate_limit" gorm:"column:rate_limit;not null;default:0"`                  // 每分钟请求上限，0表示不单独限流
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty" gorm:"column:expires_at"`                           // 过期时间，为空表示不过期
+	RevokedAt   *time.Time      `json:"revoked_at,omitempty" gorm:"column:revoked_at"`                           // 吊销时间
+	LastUsedAt  *time.Time      `json:"last_used_at,omitempty" gorm:"column:last_used_at"`                       // 最近使用时间
+	CreatedBy   uint64          `json:"created_by" gorm:"column:created_by;not null;default:0"`
+}
+
+func (APIKey) TableName() string {
+	return "sub_api_key"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == 0 {
+		k.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// Active 密钥在指定时间是否可用
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+// APIKeyRequest 创建API Key请求
+type APIKeyRequest struct {
+	Name        string     `json:"name" binding:"required,max=120"`
+	ClientID    string     `json:"client_id" binding:"required,max=120"`
+	Roles       []string   `json:"roles"`
+	SubKeys     []string   `json:"sub_keys"`
+	DataSources []string   `json:"data_sources"`
+	RateLimit   int        `json:"rate_limit" binding:"min=0"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// IssuedAPIKey 新签发或轮换后的API Key，明文密钥只在此时返回一次
+type IssuedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// ImportStrategy 导入版本与库中同版本号的版本内容不同时的处理方式
+const (
+	ImportSkip       = "skip"        // 保留库中版本
+	ImportOverwrite  = "overwrite"   // 以导出包内容覆盖库中版本的 title、abstract、extra_config
+	ImportNewVersion = "new_version" // 导入为该key的下一个版本
+)
+
+// ImportAction 导入报告中每个版本的处理结果
+const (
+	ImportActionCreate     = "create"      // 库中没有该版本号，按原版本号创建
+	ImportActionOverwrite  = "overwrite"   // 覆盖库中版本
+	ImportActionNewVersion = "new_version" // 创建为新版本
+	ImportActionSkip       = "skip"        // 内容不同但按策略跳过
+	ImportActionUnchanged  = "unchanged"   // 内容相同，无需导入
+)
+
+// ImportRequest 导入参数
+type ImportRequest struct {
+	Strategy string `form:"strategy"` // 默认 skip
+	DryRun   bool   `form:"dry_run"`  // 只返回报告，不做修改
+	Force    bool   `form:"force"`    // 覆盖生效中版本时，输出结构不兼容仍然写入
+}
+
+// ImportItem 导入包中一个版本的处理结果
+type ImportItem struct {
+	Action        string           `json:"action"`
+	Type          string           `json:"type"`
+	SubKey        string           `json:"sub_key"`
+	Version       uint32           `json:"version"`          // 导出包中的版本号
+	TargetVersion uint32           `json:"target_version"`   // 库中的版本号，new_version 在 dry-run 时为预计分配的版本号
+	Status        string           `json:"status"`           // 导入后的状态
+	Fields        []FieldChange    `json:"fields,omitempty"` // 相对库中版本的 title、abstract 变化
+	ExtraConfig   *ExtraConfigDiff `json:"extra_config,omitempty"`
+}
+
+// ImportReport 导入报告，DryRun 为 false 时已在同一事务中执行
+type ImportReport struct {
+	DryRun     bool         `json:"dry_run"`
+	Strategy   string       `json:"strategy"`
+	Checksum   string       `json:"checksum"`
+	ExportedAt time.Time    `json:"exported_at"`
+	ExportedBy string       `json:"exported_by"`
+	Items      []ImportItem `json:"items"`
+	Warnings   []string     `json:"warnings,omitempty"` // 如数据源驱动与导出环境不同
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// 数据源状态
+const (
+	DataSourceEnabled  = "enabled"
+	DataSourceDisabled = "disabled"
+)
+
+// 数据源定义来源
+const (
+	DataSourceOriginConfig   = "config"   // 配置文件，只读
+	DataSourceOriginRegistry = "registry" // 库中登记，可通过接口维护
+)
+
+// DataSource 运行时登记的数据源，密码加密保存
+type DataSource struct {
+	ID                uint64          `json:"id,string" gorm:"primaryKey"`
+	CreatedAt         time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt         time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Name              string          `json:"name" gorm:"column:name;size:120;not null;uniqueIndex:uk_name"`
+	Driver            string          `json:"driver" gorm:"column:driver;size:20;not null;default:'mysql'"`
+	Host              string          `json:"host" gorm:"column:host;size:255;not null;default:''"`
+	Port              int             `json:"port" gorm:"column:port;not null;default:0"`
+	Database          string          `json:"database" gorm:"column:database;size:255;not null;default:''"`
+	Username          string          `json:"username" gorm:"column:username;size:120;not null;default:''"`
+	PasswordEncrypted string          `json:"-" gorm:"column:password_encrypted;type:text"` // 加密后的密码
+	MaxIdleConns      int             `json:"max_idle_conns" gorm:"column:max_idle_conns;not null;default:0"`
+	MaxOpenConns      int             `json:"max_open_conns" gorm:"column:max_open_conns;not null;default:0"`
+	ConnMaxLifetime   int             `json:"conn_max_lifetime" gorm:"column:conn_max_lifetime;not null;default:0"` // 连接最长存活秒数，0表示不限制
+	AllowedTables     json.RawMessage `json:"allowed_tables" gorm:"column:allowed_tables;type:json"`
+	DeniedTables      json.RawMessage `json:"denied_tables" gorm:"column:denied_tables;type:json"`
+	Guardrails        json.RawMessage `json:"guardrails" gorm:"column:guardrails;type:json"` // 查询成本护栏，结构同配置文件
+	Replicas          json.RawMessage `json:"replicas" gorm:"column:replicas;type:json"`     // 熔断或不可用时按顺序切换的备用数据源
+	Status            string          `json:"status" gorm:"column:status;size:20;not null;default:'enabled'"`
+	CreatedBy         uint64          `json:"created_by" gorm:"column:created_by;not null;default:0"`
+	UpdatedBy         uint64          `json:"updated_by" gorm:"column:updated_by;not null;default:0"`
+}
+
+func (DataSource) TableName() string {
+	return "sub_data_source"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (d *DataSource) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == 0 {
+		d.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// DataSourceGuardrails 库中保存的查询成本护栏
+type DataSourceGuardrails struct {
+	MaxEstimatedRows int64    `json:"max_estimated_rows,omitempty"`
+	NoFullScanTables []string `json:"no_full_scan_tables,omitempty"`
+}
+
+// DataSourceRequest 创建或更新数据源请求，更新时名称不可修改，密码为空表示保留原密码
+// SQLite 数据源只需要 database（文件路径），其他驱动需要 host 和 port
+type DataSourceRequest struct {
+	Name            string                `json:"name" binding:"max=120"`
+	Driver          string                `json:"driver" binding:"omitempty,max=20"`
+	Host            string                `json:"host" binding:"max=255"`
+	Port            int                   `json:"port" binding:"omitempty,min=1,max=65535"`
+	Database        string                `json:"database" binding:"max=255"`
+	Username        string                `json:"username" binding:"max=120"`
+	Password        string                `json:"password"`
+	MaxIdleConns    int                   `json:"max_idle_conns" binding:"min=0"`
+	MaxOpenConns    int                   `json:"max_open_conns" binding:"min=0"`
+	ConnMaxLifetime int                   `json:"conn_max_lifetime" binding:"min=0"`
+	AllowedTables   []string              `json:"allowed_tables"`
+	DeniedTables    []string              `json:"denied_tables"`
+	Guardrails      *DataSourceGuardrails `json:"guardrails"`
+	Replicas        []string              `json:"replicas"`
+}
+
+// DataSourceView 数据源对外展示，不包含密码
+type DataSourceView struct {
+	*DataSource
+	Origin      string            `json:"origin"`       // config 或 registry
+	HasPassword bool              `json:"has_password"` // 是否已设置密码
+	Health      *DataSourceHealth `json:"health,omitempty"`
+}
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"    // 正常放行
+	CircuitHalfOpen = "half_open" // 放行一次探测，成功后恢复
+	CircuitOpen     = "open"      // 直接失败
+)
+
+// DataSourceHealth 数据源健康状态
+type DataSourceHealth struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LatencyMs           int64      `json:"latency_ms"` // 最近 ping 和查询延迟的滑动平均
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	LastCheckAt         *time.Time `json:"last_check_at,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	Replicas            []string   `json:"replicas,omitempty"`
+}
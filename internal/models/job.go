@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// JobStatus 异步执行任务状态
+const (
+	JobStatusPending   = "pending"   // 排队中
+	JobStatusRunning   = "running"   // 执行中
+	JobStatusSucceeded = "succeeded" // 执行成功
+	JobStatusFailed    = "failed"    // 执行失败
+	JobStatusCanceled  = "canceled"  // 已取消
+)
+
+// ExecutionJob 异步执行任务
+type ExecutionJob struct {
+	ID          uint64          `json:"id,string" gorm:"primaryKey"` // 以字符串返回，避免前端大整数精度丢失
+	CreatedAt   time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt   time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Type        string          `json:"type" gorm:"column:type;size:1;not null;default:''"`
+	SubKey      string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:'';index:idx_sub_key"`
+	Version     uint32          `json:"version" gorm:"column:version;not null;default:1"`
+	DataSource  string          `json:"data_source" gorm:"column:data_source;size:120;not null;default:''"`
+	Status      string          `json:"status" gorm:"column:status;size:20;not null;default:'';index:idx_status"`
+	Params      json.RawMessage `json:"params" gorm:"column:params;type:json"`                                           // 执行参数
+	RowCount    int64           `json:"row_count" gorm:"column:row_count;not null;default:0"`                            // 结果行数
+	ErrorMsg    string          `json:"error_msg,omitempty" gorm:"column:error_msg;type:text"`                           // 失败原因
+	RequestIP   string          `json:"request_ip" gorm:"column:request_ip;size:45;not null"`                            // 请求来源IP
+	Instance    string          `json:"instance" gorm:"column:instance;size:120;not null;default:'';index:idx_instance"` // 执行任务的实例
+	HeartbeatAt *time.Time      `json:"heartbeat_at,omitempty" gorm:"column:heartbeat_at;index:idx_heartbeat_at"`        // 实例最近一次确认仍持有该任务的时间
+	StartedAt   *time.Time      `json:"started_at,omitempty" gorm:"column:started_at"`                                   // 开始执行时间
+	FinishedAt  *time.Time      `json:"finished_at,omitempty" gorm:"column:finished_at"`                                 // 结束时间
+}
+
+func (ExecutionJob) TableName() string {
+	return "sub_execution_job"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (j *ExecutionJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == 0 {
+		j.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// Finished 任务是否已结束
+func (j *ExecutionJob) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCanceled
+}
+
+// JobResultsRequest 任务结果分页请求
+type JobResultsRequest struct {
+	Offset int64 `form:"offset" binding:"min=0"`
+	Limit  int64 `form:"limit" binding:"min=0,max=10000"` // 默认1000
+}
+
+// JobResultPage 任务结果分页
+type JobResultPage struct {
+	Columns []string                 `json:"columns"` // 列顺序与SQL结果一致
+	Rows    []map[string]interface{} `json:"rows"`
+	Total   int64                    `json:"total"`
+	Offset  int64                    `json:"offset"`
+	Limit   int64                    `json:"limit"`
+}
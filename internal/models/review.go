@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// ReviewStatus 审核状态
+const (
+	ReviewPending    = "pending"    // 待审核
+	ReviewApproved   = "approved"   // 已通过
+	ReviewRejected   = "rejected"   // 已驳回
+	ReviewSuperseded = "superseded" // 同一版本重新提交后被替代
+)
+
+// SubscriptionReview 订阅版本上线审核，审核人必须与提交人不同
+// ContentHash 为提交时 extra_config 的摘要，内容变化后审核结论失效
+type SubscriptionReview struct {
+	ID              uint64     `json:"id,string" gorm:"primaryKey"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt       time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Type            string     `json:"type" gorm:"column:type;size:1;not null;default:'';index:idx_version"`
+	SubKey          string     `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:'';index:idx_version"`
+	Version         uint32     `json:"version" gorm:"column:version;not null;default:1;index:idx_version"`
+	ContentHash     string     `json:"content_hash" gorm:"column:content_hash;size:64;not null;default:''"`
+	Status          string     `json:"status" gorm:"column:status;size:20;not null;default:'';index:idx_status"`
+	Comment         string     `json:"comment" gorm:"column:comment;type:text"` // 提交说明
+	SubmittedBy     uint64     `json:"submitted_by" gorm:"column:submitted_by;not null;default:0"`
+	SubmittedByName string     `json:"submitted_by_name" gorm:"column:submitted_by_name;size:120;not null;default:''"`
+	ReviewComment   string     `json:"review_comment" gorm:"column:review_comment;type:text"` // 审核意见
+	ReviewedBy      uint64     `json:"reviewed_by" gorm:"column:reviewed_by;not null;default:0"`
+	ReviewedByName  string     `json:"reviewed_by_name" gorm:"column:reviewed_by_name;size:120;not null;default:''"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty" gorm:"column:reviewed_at"`
+}
+
+func (SubscriptionReview) TableName() string {
+	return "sub_subscription_review"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (r *SubscriptionReview) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == 0 {
+		r.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// ReviewView 审核详情，附带待审核内容相对当前生效版本的差异
+type ReviewView struct {
+	*SubscriptionReview
+	ActiveVersion uint32        `json:"active_version,omitempty"` // 当前生效版本，没有生效版本时为空
+	Outdated      bool          `json:"outdated"`                 // 提交后版本内容已被修改
+	Diff          *RevisionDiff `json:"diff,omitempty"`
+}
+
+// SubmitReviewRequest 提交审核
+type SubmitReviewRequest struct {
+	Comment string `json:"comment" binding:"max=2000"`
+}
+
+// ReviewDecisionRequest 审核通过或驳回，驳回时必须填写意见
+type ReviewDecisionRequest struct {
+	Comment string `json:"comment" binding:"max=2000"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// RevisionAction 修订产生的原因
+const (
+	RevisionBaseline = "baseline" // 首次修改前补记的原始内容
+	RevisionCreate   = "create"   // 创建版本
+	RevisionFork     = "fork"     // 由已有版本派生
+	RevisionUpdate   = "update"   // 修改内容
+	RevisionStatus   = "status"   // 状态迁移
+	RevisionExpire   = "expire"   // 高版本强制兼容时被动失效
+	RevisionRollback = "rollback" // 回滚到历史修订
+	RevisionDelete   = "delete"   // 删除版本
+	RevisionSync     = "sync"     // 按定义目录声明式同步
+	RevisionImport   = "import"   // 由导出包导入
+)
+
+// RevisionMeta 一次变更的操作类型和操作人
+type RevisionMeta struct {
+	Action        string
+	ChangedBy     uint64
+	ChangedByName string
+}
+
+// SubscriptionRevision 订阅版本的不可变修订，每次写入订阅行时保存变更后的完整内容
+type SubscriptionRevision struct {
+	ID             uint64          `json:"id,string" gorm:"primaryKey"`
+	CreatedAt      time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	SubscriptionID uint64          `json:"subscription_id,string" gorm:"column:subscription_id;not null;default:0"`
+	Type           string          `json:"type" gorm:"column:type;size:1;not null;default:'';uniqueIndex:uk_version_revision"`
+	SubKey         string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:'';uniqueIndex:uk_version_revision"`
+	Version        uint32          `json:"version" gorm:"column:version;not null;default:1;uniqueIndex:uk_version_revision"`
+	Revision       uint32          `json:"revision" gorm:"column:revision;not null;default:1;uniqueIndex:uk_version_revision"`
+	Action         string          `json:"action" gorm:"column:action;size:20;not null;default:''"`
+	Title          string          `json:"title" gorm:"column:title;size:240;not null"`
+	Abstract       string          `json:"abstract" gorm:"column:abstract;type:tinytext;not null"`
+	Status         string          `json:"status" gorm:"column:status;size:1;not null;default:''"`
+	ExtraConfig    json.RawMessage `json:"extra_config" gorm:"column:extra_config;type:json;not null"`
+	ChangedBy      uint64          `json:"changed_by" gorm:"column:changed_by;not null;default:0"`
+	ChangedByName  string          `json:"changed_by_name" gorm:"column:changed_by_name;size:120;not null;default:''"`
+}
+
+func (SubscriptionRevision) TableName() string {
+	return "sub_subscription_revision"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (r *SubscriptionRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == 0 {
+		r.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// NewSubscriptionRevision 以订阅当前内容生成修订，修订号由仓储分配
+func NewSubscriptionRevision(subscription *Subscription, meta RevisionMeta) *SubscriptionRevision {
+	return &SubscriptionRevision{
+		SubscriptionID: subscription.ID,
+		Type:           subscription.Type,
+		SubKey:         subscription.SubKey,
+		Version:        subscription.Version,
+		Action:         meta.Action,
+		Title:          subscription.Title,
+		Abstract:       subscription.Abstract,
+		Status:         subscription.Status,
+		ExtraConfig:    subscription.ExtraConfig,
+		ChangedBy:      meta.ChangedBy,
+		ChangedByName:  meta.ChangedByName,
+	}
+}
+
+// FieldChange 字段变更
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// DiffLine SQL文本差异行，Op 为 equal/insert/delete
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// ExtraConfigDiff extra_config 的结构化差异
+type ExtraConfigDiff struct {
+	SQL              []DiffLine    `json:"sql,omitempty"`               // SQL逐行差异，SQL未变化时为空
+	AddedVariables   []string      `json:"added_variables,omitempty"`   // 新增的 sql_replace 变量
+	RemovedVariables []string      `json:"removed_variables,omitempty"` // 删除的 sql_replace 变量
+	ChangedVariables []string      `json:"changed_variables,omitempty"` // 定义发生变化的变量
+	Fields           []FieldChange `json:"fields,omitempty"`            // example、db_source、cache_ttl 等其他配置
+}
+
+// RevisionDiff 修订相对上一修订的差异，首个修订没有差异
+type RevisionDiff struct {
+	Fields      []FieldChange    `json:"fields,omitempty"` // title、abstract、status
+	ExtraConfig *ExtraConfigDiff `json:"extra_config,omitempty"`
+}
+
+// RevisionView 修订及其差异
+type RevisionView struct {
+	*SubscriptionRevision
+	Diff *RevisionDiff `json:"diff,omitempty"`
+}
+
+// RollbackRequest 回滚到指定修订
+type RollbackRequest struct {
+	Revision uint32 `json:"revision" binding:"required,min=1"`
+	Force    bool   `json:"force"` // 恢复后的输出结构与生效内容不兼容时仍然回滚
+}
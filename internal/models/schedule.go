@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"gorm.io/gorm"
+)
+
+// DeliveryTargetType 定时投递目标类型
+const (
+	TargetWebhook = "webhook" // HTTP回调，POST JSON
+	TargetEmail   = "email"   // SMTP邮件，结果作为CSV附件
+	TargetFile    = "file"    // 写入配置目录下的CSV文件
+)
+
+// ScheduleRunStatus 定时执行记录状态
+const (
+	RunStatusRunning   = "running"   // 执行中
+	RunStatusSucceeded = "succeeded" // 成功
+	RunStatusFailed    = "failed"    // 重试后仍失败
+)
+
+// DeliveryTarget 投递目标
+type DeliveryTarget struct {
+	Type     string            `json:"type" binding:"required,oneof=webhook email file"`
+	URL      string            `json:"url,omitempty"`       // webhook 地址
+	Headers  map[string]string `json:"headers,omitempty"`   // webhook 附加请求头
+	To       []string          `json:"to,omitempty"`        // 邮件收件人
+	Subject  string            `json:"subject,omitempty"`   // 邮件主题，默认使用订阅标题
+	FileName string            `json:"file_name,omitempty"` // 文件名模板，支持 {sub_key} {date} {time}，默认 {sub_key}_{date}_{time}.csv
+}
+
+// SubscriptionSchedule 订阅定时投递计划，按 type+sub_key 关联，执行时使用生效中的最高版本
+type SubscriptionSchedule struct {
+	ID         uint64          `json:"id,string" gorm:"primaryKey"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt  time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Type       string          `json:"type" gorm:"column:type;size:1;not null;default:''"`
+	SubKey     string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:'';index:idx_sub_key"`
+	Name       string          `json:"name" gorm:"column:name;size:120;not null;default:''"`
+	CronExpr   string          `json:"cron_expr" gorm:"column:cron_expr;size:120;not null"`         // 标准5段cron表达式
+	Timezone   string          `json:"timezone" gorm:"column:timezone;size:64;not null;default:''"` // IANA时区，默认服务器时区
+	Variables  json.RawMessage `json:"variables" gorm:"column:variables;type:json"`                 // 固定的执行变量
+	DataSource string          `json:"data_source" gorm:"column:data_source;size:120;not null;default:''"`
+	Target     json.RawMessage `json:"target" gorm:"column:target;type:json;not null"` // 投递目标
+	Enabled    bool            `json:"enabled" gorm:"column:enabled;not null;default:true"`
+	NextRunAt  *time.Time      `json:"next_run_at,omitempty" gorm:"column:next_run_at;index:idx_next_run_at"` // 下次触发时间
+	LastRunAt  *time.Time      `json:"last_run_at,omitempty" gorm:"column:last_run_at"`                       // 上次触发时间
+	CreatedBy  uint64          `json:"created_by" gorm:"column:created_by;not null;default:0"`
+	RunAs      json.RawMessage `json:"-" gorm:"column:run_as;type:json"` // 触发时使用的身份，为最后保存计划的调用方
+}
+
+func (SubscriptionSchedule) TableName() string {
+	return "sub_subscription_schedule"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (s *SubscriptionSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == 0 {
+		s.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// ScheduleRun 定时执行记录，每次触发一条，重试次数记录在 attempts 中
+type ScheduleRun struct {
+	ID          uint64     `json:"id,string" gorm:"primaryKey"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt   time.Time  `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	ScheduleID  uint64     `json:"schedule_id,string" gorm:"column:schedule_id;not null;index:idx_schedule_id"`
+	SubKey      string     `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:''"`
+	Version     uint32     `json:"version" gorm:"column:version;not null;default:0"` // 实际执行的版本
+	Status      string     `json:"status" gorm:"column:status;size:20;not null;default:''"`
+	Attempts    int        `json:"attempts" gorm:"column:attempts;not null;default:0"` // 已尝试次数
+	RowCount    int64      `json:"row_count" gorm:"column:row_count;not null;default:0"`
+	ErrorMsg    string     `json:"error_msg,omitempty" gorm:"column:error_msg;type:text"` // 最后一次失败原因
+	ScheduledAt time.Time  `json:"scheduled_at" gorm:"column:scheduled_at;not null"`      // 计划触发时间
+	FinishedAt  *time.Time `json:"finished_at,omitempty" gorm:"column:finished_at"`
+}
+
+func (ScheduleRun) TableName() string {
+	return "sub_schedule_run"
+}
+
+// BeforeCreate GORM钩子，创建前生成分布式ID
+func (r *ScheduleRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == 0 {
+		r.ID = uint64(utils.GenerateID())
+	}
+	return nil
+}
+
+// ScheduleRequest 创建/更新定时投递请求
+type ScheduleRequest struct {
+	Name       string                 `json:"name" binding:"required,max=120"`
+	CronExpr   string                 `json:"cron_expr" binding:"required"`
+	Timezone   string                 `json:"timezone"`
+	Variables  map[string]interface{} `json:"variables"`
+	DataSource string                 `json:"data_source"`
+	Target     DeliveryTarget         `json:"target" binding:"required"`
+	Enabled    *bool                  `json:"enabled"` // 默认启用
+}
+
+// ScheduleRunsRequest 执行记录查询请求
+type ScheduleRunsRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
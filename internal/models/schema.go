@@ -0,0 +1,50 @@
+package models
+
+// 输出列的逻辑类型
+const (
+	ColumnString   = "string"
+	ColumnInteger  = "integer"
+	ColumnNumber   = "number"
+	ColumnBoolean  = "boolean"
+	ColumnDate     = "date"
+	ColumnDatetime = "datetime"
+	ColumnJSON     = "json"
+)
+
+// 输出结构校验模式
+const (
+	SchemaModeWarn   = "warn"   // 不一致时记录告警并在响应中返回（默认）
+	SchemaModeStrict = "strict" // 不一致时执行失败
+)
+
+// 输出结构变化类型
+const (
+	SchemaColumnRemoved  = "column_removed"  // 删除列（不兼容）
+	SchemaColumnAdded    = "column_added"    // 新增列
+	SchemaTypeWidened    = "type_widened"    // 类型放宽，如 integer -> number
+	SchemaTypeNarrowed   = "type_narrowed"   // 类型收窄，如 number -> integer（不兼容）
+	SchemaTypeChanged    = "type_changed"    // 类型变为不相关的类型（不兼容）
+	SchemaBecameNullable = "became_nullable" // 非空列变为可空（不兼容）
+)
+
+// OutputSchema 订阅声明的输出结构
+type OutputSchema struct {
+	Mode    string         `json:"mode,omitempty"` // warn 或 strict，默认 warn
+	Columns []SchemaColumn `json:"columns"`
+}
+
+// SchemaColumn 输出列定义
+type SchemaColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`               // 逻辑类型，见 Column* 常量
+	Nullable bool   `json:"nullable,omitempty"` // 是否允许为空
+}
+
+// SchemaChange 两个版本之间输出结构的变化
+type SchemaChange struct {
+	Column   string `json:"column"`
+	Kind     string `json:"kind"`
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Breaking bool   `json:"breaking"`
+}
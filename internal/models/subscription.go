@@ -16,31 +16,113 @@ const (
 	StatusExpired               = "D" // 已失效
 )
 
+// ServingStatuses 生效中的状态，未指定版本时取其中版本最高者
+var ServingStatuses = []string{StatusActive, StatusActiveForceCompatible}
+
+// statusTransitions 允许的状态迁移；迁移到 B/C 前需试执行SQL，迁移到 C 时低版本失效
+var statusTransitions = map[string][]string{
+	StatusPending:               {StatusActive, StatusActiveForceCompatible, StatusExpired},
+	StatusActive:                {StatusActiveForceCompatible, StatusExpired},
+	StatusActiveForceCompatible: {StatusExpired},
+	StatusExpired:               {StatusActive, StatusActiveForceCompatible},
+}
+
+// CanTransition 是否允许从 from 迁移到 to
+func CanTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidStatus 是否为已定义的状态
+func IsValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// IsServingStatus 状态是否为生效中
+func IsServingStatus(status string) bool {
+	return status == StatusActive || status == StatusActiveForceCompatible
+}
+
 // SubscriptionType 订阅类型
 const (
 	TypeAnalysisData = "A" // 分析数据
 )
 
+// VariableType SQL替换变量类型
+const (
+	VarTypeInt      = "int"      // 整数
+	VarTypeDecimal  = "decimal"  // 小数
+	VarTypeDate     = "date"     // 日期 2006-01-02
+	VarTypeDatetime = "datetime" // 日期时间 2006-01-02 15:04:05
+	VarTypeString   = "string"   // 字符串
+	VarTypeEnum     = "enum"     // 枚举，取值必须在 options 中
+	VarTypeList     = "list"     // 列表，用于 IN (...)
+)
+
+// VariableSpec SQL替换变量定义
+// 兼容旧格式：sql_replace 的值为字符串时视为变量说明，类型按传入值推断
+type VariableSpec struct {
+	Type        string      `json:"type,omitempty"`        // 变量类型
+	Description string      `json:"description,omitempty"` // 变量说明
+	Default     interface{} `json:"default,omitempty"`     // 默认值，未传入变量时使用
+	Options     []string    `json:"options,omitempty"`     // enum 可选值
+	ItemType    string      `json:"item_type,omitempty"`   // list 元素类型，默认 string
+	MaxItems    int         `json:"max_items,omitempty"`   // list 最大元素个数
+}
+
+// UnmarshalJSON 支持字符串（旧格式）和对象两种写法
+func (v *VariableSpec) UnmarshalJSON(data []byte) error {
+	var description string
+	if err := json.Unmarshal(data, &description); err == nil {
+		*v = VariableSpec{Description: description}
+		return nil
+	}
+
+	type alias VariableSpec
+	var spec alias
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+	*v = VariableSpec(spec)
+	return nil
+}
+
 // ExtraConfig 扩展配置
 type ExtraConfig struct {
-	SQLContent string            `json:"sql_content"` // 订阅数据SQL
-	SQLReplace map[string]string `json:"sql_replace"` // SQL替换变量说明
-	Example    string            `json:"example"`     // 示例说明
+	SQLContent string                  `json:"sql_content"`         // 订阅数据SQL
+	SQLReplace map[string]VariableSpec `json:"sql_replace"`         // SQL替换变量定义
+	Example    string                  `json:"example"`             // 示例说明
+	DBSource   string                  `json:"db_source,omitempty"` // 默认数据源，执行请求未指定数据源时使用，为空表示 default
+	CacheTTL   int                     `json:"cache_ttl,omitempty"` // 结果缓存时间（秒），0 表示不缓存
+
+	AllowedDataSources []string `json:"allowed_data_sources,omitempty"` // 允许执行的数据源，为空表示只允许默认数据源；primary 须显式列出
+
+	MaxRows          int      `json:"max_rows,omitempty"`           // 单次响应最多行数，不能放宽全局限制
+	MaxResponseBytes int64    `json:"max_response_bytes,omitempty"` // 单次响应结果的最大字节数，不能放宽全局限制
+	PageKeys         []string `json:"page_keys,omitempty"`          // 游标分页的排序键列，组合后须唯一
+
+	OutputSchema *OutputSchema `json:"output_schema,omitempty"` // 声明的输出结构，用于执行结果校验和版本间兼容性检查
 }
 
 // Subscription 订阅模型
 type Subscription struct {
-	ID          uint64          `json:"id" gorm:"primaryKey"`
-	CreatedAt   time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
-	UpdatedAt   time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
-	Type        string          `json:"type" gorm:"column:type;size:1;not null;default:''"`
-	SubKey      string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:''"`
-	Version     uint8           `json:"version" gorm:"column:version;not null;default:1"`
-	Title       string          `json:"title" gorm:"column:title;size:240;not null"`
-	Abstract    string          `json:"abstract" gorm:"column:abstract;type:tinytext;not null"`
-	Status      string          `json:"status" gorm:"column:status;size:1;not null;default:''"`
-	CreatedBy   uint64          `json:"created_by" gorm:"column:created_by;not null;default:0"`
-	ExtraConfig json.RawMessage `json:"extra_config" gorm:"column:extra_config;type:json;not null"`
+	ID            uint64          `json:"id" gorm:"primaryKey"`
+	CreatedAt     time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
+	UpdatedAt     time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
+	Type          string          `json:"type" gorm:"column:type;size:1;not null;default:''"`
+	SubKey        string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:''"`
+	Version       uint32          `json:"version" gorm:"column:version;not null;default:1"`
+	Title         string          `json:"title" gorm:"column:title;size:240;not null"`
+	Abstract      string          `json:"abstract" gorm:"column:abstract;type:tinytext;not null"`
+	Status        string          `json:"status" gorm:"column:status;size:1;not null;default:''"`
+	CreatedBy     uint64          `json:"created_by" gorm:"column:created_by;not null;default:0"`
+	ExtraConfig   json.RawMessage `json:"extra_config" gorm:"column:extra_config;type:json;not null"`
+	ParentVersion uint32          `json:"parent_version,omitempty" gorm:"column:parent_version;not null;default:0"` // 派生来源版本，0 表示直接创建
 }
 
 func (Subscription) TableName() string {
@@ -61,7 +143,9 @@ type RequestResponse struct {
 	InstanceSQL    string      `json:"instance_sql"`    // 执行实例SQL
 	InstanceSource string      `json:"instance_source"` // 实例来源
 	RequestIP      string      `json:"request_ip"`      // 请求来源IP
-	Version        uint8       `json:"version"`         // 版本号
+	Version        uint32      `json:"version"`         // 版本号
+	RowCount       int64       `json:"row_count"`       // 返回行数
+	CacheHit       bool        `json:"cache_hit"`       // 是否命中结果缓存
 }
 
 // SubscriptionStats 订阅统计模型
@@ -70,7 +154,7 @@ type SubscriptionStats struct {
 	CreatedAt         time.Time       `json:"created_at" gorm:"column:created_at;autoCreateTime"`
 	UpdatedAt         time.Time       `json:"updated_at" gorm:"column:updated_at;autoUpdateTime"`
 	SubKey            string          `json:"sub_key" gorm:"column:sub_key;size:120;not null;default:''"`
-	Version           uint8           `json:"version" gorm:"column:version;not null;default:1"`
+	Version           uint32          `json:"version" gorm:"column:version;not null;default:1"`
 	ExecutionDuration uint32          `json:"execution_duration" gorm:"column:execution_duration;not null;default:0"` // 毫秒
 	RequestURL        string          `json:"request_url" gorm:"column:request_url;size:1000;not null;default:''"`
 	RequestResponse   json.RawMessage `json:"request_response" gorm:"column:request_response;type:json;not null"`
@@ -93,11 +177,12 @@ func (s *SubscriptionStats) BeforeCreate(tx *gorm.DB) error {
 type CreateSubscriptionRequest struct {
 	Type        string          `json:"type" binding:"required,len=1"`
 	SubKey      string          `json:"sub_key" binding:"required"`
-	Version     uint8           `json:"version" binding:"required,min=1"`
+	Version     uint32          `json:"version"` // 为空时自动分配下一个版本号
 	Title       string          `json:"title" binding:"required"`
 	Abstract    string          `json:"abstract" binding:"required"`
 	Status      string          `json:"status" binding:"required,len=1"`
 	ExtraConfig json.RawMessage `json:"extra_config" binding:"required"`
+	Force       bool            `json:"force"` // 输出结构与生效版本不兼容时仍然激活
 }
 
 // UpdateSubscriptionRequest 更新订阅请求
@@ -106,18 +191,37 @@ type UpdateSubscriptionRequest struct {
 	Abstract    string          `json:"abstract"`
 	Status      string          `json:"status" binding:"omitempty,len=1"`
 	ExtraConfig json.RawMessage `json:"extra_config"`
+	Force       bool            `json:"force"` // 输出结构与生效版本不兼容时仍然激活
+}
+
+// ForkSubscriptionRequest 由已有版本派生新版本，未填写的字段沿用来源版本
+type ForkSubscriptionRequest struct {
+	Title       string          `json:"title"`
+	Abstract    string          `json:"abstract"`
+	ExtraConfig json.RawMessage `json:"extra_config"`
 }
 
 // UpdateStatusRequest 更新状态请求
 type UpdateStatusRequest struct {
 	Status string `json:"status" binding:"required,len=1"`
+	Force  bool   `json:"force"` // 输出结构与生效版本不兼容时仍然激活
 }
 
+// ResultFormat 执行结果输出格式
+const (
+	FormatJSON   = "json"   // 标准JSON响应
+	FormatNDJSON = "ndjson" // 每行一个JSON对象，流式输出
+	FormatCSV    = "csv"    // CSV，流式输出
+)
+
 // ExecuteSubscriptionRequest 执行订阅请求
 type ExecuteSubscriptionRequest struct {
 	Variables  map[string]interface{} `json:"variables"`
-	Timeout    int                    `json:"timeout"`     // 毫秒，默认120000
-	DataSource string                 `json:"data_source"` // 数据源名称，默认default
+	Timeout    int                    `json:"timeout"`                                          // 毫秒，默认120000
+	DataSource string                 `json:"data_source"`                                      // 数据源名称，须在订阅的 allowed_data_sources 中，默认为订阅的 db_source
+	Format     string                 `json:"format" binding:"omitempty,oneof=json ndjson csv"` // 输出格式，为空时按 Accept 头选择
+	PageSize   int                    `json:"page_size" binding:"omitempty,min=1"`              // 分页大小，设置后按 page_keys 游标分页
+	Cursor     string                 `json:"cursor"`                                           // 上一页返回的 next_cursor
 }
 
 // StatsQueryRequest 统计查询请求
@@ -131,7 +235,7 @@ type StatsQueryRequest struct {
 // StatsResponse 统计响应
 type StatsResponse struct {
 	SubKey           string  `json:"sub_key"`
-	Version          uint8   `json:"version"`
+	Version          uint32  `json:"version"`
 	CallCount        int64   `json:"call_count"`
 	AvgExecutionTime float64 `json:"avg_execution_time"`
 	MinExecutionTime uint32  `json:"min_execution_time"`
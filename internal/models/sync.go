@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// SyncAction 声明式同步计划中的变更类型
+const (
+	SyncCreate = "create" // 创建定义中新增的版本
+	SyncUpdate = "update" // 修改 title、abstract、extra_config
+	SyncStatus = "status" // 变更状态
+	SyncPrune  = "prune"  // 删除定义中不存在的版本
+)
+
+// SyncRequest 按定义目录同步订阅
+type SyncRequest struct {
+	Apply bool `json:"apply"` // false 时只返回计划（dry-run）
+	Prune bool `json:"prune"` // 删除定义中不存在的版本，未开启时这些版本列为 unmanaged
+	Force bool `json:"force"` // 输出结构与生效版本不兼容时仍然激活
+}
+
+// SyncChange 计划中的一项变更
+type SyncChange struct {
+	Action      string           `json:"action"`
+	Type        string           `json:"type"`
+	SubKey      string           `json:"sub_key"`
+	Version     uint32           `json:"version"`
+	Fields      []FieldChange    `json:"fields,omitempty"` // title、abstract、status
+	ExtraConfig *ExtraConfigDiff `json:"extra_config,omitempty"`
+	Drift       bool             `json:"drift,omitempty"` // 覆盖上次同步后在界面或接口中做的修改
+}
+
+// SyncDrift 上次同步后被带外修改的版本
+type SyncDrift struct {
+	Type      string    `json:"type"`
+	SubKey    string    `json:"sub_key"`
+	Version   uint32    `json:"version"`
+	Revision  uint32    `json:"revision"` // 最新修订号
+	Action    string    `json:"action"`   // 最新修订的操作类型
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+	Deleted   bool      `json:"deleted,omitempty"` // 版本已被删除
+}
+
+// SyncVersionRef 订阅版本
+type SyncVersionRef struct {
+	Type    string `json:"type"`
+	SubKey  string `json:"sub_key"`
+	Version uint32 `json:"version"`
+	Status  string `json:"status"`
+}
+
+// SyncPlan 同步计划，Applied 为 true 时已在同一事务中执行
+type SyncPlan struct {
+	Changes   []SyncChange     `json:"changes"`
+	Drift     []SyncDrift      `json:"drift,omitempty"`
+	Unmanaged []SyncVersionRef `json:"unmanaged,omitempty"` // 库中存在但定义中没有的版本（未开启 prune）
+	Applied   bool             `json:"applied"`
+}
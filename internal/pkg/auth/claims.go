@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims 解析后的JWT声明，业务声明统一转换为确定的类型
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID   uint64   // user_id，兼容数字和字符串
+	Username string   // username
+	ClientID string   // client_id，存在时调用方为API客户端
+	Roles    []string // roles，兼容数组和逗号分隔字符串
+
+	present map[string]bool
+}
+
+// Has 声明是否存在于token中
+func (c *Claims) Has(name string) bool {
+	return c.present[name]
+}
+
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &c.RegisteredClaims); err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	c.present = make(map[string]bool, len(raw))
+	for name, value := range raw {
+		if string(value) != "null" {
+			c.present[name] = true
+		}
+	}
+
+	c.UserID = rawUint64(raw["user_id"])
+	c.Username = rawString(raw["username"])
+	c.ClientID = rawString(raw["client_id"])
+	c.Roles = rawStrings(raw["roles"])
+	return nil
+}
+
+func rawString(data json.RawMessage) string {
+	var s string
+	if len(data) > 0 && json.Unmarshal(data, &s) == nil {
+		return s
+	}
+	return ""
+}
+
+func rawUint64(data json.RawMessage) uint64 {
+	if len(data) == 0 {
+		return 0
+	}
+	// 数字直接解析，避免经 float64 丢失雪花ID精度
+	if id, err := strconv.ParseUint(string(data), 10, 64); err == nil {
+		return id
+	}
+	id, _ := strconv.ParseUint(rawString(data), 10, 64)
+	return id
+}
+
+// rawStrings 支持数组和逗号分隔字符串两种写法
+func rawStrings(data json.RawMessage) []string {
+	var items []string
+	if len(data) == 0 || json.Unmarshal(data, &items) != nil {
+		items = strings.Split(rawString(data), ",")
+	}
+
+	var result []string
+	for _, item := range items {
+		if s := strings.TrimSpace(item); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTOptions JWT校验选项
+type JWTOptions struct {
+	Secret         string        // HMAC密钥，仅在未配置JWKS时使用
+	JWKSFile       string        // JWKS文件路径
+	JWKSURL        string        // JWKS地址
+	JWKSRefresh    time.Duration // JWKS刷新间隔，默认5分钟
+	Algorithms     []string      // 允许的签名算法，默认 HMAC 为 HS256，JWKS 为 RS256/ES256
+	Issuer         string        // 期望的 iss，为空不校验
+	Audience       string        // 期望的 aud，为空不校验
+	ClockSkew      time.Duration // exp/nbf/iat 的时钟偏差容忍
+	RequiredClaims []string      // 必须存在的声明
+}
+
+// JWTVerifier 校验JWT签名和声明
+type JWTVerifier struct {
+	parser   *jwt.Parser
+	secret   []byte
+	keys     *KeySet
+	required []string
+}
+
+// NewJWTVerifier 按选项创建校验器；配置JWKS时禁止HMAC算法，防止以公钥作为HMAC密钥伪造token
+func NewJWTVerifier(ctx context.Context, opts JWTOptions) (*JWTVerifier, error) {
+	v := &JWTVerifier{required: opts.RequiredClaims}
+
+	useJWKS := opts.JWKSFile != "" || opts.JWKSURL != ""
+	algorithms := opts.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256"}
+		if useJWKS {
+			algorithms = []string{"RS256", "ES256"}
+		}
+	}
+	for _, alg := range algorithms {
+		method := jwt.GetSigningMethod(alg)
+		if method == nil || alg == "none" {
+			return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+		}
+		_, hmac := method.(*jwt.SigningMethodHMAC)
+		if useJWKS && hmac {
+			return nil, fmt.Errorf("jwt algorithm %s cannot be used with jwks", alg)
+		}
+		if !useJWKS && !hmac {
+			return nil, fmt.Errorf("jwt algorithm %s requires jwks", alg)
+		}
+	}
+
+	if useJWKS {
+		refresh := opts.JWKSRefresh
+		if refresh <= 0 {
+			refresh = 5 * time.Minute
+		}
+		keys, err := NewKeySet(ctx, opts.JWKSFile, opts.JWKSURL, refresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwks: %w", err)
+		}
+		v.keys = keys
+	} else {
+		if opts.Secret == "" {
+			return nil, errors.New("jwt secret or jwks must be configured")
+		}
+		v.secret = []byte(opts.Secret)
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithLeeway(opts.ClockSkew),
+		jwt.WithIssuedAt(),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+	for _, claim := range opts.RequiredClaims {
+		if claim == "exp" {
+			parserOpts = append(parserOpts, jwt.WithExpirationRequired())
+		}
+	}
+	v.parser = jwt.NewParser(parserOpts...)
+	return v, nil
+}
+
+// Verify 校验token并返回声明
+func (v *JWTVerifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if v.keys == nil {
+			return v.secret, nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, claim := range v.required {
+		if !claims.Has(claim) {
+			missing = append(missing, claim)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("token is missing required claims: %s", strings.Join(missing, ", "))
+	}
+	return claims, nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signHS(t *testing.T, secret string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func TestClaimsTypedAccess(t *testing.T) {
+	var claims Claims
+	require.NoError(t, json.Unmarshal([]byte(`{"user_id": 756098401183076352, "username": "alice", "roles": "analyst, admin", "exp": 1}`), &claims))
+	// 雪花ID超出 float64 精度，必须原样解析
+	assert.Equal(t, uint64(756098401183076352), claims.UserID)
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, []string{"analyst", "admin"}, claims.Roles)
+	assert.True(t, claims.Has("exp"))
+	assert.False(t, claims.Has("client_id"))
+
+	claims = Claims{}
+	require.NoError(t, json.Unmarshal([]byte(`{"user_id": "42", "client_id": "crm", "roles": ["a", ""]}`), &claims))
+	assert.Equal(t, uint64(42), claims.UserID)
+	assert.Equal(t, "crm", claims.ClientID)
+	assert.Equal(t, []string{"a"}, claims.Roles)
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	ctx := context.Background()
+	v, err := NewJWTVerifier(ctx, JWTOptions{
+		Secret:         "secret",
+		Issuer:         "sso",
+		Audience:       "bisub",
+		ClockSkew:      30 * time.Second,
+		RequiredClaims: []string{"exp", "user_id"},
+	})
+	require.NoError(t, err)
+
+	valid := jwt.MapClaims{
+		"iss":     "sso",
+		"aud":     "bisub",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"user_id": 1001,
+	}
+	claims, err := v.Verify(ctx, signHS(t, "secret", valid))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1001), claims.UserID)
+
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "other" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{"missing exp", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"missing user_id", func(c jwt.MapClaims) { delete(c, "user_id") }},
+		{"expired beyond skew", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := jwt.MapClaims{}
+			for k, val := range valid {
+				claims[k] = val
+			}
+			tt.mutate(claims)
+			_, err := v.Verify(ctx, signHS(t, "secret", claims))
+			assert.Error(t, err)
+		})
+	}
+
+	// 时钟偏差范围内的过期仍然有效
+	skewed := jwt.MapClaims{"iss": "sso", "aud": "bisub", "exp": time.Now().Add(-10 * time.Second).Unix(), "user_id": 1}
+	_, err = v.Verify(ctx, signHS(t, "secret", skewed))
+	assert.NoError(t, err)
+
+	// 不在允许列表中的算法
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS384, valid).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, token)
+	assert.Error(t, err)
+
+	_, err = v.Verify(ctx, signHS(t, "wrong", valid))
+	assert.Error(t, err)
+}
+
+func TestNewJWTVerifierRejectsUnsafeConfig(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewJWTVerifier(ctx, JWTOptions{})
+	assert.Error(t, err)
+
+	_, err = NewJWTVerifier(ctx, JWTOptions{Secret: "secret", Algorithms: []string{"RS256"}})
+	assert.Error(t, err)
+
+	_, err = NewJWTVerifier(ctx, JWTOptions{Secret: "secret", Algorithms: []string{"none"}})
+	assert.Error(t, err)
+
+	file := writeJWKS(t, t.TempDir(), jwkFromRSA("k1", &mustRSA(t).PublicKey))
+	_, err = NewJWTVerifier(ctx, JWTOptions{JWKSFile: file, Algorithms: []string{"RS256", "HS256"}})
+	assert.Error(t, err)
+}
+
+func TestJWTVerifierJWKSFileRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	rsaKey := mustRSA(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	file := writeJWKS(t, dir, jwkFromRSA("rsa-1", &rsaKey.PublicKey))
+	v, err := NewJWTVerifier(ctx, JWTOptions{JWKSFile: file, JWKSRefresh: time.Nanosecond})
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix(), "user_id": 7}
+
+	rsaToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	rsaToken.Header["kid"] = "rsa-1"
+	signed, err := rsaToken.SignedString(rsaKey)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, signed)
+	require.NoError(t, err)
+
+	ecToken := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	ecToken.Header["kid"] = "ec-1"
+	ecSigned, err := ecToken.SignedString(ecKey)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, ecSigned)
+	assert.Error(t, err, "ec key not yet published")
+
+	// 轮换：发布新的EC公钥并撤下RSA公钥
+	writeJWKS(t, dir, jwkFromEC("ec-1", &ecKey.PublicKey))
+	_, err = v.Verify(ctx, ecSigned)
+	assert.NoError(t, err)
+	_, err = v.Verify(ctx, signed)
+	assert.Error(t, err)
+
+	// 以HMAC签名的token不能通过JWKS校验
+	_, err = v.Verify(ctx, signHS(t, "secret", claims))
+	assert.Error(t, err)
+}
+
+func TestKeySetURL(t *testing.T) {
+	rsaKey := mustRSA(t)
+	body, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{jwkFromRSA("k1", &rsaKey.PublicKey)}})
+	require.NoError(t, err)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	keys, err := NewKeySet(ctx, "", server.URL, time.Hour)
+	require.NoError(t, err)
+
+	key, err := keys.Key(ctx, "k1")
+	require.NoError(t, err)
+	assert.Equal(t, rsaKey.PublicKey.N, key.(*rsa.PublicKey).N)
+	// kid为空且只有一个公钥时直接使用
+	_, err = keys.Key(ctx, "")
+	assert.NoError(t, err)
+
+	// 未知kid在最小间隔内不重新拉取
+	_, err = keys.Key(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, 1, requests)
+}
+
+func TestKeySetConcurrentRefresh(t *testing.T) {
+	rsaKey := mustRSA(t)
+	body, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{jwkFromRSA("k1", &rsaKey.PublicKey)}})
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	keys, err := NewKeySet(ctx, "", server.URL, 200*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(250 * time.Millisecond)
+
+	// 公钥过期后并发的请求只触发一次拉取
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := keys.Key(ctx, "k1")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func mustRSA(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func jwkFromRSA(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func jwkFromEC(kid string, key *ecdsa.PublicKey) map[string]string {
+	point, err := key.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	size := (len(point) - 1) / 2
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(point[1 : 1+size]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[1+size:]),
+	}
+}
+
+func writeJWKS(t *testing.T, dir string, keys ...map[string]string) string {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	require.NoError(t, err)
+	file := filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+	return file
+}
@@ -0,0 +1,90 @@
+// Package auth 定义请求的调用方身份，由认证中间件写入 context，服务层据此做权限判断
+package auth
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalKind 调用方类型
+const (
+	KindUser   = "user"   // 终端用户（JWT）
+	KindClient = "client" // API 客户端
+	KindSystem = "system" // 服务内部任务（调度器等）
+)
+
+// Principal 已认证的调用方
+type Principal struct {
+	Kind     string
+	UserID   uint64
+	Username string
+	ClientID string
+	Roles    []string
+	Admin    bool // 管理员跳过订阅ACL检查
+	Shared   bool // 多人共用的账号（Web管理界面的 BasicAuth），不代表具体的人，不能做审核决定
+
+	// 以下仅API Key调用方使用
+	APIKeyID    uint64
+	SubKeys     []string // 允许访问的订阅key，空表示不限制
+	DataSources []string // 允许使用的数据源，空表示不限制
+	RateLimit   int      // 每分钟请求上限，0表示不单独限流
+}
+
+// System 服务内部任务使用的身份
+var System = &Principal{Kind: KindSystem, Username: "system", Admin: true}
+
+// HasRole 是否拥有角色
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// AllowsSubscription 订阅key是否在调用方作用域内
+func (p *Principal) AllowsSubscription(key string) bool {
+	return len(p.SubKeys) == 0 || contains(p.SubKeys, key)
+}
+
+// AllowsDataSource 数据源是否在调用方作用域内
+func (p *Principal) AllowsDataSource(name string) bool {
+	return len(p.DataSources) == 0 || contains(p.DataSources, name)
+}
+
+// Name 用于日志展示的身份名称
+func (p *Principal) Name() string {
+	switch {
+	case p.Kind == KindClient:
+		return "client:" + p.ClientID
+	case p.Username != "":
+		return p.Username
+	default:
+		return "user:" + strconv.FormatUint(p.UserID, 10)
+	}
+}
+
+type principalKey struct{}
+
+// WithPrincipal 将调用方写入 context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Current 读取gin请求的调用方，处理器和中间件统一通过它获取当前身份
+func Current(c *gin.Context) (*Principal, bool) {
+	return FromContext(c.Request.Context())
+}
+
+// FromContext 读取调用方，未认证时返回 false
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+func contains(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
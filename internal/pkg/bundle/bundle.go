@@ -0,0 +1,281 @@
+// Package bundle 订阅导出包，用于在环境之间迁移订阅
+//
+// 导出包有两种编码：
+//   - JSON：一个文档，包含清单字段和全部订阅
+//   - tar：manifest.json 保存清单字段，每个订阅 key 保存为 subscriptions/<type>/<sub_key>.json
+//
+// 校验和为订阅、数据源引用和订阅类型引用按固定顺序编码后的 SHA-256，与编码方式无关。
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+)
+
+const (
+	Format        = "bisub.bundle"
+	FormatVersion = 1
+
+	EncodingJSON = "json"
+	EncodingTar  = "tar"
+
+	manifestName     = "manifest.json"
+	subscriptionsDir = "subscriptions/"
+)
+
+var (
+	ErrUnsupported      = errors.New("unsupported bundle")
+	ErrChecksumMismatch = errors.New("bundle checksum mismatch")
+	ErrInvalid          = errors.New("invalid bundle")
+)
+
+// Bundle 导出包
+type Bundle struct {
+	Format        string          `json:"format"`
+	FormatVersion int             `json:"format_version"`
+	ExportedAt    time.Time       `json:"exported_at"`
+	ExportedBy    string          `json:"exported_by"`
+	Checksum      string          `json:"checksum"` // sha256:<hex>
+	DataSources   []DataSourceRef `json:"data_sources"`
+	Types         []TypeRef       `json:"types,omitempty"`         // 早期的导出包没有类型引用
+	Subscriptions []Subscription  `json:"subscriptions,omitempty"` // tar 编码时保存在单独的文件中
+}
+
+// DataSourceRef 订阅引用的数据源，导入环境中必须存在同名数据源
+type DataSourceRef struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+}
+
+// TypeRef 订阅使用的订阅类型（sub_refs 中的 SUBSCRIPTION_TYPE），导入环境中必须定义同一类型
+type TypeRef struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// Subscription 一个订阅 key 的全部版本
+type Subscription struct {
+	Type     string    `json:"type"`
+	SubKey   string    `json:"sub_key"`
+	Versions []Version `json:"versions"`
+}
+
+// Version 订阅版本，不包含ID和创建人，导入时重新生成
+type Version struct {
+	Version     uint32          `json:"version"`
+	Title       string          `json:"title"`
+	Abstract    string          `json:"abstract"`
+	Status      string          `json:"status"`
+	ExtraConfig json.RawMessage `json:"extra_config"`
+}
+
+// New 生成导出包，订阅按 type、sub_key 排序，版本按版本号排序
+func New(subscriptions []Subscription, dataSources []DataSourceRef, types []TypeRef, exportedBy string) *Bundle {
+	b := &Bundle{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		ExportedAt:    time.Now().UTC().Truncate(time.Second),
+		ExportedBy:    exportedBy,
+		DataSources:   dataSources,
+		Types:         types,
+		Subscriptions: subscriptions,
+	}
+	b.sort()
+	b.Checksum = b.computeChecksum()
+	return b
+}
+
+func (b *Bundle) sort() {
+	sort.Slice(b.Subscriptions, func(i, j int) bool {
+		x, y := b.Subscriptions[i], b.Subscriptions[j]
+		if x.Type != y.Type {
+			return x.Type < y.Type
+		}
+		return x.SubKey < y.SubKey
+	})
+	for _, sub := range b.Subscriptions {
+		sort.Slice(sub.Versions, func(i, j int) bool { return sub.Versions[i].Version < sub.Versions[j].Version })
+	}
+	sort.Slice(b.DataSources, func(i, j int) bool { return b.DataSources[i].Name < b.DataSources[j].Name })
+	sort.Slice(b.Types, func(i, j int) bool { return b.Types[i].Value < b.Types[j].Value })
+}
+
+// computeChecksum 内容的校验和，json.Marshal 会压缩 extra_config 中的空白
+// 没有类型引用时不编码该字段，早期导出包的校验和保持不变
+func (b *Bundle) computeChecksum() string {
+	content, _ := json.Marshal(struct {
+		DataSources   []DataSourceRef `json:"data_sources"`
+		Types         []TypeRef       `json:"types,omitempty"`
+		Subscriptions []Subscription  `json:"subscriptions"`
+	}{b.DataSources, b.Types, b.Subscriptions})
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Verify 检查格式版本和校验和
+func (b *Bundle) Verify() error {
+	if b.Format != Format {
+		return fmt.Errorf("%w: format %q", ErrUnsupported, b.Format)
+	}
+	if b.FormatVersion != FormatVersion {
+		return fmt.Errorf("%w: format version %d, expected %d", ErrUnsupported, b.FormatVersion, FormatVersion)
+	}
+	if actual := b.computeChecksum(); actual != b.Checksum {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, b.Checksum, actual)
+	}
+	return b.validate()
+}
+
+// validate 检查订阅标识、版本号和状态，校验和只能发现传输中的损坏
+func (b *Bundle) validate() error {
+	seen := make(map[string]bool, len(b.Subscriptions))
+	for _, sub := range b.Subscriptions {
+		id := sub.Type + "/" + sub.SubKey
+		if len(sub.Type) != 1 || sub.SubKey == "" || len(sub.SubKey) > 120 {
+			return fmt.Errorf("%w: invalid subscription %q", ErrInvalid, id)
+		}
+		if seen[id] {
+			return fmt.Errorf("%w: %s appears more than once", ErrInvalid, id)
+		}
+		seen[id] = true
+		if len(sub.Versions) == 0 {
+			return fmt.Errorf("%w: %s has no versions", ErrInvalid, id)
+		}
+
+		versions := make(map[uint32]bool, len(sub.Versions))
+		for _, v := range sub.Versions {
+			switch {
+			case v.Version == 0:
+				return fmt.Errorf("%w: %s has version 0", ErrInvalid, id)
+			case versions[v.Version]:
+				return fmt.Errorf("%w: %s version %d appears more than once", ErrInvalid, id, v.Version)
+			case v.Title == "" || len(v.Title) > 240:
+				return fmt.Errorf("%w: %s version %d has an invalid title", ErrInvalid, id, v.Version)
+			case !models.IsValidStatus(v.Status):
+				return fmt.Errorf("%w: %s version %d has invalid status %q", ErrInvalid, id, v.Version, v.Status)
+			case len(v.ExtraConfig) == 0:
+				return fmt.Errorf("%w: %s version %d has no extra_config", ErrInvalid, id, v.Version)
+			}
+			versions[v.Version] = true
+		}
+	}
+	return nil
+}
+
+// Write 按 encoding 编码导出包
+func Write(w io.Writer, b *Bundle, encoding string) error {
+	switch encoding {
+	case EncodingJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	case EncodingTar:
+		return writeTar(w, b)
+	}
+	return fmt.Errorf("%w: encoding %q", ErrUnsupported, encoding)
+}
+
+func writeTar(w io.Writer, b *Bundle) error {
+	tw := tar.NewWriter(w)
+	manifest := *b
+	manifest.Subscriptions = nil
+	if err := writeTarFile(tw, manifestName, &manifest, b.ExportedAt); err != nil {
+		return err
+	}
+	for i := range b.Subscriptions {
+		sub := &b.Subscriptions[i]
+		name := subscriptionsDir + sub.Type + "/" + sub.SubKey + ".json"
+		if err := writeTarFile(tw, name, sub, b.ExportedAt); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, v interface{}, modTime time.Time) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime, Format: tar.FormatPAX}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// Read 读取导出包并校验，按内容识别 JSON 和 tar 编码
+func Read(r io.Reader) (*Bundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var b *Bundle
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		b = &Bundle{}
+		if err := json.Unmarshal(trimmed, b); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+	} else if b, err = readTar(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	// 内容顺序不影响校验和
+	b.sort()
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func readTar(r io.Reader) (*Bundle, error) {
+	tr := tar.NewReader(r)
+	var b *Bundle
+	var subscriptions []Subscription
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case name == manifestName:
+			b = &Bundle{}
+			if err := json.NewDecoder(tr).Decode(b); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrUnsupported, name, err)
+			}
+		case strings.HasPrefix(name, subscriptionsDir) && strings.HasSuffix(name, ".json"):
+			var sub Subscription
+			if err := json.NewDecoder(tr).Decode(&sub); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrUnsupported, name, err)
+			}
+			subscriptions = append(subscriptions, sub)
+		}
+	}
+	if b == nil {
+		return nil, fmt.Errorf("%w: %s not found", ErrUnsupported, manifestName)
+	}
+	b.Subscriptions = subscriptions
+	return b, nil
+}
@@ -0,0 +1,77 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBundle() *Bundle {
+	return New([]Subscription{
+		{Type: "A", SubKey: "orders", Versions: []Version{
+			{Version: 2, Title: "订单", Abstract: "订单", Status: "B", ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id, amount FROM orders"}`)},
+			{Version: 1, Title: "订单", Abstract: "订单", Status: "D", ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id FROM orders"}`)},
+		}},
+		{Type: "A", SubKey: "houses", Versions: []Version{
+			{Version: 1, Title: "房源", Abstract: "房源", Status: "A", ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id FROM houses", "db_source": "report"}`)},
+		}},
+	}, []DataSourceRef{{Name: "report", Driver: "postgres"}, {Name: "default", Driver: "mysql"}}, []TypeRef{{Value: "A", Label: "分析数据"}}, "alice")
+}
+
+func TestRoundTrip(t *testing.T) {
+	b := testBundle()
+	assert.Equal(t, "houses", b.Subscriptions[0].SubKey)
+	assert.Equal(t, uint32(1), b.Subscriptions[1].Versions[0].Version)
+	assert.Equal(t, "default", b.DataSources[0].Name)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, b.Checksum)
+
+	for _, encoding := range []string{EncodingJSON, EncodingTar} {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, b, encoding))
+
+		read, err := Read(&buf)
+		require.NoError(t, err, encoding)
+		assert.Equal(t, b.Checksum, read.Checksum, encoding)
+		assert.Equal(t, "alice", read.ExportedBy, encoding)
+		assert.True(t, b.ExportedAt.Equal(read.ExportedAt), encoding)
+		assert.Equal(t, []TypeRef{{Value: "A", Label: "分析数据"}}, read.Types, encoding)
+		require.Len(t, read.Subscriptions, 2, encoding)
+		assert.Equal(t, "orders", read.Subscriptions[1].SubKey, encoding)
+		assert.JSONEq(t, `{"sql_content": "SELECT id, amount FROM orders"}`, string(read.Subscriptions[1].Versions[1].ExtraConfig), encoding)
+	}
+
+	assert.ErrorIs(t, Write(&bytes.Buffer{}, b, "zip"), ErrUnsupported)
+}
+
+func TestReadRejectsModifiedBundle(t *testing.T) {
+	b := testBundle()
+	b.Subscriptions[0].Versions[0].Title = "房源（改）"
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, b, EncodingJSON))
+	_, err := Read(&buf)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	// 校验和正确但内容不合法
+	b = testBundle()
+	b.Subscriptions[0].Versions[0].Status = "X"
+	b.Checksum = b.computeChecksum()
+	buf.Reset()
+	require.NoError(t, Write(&buf, b, EncodingTar))
+	_, err = Read(&buf)
+	assert.True(t, errors.Is(err, ErrInvalid))
+	assert.Contains(t, err.Error(), `A/houses version 1 has invalid status "X"`)
+
+	b = testBundle()
+	b.FormatVersion = 2
+	buf.Reset()
+	require.NoError(t, Write(&buf, b, EncodingJSON))
+	_, err = Read(&buf)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = Read(bytes.NewReader([]byte("not a bundle")))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
@@ -0,0 +1,363 @@
+// Package client go-bisub HTTP API 的客户端，供 bisubctl 等工具使用
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+)
+
+// apiKeyHeader 与服务端 middleware.APIKeyHeader 一致
+const apiKeyHeader = "X-API-Key"
+
+// Client 调用 /v1 接口，使用 JWT 或 API Key 认证
+type Client struct {
+	baseURL string
+	token   string
+	apiKey  string
+	http    *http.Client
+}
+
+// New 按 profile 创建客户端，未配置超时时不限制（流式执行结果可能持续较长时间）
+func New(p Profile) (*Client, error) {
+	if p.Server == "" {
+		return nil, fmt.Errorf("server is not configured")
+	}
+	if _, err := url.ParseRequestURI(p.Server); err != nil {
+		return nil, fmt.Errorf("invalid server %q: %w", p.Server, err)
+	}
+	return &Client{
+		baseURL: strings.TrimRight(p.Server, "/") + "/v1",
+		token:   p.Token,
+		apiKey:  p.APIKey,
+		http:    &http.Client{Timeout: p.Timeout},
+	}, nil
+}
+
+// APIError 接口返回的错误响应
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+	Data       json.RawMessage // 校验失败的明细，如 SQL 策略违规
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s (HTTP %d): %s", e.Code, e.StatusCode, e.Message)
+	if e.RequestID != "" {
+		msg += " [request_id=" + e.RequestID + "]"
+	}
+	return msg
+}
+
+// envelope 服务端的标准响应
+type envelope struct {
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	RequestID string          `json:"request_id"`
+	Data      json.RawMessage `json:"data"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+// Pagination 列表接口的分页信息
+type Pagination struct {
+	Total       int64 `json:"total"`
+	Limit       int   `json:"limit"`
+	Offset      int   `json:"offset"`
+	CurrentPage int   `json:"current_page"`
+	TotalPages  int64 `json:"total_pages"`
+}
+
+// SubscriptionList 订阅列表
+type SubscriptionList struct {
+	Items      []*models.Subscription `json:"items"`
+	Pagination Pagination             `json:"pagination"`
+}
+
+// OperationLogList 操作日志列表
+type OperationLogList struct {
+	Items      []*models.OperationLog `json:"items"`
+	Pagination Pagination             `json:"pagination"`
+}
+
+// ListOptions 订阅列表的筛选条件
+type ListOptions struct {
+	Limit  int
+	Offset int
+	SubKey string
+	Title  string
+	Status string
+}
+
+// ExecuteResult JSON 格式的执行结果
+type ExecuteResult struct {
+	Rows     []map[string]interface{} `json:"rows"`
+	Metadata map[string]interface{}   `json:"metadata,omitempty"`
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*envelope, error) {
+	resp, err := c.send(ctx, method, path, query, body, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	env, err := decodeEnvelope(resp)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return env, nil
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body interface{}, accept string) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	switch {
+	case c.apiKey != "":
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// decodeEnvelope 解析标准响应，非 2xx 时返回 *APIError
+func decodeEnvelope(resp *http.Response) (*envelope, error) {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var env envelope
+	if jsonErr := json.Unmarshal(data, &env); jsonErr != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &APIError{StatusCode: resp.StatusCode, Code: http.StatusText(resp.StatusCode), Message: strings.TrimSpace(string(data))}
+		}
+		return nil, fmt.Errorf("decode response: %w", jsonErr)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &APIError{StatusCode: resp.StatusCode, Code: env.Code, Message: env.Message, RequestID: env.RequestID, Data: env.Data}
+	}
+	return &env, nil
+}
+
+// versionPath 订阅路径，version 为 0 时指向当前生效版本
+func versionPath(key string, version uint32) string {
+	path := "/subscriptions/" + url.PathEscape(key)
+	if version > 0 {
+		path += "/versions/" + strconv.FormatUint(uint64(version), 10)
+	}
+	return path
+}
+
+func typeQuery(subType string) url.Values {
+	if subType == "" {
+		return nil
+	}
+	return url.Values{"type": {subType}}
+}
+
+// ListSubscriptions 按条件分页列出订阅
+func (c *Client) ListSubscriptions(ctx context.Context, opts ListOptions) (*SubscriptionList, error) {
+	query := url.Values{}
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "offset", opts.Offset)
+	setQuery(query, "sub_key", opts.SubKey)
+	setQuery(query, "title", opts.Title)
+	setQuery(query, "status", opts.Status)
+
+	var list SubscriptionList
+	if _, err := c.do(ctx, http.MethodGet, "/subscriptions", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetSubscription 获取订阅，version 为 0 时返回当前生效版本
+func (c *Client) GetSubscription(ctx context.Context, subType, key string, version uint32) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if _, err := c.do(ctx, http.MethodGet, versionPath(key, version), typeQuery(subType), nil, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// CreateSubscription 创建订阅
+func (c *Client) CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if _, err := c.do(ctx, http.MethodPost, "/subscriptions", nil, req, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// UpdateSubscription 更新订阅的指定版本
+func (c *Client) UpdateSubscription(ctx context.Context, subType, key string, version uint32, req *models.UpdateSubscriptionRequest) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if _, err := c.do(ctx, http.MethodPut, versionPath(key, version), typeQuery(subType), req, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// UpdateStatus 变更订阅版本的状态
+func (c *Client) UpdateStatus(ctx context.Context, subType, key string, version uint32, status string, force bool) error {
+	req := &models.UpdateStatusRequest{Status: status, Force: force}
+	_, err := c.do(ctx, http.MethodPatch, versionPath(key, version)+"/status", typeQuery(subType), req, nil)
+	return err
+}
+
+// ForkSubscription 由已有版本派生新版本
+func (c *Client) ForkSubscription(ctx context.Context, subType, key string, version uint32, req *models.ForkSubscriptionRequest) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if _, err := c.do(ctx, http.MethodPost, versionPath(key, version)+"/fork", typeQuery(subType), req, &subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// DeleteSubscription 删除订阅的指定版本
+func (c *Client) DeleteSubscription(ctx context.Context, subType, key string, version uint32) error {
+	_, err := c.do(ctx, http.MethodDelete, versionPath(key, version), typeQuery(subType), nil, nil)
+	return err
+}
+
+// Execute 执行订阅并返回 JSON 结果，version 为 0 时执行当前生效版本
+func (c *Client) Execute(ctx context.Context, subType, key string, version uint32, req *models.ExecuteSubscriptionRequest) (*ExecuteResult, error) {
+	body := *req
+	body.Format = models.FormatJSON
+
+	var result ExecuteResult
+	env, err := c.do(ctx, http.MethodPost, versionPath(key, version)+"/execute", typeQuery(subType), &body, &result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Metadata) > 0 {
+		if err := json.Unmarshal(env.Metadata, &result.Metadata); err != nil {
+			return nil, fmt.Errorf("decode metadata: %w", err)
+		}
+	}
+	return &result, nil
+}
+
+// Stream 以 csv 或 ndjson 格式执行订阅并将结果原样写入 w，返回行数
+// 输出中途的错误由服务端通过 X-Stream-Error trailer 返回
+func (c *Client) Stream(ctx context.Context, subType, key string, version uint32, req *models.ExecuteSubscriptionRequest, format string, w io.Writer) (int64, error) {
+	body := *req
+	body.Format = format
+	accept := "application/x-ndjson"
+	if format == models.FormatCSV {
+		accept = "text/csv"
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, versionPath(key, version)+"/execute", typeQuery(subType), &body, accept)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		_, err := decodeEnvelope(resp)
+		return 0, err
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return 0, err
+	}
+	if msg := resp.Trailer.Get("X-Stream-Error"); msg != "" {
+		return 0, fmt.Errorf("stream interrupted: %s", msg)
+	}
+	rows, _ := strconv.ParseInt(resp.Trailer.Get("X-Row-Count"), 10, 64)
+	return rows, nil
+}
+
+// StatsQuery 统计查询条件，日期格式 2006-01-02
+type StatsQuery struct {
+	StartTime string
+	EndTime   string
+	Limit     int
+	Offset    int
+}
+
+// Stats 查询订阅调用统计
+func (c *Client) Stats(ctx context.Context, q StatsQuery) ([]*models.StatsResponse, error) {
+	query := url.Values{}
+	setQuery(query, "start_time", q.StartTime)
+	setQuery(query, "end_time", q.EndTime)
+	setInt(query, "limit", q.Limit)
+	setInt(query, "offset", q.Offset)
+
+	var stats []*models.StatsResponse
+	if _, err := c.do(ctx, http.MethodGet, "/subscriptions/stats", query, nil, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// OperationLogs 查询操作日志
+func (c *Client) OperationLogs(ctx context.Context, req models.OperationLogRequest) (*OperationLogList, error) {
+	query := url.Values{}
+	setQuery(query, "start_time", req.StartTime)
+	setQuery(query, "end_time", req.EndTime)
+	setQuery(query, "username", req.Username)
+	setQuery(query, "operation", req.Operation)
+	setQuery(query, "resource", req.Resource)
+	setQuery(query, "status", req.Status)
+	setQuery(query, "client_ip", req.ClientIP)
+	if req.UserID > 0 {
+		query.Set("user_id", strconv.FormatUint(req.UserID, 10))
+	}
+	setInt(query, "limit", req.Limit)
+	setInt(query, "offset", req.Offset)
+
+	var list OperationLogList
+	if _, err := c.do(ctx, http.MethodGet, "/operation-logs", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
+
+func setInt(query url.Values, key string, value int) {
+	if value > 0 {
+		query.Set(key, strconv.Itoa(value))
+	}
+}
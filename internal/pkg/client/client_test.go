@@ -0,0 +1,129 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAuthAndErrors(t *testing.T) {
+	var gotKey, gotAuth, gotPath, gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey, gotAuth = r.Header.Get(apiKeyHeader), r.Header.Get("Authorization")
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"SQL_POLICY_VIOLATION","message":"sql rejected","request_id":"req-1","data":[{"rule":"denied_function"}]}`))
+			return
+		}
+		w.Write([]byte(`{"code":"SUCCESS","message":"ok","data":{"sub_key":"orders","version":2}}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(Profile{Server: srv.URL + "/", APIKey: "bsk_test"})
+	require.NoError(t, err)
+	sub, err := c.GetSubscription(context.Background(), "A", "orders", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "orders", sub.SubKey)
+	assert.Equal(t, "bsk_test", gotKey)
+	assert.Empty(t, gotAuth)
+	assert.Equal(t, "/v1/subscriptions/orders/versions/2", gotPath)
+	assert.Equal(t, "type=A", gotQuery)
+
+	c, err = New(Profile{Server: srv.URL, Token: "jwt"})
+	require.NoError(t, err)
+	_, err = c.CreateSubscription(context.Background(), &models.CreateSubscriptionRequest{SubKey: "orders"})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Bearer jwt", gotAuth)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "SQL_POLICY_VIOLATION", apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+	assert.JSONEq(t, `[{"rule":"denied_function"}]`, string(apiErr.Data))
+}
+
+func TestClientStream(t *testing.T) {
+	var body models.ExecuteSubscriptionRequest
+	failAfter := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Trailer", "X-Row-Count, X-Stream-Error")
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("id,name\n1,a\n2,b\n"))
+		if failAfter {
+			w.Header().Set("X-Stream-Error", "context deadline exceeded")
+			return
+		}
+		w.Header().Set("X-Row-Count", "2")
+	}))
+	defer srv.Close()
+
+	c, err := New(Profile{Server: srv.URL})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	req := &models.ExecuteSubscriptionRequest{Variables: map[string]interface{}{"id": 1}}
+	rows, err := c.Stream(context.Background(), "", "orders", 0, req, models.FormatCSV, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), rows)
+	assert.Equal(t, "id,name\n1,a\n2,b\n", buf.String())
+	assert.Equal(t, models.FormatCSV, body.Format)
+	assert.Empty(t, req.Format, "请求参数不应被修改")
+
+	failAfter = true
+	_, err = c.Stream(context.Background(), "", "orders", 0, req, models.FormatCSV, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
+
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bisubctl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+current: dev
+profiles:
+  dev:
+    server: http://localhost:8080
+    token: dev-jwt
+  prod:
+    server: https://bisub.example.com
+    api_key: bsk_prod
+`), 0o600))
+	for _, key := range []string{EnvProfile, EnvServer, EnvToken, EnvAPIKey} {
+		t.Setenv(key, "")
+	}
+
+	p, err := LoadProfile(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Server: "http://localhost:8080", Token: "dev-jwt"}, p)
+
+	p, err = LoadProfile(path, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, "bsk_prod", p.APIKey)
+
+	_, err = LoadProfile(path, "staging")
+	assert.Error(t, err)
+
+	// 环境变量覆盖文件，凭据整体替换
+	t.Setenv(EnvAPIKey, "bsk_ci")
+	p, err = LoadProfile(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Server: "http://localhost:8080", APIKey: "bsk_ci"}, p)
+
+	// 文件不存在时只使用环境变量
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	_, err = LoadProfile(missing, "")
+	assert.Error(t, err)
+	t.Setenv(EnvServer, "http://ci:8080")
+	p, err = LoadProfile(missing, "")
+	require.NoError(t, err)
+	assert.Equal(t, Profile{Server: "http://ci:8080", APIKey: "bsk_ci"}, p)
+}
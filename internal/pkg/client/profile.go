@@ -0,0 +1,104 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量，优先于 profile 文件，便于在 CI 中使用
+const (
+	EnvConfig  = "BISUBCTL_CONFIG"
+	EnvProfile = "BISUBCTL_PROFILE"
+	EnvServer  = "BISUB_SERVER"
+	EnvToken   = "BISUB_TOKEN"
+	EnvAPIKey  = "BISUB_API_KEY"
+)
+
+// Profile 一个服务端地址及其认证方式，token（JWT）和 api_key 二选一
+type Profile struct {
+	Server  string        `yaml:"server"`
+	Token   string        `yaml:"token,omitempty"`
+	APIKey  string        `yaml:"api_key,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"` // 单个请求的超时，0 表示不限制
+}
+
+// ProfileFile profile 文件，默认 ~/.bisubctl.yaml
+//
+//	current: prod
+//	profiles:
+//	  prod:
+//	    server: https://bisub.example.com
+//	    api_key: bsk_xxx
+type ProfileFile struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// DefaultProfilePath profile 文件的默认位置，可用 BISUBCTL_CONFIG 覆盖
+func DefaultProfilePath() string {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".bisubctl.yaml"
+	}
+	return filepath.Join(home, ".bisubctl.yaml")
+}
+
+// LoadProfile 读取 profile 文件中的指定 profile，name 为空时依次取 BISUBCTL_PROFILE 和文件中的 current
+// BISUB_SERVER、BISUB_TOKEN、BISUB_API_KEY 覆盖文件中的值；文件不存在时只使用环境变量
+func LoadProfile(path, name string) (Profile, error) {
+	var profile Profile
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var file ProfileFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return Profile{}, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if name == "" {
+			name = os.Getenv(EnvProfile)
+		}
+		if name == "" {
+			name = file.Current
+		}
+		if name != "" {
+			p, ok := file.Profiles[name]
+			if !ok {
+				return Profile{}, fmt.Errorf("profile %q not found in %s", name, path)
+			}
+			profile = p
+		}
+	case os.IsNotExist(err):
+		if name != "" {
+			return Profile{}, fmt.Errorf("profile %q requested but %s does not exist", name, path)
+		}
+	default:
+		return Profile{}, err
+	}
+
+	if server := os.Getenv(EnvServer); server != "" {
+		profile.Server = server
+	}
+	// 环境变量中的凭据替换文件中的两种凭据，避免同时生效
+	if token := os.Getenv(EnvToken); token != "" {
+		profile.Token, profile.APIKey = token, ""
+	}
+	if apiKey := os.Getenv(EnvAPIKey); apiKey != "" {
+		profile.Token, profile.APIKey = "", apiKey
+	}
+
+	if profile.Server == "" {
+		return Profile{}, fmt.Errorf("no server configured: create %s or set %s", path, EnvServer)
+	}
+	if profile.Token != "" && profile.APIKey != "" {
+		return Profile{}, fmt.Errorf("profile %q sets both token and api_key", name)
+	}
+	return profile, nil
+}
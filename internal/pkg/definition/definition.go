@@ -0,0 +1,366 @@
+// Package definition 读取 git 中维护的订阅定义目录，转换为期望的订阅版本，供声明式同步使用
+//
+// 每个 YAML 文件描述一个订阅 key 及其全部版本，SQL 放在单独的 .sql 文件中：
+//
+//	type: A
+//	sub_key: user_orders
+//	title: 用户订单
+//	abstract: 按用户查询订单
+//	versions:
+//	  - version: 1
+//	    status: B
+//	    sql_file: user_orders.v1.sql
+//	    variables:
+//	      user_id: {type: int, description: 用户ID}
+//	    example: {user_id: 1}
+//	    extra_config:
+//	      cache_ttl: 60
+package definition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Subscription 一个订阅 key 的定义
+type Subscription struct {
+	Type     string    `json:"type"` // 默认 A
+	SubKey   string    `json:"sub_key"`
+	Title    string    `json:"title"`
+	Abstract string    `json:"abstract"`
+	Versions []Version `json:"versions"`
+}
+
+// Version 一个版本的定义，title、abstract 为空时沿用订阅的定义
+type Version struct {
+	Version     uint32                         `json:"version"`
+	Status      string                         `json:"status"`
+	Title       string                         `json:"title"`
+	Abstract    string                         `json:"abstract"`
+	SQLFile     string                         `json:"sql_file"` // 相对于定义文件所在目录
+	Variables   map[string]models.VariableSpec `json:"variables"`
+	Example     json.RawMessage                `json:"example"`      // 字符串或对象，对象按JSON文本保存
+	ExtraConfig map[string]json.RawMessage     `json:"extra_config"` // sql_content、sql_replace、example 之外的配置项
+}
+
+// Problem 定义文件中的一处错误
+type Problem struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+// ValidationError 定义目录中的全部错误
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid subscription definitions:")
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.File, p.Message)
+	}
+	return b.String()
+}
+
+// managedKeys 由专门的字段生成，不能写在 extra_config 中
+var managedKeys = []string{"sql_content", "sql_replace", "example"}
+
+// Load 读取目录（含子目录）下的 .yaml/.yml 文件，返回按 type、sub_key、version 排序的期望版本
+// 隐藏目录（如 .git）被跳过；任一文件有错误时返回 *ValidationError，列出所有错误
+func Load(dir string) ([]*models.Subscription, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var files []string
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if ext := filepath.Ext(path); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var subscriptions []*models.Subscription
+	var problems []Problem
+	seen := make(map[string]string)
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		def, err := readFile(file)
+		if err != nil {
+			problems = append(problems, Problem{File: rel, Message: err.Error()})
+			continue
+		}
+
+		id := def.Type + "/" + def.SubKey
+		if previous, ok := seen[id]; ok {
+			problems = append(problems, Problem{File: rel, Message: fmt.Sprintf("%s is already defined in %s", id, previous)})
+			continue
+		}
+		seen[id] = rel
+
+		versions, errs := def.build(dir, filepath.Dir(file))
+		for _, err := range errs {
+			problems = append(problems, Problem{File: rel, Message: err.Error()})
+		}
+		subscriptions = append(subscriptions, versions...)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		a, b := subscriptions[i], subscriptions[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.SubKey != b.SubKey {
+			return a.SubKey < b.SubKey
+		}
+		return a.Version < b.Version
+	})
+	return subscriptions, nil
+}
+
+// readFile 按 YAML 解析后转为 JSON 严格解码，拼错的字段名视为错误
+func readFile(path string) (*Subscription, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var def Subscription
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return nil, err
+	}
+	if def.Type == "" {
+		def.Type = models.TypeAnalysisData
+	}
+	if len(def.Type) != 1 {
+		return nil, fmt.Errorf("type must be a single character, got %q", def.Type)
+	}
+	if def.SubKey == "" {
+		return nil, fmt.Errorf("sub_key is required")
+	}
+	if len(def.SubKey) > 120 {
+		return nil, fmt.Errorf("sub_key must not exceed 120 characters")
+	}
+	return &def, nil
+}
+
+// sqlFilePath 解析 sql_file：必须是相对路径，解析符号链接后仍需位于定义目录 root 内
+func sqlFilePath(root, baseDir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("sql_file must be a relative path, got %s", name)
+	}
+	path := filepath.Join(baseDir, name)
+	if !insideDir(root, path) {
+		return "", fmt.Errorf("sql_file %s is outside the definitions directory", name)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if !insideDir(realRoot, resolved) {
+		return "", fmt.Errorf("sql_file %s is outside the definitions directory", name)
+	}
+	return resolved, nil
+}
+
+// insideDir path 是否位于 dir 内
+func insideDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// build 生成各版本的期望内容，baseDir 为 sql_file 的相对路径起点，sql_file 不能超出 root
+func (d *Subscription) build(root, baseDir string) ([]*models.Subscription, []error) {
+	if len(d.Versions) == 0 {
+		return nil, []error{fmt.Errorf("%s: at least one version is required", d.SubKey)}
+	}
+
+	var subscriptions []*models.Subscription
+	var errs []error
+	seen := make(map[uint32]bool)
+	for _, v := range d.Versions {
+		prefix := fmt.Sprintf("%s version %d", d.SubKey, v.Version)
+		if v.Version == 0 {
+			errs = append(errs, fmt.Errorf("%s: version must be a positive number", d.SubKey))
+			continue
+		}
+		if seen[v.Version] {
+			errs = append(errs, fmt.Errorf("%s: defined more than once", prefix))
+			continue
+		}
+		seen[v.Version] = true
+
+		subscription, err := d.buildVersion(root, baseDir, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	// 强制兼容版本会使低版本失效，低版本声明为生效中时同步后会被再次改写
+	for _, high := range subscriptions {
+		if high.Status != models.StatusActiveForceCompatible {
+			continue
+		}
+		for _, low := range subscriptions {
+			if low.Version < high.Version && models.IsServingStatus(low.Status) {
+				errs = append(errs, fmt.Errorf("%s version %d: must not be active below version %d in status %s", d.SubKey, low.Version, high.Version, high.Status))
+			}
+		}
+	}
+	return subscriptions, errs
+}
+
+func (d *Subscription) buildVersion(root, baseDir string, v Version) (*models.Subscription, error) {
+	switch v.Status {
+	case models.StatusPending, models.StatusActive, models.StatusActiveForceCompatible, models.StatusExpired:
+	default:
+		return nil, fmt.Errorf("status must be one of A, B, C, D, got %q", v.Status)
+	}
+
+	subscription := &models.Subscription{
+		Type:     d.Type,
+		SubKey:   d.SubKey,
+		Version:  v.Version,
+		Title:    firstNonEmpty(v.Title, d.Title),
+		Abstract: firstNonEmpty(v.Abstract, d.Abstract),
+		Status:   v.Status,
+	}
+	if subscription.Title == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if len(subscription.Title) > 240 {
+		return nil, fmt.Errorf("title must not exceed 240 characters")
+	}
+	if subscription.Abstract == "" {
+		return nil, fmt.Errorf("abstract is required")
+	}
+
+	if v.SQLFile == "" {
+		return nil, fmt.Errorf("sql_file is required")
+	}
+	sqlPath, err := sqlFilePath(root, baseDir, v.SQLFile)
+	if err != nil {
+		return nil, err
+	}
+	sqlContent, err := os.ReadFile(sqlPath)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(sqlContent)) == "" {
+		return nil, fmt.Errorf("%s is empty", v.SQLFile)
+	}
+
+	extra := make(map[string]json.RawMessage, len(v.ExtraConfig)+3)
+	for key, value := range v.ExtraConfig {
+		for _, managed := range managedKeys {
+			if key == managed {
+				return nil, fmt.Errorf("extra_config.%s is generated from the version definition and must not be set", key)
+			}
+		}
+		extra[key] = value
+	}
+	extra["sql_content"], _ = json.Marshal(strings.TrimRight(string(sqlContent), "\n"))
+	if len(v.Variables) > 0 {
+		extra["sql_replace"], _ = json.Marshal(v.Variables)
+	}
+	if example, err := exampleText(v.Example); err != nil {
+		return nil, err
+	} else if example != "" {
+		extra["example"], _ = json.Marshal(example)
+	}
+
+	raw, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+	subscription.ExtraConfig, err = canonical(raw, true)
+	if err != nil {
+		return nil, fmt.Errorf("extra_config: %w", err)
+	}
+	return subscription, nil
+}
+
+// exampleText example 为字符串时原样使用，为对象时转为紧凑的JSON文本
+func exampleText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", fmt.Errorf("example: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// CanonicalExtraConfig 按 models.ExtraConfig 重新编码，字段顺序和零值的省略方式固定，
+// 用于比较库中内容与定义是否一致；未知的配置项被丢弃
+func CanonicalExtraConfig(raw json.RawMessage) (json.RawMessage, error) {
+	return canonical(raw, false)
+}
+
+func canonical(raw json.RawMessage, strict bool) (json.RawMessage, error) {
+	var extraConfig models.ExtraConfig
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&extraConfig); err != nil {
+		return nil, err
+	}
+	return json.Marshal(extraConfig)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
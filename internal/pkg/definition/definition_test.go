@@ -0,0 +1,123 @@
+package definition
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"orders/user_orders.yaml": `
+sub_key: user_orders
+title: 用户订单
+abstract: 按用户查询订单
+versions:
+  - version: 2
+    status: C
+    title: 用户订单（含金额）
+    sql_file: v2.sql
+    variables:
+      user_id_replace: {type: int, description: 用户ID}
+    example: {user_id: 1}
+    extra_config:
+      cache_ttl: 60
+  - version: 1
+    status: D
+    sql_file: v1.sql
+`,
+		"orders/v1.sql":     "SELECT id FROM orders WHERE user_id = user_id_replace\n",
+		"orders/v2.sql":     "SELECT id, amount FROM orders WHERE user_id = user_id_replace\n",
+		".git/ignored.yaml": "not: [valid",
+		"orders/README.md":  "ignored",
+		"houses.yml":        "type: B\nsub_key: houses\ntitle: 房源\nabstract: 房源列表\nversions:\n  - {version: 1, status: A, sql_file: houses.sql, example: '{}'}\n",
+		"houses.sql":        "SELECT id FROM houses",
+	})
+
+	subscriptions, err := Load(dir)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 3)
+
+	v1, v2, houses := subscriptions[0], subscriptions[1], subscriptions[2]
+	assert.Equal(t, "A", v1.Type)
+	assert.Equal(t, uint32(1), v1.Version)
+	assert.Equal(t, "用户订单", v1.Title)
+	assert.Equal(t, models.StatusExpired, v1.Status)
+	assert.JSONEq(t, `{"sql_content":"SELECT id FROM orders WHERE user_id = user_id_replace","sql_replace":null,"example":""}`, string(v1.ExtraConfig))
+
+	assert.Equal(t, uint32(2), v2.Version)
+	assert.Equal(t, "用户订单（含金额）", v2.Title)
+	assert.Equal(t, "按用户查询订单", v2.Abstract)
+	assert.JSONEq(t, `{
+		"sql_content": "SELECT id, amount FROM orders WHERE user_id = user_id_replace",
+		"sql_replace": {"user_id_replace": {"type": "int", "description": "用户ID"}},
+		"example": "{\"user_id\":1}",
+		"cache_ttl": 60
+	}`, string(v2.ExtraConfig))
+
+	assert.Equal(t, "B", houses.Type)
+	assert.Equal(t, "houses", houses.SubKey)
+
+	// 内容固定为规范形式，与库中内容重新编码后可直接比较
+	canonical, err := CanonicalExtraConfig(v2.ExtraConfig)
+	require.NoError(t, err)
+	assert.Equal(t, string(v2.ExtraConfig), string(canonical))
+}
+
+func TestLoadProblems(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yaml": "sub_key: a\ntitle: A\nabstract: A\nversions:\n  - {version: 1, status: X, sql_file: a.sql}\n",
+		"b.yaml": "sub_key: a\ntitle: A\nabstract: A\nversions:\n  - {version: 1, status: B, sql_file: a.sql}\n",
+		"c.yaml": "sub_key: c\ntitle: C\nabstract: C\nversoins: []\n",
+		"d.yaml": "sub_key: d\ntitle: D\nabstract: D\nversions:\n  - {version: 1, status: B, sql_file: a.sql}\n  - {version: 2, status: C, sql_file: a.sql}\n",
+		"e.yaml": "sub_key: e\ntitle: E\nabstract: E\nversions:\n  - {version: 1, status: B, sql_file: a.sql, extra_config: {sql_content: x}}\n  - {version: 1, status: B, sql_file: a.sql}\n",
+		"f.yaml": "sub_key: f\ntitle: F\nabstract: F\nversions:\n  - {version: 1, status: B, sql_file: missing.sql}\n",
+		"g.yaml": "sub_key: g\ntitle: G\nabstract: G\nversions:\n  - {version: 1, status: B, sql_file: ../outside.sql}\n  - {version: 2, status: B, sql_file: /etc/passwd}\n  - {version: 3, status: B, sql_file: link.sql}\n",
+		"a.sql":  "SELECT 1",
+	})
+	outside := filepath.Join(filepath.Dir(dir), "outside.sql")
+	require.NoError(t, os.WriteFile(outside, []byte("SELECT 1"), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link.sql")))
+
+	_, err := Load(dir)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+
+	messages := make(map[string][]string)
+	for _, p := range validationErr.Problems {
+		messages[p.File] = append(messages[p.File], p.Message)
+	}
+	assert.Contains(t, messages["a.yaml"][0], `status must be one of A, B, C, D, got "X"`)
+	assert.Equal(t, []string{"A/a is already defined in a.yaml"}, messages["b.yaml"])
+	assert.Contains(t, messages["c.yaml"][0], "unknown field")
+	assert.Equal(t, []string{"d version 1: must not be active below version 2 in status C"}, messages["d.yaml"])
+	assert.Len(t, messages["e.yaml"], 2)
+	assert.Contains(t, messages["e.yaml"][0], "extra_config.sql_content is generated")
+	assert.Equal(t, "e version 1: defined more than once", messages["e.yaml"][1])
+	assert.Contains(t, messages["f.yaml"][0], "missing.sql")
+	// sql_file 不能通过 ../、绝对路径或符号链接读取定义目录之外的文件
+	assert.Equal(t, []string{
+		"g version 1: sql_file ../outside.sql is outside the definitions directory",
+		"g version 2: sql_file must be a relative path, got /etc/passwd",
+		"g version 3: sql_file link.sql is outside the definitions directory",
+	}, messages["g.yaml"])
+	assert.Contains(t, err.Error(), "invalid subscription definitions:\n  a.yaml: ")
+
+	_, err = Load(filepath.Join(dir, "a.sql"))
+	assert.EqualError(t, err, filepath.Join(dir, "a.sql")+" is not a directory")
+}
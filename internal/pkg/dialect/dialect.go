@@ -0,0 +1,199 @@
+// Package dialect 数据源驱动的连接方式和SQL方言差异
+package dialect
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/clickhouse"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// 支持的驱动，与 gorm Dialector.Name() 一致
+const (
+	MySQL      = "mysql"
+	Postgres   = "postgres"
+	ClickHouse = "clickhouse"
+	SQLite     = "sqlite"
+)
+
+// Drivers 支持的全部驱动
+var Drivers = []string{MySQL, Postgres, ClickHouse, SQLite}
+
+// Normalize 规范化驱动名，未配置时为 mysql
+func Normalize(driver string) string {
+	switch d := strings.ToLower(strings.TrimSpace(driver)); d {
+	case "":
+		return MySQL
+	case "postgresql":
+		return Postgres
+	case "sqlite3":
+		return SQLite
+	default:
+		return d
+	}
+}
+
+// Supported 是否为支持的驱动
+func Supported(driver string) bool {
+	driver = Normalize(driver)
+	for _, d := range Drivers {
+		if d == driver {
+			return true
+		}
+	}
+	return false
+}
+
+// Open 按驱动构造执行查询用的连接，dialTimeout 为 0 时使用驱动默认值
+// SQLite 的 database 为文件路径并以只读方式打开，PostgreSQL 会话默认只读事务
+func Open(dbConfig config.DBConfig, dialTimeout time.Duration) (gorm.Dialector, error) {
+	return open(dbConfig, dialTimeout, true)
+}
+
+// OpenPrimary 按驱动构造主库连接，主库保存订阅等元数据，需要可写
+func OpenPrimary(dbConfig config.DBConfig) (gorm.Dialector, error) {
+	return open(dbConfig, 0, false)
+}
+
+func open(dbConfig config.DBConfig, dialTimeout time.Duration, readOnly bool) (gorm.Dialector, error) {
+	switch driver := Normalize(dbConfig.Driver); driver {
+	case MySQL:
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			dbConfig.Username,
+			dbConfig.Password,
+			dbConfig.Host,
+			dbConfig.Port,
+			dbConfig.Database,
+		)
+		if dialTimeout > 0 {
+			dsn += "&timeout=" + dialTimeout.String()
+		}
+		return mysql.Open(dsn), nil
+
+	case Postgres:
+		query := url.Values{}
+		if dialTimeout > 0 {
+			query.Set("connect_timeout", strconv.Itoa(int(dialTimeout.Seconds())))
+		}
+		if readOnly {
+			// SQL校验之外的保护
+			query.Set("default_transaction_read_only", "on")
+		}
+		return postgres.Open(serverURL("postgres", dbConfig, query)), nil
+
+	case ClickHouse:
+		query := url.Values{}
+		if dialTimeout > 0 {
+			query.Set("dial_timeout", dialTimeout.String())
+		}
+		return clickhouse.Open(serverURL("clickhouse", dbConfig, query)), nil
+
+	case SQLite:
+		if dbConfig.Database == "" {
+			return nil, fmt.Errorf("sqlite data source requires database file path")
+		}
+		dsn := "file:" + dbConfig.Database
+		if readOnly {
+			dsn += "?mode=ro"
+		}
+		return sqlite.Open(dsn), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported driver %q", driver)
+	}
+}
+
+func serverURL(scheme string, dbConfig config.DBConfig, query url.Values) string {
+	u := url.URL{
+		Scheme:   scheme,
+		User:     url.UserPassword(dbConfig.Username, dbConfig.Password),
+		Host:     fmt.Sprintf("%s:%d", dbConfig.Host, dbConfig.Port),
+		Path:     "/" + dbConfig.Database,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// DefaultSchema 未限定的表名所属的库或模式，用于表策略匹配
+func DefaultSchema(driver, database string) string {
+	switch Normalize(driver) {
+	case Postgres:
+		return "public"
+	case SQLite:
+		return "main"
+	default:
+		return database
+	}
+}
+
+// BackslashEscapes 字符串字面量中的反斜杠是否为转义符
+func BackslashEscapes(driver string) bool {
+	driver = Normalize(driver)
+	return driver == MySQL || driver == ClickHouse
+}
+
+// HashComments # 是否开始单行注释，PostgreSQL 中 # 是按位异或
+func HashComments(driver string) bool {
+	driver = Normalize(driver)
+	return driver == MySQL || driver == ClickHouse
+}
+
+// DashCommentNeedsSpace -- 之后是否必须是空白或控制字符才开始注释，MySQL 中 5--1 是减去负数
+func DashCommentNeedsSpace(driver string) bool {
+	return Normalize(driver) == MySQL
+}
+
+// DoubleQuotedIdentifiers 双引号是否表示标识符，MySQL 中双引号是字符串
+func DoubleQuotedIdentifiers(driver string) bool {
+	return Normalize(driver) != MySQL
+}
+
+// Concat 拼接字符串表达式
+// MySQL 的 || 默认是逻辑或；PostgreSQL 的 CONCAT 无法推断参数类型，SQLite 3.44 之前没有 CONCAT
+func Concat(driver string, parts []string) string {
+	switch Normalize(driver) {
+	case Postgres, SQLite:
+		return "(" + strings.Join(parts, " || ") + ")"
+	default:
+		return "CONCAT(" + strings.Join(parts, ", ") + ")"
+	}
+}
+
+// Decode 将驱动扫描出的值转换为可直接序列化的值
+// MySQL 等驱动以 []byte 返回文本；ClickHouse 对 Nullable 列返回指针，对 128/256 位整数返回 *big.Int
+func Decode(driver string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return string(v)
+	case *big.Int:
+		if v == nil {
+			return nil
+		}
+		return v.String()
+	case net.IP:
+		return v.String()
+	}
+
+	if Normalize(driver) == ClickHouse {
+		if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return nil
+			}
+			return Decode(driver, rv.Elem().Interface())
+		}
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+package dialect
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, MySQL, Normalize(""))
+	assert.Equal(t, Postgres, Normalize(" PostgreSQL "))
+	assert.Equal(t, SQLite, Normalize("sqlite3"))
+	assert.True(t, Supported("ClickHouse"))
+	assert.False(t, Supported("oracle"))
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		driver string
+		name   string
+	}{
+		{driver: "", name: "mysql"},
+		{driver: Postgres, name: "postgres"},
+		{driver: ClickHouse, name: "clickhouse"},
+		{driver: SQLite, name: "sqlite"},
+	}
+	for _, tt := range tests {
+		dialector, err := Open(config.DBConfig{Driver: tt.driver, Host: "127.0.0.1", Port: 1, Database: "fixtures.db"}, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, tt.name, dialector.Name())
+	}
+
+	_, err := Open(config.DBConfig{Driver: SQLite}, time.Second)
+	assert.Error(t, err)
+	_, err = Open(config.DBConfig{Driver: "oracle"}, time.Second)
+	assert.Error(t, err)
+}
+
+func TestConcat(t *testing.T) {
+	parts := []string{"'%'", "?", "'%'"}
+	assert.Equal(t, "CONCAT('%', ?, '%')", Concat(MySQL, parts))
+	assert.Equal(t, "CONCAT('%', ?, '%')", Concat(ClickHouse, parts))
+	assert.Equal(t, "('%' || ? || '%')", Concat(Postgres, parts))
+}
+
+func TestDecode(t *testing.T) {
+	s := "abc"
+	var missing *string
+	n, _ := new(big.Int).SetString("340282366920938463463374607431768211455", 10)
+
+	assert.Equal(t, "abc", Decode(MySQL, []byte("abc")))
+	assert.Equal(t, "abc", Decode(ClickHouse, &s))
+	assert.Nil(t, Decode(ClickHouse, missing))
+	assert.Equal(t, "340282366920938463463374607431768211455", Decode(ClickHouse, n))
+	assert.Equal(t, int64(1), Decode(SQLite, int64(1)))
+}
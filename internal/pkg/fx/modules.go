@@ -9,6 +9,7 @@ import (
 	"git.uhomes.net/uhs-go/go-bisub/internal/handler"
 	"git.uhomes.net/uhs-go/go-bisub/internal/middleware"
 	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
 	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/logger"
 	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
 	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
@@ -17,13 +18,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/fx"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 // ConfigModule provides configuration
 var ConfigModule = fx.Module("config",
-	fx.Provide(config.Load),
+	fx.Provide(config.Load, config.NewReloader),
 )
 
 // LoggerModule provides logger
@@ -55,13 +55,10 @@ var LoggerModule = fx.Module("logger",
 var DatabaseModule = fx.Module("database",
 	fx.Provide(
 		func(cfg *config.Config) (*gorm.DB, error) {
-			dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-				cfg.Database.Primary.Username,
-				cfg.Database.Primary.Password,
-				cfg.Database.Primary.Host,
-				cfg.Database.Primary.Port,
-				cfg.Database.Primary.Database,
-			)
+			dialector, err := dialect.OpenPrimary(cfg.Database.Primary)
+			if err != nil {
+				return nil, err
+			}
 
 			// 配置GORM日志
 			gormConfig := &gorm.Config{}
@@ -71,7 +68,7 @@ var DatabaseModule = fx.Module("database",
 				gormConfig.Logger = gormLogger
 			}
 
-			db, err := gorm.Open(mysql.Open(dsn), gormConfig)
+			db, err := gorm.Open(dialector, gormConfig)
 			if err != nil {
 				return nil, err
 			}
@@ -86,49 +83,12 @@ var DatabaseModule = fx.Module("database",
 			sqlDB.SetConnMaxLifetime(cfg.Database.Primary.ConnMaxLifetime)
 
 			// Auto migrate
-			if err := db.AutoMigrate(&models.Subscription{}, &models.SubscriptionStats{}, &models.OperationLog{}); err != nil {
+			if err := db.AutoMigrate(&models.Subscription{}, &models.SubscriptionStats{}, &models.OperationLog{}, &models.ExecutionJob{}, &models.SubscriptionSchedule{}, &models.ScheduleRun{}, &models.SubscriptionACL{}, &models.APIKey{}, &models.SubscriptionRevision{}, &models.SubscriptionReview{}, &models.DataSource{}); err != nil {
 				return nil, err
 			}
 
 			return db, nil
 		},
-		func(cfg *config.Config, primaryDB *gorm.DB) map[string]*gorm.DB {
-			dataSources := make(map[string]*gorm.DB)
-			dataSources["primary"] = primaryDB
-
-			// 配置GORM日志
-			gormConfig := &gorm.Config{}
-			if cfg.Logging.FileLogEnabled {
-				fileLogger := logger.GetFileLogger()
-				gormLogger := logger.NewGormLogger(fileLogger)
-				gormConfig.Logger = gormLogger
-			}
-
-			for name, dbConfig := range cfg.Database.DataSources {
-				dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-					dbConfig.Username,
-					dbConfig.Password,
-					dbConfig.Host,
-					dbConfig.Port,
-					dbConfig.Database,
-				)
-
-				db, err := gorm.Open(mysql.Open(dsn), gormConfig)
-				if err != nil {
-					slog.Error("Failed to connect to data source", "name", name, "error", err)
-					continue
-				}
-
-				sqlDB, _ := db.DB()
-				sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
-				sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
-				sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
-
-				dataSources[name] = db
-			}
-
-			return dataSources
-		},
 	),
 )
 
@@ -158,16 +118,45 @@ var RepositoryModule = fx.Module("repository",
 		repository.NewStatsRepository,
 		repository.NewRefsRepository,
 		repository.NewOperationLogRepository,
+		repository.NewJobRepository,
+		repository.NewScheduleRepository,
+		repository.NewACLRepository,
+		repository.NewAPIKeyRepository,
+		repository.NewReviewRepository,
+		repository.NewDataSourceRepository,
 	),
 )
 
 // ServiceModule provides services
 var ServiceModule = fx.Module("service",
 	fx.Provide(
+		service.NewResultCache,
+		service.NewDataSourceRegistry,
+		service.NewDataSourceService,
+		service.NewAccessControl,
+		service.NewAPIKeyService,
 		service.NewSubscriptionService,
+		service.NewReviewService,
 		service.NewRefsService,
 		service.NewOperationLogService,
+		service.NewJobService,
+		service.NewScheduleService,
+		service.NewScheduler,
 	),
+	fx.Invoke(func(lc fx.Lifecycle, registry *service.DataSourceRegistry, jobService *service.JobService, scheduler *service.Scheduler) {
+		lc.Append(fx.Hook{
+			OnStart: registry.Start,
+			OnStop:  registry.Stop,
+		})
+		lc.Append(fx.Hook{
+			OnStart: jobService.Start,
+			OnStop:  jobService.Stop,
+		})
+		lc.Append(fx.Hook{
+			OnStart: scheduler.Start,
+			OnStop:  scheduler.Stop,
+		})
+	}),
 )
 
 // HandlerModule provides handlers
@@ -176,6 +165,11 @@ var HandlerModule = fx.Module("handler",
 		handler.NewSubscriptionHandler,
 		handler.NewRefsHandler,
 		handler.NewOperationLogHandler,
+		handler.NewJobHandler,
+		handler.NewScheduleHandler,
+		handler.NewAPIKeyHandler,
+		handler.NewReviewHandler,
+		handler.NewDataSourceHandler,
 	),
 )
 
@@ -194,6 +188,7 @@ var HTTPModule = fx.Module("http",
 	fx.Provide(NewGinEngine),
 	fx.Invoke(RegisterRoutes),
 	fx.Invoke(InitMetrics),
+	fx.Invoke(RegisterConfigReload),
 )
 
 // NewGinEngine creates a new Gin engine
@@ -231,6 +226,29 @@ func InitMetrics(cfg *config.Config) {
 	slog.Info("Metrics system initialized")
 }
 
+// RegisterConfigReload 监听配置变化，将可热更新的配置应用到限流、SQL策略、日志级别和数据源连接池
+func RegisterConfigReload(
+	lc fx.Lifecycle,
+	reloader *config.Reloader,
+	l *logger.Logger,
+	rateLimiter *middleware.RateLimiter,
+	subscriptionService *service.SubscriptionService,
+	registry *service.DataSourceRegistry,
+) {
+	reloader.OnReload(func(cfg *config.Config) {
+		rateLimiter.SetLimit(cfg.Server.RateLimit)
+		if err := l.SetLevel(cfg.Logging.Level); err != nil {
+			slog.Warn("Failed to apply log level", "error", err)
+		}
+		subscriptionService.ApplyConfig(cfg)
+		registry.ApplyConfig(cfg)
+	})
+	lc.Append(fx.Hook{
+		OnStart: reloader.Start,
+		OnStop:  reloader.Stop,
+	})
+}
+
 // RegisterRoutes registers all routes
 func RegisterRoutes(
 	engine *gin.Engine,
@@ -238,6 +256,11 @@ func RegisterRoutes(
 	subscriptionHandler *handler.SubscriptionHandler,
 	refsHandler *handler.RefsHandler,
 	operationLogHandler *handler.OperationLogHandler,
+	jobHandler *handler.JobHandler,
+	scheduleHandler *handler.ScheduleHandler,
+	apiKeyHandler *handler.APIKeyHandler,
+	reviewHandler *handler.ReviewHandler,
+	dataSourceHandler *handler.DataSourceHandler,
 	authMiddleware *middleware.AuthMiddleware,
 	rateLimiter *middleware.RateLimiter,
 ) {
@@ -245,14 +268,16 @@ func RegisterRoutes(
 	engine.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
+	engine.GET("/health/data-sources", dataSourceHandler.DataSourceHealth)
 	
 	// Metrics endpoint
 	engine.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	// API routes (需要 JWT 认证)
+	// API routes (需要 JWT 或 API Key 认证)
 	v1 := engine.Group("/v1")
 	v1.Use(rateLimiter.RateLimit())
-	v1.Use(authMiddleware.JWTAuth())
+	v1.Use(authMiddleware.Authenticate())
+	v1.Use(rateLimiter.APIKeyRateLimit())
 	{
 		// Refs
 		v1.GET("/refs/subscription-types", refsHandler.GetSubscriptionTypes)
@@ -261,21 +286,69 @@ func RegisterRoutes(
 		// Subscriptions
 		v1.GET("/subscriptions", subscriptionHandler.GetSubscriptions)
 		v1.POST("/subscriptions", subscriptionHandler.CreateSubscription)
+		v1.POST("/subscriptions/sync", subscriptionHandler.SyncSubscriptions)
+		v1.GET("/subscriptions/export", subscriptionHandler.ExportSubscriptions)
+		v1.POST("/subscriptions/import", subscriptionHandler.ImportSubscriptions)
 		v1.GET("/subscriptions/:key", subscriptionHandler.GetSubscription)
 		v1.GET("/subscriptions/:key/versions/:version", subscriptionHandler.GetSubscription)
 		v1.PUT("/subscriptions/:key/versions/:version", subscriptionHandler.UpdateSubscription)
 		v1.PATCH("/subscriptions/:key/versions/:version/status", subscriptionHandler.UpdateSubscriptionStatus)
 		v1.DELETE("/subscriptions/:key/versions/:version", subscriptionHandler.DeleteSubscription)
+		v1.POST("/subscriptions/:key/versions/:version/fork", subscriptionHandler.ForkSubscription)
+		v1.GET("/subscriptions/:key/versions/:version/revisions", subscriptionHandler.ListRevisions)
+		v1.POST("/subscriptions/:key/versions/:version/rollback", subscriptionHandler.RollbackSubscription)
+		v1.GET("/subscriptions/:key/acl", subscriptionHandler.GetACL)
+		v1.PUT("/subscriptions/:key/acl", subscriptionHandler.SetACL)
 
 		// Execution
 		v1.POST("/subscriptions/:key/execute", subscriptionHandler.ExecuteSubscription)
 		v1.POST("/subscriptions/:key/versions/:version/execute", subscriptionHandler.ExecuteSubscription)
+		v1.POST("/subscriptions/:key/dry-run", subscriptionHandler.DryRunSubscription)
+		v1.POST("/subscriptions/:key/versions/:version/dry-run", subscriptionHandler.DryRunSubscription)
+
+		// Async jobs
+		v1.POST("/subscriptions/:key/jobs", jobHandler.SubmitJob)
+		v1.POST("/subscriptions/:key/versions/:version/jobs", jobHandler.SubmitJob)
+		v1.GET("/jobs/:id", jobHandler.GetJob)
+		v1.GET("/jobs/:id/results", jobHandler.GetJobResults)
+		v1.POST("/jobs/:id/cancel", jobHandler.CancelJob)
+
+		// Scheduled delivery
+		v1.GET("/subscriptions/:key/schedules", scheduleHandler.ListSchedules)
+		v1.POST("/subscriptions/:key/schedules", scheduleHandler.CreateSchedule)
+		v1.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		v1.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+		v1.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+		v1.GET("/schedules/:id/runs", scheduleHandler.ListScheduleRuns)
 
 		// Stats
 		v1.GET("/subscriptions/stats", subscriptionHandler.GetStats)
 
 		// Operation logs
 		v1.GET("/operation-logs", operationLogHandler.GetOperationLogs)
+
+		// Reviews
+		v1.GET("/subscriptions/:key/versions/:version/reviews", reviewHandler.ListVersionReviews)
+		v1.POST("/subscriptions/:key/versions/:version/reviews", reviewHandler.SubmitReview)
+		v1.GET("/reviews", reviewHandler.ListReviews)
+		v1.GET("/reviews/:id", reviewHandler.GetReview)
+		v1.POST("/reviews/:id/approve", reviewHandler.ApproveReview)
+		v1.POST("/reviews/:id/reject", reviewHandler.RejectReview)
+
+		// API keys
+		v1.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+		v1.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+		v1.POST("/api-keys/:id/rotate", apiKeyHandler.RotateAPIKey)
+		v1.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+		// Data sources
+		v1.GET("/data-sources", dataSourceHandler.ListDataSources)
+		v1.POST("/data-sources", dataSourceHandler.CreateDataSource)
+		v1.GET("/data-sources/:name", dataSourceHandler.GetDataSource)
+		v1.PUT("/data-sources/:name", dataSourceHandler.UpdateDataSource)
+		v1.POST("/data-sources/:name/test", dataSourceHandler.TestDataSource)
+		v1.POST("/data-sources/:name/enable", dataSourceHandler.EnableDataSource)
+		v1.POST("/data-sources/:name/disable", dataSourceHandler.DisableDataSource)
 	}
 
 	// Internal API for Web UI (使用 BasicAuth，与 Web UI 共享认证)
@@ -289,22 +362,70 @@ func RegisterRoutes(
 		// Subscriptions
 		api.GET("/subscriptions", subscriptionHandler.GetSubscriptions)
 		api.POST("/subscriptions", subscriptionHandler.CreateSubscription)
+		api.POST("/subscriptions/sync", subscriptionHandler.SyncSubscriptions)
+		api.GET("/subscriptions/export", subscriptionHandler.ExportSubscriptions)
+		api.POST("/subscriptions/import", subscriptionHandler.ImportSubscriptions)
 		api.GET("/subscriptions/:key", subscriptionHandler.GetSubscription)
 		api.GET("/subscriptions/:key/versions/:version", subscriptionHandler.GetSubscription)
 		api.PUT("/subscriptions/:key/versions/:version", subscriptionHandler.UpdateSubscription)
 		api.PATCH("/subscriptions/:key/versions/:version/status", subscriptionHandler.UpdateSubscriptionStatus)
 		api.PUT("/subscriptions/:key/versions/:version/status", subscriptionHandler.UpdateSubscriptionStatus)
 		api.DELETE("/subscriptions/:key/versions/:version", subscriptionHandler.DeleteSubscription)
+		api.POST("/subscriptions/:key/versions/:version/fork", subscriptionHandler.ForkSubscription)
+		api.GET("/subscriptions/:key/versions/:version/revisions", subscriptionHandler.ListRevisions)
+		api.POST("/subscriptions/:key/versions/:version/rollback", subscriptionHandler.RollbackSubscription)
+		api.GET("/subscriptions/:key/acl", subscriptionHandler.GetACL)
+		api.PUT("/subscriptions/:key/acl", subscriptionHandler.SetACL)
 
 		// Execution
 		api.POST("/subscriptions/:key/execute", subscriptionHandler.ExecuteSubscription)
 		api.POST("/subscriptions/:key/versions/:version/execute", subscriptionHandler.ExecuteSubscription)
+		api.POST("/subscriptions/:key/dry-run", subscriptionHandler.DryRunSubscription)
+		api.POST("/subscriptions/:key/versions/:version/dry-run", subscriptionHandler.DryRunSubscription)
+
+		// Async jobs
+		api.POST("/subscriptions/:key/jobs", jobHandler.SubmitJob)
+		api.POST("/subscriptions/:key/versions/:version/jobs", jobHandler.SubmitJob)
+		api.GET("/jobs/:id", jobHandler.GetJob)
+		api.GET("/jobs/:id/results", jobHandler.GetJobResults)
+		api.POST("/jobs/:id/cancel", jobHandler.CancelJob)
+
+		// Scheduled delivery
+		api.GET("/subscriptions/:key/schedules", scheduleHandler.ListSchedules)
+		api.POST("/subscriptions/:key/schedules", scheduleHandler.CreateSchedule)
+		api.GET("/schedules/:id", scheduleHandler.GetSchedule)
+		api.PUT("/schedules/:id", scheduleHandler.UpdateSchedule)
+		api.DELETE("/schedules/:id", scheduleHandler.DeleteSchedule)
+		api.GET("/schedules/:id/runs", scheduleHandler.ListScheduleRuns)
 
 		// Stats
 		api.GET("/subscriptions/stats", subscriptionHandler.GetStats)
 
 		// Operation logs
 		api.GET("/operation-logs", operationLogHandler.GetOperationLogs)
+
+		// Reviews
+		api.GET("/subscriptions/:key/versions/:version/reviews", reviewHandler.ListVersionReviews)
+		api.POST("/subscriptions/:key/versions/:version/reviews", reviewHandler.SubmitReview)
+		api.GET("/reviews", reviewHandler.ListReviews)
+		api.GET("/reviews/:id", reviewHandler.GetReview)
+		api.POST("/reviews/:id/approve", reviewHandler.ApproveReview)
+		api.POST("/reviews/:id/reject", reviewHandler.RejectReview)
+
+		// API keys
+		api.GET("/api-keys", apiKeyHandler.ListAPIKeys)
+		api.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+		api.POST("/api-keys/:id/rotate", apiKeyHandler.RotateAPIKey)
+		api.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+		// Data sources
+		api.GET("/data-sources", dataSourceHandler.ListDataSources)
+		api.POST("/data-sources", dataSourceHandler.CreateDataSource)
+		api.GET("/data-sources/:name", dataSourceHandler.GetDataSource)
+		api.PUT("/data-sources/:name", dataSourceHandler.UpdateDataSource)
+		api.POST("/data-sources/:name/test", dataSourceHandler.TestDataSource)
+		api.POST("/data-sources/:name/enable", dataSourceHandler.EnableDataSource)
+		api.POST("/data-sources/:name/disable", dataSourceHandler.DisableDataSource)
 	}
 
 	// Web UI
@@ -118,8 +118,9 @@ func NewLoggerFromConfig(cfg *Config) (*Logger, error) {
 	slogLogger := slog.New(slogHandler)
 
 	return &Logger{
-		zap:  zapLogger,
-		slog: slogLogger,
+		zap:   zapLogger,
+		slog:  slogLogger,
+		level: zapConfig.Level,
 	}, nil
 }
 
@@ -154,8 +155,9 @@ func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
 	newSlog := slog.New(NewZapHandler(newZap))
 	
 	return &Logger{
-		zap:  newZap,
-		slog: newSlog,
+		zap:   newZap,
+		slog:  newSlog,
+		level: l.level,
 	}
 }
 
@@ -172,8 +174,9 @@ func (l *Logger) Named(name string) *Logger {
 	newSlog := slog.New(NewZapHandler(newZap))
 	
 	return &Logger{
-		zap:  newZap,
-		slog: newSlog,
+		zap:   newZap,
+		slog:  newSlog,
+		level: l.level,
 	}
 }
 
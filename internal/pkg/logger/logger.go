@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 
 	"go.uber.org/zap"
@@ -10,8 +11,9 @@ import (
 
 // Logger wraps zap logger with slog interface
 type Logger struct {
-	zap  *zap.Logger
-	slog *slog.Logger
+	zap   *zap.Logger
+	slog  *slog.Logger
+	level zap.AtomicLevel
 }
 
 // NewLogger creates a new logger instance
@@ -24,18 +26,7 @@ func NewLogger(level string, isDev bool) *Logger {
 	}
 
 	// Set log level
-	switch level {
-	case "debug":
-		zapConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	case "info":
-		zapConfig.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	case "warn":
-		zapConfig.Level = zap.NewAtomicLevelAt(zapcore.WarnLevel)
-	case "error":
-		zapConfig.Level = zap.NewAtomicLevelAt(zapcore.ErrorLevel)
-	default:
-		zapConfig.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
-	}
+	zapConfig.Level = zap.NewAtomicLevelAt(parseLevel(level))
 
 	zapLogger, err := zapConfig.Build()
 	if err != nil {
@@ -47,9 +38,35 @@ func NewLogger(level string, isDev bool) *Logger {
 	slogLogger := slog.New(slogHandler)
 
 	return &Logger{
-		zap:  zapLogger,
-		slog: slogLogger,
+		zap:   zapLogger,
+		slog:  slogLogger,
+		level: zapConfig.Level,
+	}
+}
+
+// parseLevel 解析日志级别，未知级别按 info 处理
+func parseLevel(level string) zapcore.Level {
+	switch level {
+	case "debug":
+		return zapcore.DebugLevel
+	case "warn":
+		return zapcore.WarnLevel
+	case "error":
+		return zapcore.ErrorLevel
+	default:
+		return zapcore.InfoLevel
+	}
+}
+
+// SetLevel 运行时调整日志级别，对已创建的 logger 立即生效
+func (l *Logger) SetLevel(level string) error {
+	switch level {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level: %s", level)
 	}
+	l.level.SetLevel(parseLevel(level))
+	return nil
 }
 
 // Zap returns the underlying zap logger
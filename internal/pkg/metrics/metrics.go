@@ -32,6 +32,17 @@ type Metrics struct {
 	ExecutionTotal    *prometheus.CounterVec
 	ExecutionDuration *prometheus.HistogramVec
 	ErrorTotal        *prometheus.CounterVec
+	CacheLookupTotal  *prometheus.CounterVec
+
+	// 数据源健康指标
+	DataSourceCircuitState *prometheus.GaugeVec
+	DataSourceLatency      *prometheus.GaugeVec
+	DataSourceFailureTotal *prometheus.CounterVec
+	DataSourceFailover     *prometheus.CounterVec
+
+	// 配置重新加载指标
+	ConfigReloadTotal       *prometheus.CounterVec
+	ConfigLastReloadSuccess *prometheus.GaugeVec
 }
 
 var globalMetrics *Metrics
@@ -187,6 +198,69 @@ func Init(serviceName string) *Metrics {
 			},
 			[]string{"service", "type", "code"},
 		),
+
+		// 结果缓存查询
+		CacheLookupTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "subscription_cache_lookups_total",
+				Help: "Total number of subscription result cache lookups",
+			},
+			[]string{"service", "subscription_key", "result"}, // result: hit, miss
+		),
+
+		// 数据源熔断状态
+		DataSourceCircuitState: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "datasource_circuit_state",
+				Help: "Circuit breaker state of data sources (0=closed, 1=half_open, 2=open)",
+			},
+			[]string{"service", "data_source"},
+		),
+
+		// 数据源延迟（指数滑动平均）
+		DataSourceLatency: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "datasource_latency_seconds",
+				Help: "Smoothed latency of data source pings and queries in seconds",
+			},
+			[]string{"service", "data_source"},
+		),
+
+		// 数据源故障
+		DataSourceFailureTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "datasource_failures_total",
+				Help: "Total number of data source failures",
+			},
+			[]string{"service", "data_source", "source"}, // source: ping, query
+		),
+
+		// 切换到备用副本
+		DataSourceFailover: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "datasource_failover_total",
+				Help: "Total number of executions routed to a fallback replica",
+			},
+			[]string{"service", "data_source", "replica"},
+		),
+
+		// 配置重新加载
+		ConfigReloadTotal: promauto.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "config_reload_total",
+				Help: "Total number of configuration reload attempts",
+			},
+			[]string{"service", "trigger", "result"}, // trigger: file, signal; result: success, failure
+		),
+
+		// 最近一次配置重新加载是否成功
+		ConfigLastReloadSuccess: promauto.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "config_last_reload_successful",
+				Help: "Whether the last configuration reload attempt was successful (1=success, 0=failure)",
+			},
+			[]string{"service"},
+		),
 	}
 	
 	globalMetrics = m
@@ -260,6 +334,55 @@ func RecordExecution(service, subscriptionKey string, duration time.Duration, er
 	m.ExecutionDuration.WithLabelValues(service, subscriptionKey).Observe(duration.Seconds())
 }
 
+// RecordCacheLookup 记录结果缓存查询
+func RecordCacheLookup(service, subscriptionKey string, hit bool) {
+	m := GetMetrics()
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	m.CacheLookupTotal.WithLabelValues(service, subscriptionKey, result).Inc()
+}
+
+// SetDataSourceCircuitState 设置数据源熔断状态
+func SetDataSourceCircuitState(service, dataSource string, state int) {
+	m := GetMetrics()
+	m.DataSourceCircuitState.WithLabelValues(service, dataSource).Set(float64(state))
+}
+
+// SetDataSourceLatency 设置数据源延迟
+func SetDataSourceLatency(service, dataSource string, latency time.Duration) {
+	m := GetMetrics()
+	m.DataSourceLatency.WithLabelValues(service, dataSource).Set(latency.Seconds())
+}
+
+// RecordDataSourceFailure 记录数据源故障
+func RecordDataSourceFailure(service, dataSource, source string) {
+	m := GetMetrics()
+	m.DataSourceFailureTotal.WithLabelValues(service, dataSource, source).Inc()
+}
+
+// RecordDataSourceFailover 记录切换到备用副本
+func RecordDataSourceFailover(service, dataSource, replica string) {
+	m := GetMetrics()
+	m.DataSourceFailover.WithLabelValues(service, dataSource, replica).Inc()
+}
+
+// RecordConfigReload 记录配置重新加载结果
+func RecordConfigReload(service, trigger string, err error) {
+	m := GetMetrics()
+
+	result, success := "success", 1.0
+	if err != nil {
+		result, success = "failure", 0
+	}
+
+	m.ConfigReloadTotal.WithLabelValues(service, trigger, result).Inc()
+	m.ConfigLastReloadSuccess.WithLabelValues(service).Set(success)
+}
+
 // RecordError 记录错误
 func RecordError(service, errorType, errorCode string) {
 	m := GetMetrics()
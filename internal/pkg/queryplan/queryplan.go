@@ -0,0 +1,291 @@
+// Package queryplan 解析 MySQL EXPLAIN FORMAT=JSON 的执行计划并按护栏规则评估查询成本
+package queryplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
+)
+
+// 护栏规则
+const (
+	RuleMaxEstimatedRows = "max_estimated_rows" // 估算扫描行数超限
+	RuleFullScan         = "full_scan"          // 对受保护的表全表扫描
+)
+
+// TableAccess 执行计划中的一次表访问
+type TableAccess struct {
+	Table         string   `json:"table"`           // 解析别名后的 schema.table，派生表保留原名
+	Alias         string   `json:"alias,omitempty"` // 执行计划中的表名，与 Table 相同时为空
+	AccessType    string   `json:"access_type"`
+	PossibleKeys  []string `json:"possible_keys,omitempty"`
+	Key           string   `json:"key,omitempty"`
+	RowsPerScan   int64    `json:"rows_examined_per_scan"`
+	RowsExamined  int64    `json:"rows_examined"` // 考虑嵌套循环后的估算扫描行数
+	FullScan      bool     `json:"full_scan"`
+	UsingFilesort bool     `json:"using_filesort,omitempty"`
+}
+
+// Plan 执行计划摘要
+type Plan struct {
+	QueryCost     float64         `json:"query_cost"`
+	EstimatedRows int64           `json:"estimated_rows"` // 各表估算扫描行数之和
+	Tables        []TableAccess   `json:"tables"`
+	Warnings      []string        `json:"warnings"`
+	Raw           json.RawMessage `json:"raw"`
+}
+
+// ParseMySQL 解析 EXPLAIN FORMAT=JSON 的输出，aliases 为别名到 schema.table 的映射
+func ParseMySQL(raw []byte, aliases map[string]string) (*Plan, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var root map[string]interface{}
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid EXPLAIN output: %w", err)
+	}
+
+	block, ok := root["query_block"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid EXPLAIN output: query_block not found")
+	}
+
+	w := &walker{aliases: aliases, warnings: make(map[string]bool)}
+	w.walk(block, 1)
+
+	plan := &Plan{
+		Tables:   w.tables,
+		Warnings: make([]string, 0, len(w.warnings)),
+		Raw:      json.RawMessage(raw),
+	}
+	if costInfo, ok := block["cost_info"].(map[string]interface{}); ok {
+		plan.QueryCost = toFloat(costInfo["query_cost"])
+	}
+	for _, table := range plan.Tables {
+		plan.EstimatedRows += table.RowsExamined
+	}
+	for warning := range w.warnings {
+		plan.Warnings = append(plan.Warnings, warning)
+	}
+	sort.Strings(plan.Warnings)
+	return plan, nil
+}
+
+type walker struct {
+	aliases  map[string]string
+	tables   []TableAccess
+	warnings map[string]bool
+}
+
+// walk 递归遍历执行计划，loops 为外层循环的估算执行次数
+func (w *walker) walk(node interface{}, loops float64) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if v["using_filesort"] == true {
+			w.warnings["query uses filesort"] = true
+		}
+		if v["using_temporary_table"] == true {
+			w.warnings["query uses a temporary table"] = true
+		}
+
+		for _, key := range sortedKeys(v) {
+			switch key {
+			case "table":
+				if table, ok := v[key].(map[string]interface{}); ok {
+					w.table(table, loops)
+				}
+			case "nested_loop":
+				items, _ := v[key].([]interface{})
+				w.nestedLoop(items, loops)
+			default:
+				w.walk(v[key], loops)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			w.walk(item, loops)
+		}
+	}
+}
+
+// nestedLoop 嵌套循环中每张表的扫描次数等于前面各表连接后的行数
+func (w *walker) nestedLoop(items []interface{}, loops float64) {
+	prefix := loops
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		table, ok := m["table"].(map[string]interface{})
+		if !ok {
+			w.walk(m, prefix)
+			continue
+		}
+		if produced := w.table(table, prefix); produced > 0 {
+			prefix = produced * loops
+		}
+	}
+}
+
+// table 记录一次表访问，返回连接后产生的行数
+func (w *walker) table(t map[string]interface{}, loops float64) float64 {
+	name, _ := t["table_name"].(string)
+	access := TableAccess{
+		Table:         name,
+		AccessType:    stringValue(t["access_type"]),
+		PossibleKeys:  stringList(t["possible_keys"]),
+		Key:           stringValue(t["key"]),
+		RowsPerScan:   int64(toFloat(t["rows_examined_per_scan"])),
+		UsingFilesort: t["using_filesort"] == true,
+	}
+	if resolved, ok := w.aliases[strings.ToLower(name)]; ok {
+		access.Table = resolved
+		if resolved != strings.ToLower(name) {
+			access.Alias = name
+		}
+	}
+	access.RowsExamined = int64(float64(access.RowsPerScan) * loops)
+
+	switch access.AccessType {
+	case "ALL":
+		access.FullScan = true
+		w.warnings[fmt.Sprintf("full table scan on %s", access.Table)] = true
+		if len(access.PossibleKeys) == 0 {
+			w.warnings[fmt.Sprintf("no usable index on %s", access.Table)] = true
+		}
+	case "index":
+		w.warnings[fmt.Sprintf("full index scan on %s", access.Table)] = true
+	}
+	if len(access.PossibleKeys) > 0 && access.Key == "" {
+		w.warnings[fmt.Sprintf("index not used on %s (possible keys: %s)", access.Table, strings.Join(access.PossibleKeys, ", "))] = true
+	}
+
+	if name != "" {
+		w.tables = append(w.tables, access)
+	}
+
+	// 物化子查询、附加子查询等嵌套在表节点内
+	for _, key := range sortedKeys(t) {
+		switch v := t[key].(type) {
+		case map[string]interface{}, []interface{}:
+			w.walk(v, 1)
+		}
+	}
+
+	return toFloat(t["rows_produced_per_join"])
+}
+
+// Guardrails 查询成本护栏，零值表示不限制
+type Guardrails struct {
+	MaxEstimatedRows int64    // 估算扫描行数上限
+	NoFullScanTables []string // 禁止全表扫描的表，支持 schema.table 和通配符
+}
+
+// Enabled 是否配置了任一护栏
+func (g Guardrails) Enabled() bool {
+	return g.MaxEstimatedRows > 0 || len(g.NoFullScanTables) > 0
+}
+
+// Violation 违反的护栏规则
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Table   string `json:"table,omitempty"`
+}
+
+// Check 按护栏评估执行计划，返回全部违规项
+func (g Guardrails) Check(plan *Plan) []Violation {
+	var violations []Violation
+	if g.MaxEstimatedRows > 0 && plan.EstimatedRows > g.MaxEstimatedRows {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxEstimatedRows,
+			Message: fmt.Sprintf("estimated rows examined %d exceeds the limit of %d", plan.EstimatedRows, g.MaxEstimatedRows),
+		})
+	}
+
+	for _, table := range plan.Tables {
+		if !table.FullScan {
+			continue
+		}
+		schema, name := splitTable(table.Table)
+		for _, pattern := range g.NoFullScanTables {
+			if sqlguard.MatchTable(pattern, schema, name) {
+				violations = append(violations, Violation{
+					Rule:    RuleFullScan,
+					Message: fmt.Sprintf("full table scan on %s is not allowed", table.Table),
+					Table:   table.Table,
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// GuardrailError 查询违反成本护栏
+type GuardrailError struct {
+	Violations []Violation
+}
+
+func (e *GuardrailError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "query guardrail violated: " + strings.Join(messages, "; ")
+}
+
+func splitTable(table string) (string, string) {
+	table = strings.ToLower(table)
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[:i], table[i+1:]
+	}
+	return "", table
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	list := make([]string, 0, len(items))
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+// toFloat 兼容数值和字符串形式（如 cost_info 中的 "1.20"）
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case json.Number:
+		f, _ := n.Float64()
+		return f
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	case float64:
+		return n
+	}
+	return 0
+}
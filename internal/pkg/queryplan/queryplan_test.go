@@ -0,0 +1,81 @@
+package queryplan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const joinPlan = `{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "1250.40"},
+    "ordering_operation": {
+      "using_filesort": true,
+      "nested_loop": [
+        {
+          "table": {
+            "table_name": "h",
+            "access_type": "ALL",
+            "possible_keys": ["PRIMARY"],
+            "rows_examined_per_scan": 1000,
+            "rows_produced_per_join": 100,
+            "filtered": "10.00"
+          }
+        },
+        {
+          "table": {
+            "table_name": "events",
+            "access_type": "ref",
+            "possible_keys": ["idx_house"],
+            "key": "idx_house",
+            "rows_examined_per_scan": 20,
+            "rows_produced_per_join": 2000
+          }
+        }
+      ]
+    }
+  }
+}`
+
+func TestParseMySQL(t *testing.T) {
+	plan, err := ParseMySQL([]byte(joinPlan), map[string]string{"h": "bi.houses", "events": "stat.events"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1250.40, plan.QueryCost)
+	require.Len(t, plan.Tables, 2)
+
+	houses := plan.Tables[0]
+	assert.Equal(t, "bi.houses", houses.Table)
+	assert.Equal(t, "h", houses.Alias)
+	assert.True(t, houses.FullScan)
+	assert.Equal(t, int64(1000), houses.RowsExamined)
+
+	// 被驱动表按驱动表产生的行数循环扫描
+	assert.Equal(t, int64(2000), plan.Tables[1].RowsExamined)
+	assert.Equal(t, int64(3000), plan.EstimatedRows)
+
+	assert.Contains(t, plan.Warnings, "full table scan on bi.houses")
+	assert.Contains(t, plan.Warnings, "index not used on bi.houses (possible keys: PRIMARY)")
+	assert.Contains(t, plan.Warnings, "query uses filesort")
+}
+
+func TestParseMySQLInvalid(t *testing.T) {
+	_, err := ParseMySQL([]byte(`{"foo": 1}`), nil)
+	assert.Error(t, err)
+}
+
+func TestGuardrailsCheck(t *testing.T) {
+	plan, err := ParseMySQL([]byte(joinPlan), map[string]string{"h": "bi.houses", "events": "stat.events"})
+	require.NoError(t, err)
+
+	assert.False(t, Guardrails{}.Enabled())
+	assert.Empty(t, Guardrails{MaxEstimatedRows: 5000, NoFullScanTables: []string{"stat.*"}}.Check(plan))
+
+	violations := Guardrails{MaxEstimatedRows: 1000, NoFullScanTables: []string{"houses"}}.Check(plan)
+	require.Len(t, violations, 2)
+	assert.Equal(t, RuleMaxEstimatedRows, violations[0].Rule)
+	assert.Equal(t, RuleFullScan, violations[1].Rule)
+	assert.Equal(t, "bi.houses", violations[1].Table)
+}
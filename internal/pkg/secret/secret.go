@@ -0,0 +1,87 @@
+// Package secret 使用 AES-256-GCM 加密需要落库的凭据
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 密文格式版本前缀，便于以后更换算法
+const prefixV1 = "v1:"
+
+var (
+	ErrKeyMissing = errors.New("encryption key is not configured")
+	ErrCiphertext = errors.New("invalid ciphertext")
+)
+
+// Cipher 对称加密器，密钥为空时只能处理空值
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher 由 base64 编码的 32 字节密钥创建加密器，key 为空时返回未配置密钥的加密器
+func NewCipher(key string) (*Cipher, error) {
+	if key == "" {
+		return &Cipher{}, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64 encoded: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Encrypt 加密明文，空字符串原样返回
+func (c *Cipher) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if c.aead == nil {
+		return "", ErrKeyMissing
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefixV1 + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 的输出，空字符串原样返回
+func (c *Cipher) Decrypt(encoded string) (string, error) {
+	if encoded == "" {
+		return "", nil
+	}
+	if c.aead == nil {
+		return "", ErrKeyMissing
+	}
+	if !strings.HasPrefix(encoded, prefixV1) {
+		return "", ErrCiphertext
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encoded, prefixV1))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", ErrCiphertext
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCiphertext, err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,57 @@
+package secret
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestEncryptDecrypt(t *testing.T) {
+	c, err := NewCipher(testKey)
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, prefixV1))
+	assert.NotContains(t, encrypted, "s3cret")
+
+	// 每次加密使用随机 nonce
+	again, err := c.Encrypt("s3cret")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	plain, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", plain)
+
+	// 其他密钥无法解密
+	other, err := NewCipher(base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")))
+	require.NoError(t, err)
+	_, err = other.Decrypt(encrypted)
+	assert.True(t, errors.Is(err, ErrCiphertext))
+}
+
+func TestCipherWithoutKey(t *testing.T) {
+	c, err := NewCipher("")
+	require.NoError(t, err)
+
+	empty, err := c.Encrypt("")
+	require.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	_, err = c.Encrypt("s3cret")
+	assert.True(t, errors.Is(err, ErrKeyMissing))
+}
+
+func TestNewCipherRejectsInvalidKey(t *testing.T) {
+	_, err := NewCipher("not base64!")
+	assert.Error(t, err)
+	_, err = NewCipher(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,472 @@
+package sqlguard
+
+import (
+	"fmt"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+)
+
+// 非 MySQL 方言没有可用的语法树解析器，按词法单元校验：
+// 语句数量和类型、写操作和锁定关键字、函数调用，以及 FROM 子句中引用的表。
+// 词法规则与目标数据库保持一致（注释、引号、转义），避免数据库执行的内容被当作字面量或注释跳过。
+
+type tokenKind int
+
+const (
+	tokenWord   tokenKind = iota // 未加引号的标识符或关键字，已转为小写
+	tokenQuoted                  // 加引号的标识符，已去掉引号并转为小写
+	tokenString                  // 字符串字面量
+	tokenNumber
+	tokenParam  // ? 或 $n 参数
+	tokenSymbol // 运算符和标点
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) ident() bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted
+}
+
+// writeKeywords 只读查询中不应出现的关键字
+var writeKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "upsert": true, "replace": true,
+	"create": true, "drop": true, "alter": true, "truncate": true, "rename": true, "grant": true, "revoke": true,
+	"copy": true, "vacuum": true, "attach": true, "detach": true, "pragma": true, "optimize": true, "kill": true, "call": true,
+}
+
+// clauseKeywords 结束 FROM 子句的关键字
+var clauseKeywords = map[string]bool{
+	"where": true, "group": true, "order": true, "having": true, "limit": true, "offset": true, "fetch": true,
+	"union": true, "except": true, "intersect": true, "window": true, "qualify": true, "prewhere": true,
+	"settings": true, "format": true, "returning": true, "for": true, "into": true,
+}
+
+// fromFunctions 参数中可以出现 FROM 关键字的函数
+var fromFunctions = map[string]bool{
+	"extract": true, "substring": true, "substr": true, "trim": true, "overlay": true, "position": true,
+}
+
+// validateTokens 按词法规则校验非 MySQL 方言的SQL
+func validateTokens(sql string, policy Policy) error {
+	tokens, err := tokenize(sql, policy.Dialect)
+	if err != nil {
+		return &ValidationError{Violations: []Violation{{
+			Rule:    RuleSyntax,
+			Message: fmt.Sprintf("SQL syntax error: %v", err),
+		}}}
+	}
+
+	// 只允许末尾的分号
+	for len(tokens) > 0 && tokens[len(tokens)-1].is(tokenSymbol, ";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	statements := 1
+	for _, t := range tokens {
+		if t.is(tokenSymbol, ";") {
+			statements++
+		}
+	}
+	if len(tokens) == 0 || statements != 1 {
+		return &ValidationError{Violations: []Violation{{
+			Rule:    RuleMultipleStatement,
+			Message: fmt.Sprintf("exactly one statement is allowed, got %d", statements),
+		}}}
+	}
+
+	match, opener, err := matchParens(tokens)
+	if err != nil {
+		return &ValidationError{Violations: []Violation{{
+			Rule:    RuleSyntax,
+			Message: fmt.Sprintf("SQL syntax error: %v", err),
+		}}}
+	}
+
+	c := &checker{policy: policy}
+	l := &lexicalChecker{checker: c, tokens: tokens, match: match, opener: opener, cteRanges: cteRanges(tokens, match)}
+	l.check()
+
+	if len(c.violations) > 0 {
+		return &ValidationError{Violations: c.violations}
+	}
+	return nil
+}
+
+type lexicalChecker struct {
+	*checker
+	tokens []token
+	match  []int    // 括号对应的另一半位置
+	opener []string // 每个词法单元所在的最内层括号前的函数名
+
+	cteRanges []cteRange
+}
+
+func (l *lexicalChecker) check() {
+	first := 0
+	for first < len(l.tokens) && l.tokens[first].is(tokenSymbol, "(") {
+		first++
+	}
+	stmtType := "SELECT"
+	if first < len(l.tokens) && l.tokens[first].kind == tokenWord {
+		if word := l.tokens[first].text; word != "select" && word != "with" {
+			stmtType = strings.ToUpper(word)
+		}
+	}
+	if !l.statementAllowed(stmtType) {
+		l.addText(RuleStatementType, stmtType,
+			"statement type %s not allowed, only %v are permitted", stmtType, l.policy.AllowedStatements)
+	}
+
+	for i, t := range l.tokens {
+		prev, next := l.at(i-1), l.at(i+1)
+		qualified := prev.is(tokenSymbol, ".") || next.is(tokenSymbol, ".")
+
+		// 函数调用，包括带模式名和加引号的函数名
+		if t.ident() && next.is(tokenSymbol, "(") && l.functionDenied(t.text) {
+			l.addText(RuleDeniedFunction, t.text, "function %s is not allowed", strings.ToUpper(t.text))
+		}
+		if t.kind != tokenWord || qualified {
+			continue
+		}
+
+		switch {
+		case t.text == "for" && (next.is(tokenWord, "update") || next.is(tokenWord, "share") || next.is(tokenWord, "no") || next.is(tokenWord, "key")):
+			l.addText(RuleLockingClause, "FOR "+strings.ToUpper(next.text), "locking clauses are not allowed")
+		case writeKeywords[t.text] && !next.is(tokenSymbol, "(") && !prev.is(tokenWord, "for") && !prev.is(tokenWord, "key"):
+			// 顶层语句类型已单独校验
+			if i != first {
+				l.addText(RuleWrite, strings.ToUpper(t.text), "write statements are not allowed")
+			}
+		case t.text == "into" && !(prev.kind == tokenWord && writeKeywords[prev.text]):
+			// INSERT INTO 等已按写操作拒绝
+			l.addText(RuleSelectInto, "INTO", "SELECT ... INTO is not allowed")
+		case t.text == "from" && l.tableClause(i):
+			l.checkFrom(i)
+		case t.text == "table" && next.ident():
+			// PostgreSQL 的 TABLE name 等同于 SELECT * FROM name
+			l.tableRef(i + 1)
+		}
+	}
+}
+
+func (l *lexicalChecker) at(i int) token {
+	if i < 0 || i >= len(l.tokens) {
+		return token{kind: tokenSymbol}
+	}
+	return l.tokens[i]
+}
+
+// tableClause 是否为引用表的 FROM，排除 EXTRACT(x FROM y) 和 IS DISTINCT FROM
+func (l *lexicalChecker) tableClause(i int) bool {
+	if fromFunctions[l.opener[i]] {
+		return false
+	}
+	return !(l.at(i-1).is(tokenWord, "distinct") && (l.at(i-2).is(tokenWord, "is") || l.at(i-2).is(tokenWord, "not")))
+}
+
+// checkFrom 检查 FROM 子句中的表，子句在同一括号层级的结束关键字或右括号处结束
+// 子句开头、同层级的逗号和 JOIN 之后是表引用；ARRAY JOIN 之后是数组列
+func (l *lexicalChecker) checkFrom(from int) {
+	start := true
+	arrayJoin := false
+	for i := from + 1; i < len(l.tokens); i++ {
+		t := l.tokens[i]
+		if t.is(tokenSymbol, ")") {
+			return
+		}
+		if t.kind == tokenWord && clauseKeywords[t.text] && !l.at(i-1).is(tokenSymbol, ".") && !l.at(i+1).is(tokenSymbol, ".") {
+			return
+		}
+		if start {
+			start = false
+			if !arrayJoin {
+				l.tableRef(i)
+			}
+		}
+		switch {
+		case t.is(tokenSymbol, "("):
+			i = l.match[i]
+		case t.is(tokenSymbol, ","):
+			start = true
+		case t.is(tokenWord, "join"):
+			start = true
+			arrayJoin = l.at(i-1).is(tokenWord, "array")
+		}
+	}
+}
+
+// tableRef 检查位置 i 开始的表引用，子查询和表函数由其他规则检查
+func (l *lexicalChecker) tableRef(i int) {
+	for l.at(i).is(tokenWord, "only") || l.at(i).is(tokenWord, "lateral") {
+		i++
+	}
+	var parts []string
+	for l.at(i).ident() {
+		parts = append(parts, l.at(i).text)
+		if !l.at(i+1).is(tokenSymbol, ".") {
+			break
+		}
+		i += 2
+	}
+	if len(parts) == 0 || l.at(i+1).is(tokenSymbol, "(") {
+		return
+	}
+
+	table := parts[len(parts)-1]
+	schema := ""
+	if len(parts) > 1 {
+		// PostgreSQL 允许 database.schema.table
+		schema = parts[len(parts)-2]
+	} else if l.cteVisible(table, i) {
+		return
+	}
+	if rule, msg := l.tableViolation(schema, table); rule != "" {
+		l.addText(rule, strings.Join(parts, "."), "%s", msg)
+	}
+}
+
+// cteRange CTE 名称及其可见的词法单元范围 [from, to)
+type cteRange struct {
+	name     string
+	from, to int
+}
+
+// cteRanges 收集 WITH 子句定义的名称：WITH [RECURSIVE] name [(columns)] AS [[NOT] MATERIALIZED] (...) [, ...]
+// 名称在定义结束后（RECURSIVE 时在定义内）到 WITH 所在括号层级结束前可见
+func cteRanges(tokens []token, match []int) []cteRange {
+	at := func(i int) token {
+		if i >= len(tokens) {
+			return token{kind: tokenSymbol}
+		}
+		return tokens[i]
+	}
+
+	var ranges []cteRange
+	for w, t := range tokens {
+		if !t.is(tokenWord, "with") || (w > 0 && tokens[w-1].is(tokenSymbol, ".")) {
+			continue
+		}
+		end := len(tokens)
+		for j := w - 1; j >= 0; j-- {
+			if tokens[j].is(tokenSymbol, ")") {
+				j = match[j]
+			} else if tokens[j].is(tokenSymbol, "(") {
+				end = match[j]
+				break
+			}
+		}
+
+		i := w + 1
+		recursive := at(i).is(tokenWord, "recursive")
+		if recursive {
+			i++
+		}
+		for at(i).ident() {
+			j := i + 1
+			if at(j).is(tokenSymbol, "(") {
+				j = match[j] + 1
+			}
+			if !at(j).is(tokenWord, "as") {
+				break
+			}
+			j++
+			for at(j).is(tokenWord, "not") || at(j).is(tokenWord, "materialized") {
+				j++
+			}
+			if !at(j).is(tokenSymbol, "(") {
+				break
+			}
+			from := match[j] + 1
+			if recursive {
+				from = j
+			}
+			ranges = append(ranges, cteRange{name: tokens[i].text, from: from, to: end})
+
+			i = match[j] + 1
+			if !at(i).is(tokenSymbol, ",") {
+				break
+			}
+			i++
+		}
+	}
+	return ranges
+}
+
+// cteVisible 位置 i 处的表名是否引用 CTE
+func (l *lexicalChecker) cteVisible(name string, i int) bool {
+	for _, r := range l.cteRanges {
+		if r.name == name && r.from <= i && i < r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// matchParens 配对括号，并记录每个词法单元所在括号前的函数名
+func matchParens(tokens []token) ([]int, []string, error) {
+	match := make([]int, len(tokens))
+	opener := make([]string, len(tokens))
+	var stack []int
+	for i, t := range tokens {
+		if len(stack) > 0 {
+			if open := stack[len(stack)-1]; open > 0 && tokens[open-1].ident() {
+				opener[i] = tokens[open-1].text
+			}
+		}
+		switch {
+		case t.is(tokenSymbol, "("):
+			stack = append(stack, i)
+		case t.is(tokenSymbol, ")"):
+			if len(stack) == 0 {
+				return nil, nil, fmt.Errorf("unbalanced parentheses")
+			}
+			open := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			match[open], match[i] = i, open
+		}
+	}
+	if len(stack) > 0 {
+		return nil, nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return match, opener, nil
+}
+
+// tokenize 按方言的注释、引号和转义规则切分词法单元，跳过空白和注释
+func tokenize(sql, driver string) ([]token, error) {
+	var tokens []token
+	backslash := dialect.BackslashEscapes(driver)
+	n := len(sql)
+
+	for i := 0; i < n; {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+
+		case c == '-' && i+1 < n && sql[i+1] == '-', c == '#' && dialect.HashComments(driver):
+			for i < n && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+
+		case c == '\'':
+			// PostgreSQL 的 E'...' 字符串支持反斜杠转义
+			escapes := backslash
+			if len(tokens) > 0 && i > 0 && (sql[i-1] == 'e' || sql[i-1] == 'E') && tokens[len(tokens)-1].is(tokenWord, "e") {
+				tokens = tokens[:len(tokens)-1]
+				escapes = true
+			}
+			end, err := scanQuoted(sql, i, '\'', escapes)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sql[i:end]})
+			i = end
+
+		case c == '"' || (c == '`' && driver != dialect.Postgres):
+			end, err := scanQuoted(sql, i, c, backslash)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.ReplaceAll(sql[i+1:end-1], string([]byte{c, c}), string(c))
+			tokens = append(tokens, token{kind: tokenQuoted, text: strings.ToLower(name)})
+			i = end
+
+		case c == '[' && driver == dialect.SQLite:
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier")
+			}
+			tokens = append(tokens, token{kind: tokenQuoted, text: strings.ToLower(sql[i+1 : i+end])})
+			i += end + 1
+
+		case c == '$' && driver == dialect.Postgres:
+			j := i + 1
+			for j < n && isWordByte(sql[j]) && !(j == i+1 && sql[j] >= '0' && sql[j] <= '9') {
+				j++
+			}
+			if j < n && sql[j] == '$' {
+				// 美元符号引用的字符串 $tag$...$tag$
+				tag := sql[i : j+1]
+				end := strings.Index(sql[j+1:], tag)
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated dollar-quoted string")
+				}
+				end += j + 1 + len(tag)
+				tokens = append(tokens, token{kind: tokenString, text: sql[i:end]})
+				i = end
+				continue
+			}
+			j = i + 1
+			for j < n && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenParam, text: sql[i:j]})
+			i = j
+
+		case c == '?':
+			tokens = append(tokens, token{kind: tokenParam, text: "?"})
+			i++
+
+		case c >= '0' && c <= '9':
+			j := i
+			for j < n && (isWordByte(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: sql[i:j]})
+			i = j
+
+		case isWordByte(c):
+			j := i
+			for j < n && (isWordByte(sql[j]) || sql[j] == '$') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: strings.ToLower(sql[i:j])})
+			i = j
+
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// scanQuoted 返回以 start 处引号开始的字面量或标识符的结束位置（不含），连续两个引号表示引号本身
+func scanQuoted(sql string, start int, quote byte, backslash bool) (int, error) {
+	for i := start + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	if quote == '\'' {
+		return 0, fmt.Errorf("unterminated string literal")
+	}
+	return 0, fmt.Errorf("unterminated identifier")
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c >= 0x80
+}
@@ -0,0 +1,421 @@
+// Package sqlguard 订阅 SQL 安全校验：MySQL 基于语法树，其他方言基于词法分析
+package sqlguard
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver" // 提供字面量节点实现
+)
+
+// 违规规则
+const (
+	RuleSyntax            = "syntax"              // 语法错误
+	RuleMultipleStatement = "multiple_statements" // 多条语句
+	RuleStatementType     = "statement_type"      // 语句类型不允许
+	RuleWrite             = "write_statement"     // 嵌套写操作
+	RuleSelectInto        = "select_into"         // INTO OUTFILE/DUMPFILE/变量
+	RuleLockingClause     = "locking_clause"      // FOR UPDATE / LOCK IN SHARE MODE
+	RuleDeniedFunction    = "denied_function"     // 禁用函数
+	RuleTableNotAllowed   = "table_not_allowed"   // 表不在白名单
+	RuleTableDenied       = "table_denied"        // 表在黑名单
+)
+
+// defaultDeniedFunctions 默认禁用的函数：文件读取、延时和锁
+var defaultDeniedFunctions = []string{
+	"load_file", "sleep", "benchmark",
+	"get_lock", "release_lock", "release_all_locks", "is_free_lock", "is_used_lock",
+	"master_pos_wait", "source_pos_wait", "wait_for_executed_gtid_set",
+}
+
+// defaultDeniedTables 默认禁止访问的系统库
+var defaultDeniedTables = []string{"mysql.*", "performance_schema.*", "sys.*", "information_schema.*"}
+
+// dialectDeniedFunctions 各方言默认禁用的函数，支持通配符：文件和网络访问、延时、锁、执行任意SQL、绕过表策略读表
+var dialectDeniedFunctions = map[string][]string{
+	dialect.MySQL: defaultDeniedFunctions,
+	dialect.Postgres: {
+		"pg_sleep*", "pg_read_file", "pg_read_binary_file", "pg_ls_*", "pg_stat_file", "lo_*",
+		"dblink*", "pg_advisory*", "pg_try_advisory*", "pg_terminate_backend", "pg_cancel_backend",
+		"pg_reload_conf", "pg_notify", "set_config", "nextval", "setval",
+		"query_to_xml*", "cursor_to_xml*", "table_to_xml*", "schema_to_xml*", "database_to_xml*", "ts_stat",
+	},
+	dialect.ClickHouse: {
+		"sleep", "sleepeachrow", "file", "url", "remote", "remotesecure", "cluster", "clusterallreplicas",
+		"s3*", "gcs", "hdfs*", "azureblobstorage*", "deltalake", "hudi", "iceberg*",
+		"mysql", "postgresql", "sqlite", "mongodb", "redis", "jdbc", "odbc", "executable", "input", "merge", "loop", "joinget*",
+	},
+	dialect.SQLite: {"load_extension", "readfile", "writefile", "edit", "fts3_tokenizer"},
+}
+
+// dialectDeniedTables 各方言默认禁止访问的系统库和系统表
+var dialectDeniedTables = map[string][]string{
+	dialect.MySQL:      defaultDeniedTables,
+	dialect.Postgres:   {"pg_catalog.*", "information_schema.*", "pg_*"},
+	dialect.ClickHouse: {"system.*", "information_schema.*"},
+	dialect.SQLite:     {"sqlite_*"},
+}
+
+// Policy 校验策略
+type Policy struct {
+	AllowedStatements []string // 允许的语句类型，如 SELECT、SHOW
+	DeniedFunctions   []string // 额外禁用的函数
+	AllowedTables     []string // 表白名单，支持 schema.table 和通配符，为空表示不限制
+	DeniedTables      []string // 表黑名单
+	DefaultSchema     string   // 未指定库名时使用的库名
+	Dialect           string   // 数据源驱动，为空表示 MySQL
+}
+
+// Violation 违规详情
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Clause  string `json:"clause,omitempty"` // 违规的子句
+}
+
+// ValidationError SQL校验失败，包含全部违规项
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+var parserPool = sync.Pool{
+	New: func() interface{} { return parser.New() },
+}
+
+// Validate 解析SQL并按策略校验，SQL中的参数需使用 ? 占位符
+func Validate(sql string, policy Policy) error {
+	policy.Dialect = dialect.Normalize(policy.Dialect)
+	if policy.Dialect != dialect.MySQL {
+		return validateTokens(sql, policy)
+	}
+
+	p := parserPool.Get().(*parser.Parser)
+	defer parserPool.Put(p)
+
+	stmts, _, err := p.Parse(sql, "", "")
+	if err != nil {
+		return &ValidationError{Violations: []Violation{{
+			Rule:    RuleSyntax,
+			Message: fmt.Sprintf("SQL syntax error: %v", err),
+		}}}
+	}
+
+	if len(stmts) != 1 {
+		return &ValidationError{Violations: []Violation{{
+			Rule:    RuleMultipleStatement,
+			Message: fmt.Sprintf("exactly one statement is allowed, got %d", len(stmts)),
+		}}}
+	}
+
+	stmt := stmts[0]
+	c := &checker{policy: policy, root: stmt}
+
+	stmtType := statementType(stmt)
+	if !c.statementAllowed(stmtType) {
+		c.add(RuleStatementType, stmt,
+			"statement type %s not allowed, only %v are permitted", stmtType, policy.AllowedStatements)
+	}
+
+	stmt.Accept(c)
+
+	if len(c.violations) > 0 {
+		return &ValidationError{Violations: c.violations}
+	}
+	return nil
+}
+
+// statementType 返回语句类型，带 CTE 的查询和 UNION 都视为 SELECT
+func statementType(stmt ast.StmtNode) string {
+	switch s := stmt.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		return "SELECT"
+	case *ast.ShowStmt:
+		return "SHOW"
+	case *ast.ExplainStmt:
+		return "EXPLAIN"
+	case *ast.InsertStmt:
+		if s.IsReplace {
+			return "REPLACE"
+		}
+		return "INSERT"
+	case *ast.UpdateStmt:
+		return "UPDATE"
+	case *ast.DeleteStmt:
+		return "DELETE"
+	default:
+		name := fmt.Sprintf("%T", stmt)
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "*ast."), "Stmt")
+		return strings.ToUpper(name)
+	}
+}
+
+// cteScopes 可见的 CTE 名称，每个 WITH 子句一层，只在所属语句内可见
+type cteScopes []map[string]bool
+
+func (s cteScopes) has(name string) bool {
+	for _, scope := range s {
+		if scope[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// withClause 返回语句的 WITH 子句
+func withClause(n ast.Node) *ast.WithClause {
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		return node.With
+	case *ast.SetOprStmt:
+		return node.With
+	case *ast.UpdateStmt:
+		return node.With
+	case *ast.DeleteStmt:
+		return node.With
+	}
+	return nil
+}
+
+// enterWith 为语句的 WITH 子句新建一层作用域，先访问 CTE 的定义再登记名称，
+// 避免定义中与 CTE 同名的真实表绕过表策略；RECURSIVE 时 CTE 可以在定义中引用自身
+func enterWith(v ast.Visitor, scopes *cteScopes, with *ast.WithClause) {
+	scope := make(map[string]bool, len(with.CTEs))
+	*scopes = append(*scopes, scope)
+	for _, cte := range with.CTEs {
+		if with.IsRecursive {
+			scope[cte.Name.L] = true
+		}
+		cte.Query.Accept(v)
+		scope[cte.Name.L] = true
+	}
+}
+
+// leaveWith 离开带 WITH 子句的语句时移除其作用域
+func leaveWith(scopes *cteScopes, n ast.Node) {
+	if withClause(n) != nil {
+		*scopes = (*scopes)[:len(*scopes)-1]
+	}
+}
+
+type checker struct {
+	policy     Policy
+	root       ast.StmtNode
+	ctes       cteScopes
+	violations []Violation
+}
+
+func (c *checker) Enter(n ast.Node) (ast.Node, bool) {
+	if with := withClause(n); with != nil {
+		enterWith(c, &c.ctes, with)
+	}
+
+	switch node := n.(type) {
+	case *ast.WithClause:
+		// 已在所属语句中访问
+		return n, true
+
+	case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt, ast.DDLNode:
+		// 顶层语句类型已单独校验，这里拦截嵌套在子查询/CTE中的写操作
+		if n != ast.Node(c.root) {
+			c.add(RuleWrite, node, "write statements are not allowed")
+		}
+
+	case *ast.SelectStmt:
+		if node.SelectIntoOpt != nil {
+			c.add(RuleSelectInto, node.SelectIntoOpt, "SELECT ... INTO is not allowed")
+		}
+		if node.LockInfo != nil && node.LockInfo.LockType != ast.SelectLockNone {
+			c.addText(RuleLockingClause, strings.ToUpper(node.LockInfo.LockType.String()), "locking clauses are not allowed")
+		}
+
+	case *ast.FuncCallExpr:
+		if c.functionDenied(node.FnName.L) {
+			c.add(RuleDeniedFunction, node, "function %s is not allowed", strings.ToUpper(node.FnName.O))
+		}
+
+	case *ast.TableName:
+		c.checkTable(node)
+	}
+	return n, false
+}
+
+func (c *checker) Leave(n ast.Node) (ast.Node, bool) {
+	leaveWith(&c.ctes, n)
+	return n, true
+}
+
+func (c *checker) statementAllowed(stmtType string) bool {
+	for _, allowed := range c.policy.AllowedStatements {
+		if strings.EqualFold(allowed, stmtType) {
+			return true
+		}
+		// 兼容旧配置中以 WITH 开头的写法
+		if strings.EqualFold(allowed, "WITH") && stmtType == "SELECT" {
+			return true
+		}
+	}
+	return false
+}
+
+// functionDenied name 为小写函数名
+func (c *checker) functionDenied(name string) bool {
+	for _, denied := range dialectDeniedFunctions[c.policy.Dialect] {
+		if ok, _ := path.Match(denied, name); ok {
+			return true
+		}
+	}
+	for _, denied := range c.policy.DeniedFunctions {
+		if strings.EqualFold(name, denied) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) checkTable(table *ast.TableName) {
+	// 引用 CTE 的表名不受表策略约束
+	if table.Schema.L == "" && c.ctes.has(table.Name.L) {
+		return
+	}
+	if rule, msg := c.tableViolation(table.Schema.L, table.Name.L); rule != "" {
+		c.add(rule, table, "%s", msg)
+	}
+}
+
+// tableViolation 按表策略检查表，schema 为空时使用默认库名，通过时返回空规则
+func (c *checker) tableViolation(schema, table string) (string, string) {
+	if schema == "" {
+		schema = strings.ToLower(c.policy.DefaultSchema)
+	}
+	name := table
+	if schema != "" {
+		name = schema + "." + name
+	}
+
+	for _, pattern := range append(dialectDeniedTables[c.policy.Dialect], c.policy.DeniedTables...) {
+		if MatchTable(pattern, schema, table) {
+			return RuleTableDenied, fmt.Sprintf("table %s is denied", name)
+		}
+	}
+
+	if len(c.policy.AllowedTables) == 0 {
+		return "", ""
+	}
+	for _, pattern := range c.policy.AllowedTables {
+		if MatchTable(pattern, schema, table) {
+			return "", ""
+		}
+	}
+	return RuleTableNotAllowed, fmt.Sprintf("table %s is not in the allowed list", name)
+}
+
+// MatchTable 匹配表规则，规则不含库名时只比较表名
+func MatchTable(pattern, schema, table string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if strings.Contains(pattern, ".") {
+		ok, _ := path.Match(pattern, schema+"."+table)
+		return ok
+	}
+	ok, _ := path.Match(pattern, table)
+	return ok
+}
+
+func (c *checker) add(rule string, node ast.Node, msg string, args ...interface{}) {
+	c.addText(rule, restore(node), msg, args...)
+}
+
+func (c *checker) addText(rule, clause, msg string, args ...interface{}) {
+	c.violations = append(c.violations, Violation{
+		Rule:    rule,
+		Message: fmt.Sprintf(msg, args...),
+		Clause:  clause,
+	})
+}
+
+// restore 还原节点对应的SQL片段，用于定位违规子句
+func restore(node ast.Node) string {
+	var sb strings.Builder
+	if err := node.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
+// TableAliases 解析SQL中的表引用，返回别名（无别名时为表名）到 schema.table 的映射
+// 未指定库名的表使用 defaultSchema，引用 CTE 的名称不在结果中
+func TableAliases(sql, defaultSchema string) (map[string]string, error) {
+	p := parserPool.Get().(*parser.Parser)
+	defer parserPool.Put(p)
+
+	stmts, _, err := p.Parse(sql, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &aliasCollector{
+		defaultSchema: strings.ToLower(defaultSchema),
+		aliases:       make(map[string]string),
+	}
+	for _, stmt := range stmts {
+		stmt.Accept(c)
+	}
+	return c.aliases, nil
+}
+
+type aliasCollector struct {
+	defaultSchema string
+	ctes          cteScopes
+	aliases       map[string]string
+}
+
+func (c *aliasCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if with := withClause(n); with != nil {
+		enterWith(c, &c.ctes, with)
+	}
+
+	switch node := n.(type) {
+	case *ast.WithClause:
+		return n, true
+	case *ast.TableSource:
+		table, ok := node.Source.(*ast.TableName)
+		if !ok {
+			break
+		}
+		schema := table.Schema.L
+		if schema == "" {
+			if c.ctes.has(table.Name.L) {
+				break
+			}
+			schema = c.defaultSchema
+		}
+		name := table.Name.L
+		if schema != "" {
+			name = schema + "." + name
+		}
+		alias := node.AsName.L
+		if alias == "" {
+			alias = table.Name.L
+		}
+		c.aliases[alias] = name
+	}
+	return n, false
+}
+
+func (c *aliasCollector) Leave(n ast.Node) (ast.Node, bool) {
+	leaveWith(&c.ctes, n)
+	return n, true
+}
@@ -0,0 +1,210 @@
+package sqlguard
+
+import (
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	policy := Policy{AllowedStatements: []string{"SELECT"}}
+
+	tests := []struct {
+		name     string
+		sql      string
+		policy   Policy
+		wantRule string
+	}{
+		{name: "simple_select", sql: "SELECT id, name FROM houses WHERE id = ? LIMIT ?"},
+		{name: "cte_select", sql: "WITH t AS (SELECT id FROM houses) SELECT * FROM t"},
+		{name: "union", sql: "(SELECT 1) UNION (SELECT 2)"},
+		{name: "syntax_error", sql: "SELECT FROM WHERE", wantRule: RuleSyntax},
+		{name: "multiple_statements", sql: "SELECT 1; DROP TABLE x", wantRule: RuleMultipleStatement},
+		{name: "delete", sql: "DELETE FROM houses", wantRule: RuleStatementType},
+		{name: "write_in_cte", sql: "WITH t AS (SELECT 1) DELETE FROM houses", wantRule: RuleStatementType},
+		{name: "into_outfile", sql: "SELECT * FROM houses INTO OUTFILE '/tmp/x'", wantRule: RuleSelectInto},
+		// 解析器不支持 DUMPFILE，按语法错误拒绝
+		{name: "into_dumpfile", sql: "SELECT * FROM houses INTO DUMPFILE '/tmp/x'", wantRule: RuleSyntax},
+		{name: "load_file", sql: "SELECT LOAD_FILE('/etc/passwd')", wantRule: RuleDeniedFunction},
+		{name: "sleep_in_subquery", sql: "SELECT * FROM houses WHERE id IN (SELECT SLEEP(10))", wantRule: RuleDeniedFunction},
+		{name: "benchmark", sql: "SELECT BENCHMARK(1000000, MD5('a'))", wantRule: RuleDeniedFunction},
+		{name: "for_update", sql: "SELECT * FROM houses FOR UPDATE", wantRule: RuleLockingClause},
+		{name: "lock_in_share_mode", sql: "SELECT * FROM houses LOCK IN SHARE MODE", wantRule: RuleLockingClause},
+		{name: "system_schema", sql: "SELECT * FROM mysql.user", wantRule: RuleTableDenied},
+		{name: "information_schema", sql: "SELECT * FROM information_schema.tables", wantRule: RuleTableDenied},
+		{
+			name:     "custom_denied_function",
+			sql:      "SELECT UUID()",
+			policy:   Policy{AllowedStatements: []string{"SELECT"}, DeniedFunctions: []string{"uuid"}},
+			wantRule: RuleDeniedFunction,
+		},
+		{
+			name:   "allowed_table",
+			sql:    "SELECT * FROM uhomes_stat.events e JOIN houses h ON e.house_id = h.id",
+			policy: Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"uhomes_stat.*", "houses"}},
+		},
+		{
+			name:     "table_not_allowed",
+			sql:      "SELECT * FROM users",
+			policy:   Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"houses"}},
+			wantRule: RuleTableNotAllowed,
+		},
+		{
+			name:     "denied_table_with_default_schema",
+			sql:      "SELECT * FROM users",
+			policy:   Policy{AllowedStatements: []string{"SELECT"}, DeniedTables: []string{"bi.users"}, DefaultSchema: "bi"},
+			wantRule: RuleTableDenied,
+		},
+		{
+			name:   "cte_name_skips_table_policy",
+			sql:    "WITH recent AS (SELECT * FROM houses) SELECT * FROM recent",
+			policy: Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"houses"}},
+		},
+		{
+			// CTE 定义中同名的表是真实表，仍受表策略约束
+			name:     "cte_shadowing_denied_table",
+			sql:      "WITH salaries AS (SELECT * FROM salaries) SELECT * FROM salaries",
+			policy:   Policy{AllowedStatements: []string{"SELECT"}, DeniedTables: []string{"salaries"}},
+			wantRule: RuleTableDenied,
+		},
+		{
+			name:     "cte_scope_ends_with_statement",
+			sql:      "SELECT * FROM (WITH salaries AS (SELECT 1) SELECT * FROM salaries) t JOIN salaries s",
+			policy:   Policy{AllowedStatements: []string{"SELECT"}, DeniedTables: []string{"salaries"}},
+			wantRule: RuleTableDenied,
+		},
+		{
+			name:   "recursive_cte",
+			sql:    "WITH RECURSIVE n AS (SELECT 1 AS i UNION ALL SELECT i + 1 FROM n WHERE i < 10) SELECT * FROM n",
+			policy: Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"houses"}},
+		},
+		{
+			name:   "cte_references_earlier_cte",
+			sql:    "WITH a AS (SELECT * FROM houses), b AS (SELECT * FROM a) SELECT * FROM b",
+			policy: Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"houses"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			if p.AllowedStatements == nil {
+				p = policy
+			}
+
+			err := Validate(tt.sql, p)
+			if tt.wantRule == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected ValidationError, got %v", err)
+			rules := make([]string, len(validationErr.Violations))
+			for i, v := range validationErr.Violations {
+				rules[i] = v.Rule
+			}
+			assert.Contains(t, rules, tt.wantRule)
+		})
+	}
+}
+
+func TestValidateReportsClause(t *testing.T) {
+	err := Validate("SELECT id, SLEEP(5) FROM houses", Policy{AllowedStatements: []string{"SELECT"}})
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Violations, 1)
+	assert.Equal(t, "SLEEP(5)", validationErr.Violations[0].Clause)
+}
+
+func TestTableAliases(t *testing.T) {
+	aliases, err := TableAliases(
+		"WITH t AS (SELECT 1) SELECT * FROM houses h JOIN stat.events ON events.house_id = h.id JOIN t", "bi")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"h": "bi.houses", "events": "stat.events"}, aliases)
+}
+
+func TestValidateDialects(t *testing.T) {
+	tables := Policy{AllowedStatements: []string{"SELECT"}, DeniedTables: []string{"secrets"}}
+
+	tests := []struct {
+		name     string
+		dialect  string
+		sql      string
+		wantRule string
+	}{
+		{name: "pg_select", dialect: dialect.Postgres, sql: `SELECT "Id", amount::numeric, extract(year FROM created_at) FROM public.orders o WHERE o.id = ? AND a IS DISTINCT FROM b`},
+		{name: "pg_cte", dialect: dialect.Postgres, sql: "WITH secrets AS (SELECT 1) SELECT * FROM secrets"},
+		{name: "pg_cte_shadowing_table", dialect: dialect.Postgres, sql: "WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", wantRule: RuleTableDenied},
+		{name: "pg_window_name", dialect: dialect.Postgres, sql: "SELECT * FROM secrets WINDOW secrets AS (ORDER BY id)", wantRule: RuleTableDenied},
+		{name: "pg_cte_scope", dialect: dialect.Postgres, sql: "SELECT * FROM (WITH secrets AS (SELECT 1) SELECT * FROM secrets) t, secrets", wantRule: RuleTableDenied},
+		{name: "pg_recursive_cte", dialect: dialect.Postgres, sql: "WITH RECURSIVE secrets(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM secrets WHERE n < 3), t AS MATERIALIZED (SELECT * FROM secrets) SELECT * FROM t"},
+		{name: "pg_trailing_semicolon", dialect: dialect.Postgres, sql: "SELECT 1;"},
+		{name: "pg_multiple_statements", dialect: dialect.Postgres, sql: "SELECT 1; DROP TABLE x", wantRule: RuleMultipleStatement},
+		{name: "pg_write_in_cte", dialect: dialect.Postgres, sql: "WITH d AS (DELETE FROM orders RETURNING *) SELECT * FROM d", wantRule: RuleWrite},
+		{name: "pg_select_into", dialect: dialect.Postgres, sql: "SELECT * INTO copy_orders FROM orders", wantRule: RuleSelectInto},
+		{name: "pg_for_update", dialect: dialect.Postgres, sql: "SELECT * FROM orders FOR NO KEY UPDATE", wantRule: RuleLockingClause},
+		{name: "pg_sleep", dialect: dialect.Postgres, sql: "SELECT pg_catalog.pg_sleep(10)", wantRule: RuleDeniedFunction},
+		{name: "pg_quoted_function", dialect: dialect.Postgres, sql: `SELECT "pg_read_file"('/etc/passwd')`, wantRule: RuleDeniedFunction},
+		{name: "pg_system_catalog", dialect: dialect.Postgres, sql: "SELECT * FROM pg_authid", wantRule: RuleTableDenied},
+		{name: "pg_denied_comma_join", dialect: dialect.Postgres, sql: "SELECT * FROM orders o JOIN users u ON o.uid = u.order, secrets", wantRule: RuleTableDenied},
+		{name: "pg_denied_subquery", dialect: dialect.Postgres, sql: "SELECT (SELECT token FROM secrets LIMIT 1) FROM orders", wantRule: RuleTableDenied},
+		{name: "pg_table_subquery", dialect: dialect.Postgres, sql: "SELECT * FROM orders WHERE id IN (TABLE secrets)", wantRule: RuleTableDenied},
+		// PostgreSQL 字符串中的反斜杠不是转义符，后面的子查询会被执行
+		{name: "pg_backslash_literal", dialect: dialect.Postgres, sql: `SELECT 'a\', (SELECT token FROM secrets), 'b'`, wantRule: RuleTableDenied},
+		// PostgreSQL 中 # 是按位异或，不是注释
+		{name: "pg_hash_is_operator", dialect: dialect.Postgres, sql: "SELECT 1 # 2, (SELECT token FROM secrets)", wantRule: RuleTableDenied},
+		{name: "pg_dollar_quoted", dialect: dialect.Postgres, sql: "SELECT $$; DROP TABLE x$$"},
+		{name: "pg_unbalanced", dialect: dialect.Postgres, sql: "SELECT (1", wantRule: RuleSyntax},
+		{name: "ch_select", dialect: dialect.ClickHouse, sql: "SELECT `id`, toDate(ts) FROM events FINAL ARRAY JOIN tags AS tag WHERE x = ? SETTINGS max_threads = 4"},
+		{name: "ch_table_function", dialect: dialect.ClickHouse, sql: "SELECT * FROM url('http://example.com/x', CSV)", wantRule: RuleDeniedFunction},
+		{name: "ch_system_table", dialect: dialect.ClickHouse, sql: "SELECT * FROM system.users", wantRule: RuleTableDenied},
+		{name: "ch_into_outfile", dialect: dialect.ClickHouse, sql: "SELECT * FROM events INTO OUTFILE 'x.csv'", wantRule: RuleSelectInto},
+		{name: "ch_alter_delete", dialect: dialect.ClickHouse, sql: "ALTER TABLE events DELETE WHERE 1", wantRule: RuleStatementType},
+		{name: "ch_hash_comment", dialect: dialect.ClickHouse, sql: "SELECT 1 # FROM secrets"},
+		{name: "sqlite_select", dialect: dialect.SQLite, sql: "SELECT [id], name FROM fixtures f LEFT JOIN houses h ON h.id = f.house_id"},
+		{name: "sqlite_cte_shadowing_table", dialect: dialect.SQLite, sql: "WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", wantRule: RuleTableDenied},
+		{name: "sqlite_window_name", dialect: dialect.SQLite, sql: "SELECT * FROM secrets WINDOW secrets AS (ORDER BY id)", wantRule: RuleTableDenied},
+		{name: "ch_cte_shadowing_table", dialect: dialect.ClickHouse, sql: "WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets", wantRule: RuleTableDenied},
+		{name: "sqlite_master", dialect: dialect.SQLite, sql: "SELECT sql FROM sqlite_master", wantRule: RuleTableDenied},
+		{name: "sqlite_pragma", dialect: dialect.SQLite, sql: "PRAGMA table_info(houses)", wantRule: RuleStatementType},
+		{name: "sqlite_load_extension", dialect: dialect.SQLite, sql: "SELECT load_extension('x')", wantRule: RuleDeniedFunction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tables
+			p.Dialect = tt.dialect
+
+			err := Validate(tt.sql, p)
+			if tt.wantRule == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "expected ValidationError, got %v", err)
+			rules := make([]string, len(validationErr.Violations))
+			for i, v := range validationErr.Violations {
+				rules[i] = v.Rule
+			}
+			assert.Contains(t, rules, tt.wantRule)
+		})
+	}
+}
+
+func TestValidateDialectAllowedTables(t *testing.T) {
+	policy := Policy{AllowedStatements: []string{"SELECT"}, AllowedTables: []string{"public.orders"}, DefaultSchema: "public", Dialect: dialect.Postgres}
+	assert.NoError(t, Validate("SELECT * FROM orders JOIN generate_series(1, 3) g ON true", policy))
+	assert.NoError(t, Validate("SELECT * FROM warehouse.public.orders", policy))
+
+	err := Validate("SELECT * FROM orders, (SELECT * FROM stats.daily) d", policy)
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Violations, 1)
+	assert.Equal(t, "stats.daily", validationErr.Violations[0].Clause)
+}
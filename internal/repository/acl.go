@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type ACLRepository struct {
+	db *gorm.DB
+}
+
+func NewACLRepository(db *gorm.DB) *ACLRepository {
+	return &ACLRepository{db: db}
+}
+
+func (r *ACLRepository) ListByKey(ctx context.Context, subType, key string) ([]*models.SubscriptionACL, error) {
+	var entries []*models.SubscriptionACL
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND sub_key = ?", subType, key).
+		Order("created_at ASC").
+		Find(&entries).Error
+	return entries, err
+}
+
+func (r *ACLRepository) Create(ctx context.Context, entry *models.SubscriptionACL) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// Replace 整体替换订阅的ACL
+func (r *ACLRepository) Replace(ctx context.Context, subType, key string, entries []*models.SubscriptionACL) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("type = ? AND sub_key = ?", subType, key).Delete(&models.SubscriptionACL{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(entries).Error
+	})
+}
+
+// accessCondition 生成可见性过滤条件，typeColumn 为空时只按 sub_key 匹配
+func accessCondition(filter *models.AccessFilter, typeColumn, keyColumn string) (string, []interface{}) {
+	join := "a.sub_key = " + keyColumn
+	if typeColumn != "" {
+		join = "a.type = " + typeColumn + " AND " + join
+	}
+
+	var subjects []string
+	var args []interface{}
+	for subjectType, values := range filter.Subjects {
+		if len(values) == 0 {
+			continue
+		}
+		subjects = append(subjects, "(a.subject_type = ? AND a.subject IN ?)")
+		args = append(args, subjectType, values)
+	}
+
+	var conditions []string
+	if len(subjects) > 0 {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM sub_subscription_acl a WHERE "+join+" AND ("+strings.Join(subjects, " OR ")+"))")
+	}
+	if filter.IncludeUnrestricted {
+		conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM sub_subscription_acl a WHERE "+join+")")
+	}
+	if len(conditions) == 0 {
+		return "1 = 0", nil
+	}
+
+	condition := "(" + strings.Join(conditions, " OR ") + ")"
+	if len(filter.SubKeys) > 0 {
+		condition = "(" + keyColumn + " IN ? AND " + condition + ")"
+		args = append([]interface{}{filter.SubKeys}, args...)
+	}
+	return condition, args
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+func (r *APIKeyRepository) GetByID(ctx context.Context, id uint64) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("key_hash = ?", hash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) List(ctx context.Context, clientID string) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	query := r.db.WithContext(ctx).Order("created_at DESC")
+	if clientID != "" {
+		query = query.Where("client_id = ?", clientID)
+	}
+	err := query.Find(&keys).Error
+	return keys, err
+}
+
+// Rotate 替换未吊销密钥的摘要，已吊销时返回 false
+func (r *APIKeyRepository) Rotate(ctx context.Context, id uint64, prefix, hash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"prefix":   prefix,
+			"key_hash": hash,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Revoke 吊销密钥，重复吊销保留首次时间
+func (r *APIKeyRepository) Revoke(ctx context.Context, id uint64, revokedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uint64, usedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", usedAt).Error
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type DataSourceRepository struct {
+	db *gorm.DB
+}
+
+func NewDataSourceRepository(db *gorm.DB) *DataSourceRepository {
+	return &DataSourceRepository{db: db}
+}
+
+func (r *DataSourceRepository) Create(ctx context.Context, ds *models.DataSource) error {
+	return r.db.WithContext(ctx).Create(ds).Error
+}
+
+func (r *DataSourceRepository) Update(ctx context.Context, ds *models.DataSource) error {
+	return r.db.WithContext(ctx).Save(ds).Error
+}
+
+func (r *DataSourceRepository) GetByName(ctx context.Context, name string) (*models.DataSource, error) {
+	var ds models.DataSource
+	if err := r.db.WithContext(ctx).Where("name = ?", name).First(&ds).Error; err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+func (r *DataSourceRepository) List(ctx context.Context) ([]*models.DataSource, error) {
+	var sources []*models.DataSource
+	err := r.db.WithContext(ctx).Order("name ASC").Find(&sources).Error
+	return sources, err
+}
+
+func (r *DataSourceRepository) UpdateStatus(ctx context.Context, id uint64, status string, updatedBy uint64) error {
+	return r.db.WithContext(ctx).Model(&models.DataSource{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_by": updatedBy,
+		}).Error
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type JobRepository struct {
+	db *gorm.DB
+}
+
+func NewJobRepository(db *gorm.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+func (r *JobRepository) Create(ctx context.Context, job *models.ExecutionJob) error {
+	return r.db.WithContext(ctx).Create(job).Error
+}
+
+func (r *JobRepository) GetByID(ctx context.Context, id uint64) (*models.ExecutionJob, error) {
+	var job models.ExecutionJob
+	if err := r.db.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// MarkRunning 将排队中的任务置为执行中，任务已被取消时返回 false
+func (r *JobRepository) MarkRunning(ctx context.Context, id uint64, startedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("id = ? AND status = ?", id, models.JobStatusPending).
+		Updates(map[string]interface{}{
+			"status":     models.JobStatusRunning,
+			"started_at": startedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Finish 记录执行中任务的最终状态
+func (r *JobRepository) Finish(ctx context.Context, id uint64, status string, rowCount int64, errorMsg string) error {
+	return r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("id = ? AND status = ?", id, models.JobStatusRunning).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"row_count":   rowCount,
+			"error_msg":   errorMsg,
+			"finished_at": time.Now(),
+		}).Error
+}
+
+// FinishPending 结束尚未开始执行的任务（取消、排队失败），任务已开始时返回 false
+func (r *JobRepository) FinishPending(ctx context.Context, id uint64, status, errorMsg string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("id = ? AND status = ?", id, models.JobStatusPending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"error_msg":   errorMsg,
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Heartbeat 刷新实例上未结束任务的心跳时间
+func (r *JobRepository) Heartbeat(ctx context.Context, instance string, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("instance = ? AND status IN ?", instance, []string{models.JobStatusPending, models.JobStatusRunning}).
+		Update("heartbeat_at", now).Error
+}
+
+// FailStale 将心跳早于 before 的未结束任务置为失败，不区分实例；没有心跳的旧任务按创建时间判断
+func (r *JobRepository) FailStale(ctx context.Context, before time.Time, errorMsg string) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("status IN ? AND COALESCE(heartbeat_at, created_at) < ?", []string{models.JobStatusPending, models.JobStatusRunning}, before).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error_msg":   errorMsg,
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+// FailUnfinished 将实例上未结束的任务置为失败，用于实例重启后回收上次退出时遗留的任务
+func (r *JobRepository) FailUnfinished(ctx context.Context, instance, errorMsg string) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.ExecutionJob{}).
+		Where("instance = ? AND status IN ?", instance, []string{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.JobStatusFailed,
+			"error_msg":   errorMsg,
+			"finished_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type ReviewRepository struct {
+	db *gorm.DB
+}
+
+func NewReviewRepository(db *gorm.DB) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+// Create 提交审核，同一版本仍在等待的审核标记为被替代
+func (r *ReviewRepository) Create(ctx context.Context, review *models.SubscriptionReview) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.SubscriptionReview{}).
+			Where("type = ? AND sub_key = ? AND version = ? AND status = ?", review.Type, review.SubKey, review.Version, models.ReviewPending).
+			Update("status", models.ReviewSuperseded).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(review).Error
+	})
+}
+
+func (r *ReviewRepository) GetByID(ctx context.Context, id uint64) (*models.SubscriptionReview, error) {
+	var review models.SubscriptionReview
+	if err := r.db.WithContext(ctx).First(&review, id).Error; err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// ListByVersion 获取订阅版本的审核记录，最新的在前
+func (r *ReviewRepository) ListByVersion(ctx context.Context, subType, key string, version uint32) ([]*models.SubscriptionReview, error) {
+	var reviews []*models.SubscriptionReview
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND sub_key = ? AND version = ?", subType, key, version).
+		Order("created_at DESC").
+		Find(&reviews).Error
+	return reviews, err
+}
+
+// List 按状态获取审核记录，status 为空时不过滤
+func (r *ReviewRepository) List(ctx context.Context, status string, limit, offset int, access *models.AccessFilter) ([]*models.SubscriptionReview, int64, error) {
+	var reviews []*models.SubscriptionReview
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SubscriptionReview{})
+	if access != nil {
+		condition, args := accessCondition(access, "sub_subscription_review.type", "sub_subscription_review.sub_key")
+		query = query.Where(condition, args...)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&reviews).Error
+	return reviews, total, err
+}
+
+// Decide 以待审核状态为条件写入审核结论，审核已被处理或替代时返回 false
+func (r *ReviewRepository) Decide(ctx context.Context, review *models.SubscriptionReview, status string) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.SubscriptionReview{}).
+		Where("id = ? AND status = ?", review.ID, models.ReviewPending).
+		Updates(map[string]interface{}{
+			"status":           status,
+			"review_comment":   review.ReviewComment,
+			"reviewed_by":      review.ReviewedBy,
+			"reviewed_by_name": review.ReviewedByName,
+			"reviewed_at":      now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	review.Status = status
+	review.ReviewedAt = &now
+	return true, nil
+}
+
+// HasApproval 版本是否存在与内容摘要一致的已通过审核
+func (r *ReviewRepository) HasApproval(ctx context.Context, subType, key string, version uint32, contentHash string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.SubscriptionReview{}).
+		Where("type = ? AND sub_key = ? AND version = ? AND content_hash = ? AND status = ?", subType, key, version, contentHash, models.ReviewApproved).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+// ListRevisions 按修订号倒序获取订阅版本的修订
+func (r *SubscriptionRepository) ListRevisions(ctx context.Context, subType, key string, version uint32, limit, offset int) ([]*models.SubscriptionRevision, int64, error) {
+	var revisions []*models.SubscriptionRevision
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.SubscriptionRevision{}).
+		Where("type = ? AND sub_key = ? AND version = ?", subType, key, version)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("revision DESC").Limit(limit).Offset(offset).Find(&revisions).Error
+	return revisions, total, err
+}
+
+// GetRevision 获取指定修订，不存在时返回 gorm.ErrRecordNotFound
+func (r *SubscriptionRepository) GetRevision(ctx context.Context, subType, key string, version uint32, revision uint32) (*models.SubscriptionRevision, error) {
+	var rev models.SubscriptionRevision
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND sub_key = ? AND version = ? AND revision = ?", subType, key, version, revision).
+		First(&rev).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// RevisionSummary 版本的最新修订号和最近一次同步修订的修订号
+type RevisionSummary struct {
+	Type    string
+	SubKey  string
+	Version uint32
+	Latest  uint32
+	Synced  uint32
+}
+
+// SyncedRevisionSummaries 汇总曾经同步过的版本（含已删除的版本）的修订号，Latest 大于 Synced 说明同步后被带外修改
+func (r *SubscriptionRepository) SyncedRevisionSummaries(ctx context.Context) ([]RevisionSummary, error) {
+	synced := "MAX(CASE WHEN action = ? THEN revision ELSE 0 END)"
+	var summaries []RevisionSummary
+	err := r.db.WithContext(ctx).Model(&models.SubscriptionRevision{}).
+		Select("type, sub_key, version, MAX(revision) AS latest, "+synced+" AS synced", models.RevisionSync).
+		Group("type, sub_key, version").
+		Having(synced+" > 0", models.RevisionSync).
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+// writeRevision 在事务内保存订阅当前内容为下一个修订
+// 调用方需已锁定或刚插入订阅行，保证同一版本的修订号串行分配
+func writeRevision(tx *gorm.DB, subscription *models.Subscription, meta models.RevisionMeta) error {
+	var latest uint32
+	err := tx.Model(&models.SubscriptionRevision{}).
+		Where("type = ? AND sub_key = ? AND version = ?", subscription.Type, subscription.SubKey, subscription.Version).
+		Select("COALESCE(MAX(revision), 0)").
+		Scan(&latest).Error
+	if err != nil {
+		return err
+	}
+
+	revision := models.NewSubscriptionRevision(subscription, meta)
+	revision.Revision = latest + 1
+	return tx.Create(revision).Error
+}
+
+// ensureBaseline 版本还没有修订时，先把修改前的内容补记为基线修订，避免历史数据首次修改后丢失
+func ensureBaseline(tx *gorm.DB, subscription *models.Subscription) error {
+	var count int64
+	err := tx.Model(&models.SubscriptionRevision{}).
+		Where("type = ? AND sub_key = ? AND version = ?", subscription.Type, subscription.SubKey, subscription.Version).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	revision := models.NewSubscriptionRevision(subscription, models.RevisionMeta{
+		Action:    models.RevisionBaseline,
+		ChangedBy: subscription.CreatedBy,
+	})
+	revision.Revision = 1
+	revision.CreatedAt = subscription.UpdatedAt
+	return tx.Create(revision).Error
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+type ScheduleRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduleRepository(db *gorm.DB) *ScheduleRepository {
+	return &ScheduleRepository{db: db}
+}
+
+func (r *ScheduleRepository) Create(ctx context.Context, schedule *models.SubscriptionSchedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+func (r *ScheduleRepository) GetByID(ctx context.Context, id uint64) (*models.SubscriptionSchedule, error) {
+	var schedule models.SubscriptionSchedule
+	if err := r.db.WithContext(ctx).First(&schedule, id).Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *ScheduleRepository) ListByKey(ctx context.Context, subType, key string) ([]*models.SubscriptionSchedule, error) {
+	var schedules []*models.SubscriptionSchedule
+	err := r.db.WithContext(ctx).
+		Where("type = ? AND sub_key = ?", subType, key).
+		Order("created_at ASC").
+		Find(&schedules).Error
+	return schedules, err
+}
+
+func (r *ScheduleRepository) Update(ctx context.Context, schedule *models.SubscriptionSchedule) error {
+	return r.db.WithContext(ctx).Save(schedule).Error
+}
+
+func (r *ScheduleRepository) Delete(ctx context.Context, id uint64) error {
+	return r.db.WithContext(ctx).Delete(&models.SubscriptionSchedule{}, id).Error
+}
+
+// ListDue 获取已到触发时间的启用计划
+func (r *ScheduleRepository) ListDue(ctx context.Context, now time.Time) ([]*models.SubscriptionSchedule, error) {
+	var schedules []*models.SubscriptionSchedule
+	err := r.db.WithContext(ctx).
+		Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Find(&schedules).Error
+	return schedules, err
+}
+
+// ClaimRun 以 next_run_at 为条件推进下次触发时间，防止同一次触发被重复执行
+func (r *ScheduleRepository) ClaimRun(ctx context.Context, id uint64, scheduledAt, nextRunAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.SubscriptionSchedule{}).
+		Where("id = ? AND next_run_at = ?", id, scheduledAt).
+		Updates(map[string]interface{}{
+			"next_run_at": nextRunAt,
+			"last_run_at": scheduledAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *ScheduleRepository) CreateRun(ctx context.Context, run *models.ScheduleRun) error {
+	return r.db.WithContext(ctx).Create(run).Error
+}
+
+func (r *ScheduleRepository) UpdateRun(ctx context.Context, run *models.ScheduleRun) error {
+	return r.db.WithContext(ctx).Save(run).Error
+}
+
+func (r *ScheduleRepository) ListRuns(ctx context.Context, scheduleID uint64, limit, offset int) ([]*models.ScheduleRun, int64, error) {
+	var runs []*models.ScheduleRun
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&models.ScheduleRun{}).Where("schedule_id = ?", scheduleID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := query.Order("scheduled_at DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, total, err
+}
@@ -2,10 +2,13 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SubscriptionRepository struct {
@@ -16,35 +19,32 @@ func NewSubscriptionRepository(db *gorm.DB) *SubscriptionRepository {
 	return &SubscriptionRepository{db: db}
 }
 
-func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
-	tx := r.db.WithContext(ctx).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+// Create 创建订阅版本并保存首个修订，Version 为0时在同一事务内分配下一个版本号
+func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription, meta models.RevisionMeta) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if subscription.Version == 0 {
+			next, err := nextVersion(tx, subscription.Type, subscription.SubKey)
+			if err != nil {
+				return err
+			}
+			subscription.Version = next
 		}
-	}()
 
-	// 如果状态为生效中-强制兼容低版本，先将同key的低版本设为失效
-	if subscription.Status == models.StatusActiveForceCompatible {
-		if err := tx.Model(&models.Subscription{}).
-			Where("type = ? AND sub_key = ? AND version < ? AND status IN (?, ?)",
-				subscription.Type, subscription.SubKey, subscription.Version,
-				models.StatusActive, models.StatusActiveForceCompatible).
-			Update("status", models.StatusExpired).Error; err != nil {
-			tx.Rollback()
-			return err
+		// 如果状态为生效中-强制兼容低版本，先将同key的低版本设为失效
+		if subscription.Status == models.StatusActiveForceCompatible {
+			if err := expireLowerVersions(tx, subscription.Type, subscription.SubKey, subscription.Version, meta); err != nil {
+				return err
+			}
 		}
-	}
-
-	if err := tx.Create(subscription).Error; err != nil {
-		tx.Rollback()
-		return err
-	}
 
-	return tx.Commit().Error
+		if err := tx.Create(subscription).Error; err != nil {
+			return err
+		}
+		return writeRevision(tx, subscription, meta)
+	})
 }
 
-func (r *SubscriptionRepository) GetByKeyAndVersion(ctx context.Context, subType, key string, version uint8) (*models.Subscription, error) {
+func (r *SubscriptionRepository) GetByKeyAndVersion(ctx context.Context, subType, key string, version uint32) (*models.Subscription, error) {
 	var subscription models.Subscription
 	err := r.db.WithContext(ctx).Where("type = ? AND sub_key = ? AND version = ?", subType, key, version).First(&subscription).Error
 	if err != nil {
@@ -53,10 +53,11 @@ func (r *SubscriptionRepository) GetByKeyAndVersion(ctx context.Context, subType
 	return &subscription, nil
 }
 
+// GetActiveByKey 获取当前生效版本：生效中（B/C）的最高版本
 func (r *SubscriptionRepository) GetActiveByKey(ctx context.Context, subType, key string) (*models.Subscription, error) {
 	var subscription models.Subscription
 	err := r.db.WithContext(ctx).
-		Where("type = ? AND sub_key = ? AND status = ?", subType, key, models.StatusActive).
+		Where("type = ? AND sub_key = ? AND status IN ?", subType, key, models.ServingStatuses).
 		Order("version DESC").
 		First(&subscription).Error
 	if err != nil {
@@ -65,12 +66,65 @@ func (r *SubscriptionRepository) GetActiveByKey(ctx context.Context, subType, ke
 	return &subscription, nil
 }
 
-func (r *SubscriptionRepository) List(ctx context.Context, limit, offset int, subKey, title, status string) ([]*models.Subscription, int64, error) {
+// ExistsByKey 判断订阅key是否存在（任意版本）
+func (r *SubscriptionRepository) ExistsByKey(ctx context.Context, subType, key string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Subscription{}).
+		Where("type = ? AND sub_key = ?", subType, key).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListAll 获取所有订阅版本，按 type、sub_key、version 排序
+func (r *SubscriptionRepository) ListAll(ctx context.Context) ([]*models.Subscription, error) {
+	var subscriptions []*models.Subscription
+	err := r.db.WithContext(ctx).Order("type ASC, sub_key ASC, version ASC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// ListVersions 获取订阅key的所有版本，按版本号排序
+func (r *SubscriptionRepository) ListVersions(ctx context.Context, subType, key string) ([]*models.Subscription, error) {
+	var subscriptions []*models.Subscription
+	err := r.db.WithContext(ctx).Where("type = ? AND sub_key = ?", subType, key).Order("version ASC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// Transaction 在同一事务中执行 fn，fn 通过传入的仓储读写，仓储方法自身的事务成为保存点
+func (r *SubscriptionRepository) Transaction(ctx context.Context, fn func(repo *SubscriptionRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&SubscriptionRepository{db: tx})
+	})
+}
+
+// ACL 返回使用同一连接的ACL仓储，在 Transaction 中与订阅写入处于同一事务
+func (r *SubscriptionRepository) ACL() *ACLRepository {
+	return &ACLRepository{db: r.db}
+}
+
+// LockKey 在事务内锁定订阅key的最新版本，返回key是否存在
+func (r *SubscriptionRepository) LockKey(ctx context.Context, subType, key string) (bool, error) {
+	var latest []models.Subscription
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("version").
+		Where("type = ? AND sub_key = ?", subType, key).
+		Order("version DESC").
+		Limit(1).
+		Find(&latest).Error
+	return len(latest) > 0, err
+}
+
+func (r *SubscriptionRepository) List(ctx context.Context, limit, offset int, subKey, title, status string, access *models.AccessFilter) ([]*models.Subscription, int64, error) {
 	var subscriptions []*models.Subscription
 	var total int64
 
 	query := r.db.WithContext(ctx).Model(&models.Subscription{})
 
+	// 只返回调用方可见的订阅
+	if access != nil {
+		condition, args := accessCondition(access, "sub_subscription_theme.type", "sub_subscription_theme.sub_key")
+		query = query.Where(condition, args...)
+	}
+
 	// 添加搜索条件
 	if subKey != "" {
 		query = query.Where("sub_key LIKE ?", "%"+subKey+"%")
@@ -95,26 +149,131 @@ func (r *SubscriptionRepository) List(ctx context.Context, limit, offset int, su
 	return subscriptions, total, err
 }
 
-func (r *SubscriptionRepository) Update(ctx context.Context, subscription *models.Subscription) error {
-	return r.db.WithContext(ctx).Save(subscription).Error
+// Update 保存订阅内容并记录修订，状态只能通过 TransitionStatus 修改
+func (r *SubscriptionRepository) Update(ctx context.Context, subscription *models.Subscription, meta models.RevisionMeta) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockVersion(tx, subscription.Type, subscription.SubKey, subscription.Version)
+		if err != nil {
+			return err
+		}
+		if err := ensureBaseline(tx, current); err != nil {
+			return err
+		}
+
+		if err := tx.Omit("status").Save(subscription).Error; err != nil {
+			return err
+		}
+
+		saved := *subscription
+		saved.Status = current.Status
+		return writeRevision(tx, &saved, meta)
+	})
 }
 
-func (r *SubscriptionRepository) UpdateFields(ctx context.Context, subType, key string, version uint8, updates map[string]interface{}) error {
-	return r.db.WithContext(ctx).Model(&models.Subscription{}).
-		Where("type = ? AND sub_key = ? AND version = ?", subType, key, version).
-		Updates(updates).Error
+// TransitionStatus 以当前状态为条件更新状态并记录修订，迁移到 C 时在同一事务内使低版本失效
+// 状态已被并发修改时返回 false
+func (r *SubscriptionRepository) TransitionStatus(ctx context.Context, subType, key string, version uint32, from, to string, meta models.RevisionMeta) (bool, error) {
+	changed := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockVersion(tx, subType, key, version)
+		if err != nil || current.Status != from {
+			return err
+		}
+		if err := ensureBaseline(tx, current); err != nil {
+			return err
+		}
+
+		if err := tx.Model(current).Update("status", to).Error; err != nil {
+			return err
+		}
+		current.Status = to
+		if err := writeRevision(tx, current, meta); err != nil {
+			return err
+		}
+		changed = true
+
+		if to == models.StatusActiveForceCompatible {
+			return expireLowerVersions(tx, subType, key, version, meta)
+		}
+		return nil
+	})
+	return changed, err
 }
 
-func (r *SubscriptionRepository) UpdateStatus(ctx context.Context, subType, key string, version uint8, status string) error {
-	return r.db.WithContext(ctx).Model(&models.Subscription{}).
-		Where("type = ? AND sub_key = ? AND version = ?", subType, key, version).
-		Update("status", status).Error
+// expireLowerVersions 将同key低于 version 的生效版本设为失效，每个被失效的版本记录一条修订
+func expireLowerVersions(tx *gorm.DB, subType, key string, version uint32, meta models.RevisionMeta) error {
+	var lower []*models.Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("type = ? AND sub_key = ? AND version < ? AND status IN ?", subType, key, version, models.ServingStatuses).
+		Find(&lower).Error
+	if err != nil {
+		return err
+	}
+
+	meta.Action = models.RevisionExpire
+	for _, subscription := range lower {
+		if err := ensureBaseline(tx, subscription); err != nil {
+			return err
+		}
+		if err := tx.Model(subscription).Update("status", models.StatusExpired).Error; err != nil {
+			return err
+		}
+		subscription.Status = models.StatusExpired
+		if err := writeRevision(tx, subscription, meta); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *SubscriptionRepository) Delete(ctx context.Context, subType, key string, version uint8) error {
-	return r.db.WithContext(ctx).
+// nextVersion 锁定当前最高版本并返回下一个版本号，并发派生在锁上排队
+func nextVersion(tx *gorm.DB, subType, key string) (uint32, error) {
+	var latest []models.Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("version").
+		Where("type = ? AND sub_key = ?", subType, key).
+		Order("version DESC").
+		Limit(1).
+		Find(&latest).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(latest) == 0 {
+		return 1, nil
+	}
+	if latest[0].Version == math.MaxUint32 {
+		return 0, fmt.Errorf("subscription %s has no version numbers left", key)
+	}
+	return latest[0].Version + 1, nil
+}
+
+// lockVersion 在事务内读取并锁定订阅版本
+func lockVersion(tx *gorm.DB, subType, key string, version uint32) (*models.Subscription, error) {
+	var subscription models.Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 		Where("type = ? AND sub_key = ? AND version = ?", subType, key, version).
-		Delete(&models.Subscription{}).Error
+		First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// Delete 删除订阅版本，删除前的内容保留在修订中
+func (r *SubscriptionRepository) Delete(ctx context.Context, subType, key string, version uint32, meta models.RevisionMeta) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockVersion(tx, subType, key, version)
+		if err != nil {
+			return err
+		}
+		if err := ensureBaseline(tx, current); err != nil {
+			return err
+		}
+		if err := writeRevision(tx, current, meta); err != nil {
+			return err
+		}
+		return tx.Delete(current).Error
+	})
 }
 
 type StatsRepository struct {
@@ -129,9 +288,18 @@ func (r *StatsRepository) Create(ctx context.Context, stats *models.Subscription
 	return r.db.WithContext(ctx).Create(stats).Error
 }
 
-func (r *StatsRepository) GetStats(ctx context.Context, startTime, endTime time.Time, limit, offset int) ([]*models.StatsResponse, error) {
+func (r *StatsRepository) GetStats(ctx context.Context, startTime, endTime time.Time, limit, offset int, access *models.AccessFilter) ([]*models.StatsResponse, error) {
 	var results []*models.StatsResponse
 
+	// 统计表没有订阅类型，按 sub_key 过滤可见性
+	accessSQL := ""
+	var accessArgs []interface{}
+	if access != nil {
+		condition, args := accessCondition(access, "", "s.sub_key")
+		accessSQL = "AND " + condition
+		accessArgs = args
+	}
+
 	query := `
 		SELECT 
 			s.sub_key,
@@ -151,15 +319,16 @@ func (r *StatsRepository) GetStats(ctx context.Context, startTime, endTime time.
 			sub.created_by
 		FROM sub_logs_bidata_response s
 		LEFT JOIN sub_subscription_theme sub ON s.sub_key = sub.sub_key AND s.version = sub.version
-		WHERE s.created_at BETWEEN ? AND ?
+		WHERE s.created_at BETWEEN ? AND ? ` + accessSQL + `
 		GROUP BY s.sub_key, s.version, sub.created_by
 		ORDER BY avg_execution_time DESC
 		LIMIT ? OFFSET ?
 	`
 
-	err := r.db.WithContext(ctx).Raw(query,
-		startTime, endTime, startTime, endTime, startTime, endTime, limit, offset).
-		Scan(&results).Error
+	args := []interface{}{startTime, endTime, startTime, endTime, startTime, endTime}
+	args = append(args, accessArgs...)
+	args = append(args, limit, offset)
+	err := r.db.WithContext(ctx).Raw(query, args...).Scan(&results).Error
 
 	return results, err
 }
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("permission denied")
+)
+
+// AccessControl 按订阅ACL判断调用方权限
+type AccessControl struct {
+	repo              *repository.ACLRepository
+	defaultPermission string
+}
+
+func NewAccessControl(repo *repository.ACLRepository, cfg *config.Config) *AccessControl {
+	return &AccessControl{
+		repo:              repo,
+		defaultPermission: cfg.Security.ACLDefaultPermission,
+	}
+}
+
+// Require 校验调用方对订阅至少拥有指定权限
+func (a *AccessControl) Require(ctx context.Context, subType, key, permission string) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if err := a.RequireScope(ctx, key); err != nil {
+		return err
+	}
+	if p.Admin {
+		return nil
+	}
+
+	entries, err := a.repo.ListByKey(ctx, subType, key)
+	if err != nil {
+		return err
+	}
+
+	granted := ""
+	if len(entries) == 0 {
+		granted = a.defaultPermission
+	}
+	for _, entry := range entries {
+		if matchesSubject(p, entry.SubjectType, entry.Subject) && models.PermissionLevel(entry.Permission) > models.PermissionLevel(granted) {
+			granted = entry.Permission
+		}
+	}
+
+	if models.PermissionLevel(granted) < models.PermissionLevel(permission) {
+		return fmt.Errorf("%w: %s requires %s permission on %s", ErrForbidden, p.Name(), permission, key)
+	}
+	return nil
+}
+
+// Filter 返回列表查询的可见性过滤，管理员返回 nil
+func (a *AccessControl) Filter(ctx context.Context) (*models.AccessFilter, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if p.Admin {
+		return nil, nil
+	}
+
+	filter := &models.AccessFilter{
+		Subjects:            make(map[string][]string),
+		IncludeUnrestricted: models.PermissionLevel(a.defaultPermission) >= models.PermissionLevel(models.PermView),
+		SubKeys:             p.SubKeys,
+	}
+	if p.UserID > 0 {
+		filter.Subjects[models.SubjectUser] = []string{strconv.FormatUint(p.UserID, 10)}
+	}
+	if p.ClientID != "" {
+		filter.Subjects[models.SubjectClient] = []string{p.ClientID}
+	}
+	if len(p.Roles) > 0 {
+		filter.Subjects[models.SubjectRole] = p.Roles
+	}
+	return filter, nil
+}
+
+// RequireScope 校验订阅key在调用方作用域内，用于尚无ACL的新key
+func (a *AccessControl) RequireScope(ctx context.Context, key string) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !p.AllowsSubscription(key) {
+		return fmt.Errorf("%w: %s is not scoped to %s", ErrForbidden, p.Name(), key)
+	}
+	return nil
+}
+
+// RequireDataSource 校验数据源在调用方作用域内
+func (a *AccessControl) RequireDataSource(ctx context.Context, name string) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !p.AllowsDataSource(name) {
+		return fmt.Errorf("%w: %s is not scoped to data source %s", ErrForbidden, p.Name(), name)
+	}
+	return nil
+}
+
+// GrantCreator 为新订阅的创建者授予 admin 权限，acl 为写入使用的仓储，以便与订阅版本在同一事务中写入
+func (a *AccessControl) GrantCreator(ctx context.Context, acl *repository.ACLRepository, subType, key string) error {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+
+	entry := &models.SubscriptionACL{
+		Type:       subType,
+		SubKey:     key,
+		Permission: models.PermAdmin,
+		CreatedBy:  p.UserID,
+	}
+	switch {
+	case p.Kind == auth.KindClient:
+		entry.SubjectType, entry.Subject = models.SubjectClient, p.ClientID
+	case p.UserID > 0:
+		entry.SubjectType, entry.Subject = models.SubjectUser, strconv.FormatUint(p.UserID, 10)
+	default:
+		// 无法标识的身份（如Web UI管理员）不生成授权
+		return nil
+	}
+	return acl.Create(ctx, entry)
+}
+
+func (a *AccessControl) ListACL(ctx context.Context, subType, key string) ([]*models.SubscriptionACL, error) {
+	if err := a.Require(ctx, subType, key, models.PermAdmin); err != nil {
+		return nil, err
+	}
+	return a.repo.ListByKey(ctx, subType, key)
+}
+
+// SetACL 整体替换订阅ACL，需要 admin 权限
+func (a *AccessControl) SetACL(ctx context.Context, subType, key string, entries []models.ACLEntry) ([]*models.SubscriptionACL, error) {
+	if err := a.Require(ctx, subType, key, models.PermAdmin); err != nil {
+		return nil, err
+	}
+
+	p, _ := auth.FromContext(ctx)
+	acl := make([]*models.SubscriptionACL, len(entries))
+	for i, entry := range entries {
+		acl[i] = &models.SubscriptionACL{
+			Type:        subType,
+			SubKey:      key,
+			SubjectType: entry.SubjectType,
+			Subject:     entry.Subject,
+			Permission:  entry.Permission,
+			CreatedBy:   p.UserID,
+		}
+	}
+	if err := a.repo.Replace(ctx, subType, key, acl); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func matchesSubject(p *auth.Principal, subjectType, subject string) bool {
+	switch subjectType {
+	case models.SubjectUser:
+		return p.UserID > 0 && subject == strconv.FormatUint(p.UserID, 10)
+	case models.SubjectClient:
+		return p.ClientID != "" && subject == p.ClientID
+	case models.SubjectRole:
+		return p.HasRole(subject)
+	default:
+		return false
+	}
+}
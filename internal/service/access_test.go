@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchesSubject(t *testing.T) {
+	user := &auth.Principal{Kind: auth.KindUser, UserID: 1001, Roles: []string{"analyst"}}
+	client := &auth.Principal{Kind: auth.KindClient, ClientID: "crm-sync"}
+
+	assert.True(t, matchesSubject(user, models.SubjectUser, "1001"))
+	assert.False(t, matchesSubject(user, models.SubjectUser, "1002"))
+	assert.True(t, matchesSubject(user, models.SubjectRole, "analyst"))
+	assert.False(t, matchesSubject(user, models.SubjectClient, ""))
+	assert.True(t, matchesSubject(client, models.SubjectClient, "crm-sync"))
+	// 客户端没有用户ID，不能匹配 user:0
+	assert.False(t, matchesSubject(client, models.SubjectUser, "0"))
+	assert.False(t, matchesSubject(user, "group", "analyst"))
+}
+
+func TestAccessControlFilter(t *testing.T) {
+	a := &AccessControl{}
+
+	_, err := a.Filter(context.Background())
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	filter, err := a.Filter(auth.WithPrincipal(context.Background(), auth.System))
+	require.NoError(t, err)
+	assert.Nil(t, filter)
+
+	user := &auth.Principal{Kind: auth.KindUser, UserID: 1001, Roles: []string{"analyst"}}
+	filter, err = a.Filter(auth.WithPrincipal(context.Background(), user))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1001"}, filter.Subjects[models.SubjectUser])
+	assert.Equal(t, []string{"analyst"}, filter.Subjects[models.SubjectRole])
+	assert.False(t, filter.IncludeUnrestricted)
+
+	a.defaultPermission = models.PermExecute
+	filter, err = a.Filter(auth.WithPrincipal(context.Background(), user))
+	require.NoError(t, err)
+	assert.True(t, filter.IncludeUnrestricted)
+}
+
+func TestAccessControlRequireWithoutPrincipal(t *testing.T) {
+	a := &AccessControl{}
+
+	err := a.Require(context.Background(), "A", "house_report", models.PermView)
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+
+	// 管理员不查询ACL
+	err = a.Require(auth.WithPrincipal(context.Background(), auth.System), "A", "house_report", models.PermAdmin)
+	assert.NoError(t, err)
+}
+
+func TestNewKeyRequiresScope(t *testing.T) {
+	s, _ := newStoreTestService(t)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindClient, ClientID: "crm-sync", SubKeys: []string{"orders"}})
+	create := func(key string) error {
+		_, err := s.CreateSubscription(ctx, &models.CreateSubscriptionRequest{
+			Type:        models.TypeAnalysisData,
+			SubKey:      key,
+			Title:       key,
+			Abstract:    key,
+			Status:      models.StatusPending,
+			ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id FROM orders"}`),
+		})
+		return err
+	}
+
+	// 限定了订阅key的API Key不能创建作用域外的新key
+	assert.True(t, errors.Is(create("houses"), ErrForbidden))
+	require.NoError(t, create("orders"))
+	acl, err := s.access.ListACL(ctx, models.TypeAnalysisData, "orders")
+	require.NoError(t, err)
+	require.Len(t, acl, 1)
+	assert.Equal(t, "crm-sync", acl[0].Subject)
+
+	b := bundle.New([]bundle.Subscription{{Type: models.TypeAnalysisData, SubKey: "houses", Versions: []bundle.Version{
+		{Version: 1, Title: "房源", Abstract: "房源", Status: models.StatusPending, ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id FROM houses"}`)},
+	}}}, nil, nil, "alice")
+	_, err = s.ImportBundle(ctx, b, &models.ImportRequest{})
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix API Key明文前缀，便于在 Authorization 头中与JWT区分
+const APIKeyPrefix = "bsk_"
+
+// apiKeyPrefixLen 记录在库中用于识别的明文长度
+const apiKeyPrefixLen = 12
+
+// apiKeyTouchInterval 最近使用时间的最小更新间隔，避免每次请求都写库
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyInvalid  = errors.New("invalid api key")
+	ErrInvalidExpiry  = errors.New("expires_at must be in the future")
+)
+
+type APIKeyService struct {
+	repo *repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo *repository.APIKeyRepository) *APIKeyService {
+	return &APIKeyService{repo: repo}
+}
+
+// CreateKey 签发新的API Key，需要管理员权限
+func (s *APIKeyService) CreateKey(ctx context.Context, req *models.APIKeyRequest) (*models.IssuedAPIKey, error) {
+	p, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	plain, prefix, hash, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		Name:        req.Name,
+		ClientID:    req.ClientID,
+		Prefix:      prefix,
+		KeyHash:     hash,
+		Roles:       marshalStrings(req.Roles),
+		SubKeys:     marshalStrings(req.SubKeys),
+		DataSources: marshalStrings(req.DataSources),
+		RateLimit:   req.RateLimit,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedBy:   p.UserID,
+	}
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+	return &models.IssuedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+// ListKeys 列出API Key，不包含明文和摘要
+func (s *APIKeyService) ListKeys(ctx context.Context, clientID string) ([]*models.APIKey, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, clientID)
+}
+
+// RotateKey 为密钥生成新的明文，旧明文立即失效，作用域和限流配置保持不变
+func (s *APIKeyService) RotateKey(ctx context.Context, id uint64) (*models.IssuedAPIKey, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	plain, prefix, hash, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.Rotate(ctx, id, prefix, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// 不存在或已吊销
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.IssuedAPIKey{APIKey: key, Key: plain}, nil
+}
+
+// RevokeKey 吊销密钥，记录保留用于审计
+func (s *APIKeyService) RevokeKey(ctx context.Context, id uint64) (*models.APIKey, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Revoke(ctx, id, time.Now()); err != nil {
+		return nil, err
+	}
+	key, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// Authenticate 校验明文密钥，返回对应的调用方身份
+func (s *APIKeyService) Authenticate(ctx context.Context, plain string) (*auth.Principal, error) {
+	if !strings.HasPrefix(plain, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	key, err := s.repo.GetByHash(ctx, hashAPIKey(plain))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		go func() {
+			if err := s.repo.TouchLastUsed(context.Background(), key.ID, now); err != nil {
+				slog.Warn("Failed to update api key last used time", "key_id", key.ID, "error", err)
+			}
+		}()
+	}
+
+	return principalFromAPIKey(key)
+}
+
+// principalFromAPIKey API Key调用方不具备管理员权限，即使角色与 admin_roles 重合
+func principalFromAPIKey(key *models.APIKey) (*auth.Principal, error) {
+	p := &auth.Principal{
+		Kind:      auth.KindClient,
+		ClientID:  key.ClientID,
+		Username:  key.Name,
+		APIKeyID:  key.ID,
+		RateLimit: key.RateLimit,
+	}
+	// 作用域解析失败时拒绝认证，不能退化为不限制
+	var err error
+	if p.Roles, err = unmarshalStrings(key.Roles); err != nil {
+		return nil, fmt.Errorf("api key %d has invalid roles: %w", key.ID, err)
+	}
+	if p.SubKeys, err = unmarshalStrings(key.SubKeys); err != nil {
+		return nil, fmt.Errorf("api key %d has invalid sub_keys: %w", key.ID, err)
+	}
+	if p.DataSources, err = unmarshalStrings(key.DataSources); err != nil {
+		return nil, fmt.Errorf("api key %d has invalid data_sources: %w", key.ID, err)
+	}
+	return p, nil
+}
+
+func requireAdmin(ctx context.Context) (*auth.Principal, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if !p.Admin {
+		return nil, fmt.Errorf("%w: %s is not an administrator", ErrForbidden, p.Name())
+	}
+	return p, nil
+}
+
+// generateAPIKey 生成明文密钥，返回明文、展示前缀和摘要
+func generateAPIKey() (plain, prefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	plain = APIKeyPrefix + hex.EncodeToString(buf)
+	return plain, plain[:apiKeyPrefixLen], hashAPIKey(plain), nil
+}
+
+// hashAPIKey 密钥为256位随机数，直接使用SHA-256即可，无需加盐慢哈希
+func hashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func marshalStrings(values []string) json.RawMessage {
+	if len(values) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(values)
+	return data
+}
+
+func unmarshalStrings(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var values []string
+	err := json.Unmarshal(data, &values)
+	return values, err
+}
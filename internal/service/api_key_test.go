@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	plain, prefix, hash, err := generateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(plain, APIKeyPrefix))
+	assert.Equal(t, plain[:apiKeyPrefixLen], prefix)
+	assert.Equal(t, hashAPIKey(plain), hash)
+	assert.Len(t, hash, 64)
+	assert.NotContains(t, hash, plain[len(APIKeyPrefix):])
+
+	other, _, _, err := generateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, other)
+}
+
+func TestAPIKeyActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.True(t, (&models.APIKey{}).Active(now))
+	assert.True(t, (&models.APIKey{ExpiresAt: &future}).Active(now))
+	assert.False(t, (&models.APIKey{ExpiresAt: &past}).Active(now))
+	assert.False(t, (&models.APIKey{RevokedAt: &past}).Active(now))
+}
+
+func TestPrincipalFromAPIKey(t *testing.T) {
+	key := &models.APIKey{
+		ID:          42,
+		Name:        "crm",
+		ClientID:    "crm-sync",
+		Roles:       json.RawMessage(`["admin","analyst"]`),
+		SubKeys:     json.RawMessage(`["house_report"]`),
+		DataSources: json.RawMessage(`null`),
+		RateLimit:   60,
+	}
+
+	p, err := principalFromAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, auth.KindClient, p.Kind)
+	assert.Equal(t, "crm-sync", p.ClientID)
+	assert.Equal(t, uint64(42), p.APIKeyID)
+	assert.Equal(t, 60, p.RateLimit)
+	// 角色包含 admin 也不授予管理员权限
+	assert.False(t, p.Admin)
+	assert.True(t, p.AllowsSubscription("house_report"))
+	assert.False(t, p.AllowsSubscription("order_report"))
+	assert.True(t, p.AllowsDataSource("default"))
+
+	// 作用域损坏时拒绝认证
+	key.SubKeys = json.RawMessage(`"house_report"`)
+	_, err = principalFromAPIKey(key)
+	assert.Error(t, err)
+}
+
+func TestAPIKeyScopeEnforcement(t *testing.T) {
+	a := &AccessControl{}
+	p := &auth.Principal{Kind: auth.KindClient, ClientID: "crm-sync", SubKeys: []string{"house_report"}, DataSources: []string{"default"}}
+	ctx := auth.WithPrincipal(context.Background(), p)
+
+	err := a.Require(ctx, "A", "order_report", models.PermView)
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	assert.NoError(t, a.RequireDataSource(ctx, "default"))
+	assert.True(t, errors.Is(a.RequireDataSource(ctx, "finance"), ErrForbidden))
+
+	filter, err := a.Filter(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"house_report"}, filter.SubKeys)
+}
+
+func TestAPIKeyManagementRequiresAdmin(t *testing.T) {
+	s := &APIKeyService{}
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindClient, ClientID: "crm-sync"})
+
+	_, err := s.CreateKey(ctx, &models.APIKeyRequest{Name: "x", ClientID: "y"})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	_, err = s.ListKeys(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrUnauthenticated))
+}
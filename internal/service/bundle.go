@@ -0,0 +1,390 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/bundle"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/definition"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+)
+
+var (
+	ErrInvalidImportStrategy    = errors.New("invalid import strategy")
+	ErrSubscriptionTypeNotFound = errors.New("subscription type not found")
+)
+
+// importStep 导入时写入的一个版本
+type importStep struct {
+	item         int                  // 报告中对应的项
+	subscription *models.Subscription // create、new_version 为新版本，overwrite 为覆盖后的库中版本
+}
+
+// ExportBundle 导出订阅key的全部版本及其引用的数据源和订阅类型，需要每个key的 view 权限
+func (s *SubscriptionService) ExportBundle(ctx context.Context, subType string, keys []string) (*bundle.Bundle, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: at least one subscription key is required", bundle.ErrInvalid)
+	}
+
+	var subscriptions []bundle.Subscription
+	dataSources := make(map[string]bool)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := s.access.Require(ctx, subType, key, models.PermView); err != nil {
+			return nil, err
+		}
+
+		versions, err := s.repo.ListVersions(ctx, subType, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrSubscriptionNotFound, key)
+		}
+		sub := bundle.Subscription{Type: subType, SubKey: key}
+		for _, v := range versions {
+			sub.Versions = append(sub.Versions, bundle.Version{
+				Version:     v.Version,
+				Title:       v.Title,
+				Abstract:    v.Abstract,
+				Status:      v.Status,
+				ExtraConfig: v.ExtraConfig,
+			})
+			for _, name := range versionDataSources(v.ExtraConfig) {
+				dataSources[name] = true
+			}
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+
+	refs := make([]bundle.DataSourceRef, 0, len(dataSources))
+	for name := range dataSources {
+		refs = append(refs, bundle.DataSourceRef{Name: name, Driver: s.dataSourceDriver(name)})
+	}
+	types, err := s.subscriptionTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var typeRefs []bundle.TypeRef
+	if label, ok := types[subType]; ok {
+		typeRefs = append(typeRefs, bundle.TypeRef{Value: subType, Label: label})
+	}
+	return bundle.New(subscriptions, refs, typeRefs, p.Name()), nil
+}
+
+// ImportBundle 导入导出包，req.DryRun 时只返回报告，否则在同一事务中写入
+// 所有版本都按当前SQL策略校验；新建的版本获得新的ID，以待生效状态创建（已失效的版本保持失效），需按普通流程激活
+func (s *SubscriptionService) ImportBundle(ctx context.Context, b *bundle.Bundle, req *models.ImportRequest) (*models.ImportReport, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = models.ImportSkip
+	}
+	switch strategy {
+	case models.ImportSkip, models.ImportOverwrite, models.ImportNewVersion:
+	default:
+		return nil, fmt.Errorf("%w: %q, expected skip, overwrite or new_version", ErrInvalidImportStrategy, strategy)
+	}
+
+	warnings, err := s.checkBundleDataSources(b)
+	if err != nil {
+		return nil, err
+	}
+	typeWarnings, err := s.checkBundleTypes(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, typeWarnings...)
+
+	report := &models.ImportReport{
+		DryRun:     req.DryRun,
+		Strategy:   strategy,
+		Checksum:   b.Checksum,
+		ExportedAt: b.ExportedAt,
+		ExportedBy: b.ExportedBy,
+		Items:      []models.ImportItem{},
+		Warnings:   warnings,
+	}
+	var steps, newVersions []importStep
+	var verify []*models.Subscription // 覆盖生效中版本的SQL前需要试执行
+	newKeys := make(map[[2]string]bool)
+	for _, sub := range b.Subscriptions {
+		current, err := s.repo.ListVersions(ctx, sub.Type, sub.SubKey)
+		if err != nil {
+			return nil, err
+		}
+		existing := make(map[uint32]*models.Subscription, len(current))
+		var next uint32
+		for _, have := range current {
+			existing[have.Version] = have
+			next = max(next, have.Version)
+		}
+		// 新版本排在导出包中所有版本之后，避免占用随后按原版本号创建的版本
+		for _, v := range sub.Versions {
+			next = max(next, v.Version)
+		}
+		next++
+		if len(current) == 0 {
+			newKeys[[2]string{sub.Type, sub.SubKey}] = true
+		}
+
+		writes := false
+		for _, v := range sub.Versions {
+			imported := &models.Subscription{
+				Type:        sub.Type,
+				SubKey:      sub.SubKey,
+				Version:     v.Version,
+				Title:       v.Title,
+				Abstract:    v.Abstract,
+				Status:      importStatus(v.Status),
+				CreatedBy:   p.UserID,
+				ExtraConfig: v.ExtraConfig,
+			}
+			if err := s.validateVersionContent(imported); err != nil {
+				return nil, err
+			}
+
+			item := models.ImportItem{Type: sub.Type, SubKey: sub.SubKey, Version: v.Version}
+			have, ok := existing[v.Version]
+			if !ok {
+				item.Action, item.TargetVersion, item.Status = models.ImportActionCreate, v.Version, imported.Status
+				steps = append(steps, importStep{item: len(report.Items), subscription: imported})
+				report.Items = append(report.Items, item)
+				writes = true
+				continue
+			}
+
+			item.TargetVersion, item.Status = have.Version, have.Status
+			item.Fields = fieldChanges(
+				[3]string{"title", have.Title, v.Title},
+				[3]string{"abstract", have.Abstract, v.Abstract},
+			)
+			configChanged := !sameExtraConfig(have.ExtraConfig, v.ExtraConfig)
+			if configChanged {
+				item.ExtraConfig = diffExtraConfig(have.ExtraConfig, v.ExtraConfig)
+			}
+
+			switch {
+			case len(item.Fields) == 0 && !configChanged:
+				item.Action = models.ImportActionUnchanged
+			case strategy == models.ImportSkip:
+				item.Action = models.ImportActionSkip
+			case strategy == models.ImportOverwrite:
+				updated := *have
+				updated.Title, updated.Abstract, updated.ExtraConfig = v.Title, v.Abstract, v.ExtraConfig
+				// 与修改接口相同：开启审核时不能修改生效中版本的SQL，未开启时先试执行并检查输出结构
+				if configChanged && models.IsServingStatus(have.Status) {
+					if s.config.Security.RequireReview {
+						return nil, fmt.Errorf("%w: %s/%s version %d is active, its extra_config cannot be overwritten; import it as a new version instead", ErrReviewRequired, sub.Type, sub.SubKey, have.Version)
+					}
+					verify = append(verify, &updated)
+				}
+				item.Action = models.ImportActionOverwrite
+				steps = append(steps, importStep{item: len(report.Items), subscription: &updated})
+				writes = true
+			case strategy == models.ImportNewVersion:
+				imported.Version = 0
+				item.Action, item.TargetVersion, item.Status = models.ImportActionNewVersion, next, imported.Status
+				next++
+				newVersions = append(newVersions, importStep{item: len(report.Items), subscription: imported})
+				writes = true
+			}
+			report.Items = append(report.Items, item)
+		}
+
+		if writes {
+			// 与创建接口相同：已有key需要 edit 权限，新key需在调用方作用域内
+			var err error
+			if len(current) > 0 {
+				err = s.access.Require(ctx, sub.Type, sub.SubKey, models.PermEdit)
+			} else {
+				err = s.access.RequireScope(ctx, sub.SubKey)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// 按原版本号创建的版本先写入，新版本号在其后分配
+	steps = append(steps, newVersions...)
+	if req.DryRun || len(steps) == 0 {
+		return report, nil
+	}
+
+	for _, subscription := range verify {
+		if err := s.verifyActivation(ctx, subscription, req.Force); err != nil {
+			return nil, fmt.Errorf("%s/%s version %d: %w", subscription.Type, subscription.SubKey, subscription.Version, err)
+		}
+	}
+
+	meta := revisionMeta(ctx, models.RevisionImport)
+	err = s.repo.Transaction(ctx, func(repo *repository.SubscriptionRepository) error {
+		for _, step := range steps {
+			item := &report.Items[step.item]
+			var err error
+			if item.Action == models.ImportActionOverwrite {
+				err = repo.Update(ctx, step.subscription, meta)
+			} else {
+				err = repo.Create(ctx, step.subscription, meta)
+				item.TargetVersion = step.subscription.Version
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s/%s version %d: %w", item.Action, item.Type, item.SubKey, item.Version, err)
+			}
+		}
+		// 新key的导入人获得 admin 权限，与版本在同一事务中写入
+		for key := range newKeys {
+			if err := s.access.GrantCreator(ctx, repo.ACL(), key[0], key[1]); err != nil {
+				return fmt.Errorf("grant creator permission on %s/%s: %w", key[0], key[1], err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	touched := make(map[[2]string]bool)
+	for _, step := range steps {
+		touched[[2]string{step.subscription.Type, step.subscription.SubKey}] = true
+	}
+	for key := range touched {
+		s.invalidateCache(ctx, key[0], key[1])
+	}
+
+	slog.InfoContext(ctx, "Subscription bundle imported", "checksum", b.Checksum, "strategy", strategy, "writes", len(steps), "operator", p.Name())
+	return report, nil
+}
+
+// checkBundleDataSources 版本引用的数据源在本环境中必须存在，驱动与导出环境不同时只给出提示
+func (s *SubscriptionService) checkBundleDataSources(b *bundle.Bundle) ([]string, error) {
+	exported := make(map[string]string, len(b.DataSources))
+	for _, ref := range b.DataSources {
+		exported[ref.Name] = ref.Driver
+	}
+	referenced := make(map[string]bool)
+	for _, sub := range b.Subscriptions {
+		for _, v := range sub.Versions {
+			for _, name := range versionDataSources(v.ExtraConfig) {
+				referenced[name] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(referenced))
+	for name := range referenced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var missing, warnings []string
+	for _, name := range names {
+		if _, ok := s.dataSourceConfig(name); !ok {
+			missing = append(missing, name)
+			continue
+		}
+		if driver, ok := exported[name]; ok && driver != s.dataSourceDriver(name) {
+			warnings = append(warnings, fmt.Sprintf("data source %s uses driver %s here but %s in the exporting environment", name, s.dataSourceDriver(name), driver))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &DataSourceError{Name: strings.Join(missing, ", "), Err: ErrDataSourceNotFound}
+	}
+	return warnings, nil
+}
+
+// checkBundleTypes 订阅使用的订阅类型在本环境中必须已定义，名称与导出环境不同时只给出提示
+// 早期的导出包没有类型引用，同样检查类型是否存在
+func (s *SubscriptionService) checkBundleTypes(ctx context.Context, b *bundle.Bundle) ([]string, error) {
+	types, err := s.subscriptionTypes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exported := make(map[string]string, len(b.Types))
+	for _, ref := range b.Types {
+		exported[ref.Value] = ref.Label
+	}
+	referenced := make(map[string]bool)
+	for _, sub := range b.Subscriptions {
+		referenced[sub.Type] = true
+	}
+	values := make([]string, 0, len(referenced))
+	for value := range referenced {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	var missing, warnings []string
+	for _, value := range values {
+		label, ok := types[value]
+		if !ok {
+			missing = append(missing, value)
+			continue
+		}
+		if want, ok := exported[value]; ok && want != label {
+			warnings = append(warnings, fmt.Sprintf("subscription type %s is named %s here but %s in the exporting environment", value, label, want))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSubscriptionTypeNotFound, strings.Join(missing, ", "))
+	}
+	return warnings, nil
+}
+
+// subscriptionTypes 本环境定义的订阅类型，值到名称
+func (s *SubscriptionService) subscriptionTypes(ctx context.Context) (map[string]string, error) {
+	options, err := s.refs.GetSubscriptionTypes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subscription types: %w", err)
+	}
+	types := make(map[string]string, len(options))
+	for _, option := range options {
+		types[option.Value] = option.Label
+	}
+	return types, nil
+}
+
+// importStatus 导入的版本不直接生效，已失效的版本保持失效
+func importStatus(status string) string {
+	if status == models.StatusExpired {
+		return models.StatusExpired
+	}
+	return models.StatusPending
+}
+
+// versionDataSources 版本可使用的数据源，extra_config 无法解析时为空
+func versionDataSources(raw json.RawMessage) []string {
+	var extraConfig models.ExtraConfig
+	if err := json.Unmarshal(raw, &extraConfig); err != nil {
+		return nil
+	}
+	return subscriptionDataSources(&extraConfig)
+}
+
+// sameExtraConfig 按规范形式比较，忽略字段顺序和空白
+func sameExtraConfig(a, b json.RawMessage) bool {
+	ca, errA := definition.CanonicalExtraConfig(a)
+	cb, errB := definition.CanonicalExtraConfig(b)
+	if errA != nil || errB != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca, cb)
+}
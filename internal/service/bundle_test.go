@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/bundle"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportBundle(t *testing.T) {
+	source, sourceRepo := newStoreTestService(t)
+	ctx := adminContext()
+	meta := revisionMeta(ctx, models.RevisionCreate)
+	for _, sub := range []*models.Subscription{
+		syncVersion(t, "orders", 1, models.StatusExpired, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 2, models.StatusActive, "订单", "SELECT id, amount FROM orders"),
+		syncVersion(t, "houses", 1, models.StatusPending, "房源", "SELECT id FROM houses"),
+	} {
+		require.NoError(t, sourceRepo.Create(ctx, sub, meta))
+	}
+
+	b, err := source.ExportBundle(ctx, models.TypeAnalysisData, []string{"orders", "houses", "orders"})
+	require.NoError(t, err)
+	require.Len(t, b.Subscriptions, 2)
+	assert.Equal(t, "houses", b.Subscriptions[0].SubKey)
+	assert.Len(t, b.Subscriptions[1].Versions, 2)
+	assert.Equal(t, []bundle.DataSourceRef{{Name: "default", Driver: "mysql"}}, b.DataSources)
+	assert.Equal(t, []bundle.TypeRef{{Value: "A", Label: "分析数据"}}, b.Types)
+	assert.Equal(t, "gitops", b.ExportedBy)
+
+	_, err = source.ExportBundle(ctx, models.TypeAnalysisData, []string{"missing"})
+	assert.True(t, errors.Is(err, ErrSubscriptionNotFound))
+
+	// 以普通用户导入，新key的导入人获得 admin 权限，之后的导入需要 edit 权限
+	target, targetRepo := newStoreTestService(t)
+	ctx = auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindUser, UserID: 7, Username: "bob"})
+
+	// dry-run 只返回报告
+	report, err := target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportSkip, report.Strategy)
+	assert.Equal(t, b.Checksum, report.Checksum)
+	require.Len(t, report.Items, 3)
+	for _, item := range report.Items {
+		assert.Equal(t, models.ImportActionCreate, item.Action)
+	}
+	current, err := targetRepo.ListAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, current)
+
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{})
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	imported, err := targetRepo.ListVersions(ctx, "A", "orders")
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	// 导入的版本不直接生效，ID重新生成
+	assert.Equal(t, models.StatusExpired, imported[0].Status)
+	assert.Equal(t, models.StatusPending, imported[1].Status)
+	exported, err := sourceRepo.ListVersions(ctx, "A", "orders")
+	require.NoError(t, err)
+	assert.NotZero(t, imported[1].ID)
+	assert.NotEqual(t, exported[1].ID, imported[1].ID)
+	acl, err := target.access.ListACL(ctx, "A", "orders")
+	require.NoError(t, err)
+	require.Len(t, acl, 1)
+	assert.Equal(t, "7", acl[0].Subject)
+
+	// 目标环境中修改后再次导入
+	edited := *imported[1]
+	edited.Title = "订单（目标环境）"
+	require.NoError(t, targetRepo.Update(ctx, &edited, revisionMeta(ctx, models.RevisionUpdate)))
+
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportSkip})
+	require.NoError(t, err)
+	actions := make(map[string]string)
+	for _, item := range report.Items {
+		actions[fmt.Sprintf("%s/%d", item.SubKey, item.Version)] = item.Action
+	}
+	assert.Equal(t, map[string]string{
+		"houses/1": models.ImportActionUnchanged,
+		"orders/1": models.ImportActionUnchanged,
+		"orders/2": models.ImportActionSkip,
+	}, actions)
+	assert.Equal(t, []models.FieldChange{{Field: "title", From: "订单（目标环境）", To: "订单"}}, report.Items[2].Fields)
+
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportNewVersion, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportActionNewVersion, report.Items[2].Action)
+	assert.Equal(t, uint32(3), report.Items[2].TargetVersion)
+	assert.Equal(t, models.StatusPending, report.Items[2].Status)
+
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportOverwrite})
+	require.NoError(t, err)
+	assert.Equal(t, models.ImportActionOverwrite, report.Items[2].Action)
+	overwritten, err := targetRepo.GetByKeyAndVersion(ctx, "A", "orders", 2)
+	require.NoError(t, err)
+	assert.Equal(t, "订单", overwritten.Title)
+	assert.Equal(t, models.StatusPending, overwritten.Status)
+	revision, err := targetRepo.GetRevision(ctx, "A", "orders", 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, models.RevisionImport, revision.Action)
+
+	_, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: "merge"})
+	assert.True(t, errors.Is(err, ErrInvalidImportStrategy))
+}
+
+func TestImportBundleValidation(t *testing.T) {
+	target, targetRepo := newStoreTestService(t)
+	ctx := adminContext()
+
+	version := func(extraConfig string) []bundle.Subscription {
+		return []bundle.Subscription{{Type: "A", SubKey: "orders", Versions: []bundle.Version{
+			{Version: 1, Title: "订单", Abstract: "订单", Status: models.StatusActive, ExtraConfig: json.RawMessage(extraConfig)},
+		}}}
+	}
+
+	// SQL 按本环境的策略校验
+	b := bundle.New(version(`{"sql_content": "DELETE FROM orders"}`), nil, nil, "alice")
+	_, err := target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	var sqlErr *sqlguard.ValidationError
+	assert.True(t, errors.As(err, &sqlErr))
+
+	// 引用的数据源必须存在
+	b = bundle.New(version(`{"sql_content": "SELECT id FROM orders", "db_source": "report"}`), []bundle.DataSourceRef{{Name: "report", Driver: "postgres"}}, nil, "alice")
+	_, err = target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	assert.True(t, errors.Is(err, ErrDataSourceNotFound))
+	assert.EqualError(t, err, "data source report not found")
+
+	// 驱动不同只提示
+	b = bundle.New(version(`{"sql_content": "SELECT id FROM orders"}`), []bundle.DataSourceRef{{Name: "default", Driver: "postgres"}}, nil, "alice")
+	report, err := target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data source default uses driver mysql here but postgres in the exporting environment"}, report.Warnings)
+
+	// 订阅类型必须在本环境中定义，名称不同只提示
+	missing := version(`{"sql_content": "SELECT id FROM orders"}`)
+	missing[0].Type = "Z"
+	b = bundle.New(missing, nil, []bundle.TypeRef{{Value: "Z", Label: "未知"}}, "alice")
+	_, err = target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	assert.True(t, errors.Is(err, ErrSubscriptionTypeNotFound))
+	assert.EqualError(t, err, "subscription type not found: Z")
+	b = bundle.New(version(`{"sql_content": "SELECT id FROM orders"}`), nil, []bundle.TypeRef{{Value: "A", Label: "报表"}}, "alice")
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"subscription type A is named 分析数据 here but 报表 in the exporting environment"}, report.Warnings)
+
+	// 开启审核时不能覆盖生效中版本的SQL
+	active := syncVersion(t, "orders", 1, models.StatusActive, "订单", "SELECT id FROM orders")
+	require.NoError(t, targetRepo.Create(ctx, active, revisionMeta(ctx, models.RevisionCreate)))
+	target.config.Security.RequireReview = true
+	b = bundle.New(version(`{"sql_content": "SELECT id, amount FROM orders"}`), nil, nil, "alice")
+	_, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportOverwrite, DryRun: true})
+	assert.True(t, errors.Is(err, ErrReviewRequired))
+
+	report, err = target.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportNewVersion})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(2), report.Items[0].TargetVersion)
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"gorm.io/gorm"
+)
+
+// dataSourcePingTimeout 连通性测试的超时时间
+const dataSourcePingTimeout = 10 * time.Second
+
+var (
+	ErrDataSourceExists   = errors.New("data source already exists")
+	ErrDataSourceReadOnly = errors.New("data source is defined in config and cannot be modified")
+	ErrInvalidDataSource  = errors.New("invalid data source")
+)
+
+// DataSourceTestResult 连通性测试结果
+type DataSourceTestResult struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DataSourceService 数据源登记的管理接口，需要管理员权限
+type DataSourceService struct {
+	repo     *repository.DataSourceRepository
+	registry *DataSourceRegistry
+	config   *config.Config
+}
+
+func NewDataSourceService(repo *repository.DataSourceRepository, registry *DataSourceRegistry, cfg *config.Config) *DataSourceService {
+	return &DataSourceService{repo: repo, registry: registry, config: cfg}
+}
+
+// ListDataSources 列出配置文件和库中登记的数据源，不返回密码
+func (s *DataSourceService) ListDataSources(ctx context.Context) ([]*models.DataSourceView, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	sources, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := s.registry.settings().Database.DataSources
+	views := make([]*models.DataSourceView, 0, len(configured)+len(sources))
+	for name, dbConfig := range configured {
+		views = append(views, configView(name, dbConfig))
+	}
+	for _, ds := range sources {
+		if s.registry.reserved(ds.Name) {
+			continue
+		}
+		views = append(views, registryView(ds))
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	s.attachHealth(views...)
+	return views, nil
+}
+
+// Health 所有数据源的健康状态和熔断状态
+func (s *DataSourceService) Health() []models.DataSourceHealth {
+	return s.registry.Health()
+}
+
+// attachHealth 为启用的数据源附加健康状态
+func (s *DataSourceService) attachHealth(views ...*models.DataSourceView) {
+	health := make(map[string]models.DataSourceHealth)
+	for _, h := range s.registry.Health() {
+		health[h.Name] = h
+	}
+	for _, view := range views {
+		if h, ok := health[view.Name]; ok {
+			view.Health = &h
+		}
+	}
+}
+
+// GetDataSource 获取数据源定义
+func (s *DataSourceService) GetDataSource(ctx context.Context, name string) (*models.DataSourceView, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	var view *models.DataSourceView
+	if dbConfig, ok := s.registry.settings().Database.DataSources[name]; ok {
+		view = configView(name, dbConfig)
+	} else {
+		ds, err := s.find(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		view = registryView(ds)
+	}
+	s.attachHealth(view)
+	return view, nil
+}
+
+// CreateDataSource 登记数据源，密码加密后保存
+func (s *DataSourceService) CreateDataSource(ctx context.Context, req *models.DataSourceRequest) (*models.DataSourceView, error) {
+	p, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidDataSource)
+	}
+	if s.registry.reserved(req.Name) {
+		return nil, ErrDataSourceReadOnly
+	}
+	if _, err := s.repo.GetByName(ctx, req.Name); err == nil {
+		return nil, ErrDataSourceExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	ds := &models.DataSource{Name: req.Name, Status: models.DataSourceEnabled, CreatedBy: p.UserID, UpdatedBy: p.UserID}
+	if err := s.apply(ds, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, ds); err != nil {
+		return nil, err
+	}
+	s.reload(ctx)
+	return registryView(ds), nil
+}
+
+// UpdateDataSource 修改数据源定义，密码为空时保留原密码；正在使用的连接池在下次使用时重建
+func (s *DataSourceService) UpdateDataSource(ctx context.Context, name string, req *models.DataSourceRequest) (*models.DataSourceView, error) {
+	p, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" && req.Name != name {
+		return nil, fmt.Errorf("%w: data source cannot be renamed", ErrInvalidDataSource)
+	}
+	ds, err := s.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(ds, req); err != nil {
+		return nil, err
+	}
+	ds.UpdatedBy = p.UserID
+	if err := s.repo.Update(ctx, ds); err != nil {
+		return nil, err
+	}
+	s.reload(ctx)
+	return registryView(ds), nil
+}
+
+// SetDataSourceStatus 启用或停用数据源，停用后使用该数据源的执行立即失败
+func (s *DataSourceService) SetDataSourceStatus(ctx context.Context, name, status string) (*models.DataSourceView, error) {
+	p, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := s.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateStatus(ctx, ds.ID, status, p.UserID); err != nil {
+		return nil, err
+	}
+	ds.Status = status
+	ds.UpdatedBy = p.UserID
+	s.reload(ctx)
+	return registryView(ds), nil
+}
+
+// TestDataSource 使用保存的定义建立临时连接，测试结果不影响正在使用的连接池
+func (s *DataSourceService) TestDataSource(ctx context.Context, name string) (*DataSourceTestResult, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	dbConfig, ok := s.registry.settings().Database.DataSources[name]
+	if !ok {
+		ds, err := s.find(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if dbConfig, err = s.registry.connectionConfig(ds); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dataSourcePingTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result := &DataSourceTestResult{Name: name, Reachable: true}
+	if err := s.registry.Ping(ctx, dbConfig); err != nil {
+		result.Reachable = false
+		result.Error = err.Error()
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	return result, nil
+}
+
+// find 获取库中登记的数据源，配置文件中的数据源只读
+func (s *DataSourceService) find(ctx context.Context, name string) (*models.DataSource, error) {
+	if s.registry.reserved(name) {
+		return nil, ErrDataSourceReadOnly
+	}
+	ds, err := s.repo.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &DataSourceError{Name: name, Err: ErrDataSourceNotFound}
+		}
+		return nil, err
+	}
+	return ds, nil
+}
+
+// apply 校验请求并写入定义
+func (s *DataSourceService) apply(ds *models.DataSource, req *models.DataSourceRequest) error {
+	driver := dialect.Normalize(req.Driver)
+	if !dialect.Supported(driver) {
+		return fmt.Errorf("%w: unsupported driver %q, supported drivers are %v", ErrInvalidDataSource, req.Driver, dialect.Drivers)
+	}
+	if driver == dialect.SQLite {
+		if req.Database == "" {
+			return fmt.Errorf("%w: sqlite data source requires database file path", ErrInvalidDataSource)
+		}
+	} else if req.Host == "" || req.Port == 0 {
+		return fmt.Errorf("%w: host and port are required", ErrInvalidDataSource)
+	}
+	if req.Guardrails != nil && req.Guardrails.MaxEstimatedRows < 0 {
+		return fmt.Errorf("%w: guardrails.max_estimated_rows must not be negative", ErrInvalidDataSource)
+	}
+	if req.Guardrails != nil && (req.Guardrails.MaxEstimatedRows > 0 || len(req.Guardrails.NoFullScanTables) > 0) && driver != dialect.MySQL {
+		return fmt.Errorf("%w: guardrails are only supported on mysql data sources", ErrInvalidDataSource)
+	}
+	seen := make(map[string]bool, len(req.Replicas))
+	for _, replica := range req.Replicas {
+		if replica == ds.Name || seen[replica] {
+			return fmt.Errorf("%w: invalid replica %q", ErrInvalidDataSource, replica)
+		}
+		replicaConfig, ok := s.registry.Config(replica)
+		if !ok {
+			return fmt.Errorf("%w: replica %q not found", ErrInvalidDataSource, replica)
+		}
+		// SQL按请求的数据源方言绑定和校验，备用数据源必须使用相同驱动
+		if dialect.Normalize(replicaConfig.Driver) != driver {
+			return fmt.Errorf("%w: replica %q uses driver %s, expected %s", ErrInvalidDataSource, replica, dialect.Normalize(replicaConfig.Driver), driver)
+		}
+		seen[replica] = true
+	}
+
+	if req.Password != "" {
+		encrypted, err := s.registry.cipher.Encrypt(req.Password)
+		if err != nil {
+			return err
+		}
+		ds.PasswordEncrypted = encrypted
+	}
+
+	ds.Driver = driver
+	ds.Host = req.Host
+	ds.Port = req.Port
+	ds.Database = req.Database
+	ds.Username = req.Username
+	ds.MaxIdleConns = req.MaxIdleConns
+	ds.MaxOpenConns = req.MaxOpenConns
+	ds.ConnMaxLifetime = req.ConnMaxLifetime
+	ds.AllowedTables = marshalStrings(req.AllowedTables)
+	ds.DeniedTables = marshalStrings(req.DeniedTables)
+	ds.Replicas = marshalStrings(req.Replicas)
+	ds.Guardrails = nil
+	if req.Guardrails != nil {
+		ds.Guardrails, _ = json.Marshal(req.Guardrails)
+	}
+	return nil
+}
+
+// reload 修改后立即刷新本实例的登记表，其他实例按刷新间隔生效
+func (s *DataSourceService) reload(ctx context.Context) {
+	if err := s.registry.Reload(ctx); err != nil {
+		// 已写入成功，刷新失败等待下次定时刷新
+		slog.WarnContext(ctx, "Failed to reload data source registry", "error", err)
+	}
+}
+
+func configView(name string, dbConfig config.DBConfig) *models.DataSourceView {
+	ds := &models.DataSource{
+		Name:            name,
+		Driver:          dialect.Normalize(dbConfig.Driver),
+		Host:            dbConfig.Host,
+		Port:            dbConfig.Port,
+		Database:        dbConfig.Database,
+		Username:        dbConfig.Username,
+		MaxIdleConns:    dbConfig.MaxIdleConns,
+		MaxOpenConns:    dbConfig.MaxOpenConns,
+		ConnMaxLifetime: int(dbConfig.ConnMaxLifetime / time.Second),
+		AllowedTables:   marshalStrings(dbConfig.AllowedTables),
+		DeniedTables:    marshalStrings(dbConfig.DeniedTables),
+		Replicas:        marshalStrings(dbConfig.Replicas),
+		Status:          models.DataSourceEnabled,
+	}
+	if dbConfig.Guardrails.MaxEstimatedRows > 0 || len(dbConfig.Guardrails.NoFullScanTables) > 0 {
+		ds.Guardrails, _ = json.Marshal(models.DataSourceGuardrails{
+			MaxEstimatedRows: dbConfig.Guardrails.MaxEstimatedRows,
+			NoFullScanTables: dbConfig.Guardrails.NoFullScanTables,
+		})
+	}
+	return &models.DataSourceView{DataSource: ds, Origin: models.DataSourceOriginConfig, HasPassword: dbConfig.Password != ""}
+}
+
+func registryView(ds *models.DataSource) *models.DataSourceView {
+	return &models.DataSourceView{DataSource: ds, Origin: models.DataSourceOriginRegistry, HasPassword: ds.PasswordEncrypted != ""}
+}
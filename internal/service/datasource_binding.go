@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+)
+
+const (
+	defaultDataSource = "default"
+	// primaryDataSource 服务自身的元数据库，需开启 security.allow_primary_data_source 且订阅显式列入 allowed_data_sources 时才能执行
+	primaryDataSource = "primary"
+)
+
+// subscriptionDefaultSource 订阅的默认数据源，未声明 db_source 时为 default
+func subscriptionDefaultSource(extraConfig *models.ExtraConfig) string {
+	if extraConfig.DBSource != "" {
+		return extraConfig.DBSource
+	}
+	return defaultDataSource
+}
+
+// subscriptionDataSources 订阅允许执行的数据源，未声明 allowed_data_sources 时只允许默认数据源
+func subscriptionDataSources(extraConfig *models.ExtraConfig) []string {
+	if len(extraConfig.AllowedDataSources) > 0 {
+		return extraConfig.AllowedDataSources
+	}
+	return []string{subscriptionDefaultSource(extraConfig)}
+}
+
+// validateDataSourceBinding 校验数据源声明：名称非空且不重复，默认数据源在允许列表中，primary 须显式列出
+// allowPrimary 为 false 时不能声明 primary，避免订阅作者自行开放元数据库
+func validateDataSourceBinding(extraConfig *models.ExtraConfig, allowPrimary bool) error {
+	seen := make(map[string]bool, len(extraConfig.AllowedDataSources))
+	for _, name := range extraConfig.AllowedDataSources {
+		if name == "" {
+			return fmt.Errorf("allowed_data_sources must not contain empty names")
+		}
+		if name == primaryDataSource && !allowPrimary {
+			return fmt.Errorf("data source %s is disabled, enable security.allow_primary_data_source to use it", primaryDataSource)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate data source %q in allowed_data_sources", name)
+		}
+		seen[name] = true
+	}
+
+	defaultSource := subscriptionDefaultSource(extraConfig)
+	if len(seen) > 0 && !seen[defaultSource] {
+		return fmt.Errorf("db_source %q is not in allowed_data_sources", defaultSource)
+	}
+	if defaultSource == primaryDataSource && !seen[primaryDataSource] {
+		return fmt.Errorf("data source %s must be listed in allowed_data_sources explicitly", primaryDataSource)
+	}
+	return nil
+}
+
+// resolveDataSource 选择执行的数据源：请求未指定时使用订阅的默认数据源，不在允许列表中的拒绝
+// allowPrimary 为 false 时拒绝 primary，已保存的版本在关闭配置后同样不能执行
+func resolveDataSource(extraConfig *models.ExtraConfig, requested string, allowPrimary bool) (string, error) {
+	if requested == "" {
+		requested = subscriptionDefaultSource(extraConfig)
+	}
+
+	allowed := false
+	for _, name := range subscriptionDataSources(extraConfig) {
+		if name == requested {
+			allowed = true
+			break
+		}
+	}
+	// 旧版本只声明了 db_source=primary 时同样拒绝
+	if requested == primaryDataSource {
+		allowed = false
+		for _, name := range extraConfig.AllowedDataSources {
+			if name == primaryDataSource {
+				allowed = allowPrimary
+			}
+		}
+	}
+	if !allowed {
+		return "", &DataSourceError{Name: requested, Err: ErrDataSourceNotAllowed}
+	}
+	return requested, nil
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDataSource(t *testing.T) {
+	legacy := &models.ExtraConfig{}
+	name, err := resolveDataSource(legacy, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "default", name)
+	_, err = resolveDataSource(legacy, "dbcfg_adb_uhomes", true)
+	assert.True(t, errors.Is(err, ErrDataSourceNotAllowed))
+	_, err = resolveDataSource(legacy, "primary", true)
+	assert.True(t, errors.Is(err, ErrDataSourceNotAllowed))
+
+	bound := &models.ExtraConfig{DBSource: "warehouse", AllowedDataSources: []string{"warehouse", "warehouse_eu"}}
+	name, err = resolveDataSource(bound, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, "warehouse", name)
+	name, err = resolveDataSource(bound, "warehouse_eu", true)
+	require.NoError(t, err)
+	assert.Equal(t, "warehouse_eu", name)
+	_, err = resolveDataSource(bound, "default", true)
+	assert.True(t, errors.Is(err, ErrDataSourceNotAllowed))
+
+	// 只声明 db_source 不足以在 primary 上执行
+	_, err = resolveDataSource(&models.ExtraConfig{DBSource: "primary"}, "", true)
+	assert.True(t, errors.Is(err, ErrDataSourceNotAllowed))
+	name, err = resolveDataSource(&models.ExtraConfig{AllowedDataSources: []string{"default", "primary"}}, "primary", true)
+	require.NoError(t, err)
+	assert.Equal(t, "primary", name)
+
+	// 未开启 allow_primary_data_source 时已保存的版本也不能在 primary 上执行
+	_, err = resolveDataSource(&models.ExtraConfig{AllowedDataSources: []string{"default", "primary"}}, "primary", false)
+	assert.True(t, errors.Is(err, ErrDataSourceNotAllowed))
+}
+
+func TestValidateDataSourceBinding(t *testing.T) {
+	assert.NoError(t, validateDataSourceBinding(&models.ExtraConfig{}, true))
+	assert.NoError(t, validateDataSourceBinding(&models.ExtraConfig{DBSource: "warehouse", AllowedDataSources: []string{"warehouse", "default"}}, true))
+	assert.Error(t, validateDataSourceBinding(&models.ExtraConfig{AllowedDataSources: []string{"warehouse"}}, true))
+	assert.Error(t, validateDataSourceBinding(&models.ExtraConfig{AllowedDataSources: []string{"default", "default"}}, true))
+	assert.Error(t, validateDataSourceBinding(&models.ExtraConfig{DBSource: "primary"}, true))
+	assert.NoError(t, validateDataSourceBinding(&models.ExtraConfig{DBSource: "primary", AllowedDataSources: []string{"primary"}}, true))
+
+	// 订阅作者不能自行开放元数据库
+	assert.Error(t, validateDataSourceBinding(&models.ExtraConfig{AllowedDataSources: []string{"default", "primary"}}, false))
+	assert.NoError(t, validateDataSourceBinding(&models.ExtraConfig{AllowedDataSources: []string{"default", "warehouse"}}, false))
+}
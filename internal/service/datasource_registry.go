@@ -0,0 +1,597 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/logger"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/secret"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRegistryRefresh = 30 * time.Second
+	// dataSourceRetryBackoff 连接失败后再次尝试的最小间隔，避免每个请求都等待连接超时
+	dataSourceRetryBackoff = 5 * time.Second
+	// dataSourceDialTimeout 建立TCP连接的超时，避免不可达的主机长时间占用请求
+	dataSourceDialTimeout = 5 * time.Second
+)
+
+var (
+	ErrDataSourceNotFound    = errors.New("data source not found")
+	ErrDataSourceDisabled    = errors.New("data source is disabled")
+	ErrDataSourceUnavailable = errors.New("data source is unavailable")
+	ErrDataSourceNotAllowed  = errors.New("data source is not allowed for this subscription")
+)
+
+// DataSourceError 获取数据源连接失败，Err 为上面的哨兵错误之一
+type DataSourceError struct {
+	Name  string
+	Err   error
+	Cause error
+}
+
+func (e *DataSourceError) Error() string {
+	switch {
+	case errors.Is(e.Err, ErrDataSourceNotFound):
+		return fmt.Sprintf("data source %s not found", e.Name)
+	case errors.Is(e.Err, ErrDataSourceDisabled):
+		return fmt.Sprintf("data source %s is disabled", e.Name)
+	case errors.Is(e.Err, ErrDataSourceNotAllowed):
+		return fmt.Sprintf("data source %s is not allowed for this subscription", e.Name)
+	case errors.Is(e.Err, ErrCircuitOpen):
+		return fmt.Sprintf("data source %s is unhealthy, circuit breaker is open", e.Name)
+	case e.Cause != nil:
+		return fmt.Sprintf("data source %s is unavailable: %v", e.Name, e.Cause)
+	default:
+		return fmt.Sprintf("data source %s is unavailable", e.Name)
+	}
+}
+
+func (e *DataSourceError) Unwrap() error {
+	return e.Err
+}
+
+// dataSourcePool 已打开的连接池或最近一次的连接失败
+type dataSourcePool struct {
+	db          *gorm.DB
+	fingerprint string
+	err         error
+	failedAt    time.Time
+}
+
+// DataSourceRegistry 管理配置文件和库中登记的数据源，连接池按需创建
+// 同名时配置文件优先；库中定义变化后下次使用时重建连接池
+type DataSourceRegistry struct {
+	config  *config.Config // 受 mu 保护，配置重新加载时替换
+	primary *gorm.DB
+	repo    *repository.DataSourceRepository
+	cipher  *secret.Cipher
+	health  *HealthTracker
+
+	mu      sync.RWMutex
+	managed map[string]*models.DataSource
+	pools   map[string]*dataSourcePool
+	opening sync.Map // 数据源名 -> *sync.Mutex，串行创建同一数据源的连接池
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewDataSourceRegistry(cfg *config.Config, primary *gorm.DB, repo *repository.DataSourceRepository) (*DataSourceRegistry, error) {
+	cipher, err := secret.NewCipher(cfg.Security.DataSourceKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid security.data_source_key: %w", err)
+	}
+	return &DataSourceRegistry{
+		config:  cfg,
+		primary: primary,
+		repo:    repo,
+		cipher:  cipher,
+		health:  NewHealthTracker(cfg.Database.Health),
+		managed: make(map[string]*models.DataSource),
+		pools:   make(map[string]*dataSourcePool),
+	}, nil
+}
+
+// Start 加载库中的数据源定义，定期刷新并检查数据源健康状态
+func (r *DataSourceRegistry) Start(ctx context.Context) error {
+	if err := r.Reload(ctx); err != nil {
+		slog.Error("Failed to load data source registry", "error", err)
+	}
+
+	interval := r.settings().Database.RegistryRefresh
+	if interval <= 0 {
+		interval = defaultRegistryRefresh
+	}
+	r.stop = make(chan struct{})
+	r.wg.Add(2)
+	go r.refreshLoop(interval)
+	go r.healthLoop()
+	return nil
+}
+
+// Stop 停止后台任务并关闭按需创建的连接池
+func (r *DataSourceRegistry) Stop(ctx context.Context) error {
+	if r.stop != nil {
+		close(r.stop)
+		r.wg.Wait()
+	}
+
+	r.mu.Lock()
+	pools := r.pools
+	r.pools = make(map[string]*dataSourcePool)
+	r.mu.Unlock()
+
+	for _, pool := range pools {
+		closePool(pool)
+	}
+	return nil
+}
+
+func (r *DataSourceRegistry) refreshLoop(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if err := r.Reload(ctx); err != nil {
+				slog.Warn("Failed to refresh data source registry", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// settings 当前生效的配置
+func (r *DataSourceRegistry) settings() *config.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+// ApplyConfig 应用重新加载的配置
+// 配置文件数据源的连接池参数在原连接池上调整；连接信息变化或已删除的数据源关闭连接池，下次使用时重建
+func (r *DataSourceRegistry) ApplyConfig(cfg *config.Config) {
+	r.mu.Lock()
+	previous := r.config.Database.DataSources
+	r.config = cfg
+	var stale []*dataSourcePool
+	for name, pool := range r.pools {
+		old, wasConfig := previous[name]
+		if !wasConfig {
+			continue
+		}
+		next, ok := cfg.Database.DataSources[name]
+		if !ok || connectionChanged(old, next) {
+			stale = append(stale, pool)
+			delete(r.pools, name)
+			continue
+		}
+		if pool.db != nil {
+			if sqlDB, err := pool.db.DB(); err == nil {
+				applyPoolSettings(sqlDB, next)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	// 执行中的查询结束后关闭
+	for _, pool := range stale {
+		go closePool(pool)
+	}
+}
+
+// connectionChanged 连接信息是否变化，连接池参数和表策略不影响已建立的连接
+func connectionChanged(a, b config.DBConfig) bool {
+	return dialect.Normalize(a.Driver) != dialect.Normalize(b.Driver) ||
+		a.Host != b.Host || a.Port != b.Port || a.Database != b.Database ||
+		a.Username != b.Username || a.Password != b.Password
+}
+
+// Reload 重新读取库中的数据源定义，已删除或停用的数据源关闭连接池
+func (r *DataSourceRegistry) Reload(ctx context.Context) error {
+	if r.repo == nil {
+		return nil
+	}
+	sources, err := r.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	managed := make(map[string]*models.DataSource, len(sources))
+	for _, ds := range sources {
+		if r.reserved(ds.Name) {
+			slog.Warn("Registered data source shadowed by config", "name", ds.Name)
+			continue
+		}
+		managed[ds.Name] = ds
+	}
+
+	r.mu.Lock()
+	for name := range r.managed {
+		if _, ok := managed[name]; !ok {
+			r.health.Forget(name)
+		}
+	}
+	r.managed = managed
+	var stale []*dataSourcePool
+	for name, pool := range r.pools {
+		if _, inConfig := r.config.Database.DataSources[name]; inConfig {
+			continue
+		}
+		if ds, ok := managed[name]; !ok || ds.Status != models.DataSourceEnabled {
+			stale = append(stale, pool)
+			delete(r.pools, name)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, pool := range stale {
+		go closePool(pool)
+	}
+	return nil
+}
+
+// reserved 名称是否由配置文件占用
+func (r *DataSourceRegistry) reserved(name string) bool {
+	if name == "primary" {
+		return true
+	}
+	_, ok := r.settings().Database.DataSources[name]
+	return ok
+}
+
+// Get 获取数据源连接，首次使用或定义变化时创建连接池
+func (r *DataSourceRegistry) Get(ctx context.Context, name string) (*gorm.DB, error) {
+	if _, ok := r.settings().Database.DataSources[name]; !ok && name == "primary" && r.primary != nil {
+		return r.primary, nil
+	}
+
+	dbConfig, fingerprint, err := r.definition(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	pool := r.pools[name]
+	r.mu.RUnlock()
+	if pool != nil && pool.fingerprint == fingerprint {
+		if pool.db != nil {
+			return pool.db, nil
+		}
+		if time.Since(pool.failedAt) < dataSourceRetryBackoff {
+			return nil, &DataSourceError{Name: name, Err: ErrDataSourceUnavailable, Cause: pool.err}
+		}
+	}
+
+	// 串行创建连接池，避免并发请求同时对同一数据源建连
+	lock, _ := r.opening.LoadOrStore(name, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	r.mu.RLock()
+	current := r.pools[name]
+	r.mu.RUnlock()
+	if current != nil && current != pool && current.fingerprint == fingerprint && current.db != nil {
+		return current.db, nil
+	}
+
+	db, openErr := r.open(dbConfig)
+	next := &dataSourcePool{db: db, fingerprint: fingerprint}
+	if openErr != nil {
+		next.err = openErr
+		next.failedAt = time.Now()
+		slog.WarnContext(ctx, "Failed to connect to data source", "name", name, "error", openErr)
+	}
+
+	r.mu.Lock()
+	previous := r.pools[name]
+	r.pools[name] = next
+	r.mu.Unlock()
+
+	// 定义变化后旧连接池在执行中的查询结束后关闭
+	if previous != nil && previous.db != nil && previous.fingerprint != fingerprint {
+		go closePool(previous)
+	}
+
+	if openErr != nil {
+		return nil, &DataSourceError{Name: name, Err: ErrDataSourceUnavailable, Cause: openErr}
+	}
+	return db, nil
+}
+
+// definition 解析数据源的连接配置和用于判断定义是否变化的指纹
+func (r *DataSourceRegistry) definition(name string) (config.DBConfig, string, error) {
+	if dbConfig, ok := r.settings().Database.DataSources[name]; ok {
+		return dbConfig, models.DataSourceOriginConfig, nil
+	}
+
+	r.mu.RLock()
+	ds, ok := r.managed[name]
+	r.mu.RUnlock()
+	if !ok {
+		return config.DBConfig{}, "", &DataSourceError{Name: name, Err: ErrDataSourceNotFound}
+	}
+	if ds.Status != models.DataSourceEnabled {
+		return config.DBConfig{}, "", &DataSourceError{Name: name, Err: ErrDataSourceDisabled}
+	}
+
+	dbConfig, err := r.connectionConfig(ds)
+	if err != nil {
+		return config.DBConfig{}, "", &DataSourceError{Name: name, Err: ErrDataSourceUnavailable, Cause: err}
+	}
+	return dbConfig, fingerprint(ds), nil
+}
+
+// fingerprint 连接相关字段的摘要，只有这些字段变化时才需要重建连接池
+func fingerprint(ds *models.DataSource) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%s|%s|%d|%d|%d",
+		ds.Driver, ds.Host, ds.Port, ds.Database, ds.Username, ds.PasswordEncrypted,
+		ds.MaxIdleConns, ds.MaxOpenConns, ds.ConnMaxLifetime)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Config 获取数据源的策略配置（表白名单、护栏等），不包含密码
+func (r *DataSourceRegistry) Config(name string) (config.DBConfig, bool) {
+	settings := r.settings()
+	if dbConfig, ok := settings.Database.DataSources[name]; ok {
+		return dbConfig, true
+	}
+	if name == "primary" {
+		return settings.Database.Primary, true
+	}
+
+	r.mu.RLock()
+	ds, ok := r.managed[name]
+	r.mu.RUnlock()
+	if !ok {
+		return config.DBConfig{}, false
+	}
+	return policyConfig(ds), true
+}
+
+// Acquire 获取执行使用的连接，数据源熔断或无法连接时按 replicas 顺序切换到备用数据源，返回实际使用的数据源名
+func (r *DataSourceRegistry) Acquire(ctx context.Context, name string) (*gorm.DB, string, error) {
+	var replicas []string
+	if dbConfig, ok := r.Config(name); ok {
+		replicas = dbConfig.Replicas
+	}
+
+	var firstErr error
+	for _, candidate := range append([]string{name}, replicas...) {
+		if r.health != nil && !r.health.Allow(candidate) {
+			if firstErr == nil {
+				firstErr = &DataSourceError{Name: candidate, Err: ErrCircuitOpen}
+			}
+			continue
+		}
+
+		db, err := r.Get(ctx, candidate)
+		if err != nil {
+			if !errors.Is(err, ErrDataSourceUnavailable) {
+				// 数据源不存在或已停用时不切换，备用数据源同理跳过
+				if candidate == name {
+					return nil, "", err
+				}
+				continue
+			}
+			r.Report(candidate, 0, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if candidate != name {
+			slog.WarnContext(ctx, "Data source unavailable, routed to replica", "name", name, "replica", candidate)
+			metrics.RecordDataSourceFailover(metricsService, name, candidate)
+		}
+		return db, candidate, nil
+	}
+	return nil, "", firstErr
+}
+
+// Report 上报查询结果，用于健康跟踪和熔断
+func (r *DataSourceRegistry) Report(name string, latency time.Duration, err error) {
+	if r.health == nil || name == "" {
+		return
+	}
+	r.health.Record(name, healthSourceQuery, latency, err)
+}
+
+// Names 所有已定义的数据源名称（不含 primary 和已停用的数据源）
+func (r *DataSourceRegistry) Names() []string {
+	configured := r.settings().Database.DataSources
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	r.mu.RLock()
+	for name, ds := range r.managed {
+		if ds.Status == models.DataSourceEnabled {
+			names = append(names, name)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Health 所有数据源的健康状态
+func (r *DataSourceRegistry) Health() []models.DataSourceHealth {
+	if r.health == nil {
+		return nil
+	}
+	snapshot := r.health.Snapshot(r.Names())
+	for i := range snapshot {
+		if dbConfig, ok := r.Config(snapshot[i].Name); ok {
+			snapshot[i].Replicas = dbConfig.Replicas
+		}
+	}
+	return snapshot
+}
+
+func (r *DataSourceRegistry) healthLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.health.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.checkHealth()
+		}
+	}
+}
+
+// checkHealth 并发 ping 所有数据源，熔断中的数据源在 open_duration 之后才会探测
+func (r *DataSourceRegistry) checkHealth() {
+	var wg sync.WaitGroup
+	for _, name := range r.Names() {
+		if !r.health.Allow(name) {
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), r.health.config.PingTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := r.ping(ctx, name)
+			r.health.Record(name, healthSourcePing, time.Since(start), err)
+		}(name)
+	}
+	wg.Wait()
+}
+
+func (r *DataSourceRegistry) ping(ctx context.Context, name string) error {
+	db, err := r.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Exists 数据源是否已定义，不检查是否可用
+func (r *DataSourceRegistry) Exists(name string) bool {
+	_, ok := r.Config(name)
+	return ok
+}
+
+// Ping 用给定的连接配置建立临时连接并检测连通性
+func (r *DataSourceRegistry) Ping(ctx context.Context, dbConfig config.DBConfig) error {
+	db, err := r.open(dbConfig)
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	return sqlDB.PingContext(ctx)
+}
+
+// connectionConfig 将库中定义转换为连接配置，解密密码
+func (r *DataSourceRegistry) connectionConfig(ds *models.DataSource) (config.DBConfig, error) {
+	password, err := r.cipher.Decrypt(ds.PasswordEncrypted)
+	if err != nil {
+		return config.DBConfig{}, fmt.Errorf("decrypt password: %w", err)
+	}
+	dbConfig := policyConfig(ds)
+	dbConfig.Password = password
+	return dbConfig, nil
+}
+
+// policyConfig 将库中定义转换为不含密码的配置
+func policyConfig(ds *models.DataSource) config.DBConfig {
+	dbConfig := config.DBConfig{
+		Driver:          ds.Driver,
+		Host:            ds.Host,
+		Port:            ds.Port,
+		Database:        ds.Database,
+		Username:        ds.Username,
+		MaxIdleConns:    ds.MaxIdleConns,
+		MaxOpenConns:    ds.MaxOpenConns,
+		ConnMaxLifetime: time.Duration(ds.ConnMaxLifetime) * time.Second,
+	}
+	// 表列表和护栏由管理接口校验后写入
+	dbConfig.AllowedTables, _ = unmarshalStrings(ds.AllowedTables)
+	dbConfig.DeniedTables, _ = unmarshalStrings(ds.DeniedTables)
+	dbConfig.Replicas, _ = unmarshalStrings(ds.Replicas)
+	var guardrails models.DataSourceGuardrails
+	if len(ds.Guardrails) > 0 && json.Unmarshal(ds.Guardrails, &guardrails) == nil {
+		dbConfig.Guardrails = config.GuardrailConfig{
+			MaxEstimatedRows: guardrails.MaxEstimatedRows,
+			NoFullScanTables: guardrails.NoFullScanTables,
+		}
+	}
+	return dbConfig
+}
+
+// open 按驱动创建连接池，gorm 打开时会做一次连通性检查
+func (r *DataSourceRegistry) open(dbConfig config.DBConfig) (*gorm.DB, error) {
+	dialector, err := dialect.Open(dbConfig, dataSourceDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	gormConfig := &gorm.Config{}
+	if r.settings().Logging.FileLogEnabled {
+		gormConfig.Logger = logger.NewGormLogger(logger.GetFileLogger())
+	}
+
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	applyPoolSettings(sqlDB, dbConfig)
+	return db, nil
+}
+
+// applyPoolSettings 设置连接池参数，可在使用中的连接池上调整
+func applyPoolSettings(sqlDB *sql.DB, dbConfig config.DBConfig) {
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(dbConfig.ConnMaxLifetime)
+}
+
+func closePool(pool *dataSourcePool) {
+	if pool.db == nil {
+		return
+	}
+	if sqlDB, err := pool.db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
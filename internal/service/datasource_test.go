@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/secret"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestRegistry(t *testing.T, cfg *config.Config) *DataSourceRegistry {
+	cfg.Security.DataSourceKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	r, err := NewDataSourceRegistry(cfg, nil, nil)
+	require.NoError(t, err)
+	return r
+}
+
+func TestDataSourceRegistryResolve(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Primary.Database = "bisub"
+	cfg.Database.DataSources = map[string]config.DBConfig{"default": {Database: "bi"}}
+	r := newTestRegistry(t, cfg)
+	r.managed = map[string]*models.DataSource{
+		"report": {
+			Name:         "report",
+			Database:     "report",
+			Status:       models.DataSourceEnabled,
+			DeniedTables: json.RawMessage(`["report.secrets"]`),
+			Guardrails:   json.RawMessage(`{"max_estimated_rows": 1000}`),
+		},
+		"archive": {Name: "archive", Status: models.DataSourceDisabled},
+	}
+
+	dbConfig, ok := r.Config("default")
+	assert.True(t, ok)
+	assert.Equal(t, "bi", dbConfig.Database)
+
+	dbConfig, ok = r.Config("primary")
+	assert.True(t, ok)
+	assert.Equal(t, "bisub", dbConfig.Database)
+
+	dbConfig, ok = r.Config("report")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"report.secrets"}, dbConfig.DeniedTables)
+	assert.Equal(t, int64(1000), dbConfig.Guardrails.MaxEstimatedRows)
+
+	assert.False(t, r.Exists("unknown"))
+
+	_, err := r.Get(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, ErrDataSourceNotFound))
+	assert.EqualError(t, err, "data source unknown not found")
+
+	_, err = r.Get(context.Background(), "archive")
+	assert.True(t, errors.Is(err, ErrDataSourceDisabled))
+
+	// 配置文件中的名称不能被登记覆盖
+	assert.True(t, r.reserved("default"))
+	assert.True(t, r.reserved("primary"))
+	assert.False(t, r.reserved("report"))
+}
+
+func TestDataSourceRegistryDecryptFailure(t *testing.T) {
+	r := newTestRegistry(t, &config.Config{})
+	r.managed = map[string]*models.DataSource{
+		"report": {Name: "report", Status: models.DataSourceEnabled, PasswordEncrypted: "v1:corrupted"},
+	}
+
+	_, err := r.Get(context.Background(), "report")
+	assert.True(t, errors.Is(err, ErrDataSourceUnavailable))
+	var sourceErr *DataSourceError
+	require.True(t, errors.As(err, &sourceErr))
+	assert.True(t, errors.Is(sourceErr.Cause, secret.ErrCiphertext))
+}
+
+func TestDataSourceFingerprint(t *testing.T) {
+	ds := &models.DataSource{Host: "db1", Port: 3306, PasswordEncrypted: "v1:a"}
+	before := fingerprint(ds)
+
+	// 护栏和表策略不影响连接池
+	ds.DeniedTables = json.RawMessage(`["a.b"]`)
+	assert.Equal(t, before, fingerprint(ds))
+
+	ds.PasswordEncrypted = "v1:b"
+	assert.NotEqual(t, before, fingerprint(ds))
+}
+
+func TestDataSourceRegistryApplyConfig(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.DataSources = map[string]config.DBConfig{
+		"bi":     {Host: "db1", MaxOpenConns: 5},
+		"report": {Host: "db2"},
+	}
+	r := newTestRegistry(t, cfg)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	r.pools["bi"] = &dataSourcePool{db: db, fingerprint: models.DataSourceOriginConfig}
+	r.pools["report"] = &dataSourcePool{fingerprint: models.DataSourceOriginConfig}
+
+	// 连接池参数在原连接池上调整，连接信息变化的数据源关闭连接池
+	next := &config.Config{}
+	next.Database.DataSources = map[string]config.DBConfig{
+		"bi":     {Host: "db1", MaxOpenConns: 7, AllowedTables: []string{"bi.*"}},
+		"report": {Host: "db3"},
+	}
+	r.ApplyConfig(next)
+
+	require.Contains(t, r.pools, "bi")
+	assert.Same(t, db, r.pools["bi"].db)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 7, sqlDB.Stats().MaxOpenConnections)
+	assert.NotContains(t, r.pools, "report")
+
+	dbConfig, ok := r.Config("bi")
+	require.True(t, ok)
+	assert.Equal(t, []string{"bi.*"}, dbConfig.AllowedTables)
+}
+
+func TestApplyDataSourceRequest(t *testing.T) {
+	cfg := &config.Config{}
+	s := &DataSourceService{registry: newTestRegistry(t, cfg), config: cfg}
+
+	ds := &models.DataSource{}
+	req := &models.DataSourceRequest{
+		Host:       "db1",
+		Port:       3306,
+		Username:   "bi",
+		Password:   "s3cret",
+		Guardrails: &models.DataSourceGuardrails{MaxEstimatedRows: 500},
+	}
+	require.NoError(t, s.apply(ds, req))
+	assert.Equal(t, "mysql", ds.Driver)
+	assert.NotContains(t, ds.PasswordEncrypted, "s3cret")
+
+	dbConfig, err := s.registry.connectionConfig(ds)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", dbConfig.Password)
+	assert.Equal(t, int64(500), dbConfig.Guardrails.MaxEstimatedRows)
+
+	// 密码为空时保留原密码
+	encrypted := ds.PasswordEncrypted
+	req.Password = ""
+	require.NoError(t, s.apply(ds, req))
+	assert.Equal(t, encrypted, ds.PasswordEncrypted)
+
+	req.Driver = "oracle"
+	assert.True(t, errors.Is(s.apply(ds, req), ErrInvalidDataSource))
+
+	// SQLite 只需要文件路径，其他驱动需要主机和端口
+	require.NoError(t, s.apply(ds, &models.DataSourceRequest{Driver: "sqlite3", Database: "fixtures/bi.db"}))
+	assert.Equal(t, "sqlite", ds.Driver)
+	assert.True(t, errors.Is(s.apply(ds, &models.DataSourceRequest{Driver: "postgres", Database: "bi"}), ErrInvalidDataSource))
+
+	// 护栏只支持 MySQL
+	err = s.apply(ds, &models.DataSourceRequest{Driver: "sqlite", Database: "fixtures/bi.db", Guardrails: &models.DataSourceGuardrails{MaxEstimatedRows: 500}})
+	assert.True(t, errors.Is(err, ErrInvalidDataSource))
+	assert.ErrorContains(t, err, "only supported on mysql")
+
+	// 未配置密钥时不能保存密码
+	noKey := &DataSourceService{registry: &DataSourceRegistry{config: cfg, cipher: &secret.Cipher{}}, config: cfg}
+	err = noKey.apply(&models.DataSource{}, &models.DataSourceRequest{Host: "db1", Port: 3306, Password: "s3cret"})
+	assert.True(t, errors.Is(err, secret.ErrKeyMissing))
+}
+
+func TestConfigViewHidesPassword(t *testing.T) {
+	view := configView("default", config.DBConfig{Host: "db1", Password: "s3cret"})
+	data, err := json.Marshal(view)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.True(t, view.HasPassword)
+	assert.Equal(t, models.DataSourceOriginConfig, view.Origin)
+}
@@ -0,0 +1,337 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+)
+
+var ErrWebhookHostDenied = errors.New("webhook host is not allowed")
+
+// delivery 一次待投递的执行结果
+type delivery struct {
+	schedule     *models.SubscriptionSchedule
+	subscription *models.Subscription
+	target       *models.DeliveryTarget
+	result       *collectedResult
+	scheduledAt  time.Time
+}
+
+// webhookPayload webhook 请求体
+type webhookPayload struct {
+	ScheduleID  uint64                   `json:"schedule_id,string"`
+	Schedule    string                   `json:"schedule"`
+	Type        string                   `json:"type"`
+	SubKey      string                   `json:"sub_key"`
+	Version     uint32                   `json:"version"`
+	ScheduledAt time.Time                `json:"scheduled_at"`
+	Columns     []string                 `json:"columns"`
+	RowCount    int                      `json:"row_count"`
+	Rows        []map[string]interface{} `json:"rows"`
+}
+
+func (s *Scheduler) deliver(ctx context.Context, d *delivery) error {
+	switch d.target.Type {
+	case models.TargetWebhook:
+		return s.deliverWebhook(ctx, d)
+	case models.TargetEmail:
+		return s.deliverEmail(d)
+	case models.TargetFile:
+		return s.deliverFile(d)
+	default:
+		return fmt.Errorf("unsupported target type %q", d.target.Type)
+	}
+}
+
+func (s *Scheduler) deliverWebhook(ctx context.Context, d *delivery) error {
+	payload := webhookPayload{
+		ScheduleID:  d.schedule.ID,
+		Schedule:    d.schedule.Name,
+		Type:        d.subscription.Type,
+		SubKey:      d.subscription.SubKey,
+		Version:     d.subscription.Version,
+		ScheduledAt: d.scheduledAt,
+		Columns:     d.result.columns,
+		RowCount:    len(d.result.rows),
+		Rows:        make([]map[string]interface{}, len(d.result.rows)),
+	}
+	for i, values := range d.result.rows {
+		row := make(map[string]interface{}, len(values))
+		for j, col := range d.result.columns {
+			row[col] = values[j]
+		}
+		payload.Rows[i] = row
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Webhook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// 计划可能在 allowed_hosts 收紧前保存
+	if err := checkWebhookHost(req.URL.Hostname(), s.config.Webhook.AllowedHosts); err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-bisub-scheduler")
+	for k, v := range d.target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.webhook.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newWebhookClient webhook 使用的客户端，不跟随重定向
+// 未配置 allowed_hosts 时在建立连接时校验解析后的地址，拒绝内网地址，DNS 解析结果变化也无法绕过；此时不使用环境变量中的代理
+func newWebhookClient(cfg config.WebhookConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(cfg.AllowedHosts) == 0 {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || privateWebhookIP(ip) {
+					return fmt.Errorf("%w: %s is a private address", ErrWebhookHostDenied, host)
+				}
+				return nil
+			},
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkWebhookHost 配置了 allowed_hosts 时主机必须在列表中，*.example.com 匹配其子域名；
+// 未配置时拒绝直接写成内网IP的地址，域名在建立连接时校验
+func checkWebhookHost(host string, allowed []string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if len(allowed) == 0 {
+		if ip := net.ParseIP(host); ip != nil && privateWebhookIP(ip) {
+			return fmt.Errorf("%w: %s is a private address", ErrWebhookHostDenied, host)
+		}
+		return nil
+	}
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if host == pattern || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in scheduler.webhook.allowed_hosts", ErrWebhookHostDenied, host)
+}
+
+// sharedAddressSpace 运营商级NAT地址段 100.64.0.0/10
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// privateWebhookIP 回环、内网、链路本地、组播、未指定和运营商级NAT地址
+func privateWebhookIP(ip net.IP) bool {
+	return !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip)
+}
+
+func (s *Scheduler) deliverEmail(d *delivery) error {
+	smtpCfg := s.config.SMTP
+	if smtpCfg.Host == "" {
+		return fmt.Errorf("smtp is not configured")
+	}
+
+	attachment, err := encodeCSV(d.result)
+	if err != nil {
+		return err
+	}
+
+	// 升级前保存的收件人可能带显示名，RCPT 只能使用地址部分
+	recipients := make([]string, len(d.target.To))
+	for i, to := range d.target.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+		recipients[i] = addr.Address
+	}
+	from, err := mail.ParseAddress(smtpCfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid scheduler.smtp.from %q: %w", smtpCfg.From, err)
+	}
+
+	subject := d.target.Subject
+	if subject == "" {
+		subject = d.subscription.Title
+	}
+
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	text, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(text, "%s (%s v%d)\r\n%d rows, scheduled at %s\r\n",
+		subject, d.subscription.SubKey, d.subscription.Version, len(d.result.rows), d.scheduledAt.Format(time.RFC3339))
+
+	fileName := deliveryFileName(d)
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("text/csv", map[string]string{"name": fileName})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": fileName})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: part})
+	encoder.Write(attachment)
+	encoder.Close()
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if smtpCfg.Username != "" {
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	}
+	port := smtpCfg.Port
+	if port == 0 {
+		port = 25
+	}
+	addr := fmt.Sprintf("%s:%d", smtpCfg.Host, port)
+	return smtp.SendMail(addr, auth, from.Address, recipients, msg.Bytes())
+}
+
+func (s *Scheduler) deliverFile(d *delivery) error {
+	if s.config.OutputDir == "" {
+		return fmt.Errorf("scheduler.output_dir is not configured")
+	}
+	if err := os.MkdirAll(s.config.OutputDir, 0o755); err != nil {
+		return err
+	}
+
+	data, err := encodeCSV(d.result)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免下游读到不完整的文件
+	path := filepath.Join(s.config.OutputDir, deliveryFileName(d))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// deliveryFileName 按模板生成文件名，只取最后一段防止路径穿越
+func deliveryFileName(d *delivery) string {
+	name := d.target.FileName
+	if name == "" {
+		name = "{sub_key}_{date}_{time}.csv"
+	}
+	name = strings.NewReplacer(
+		"{sub_key}", d.subscription.SubKey,
+		"{date}", d.scheduledAt.Format("20060102"),
+		"{time}", d.scheduledAt.Format("150405"),
+	).Replace(name)
+	return filepath.Base(name)
+}
+
+func encodeCSV(result *collectedResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(result.columns); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(result.columns))
+	for _, values := range result.rows {
+		for i, val := range values {
+			record[i] = utils.FormatCSVValue(val)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// lineWrapper 按 RFC 2045 每76个字符换行
+type lineWrapper struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := 76 - l.col
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		l.col += n
+		p = p[n:]
+		if l.col == 76 {
+			if _, err := l.w.Write([]byte("\r\n")); err != nil {
+				return written, err
+			}
+			l.col = 0
+		}
+	}
+	return written, nil
+}
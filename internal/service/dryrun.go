@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/queryplan"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
+)
+
+var ErrExplainUnsupported = errors.New("EXPLAIN is only supported on MySQL data sources")
+
+// DryRunResult 试运行结果，只返回执行计划不执行查询
+type DryRunResult struct {
+	SubKey     string                `json:"sub_key"`
+	Version    uint32                `json:"version"`
+	DataSource string                `json:"data_source"`
+	SQL        string                `json:"sql"` // 按驱动方言渲染参数后的SQL
+	Plan       *queryplan.Plan       `json:"plan"`
+	Violations []queryplan.Violation `json:"violations"`
+	Allowed    bool                  `json:"allowed"` // 是否通过数据源的成本护栏
+}
+
+// DryRun 按执行时的规则解析版本、绑定变量和选择数据源，返回 EXPLAIN 执行计划和护栏评估结果
+func (s *SubscriptionService) DryRun(ctx context.Context, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest) (*DryRunResult, error) {
+	plan, err := s.prepareExecution(ctx, subType, key, version, req)
+	if err != nil {
+		return nil, err
+	}
+
+	queryPlan, err := s.explain(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	violations := s.guardrails(plan.dataSource).Check(queryPlan)
+	if violations == nil {
+		violations = []queryplan.Violation{}
+	}
+	return &DryRunResult{
+		SubKey:     plan.subscription.SubKey,
+		Version:    plan.subscription.Version,
+		DataSource: plan.dataSource,
+		SQL:        plan.db.Dialector.Explain(plan.sql, plan.args...),
+		Plan:       queryPlan,
+		Violations: violations,
+		Allowed:    len(violations) == 0,
+	}, nil
+}
+
+// checkGuardrails 数据源配置了护栏时先 EXPLAIN 评估查询成本，超限返回 GuardrailError
+// 护栏只对 MySQL 生效，配置校验会拒绝其他驱动上的护栏，此前保存的配置在这里忽略
+func (s *SubscriptionService) checkGuardrails(ctx context.Context, plan *executionPlan) error {
+	guardrails := s.guardrails(plan.dataSource)
+	if !guardrails.Enabled() || plan.db.Dialector.Name() != dialect.MySQL {
+		return nil
+	}
+
+	queryPlan, err := s.explain(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("guardrail check failed: %w", err)
+	}
+	if violations := guardrails.Check(queryPlan); len(violations) > 0 {
+		return &queryplan.GuardrailError{Violations: violations}
+	}
+	return nil
+}
+
+// explain 在目标数据源执行 EXPLAIN FORMAT=JSON 并解析执行计划
+func (s *SubscriptionService) explain(ctx context.Context, plan *executionPlan) (*queryplan.Plan, error) {
+	if plan.db.Dialector.Name() != dialect.MySQL {
+		return nil, ErrExplainUnsupported
+	}
+
+	timeout := plan.timeout
+	if timeout == 0 {
+		timeout = s.config.Server.Timeout
+	}
+	explainCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var raw string
+	if err := plan.db.WithContext(explainCtx).Raw("EXPLAIN FORMAT=JSON "+plan.sql, plan.args...).Row().Scan(&raw); err != nil {
+		return nil, fmt.Errorf("EXPLAIN failed: %w", err)
+	}
+
+	policy := s.sqlPolicy(plan.dataSource)
+	aliases, err := sqlguard.TableAliases(plan.sql, policy.DefaultSchema)
+	if err != nil {
+		return nil, err
+	}
+	return queryplan.ParseMySQL([]byte(raw), aliases)
+}
+
+// guardrails 数据源的查询成本护栏
+func (s *SubscriptionService) guardrails(dataSource string) queryplan.Guardrails {
+	dbConfig, ok := s.dataSourceConfig(dataSource)
+	if !ok {
+		return queryplan.Guardrails{}
+	}
+	return queryplan.Guardrails{
+		MaxEstimatedRows: dbConfig.Guardrails.MaxEstimatedRows,
+		NoFullScanTables: dbConfig.Guardrails.NoFullScanTables,
+	}
+}
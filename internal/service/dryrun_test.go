@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardrailsPerDataSource(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.Primary.Guardrails.MaxEstimatedRows = 100
+	cfg.Database.DataSources = map[string]config.DBConfig{
+		"default": {Guardrails: config.GuardrailConfig{NoFullScanTables: []string{"bi.*"}}},
+		"report":  {},
+	}
+	s := &SubscriptionService{config: cfg, dataSources: &DataSourceRegistry{config: cfg}}
+
+	assert.Equal(t, []string{"bi.*"}, s.guardrails("default").NoFullScanTables)
+	assert.Equal(t, int64(100), s.guardrails("primary").MaxEstimatedRows)
+	assert.False(t, s.guardrails("report").Enabled())
+	assert.False(t, s.guardrails("unknown").Enabled())
+
+	// 未配置护栏时不执行 EXPLAIN
+	assert.NoError(t, s.checkGuardrails(context.Background(), &executionPlan{dataSource: "report"}))
+}
+
+func TestGuardrailsSkippedOnNonMySQL(t *testing.T) {
+	s, _ := newExecutionTestService(t)
+	dbConfig := s.config.Database.DataSources["default"]
+	dbConfig.Guardrails.MaxEstimatedRows = 1
+	s.config.Database.DataSources["default"] = dbConfig
+	require.True(t, s.guardrails("default").Enabled())
+
+	// SQLite 没有 EXPLAIN FORMAT=JSON，护栏不生效，执行不受影响
+	result, err := s.ExecuteSubscription(adminContext(), models.TypeAnalysisData, "orders", nil, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "")
+	require.NoError(t, err)
+	assert.Len(t, result.Rows, 3)
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultHealthCheckInterval = 15 * time.Second
+	defaultPingTimeout         = 3 * time.Second
+	defaultFailureThreshold    = 3
+	defaultOpenDuration        = 30 * time.Second
+	// latencySmoothing 延迟指数滑动平均中最新样本的权重
+	latencySmoothing = 0.2
+)
+
+var circuitStateValues = map[string]int{models.CircuitClosed: 0, models.CircuitHalfOpen: 1, models.CircuitOpen: 2}
+
+// 故障来源
+const (
+	healthSourcePing  = "ping"
+	healthSourceQuery = "query"
+)
+
+var (
+	ErrCircuitOpen    = errors.New("data source circuit breaker is open")
+	errSlowDataSource = errors.New("query exceeded slow threshold")
+)
+
+// sourceHealth 单个数据源的熔断器
+type sourceHealth struct {
+	state       string
+	failures    int
+	openedAt    time.Time
+	probeAt     time.Time // 半开状态下探测放行的时间，零值表示没有进行中的探测
+	latency     time.Duration
+	lastError   string
+	lastErrorAt time.Time
+	lastCheckAt time.Time
+}
+
+// HealthTracker 按 ping 和实际查询的结果跟踪数据源健康状态，连续失败达到阈值后熔断
+type HealthTracker struct {
+	config config.HealthConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	sources map[string]*sourceHealth
+}
+
+func NewHealthTracker(cfg config.HealthConfig) *HealthTracker {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultHealthCheckInterval
+	}
+	if cfg.PingTimeout <= 0 {
+		cfg.PingTimeout = defaultPingTimeout
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaultOpenDuration
+	}
+	return &HealthTracker{config: cfg, now: time.Now, sources: make(map[string]*sourceHealth)}
+}
+
+func (t *HealthTracker) source(name string) *sourceHealth {
+	h, ok := t.sources[name]
+	if !ok {
+		h = &sourceHealth{state: models.CircuitClosed}
+		t.sources[name] = h
+	}
+	return h
+}
+
+// Allow 是否放行对数据源的请求；熔断超过 open_duration 后转为半开并放行一次探测
+func (t *HealthTracker) Allow(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.source(name)
+	now := t.now()
+	switch h.state {
+	case models.CircuitOpen:
+		if now.Sub(h.openedAt) < t.config.OpenDuration {
+			return false
+		}
+		t.setState(name, h, models.CircuitHalfOpen)
+		h.probeAt = now
+		return true
+	case models.CircuitHalfOpen:
+		// 探测未上报结果（如命中缓存或被调用方取消）时，超时后允许新的探测
+		if !h.probeAt.IsZero() && now.Sub(h.probeAt) < t.config.OpenDuration {
+			return false
+		}
+		h.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Record 上报一次 ping 或查询的结果，无法判断数据源健康状况的错误（如调用方取消、SQL错误）不计入
+func (t *HealthTracker) Record(name, source string, latency time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.source(name)
+	now := t.now()
+	h.lastCheckAt = now
+
+	failed := isDataSourceFailure(err)
+	if !failed && err == nil && t.config.SlowThreshold > 0 && latency > t.config.SlowThreshold {
+		failed = true
+		err = errSlowDataSource
+	}
+
+	if !failed {
+		if err != nil {
+			// 结果不确定，释放探测机会
+			h.probeAt = time.Time{}
+			return
+		}
+		if h.latency == 0 {
+			h.latency = latency
+		} else {
+			h.latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(h.latency))
+		}
+		metrics.SetDataSourceLatency(metricsService, name, h.latency)
+		h.failures = 0
+		h.probeAt = time.Time{}
+		if h.state != models.CircuitClosed {
+			slog.Info("Data source recovered", "name", name)
+			t.setState(name, h, models.CircuitClosed)
+		}
+		return
+	}
+
+	metrics.RecordDataSourceFailure(metricsService, name, source)
+	h.failures++
+	h.lastError = err.Error()
+	h.lastErrorAt = now
+	h.probeAt = time.Time{}
+	if h.state == models.CircuitHalfOpen || (h.state == models.CircuitClosed && h.failures >= t.config.FailureThreshold) {
+		slog.Warn("Data source circuit opened", "name", name, "failures", h.failures, "error", err)
+		h.openedAt = now
+		t.setState(name, h, models.CircuitOpen)
+	}
+}
+
+func (t *HealthTracker) setState(name string, h *sourceHealth, state string) {
+	h.state = state
+	metrics.SetDataSourceCircuitState(metricsService, name, circuitStateValues[state])
+}
+
+// Forget 删除已移除的数据源的状态
+func (t *HealthTracker) Forget(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sources, name)
+}
+
+// Snapshot 获取指定数据源的健康状态，按名称排序
+func (t *HealthTracker) Snapshot(names []string) []models.DataSourceHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make([]models.DataSourceHealth, 0, len(names))
+	for _, name := range names {
+		h := t.source(name)
+		item := models.DataSourceHealth{
+			Name:                name,
+			State:               h.state,
+			Healthy:             h.state == models.CircuitClosed,
+			ConsecutiveFailures: h.failures,
+			LatencyMs:           h.latency.Milliseconds(),
+			LastError:           h.lastError,
+		}
+		if !h.lastErrorAt.IsZero() {
+			at := h.lastErrorAt
+			item.LastErrorAt = &at
+		}
+		if !h.lastCheckAt.IsZero() {
+			at := h.lastCheckAt
+			item.LastCheckAt = &at
+		}
+		if h.state != models.CircuitClosed {
+			at := h.openedAt
+			item.OpenedAt = &at
+		}
+		snapshot = append(snapshot, item)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Name < snapshot[j].Name })
+	return snapshot
+}
+
+// isDataSourceFailure 判断错误是否说明数据源不健康：超时、连接失败和服务端过载计入，SQL本身的错误和调用方取消不计入
+func isDataSourceFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1040, 1053, 1203: // too many connections, server shutdown, max user connections
+			return true
+		}
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 连接异常、53 资源不足、57P 服务端关闭或不可连接
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") || strings.HasPrefix(pgErr.Code, "57P")
+	}
+	var chErr *clickhouse.Exception
+	if errors.As(err, &chErr) {
+		switch chErr.Code {
+		case 202, 203, 209, 210: // too many simultaneous queries, no free connection, socket timeout, network error
+			return true
+		}
+		return false
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// SQLITE_ERROR 为SQL本身的错误，其他如文件无法打开、数据库锁定计入
+		return sqliteErr.Code()&0xff != 1
+	}
+	return true
+}
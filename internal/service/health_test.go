@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestTracker(now *time.Time) *HealthTracker {
+	t := NewHealthTracker(config.HealthConfig{FailureThreshold: 2, OpenDuration: time.Minute, SlowThreshold: time.Second})
+	t.now = func() time.Time { return *now }
+	return t
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	tracker := newTestTracker(&now)
+	timeout := context.DeadlineExceeded
+
+	tracker.Record("bi", healthSourceQuery, 0, timeout)
+	assert.True(t, tracker.Allow("bi"))
+	tracker.Record("bi", healthSourcePing, 0, timeout)
+	assert.False(t, tracker.Allow("bi"), "opens after consecutive failures")
+
+	health := tracker.Snapshot([]string{"bi"})[0]
+	assert.Equal(t, models.CircuitOpen, health.State)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+	assert.NotNil(t, health.OpenedAt)
+
+	// 冷却后只放行一次探测
+	now = now.Add(time.Minute)
+	assert.True(t, tracker.Allow("bi"))
+	assert.False(t, tracker.Allow("bi"))
+
+	// 探测失败立即重新熔断
+	tracker.Record("bi", healthSourceQuery, 0, timeout)
+	assert.False(t, tracker.Allow("bi"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, tracker.Allow("bi"))
+	tracker.Record("bi", healthSourceQuery, 20*time.Millisecond, nil)
+	assert.True(t, tracker.Allow("bi"))
+	health = tracker.Snapshot([]string{"bi"})[0]
+	assert.Equal(t, models.CircuitClosed, health.State)
+	assert.True(t, health.Healthy)
+	assert.Equal(t, int64(20), health.LatencyMs)
+}
+
+func TestCircuitBreakerIgnoresQueryErrors(t *testing.T) {
+	now := time.Now()
+	tracker := newTestTracker(&now)
+
+	// SQL错误和调用方取消不说明数据源不健康
+	for i := 0; i < 3; i++ {
+		tracker.Record("bi", healthSourceQuery, 0, &mysql.MySQLError{Number: 1064, Message: "syntax error"})
+		tracker.Record("bi", healthSourceQuery, 0, fmt.Errorf("query: %w", context.Canceled))
+	}
+	assert.True(t, tracker.Allow("bi"))
+
+	// 服务端过载和慢查询计入
+	tracker.Record("bi", healthSourceQuery, 0, &mysql.MySQLError{Number: 1040, Message: "Too many connections"})
+	tracker.Record("bi", healthSourceQuery, 2*time.Second, nil)
+	assert.False(t, tracker.Allow("bi"))
+	assert.Equal(t, errSlowDataSource.Error(), tracker.Snapshot([]string{"bi"})[0].LastError)
+}
+
+func TestCircuitBreakerUnreportedProbe(t *testing.T) {
+	now := time.Now()
+	tracker := newTestTracker(&now)
+	tracker.Record("bi", healthSourceQuery, 0, context.DeadlineExceeded)
+	tracker.Record("bi", healthSourceQuery, 0, context.DeadlineExceeded)
+
+	now = now.Add(time.Minute)
+	assert.True(t, tracker.Allow("bi"))
+	// 探测没有上报结果时，超时后允许新的探测
+	now = now.Add(time.Minute)
+	assert.True(t, tracker.Allow("bi"))
+}
+
+func TestAcquireFailover(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Database.DataSources = map[string]config.DBConfig{
+		"bi":         {Replicas: []string{"bi_replica", "bi_backup"}},
+		"bi_replica": {},
+		"bi_backup":  {},
+	}
+	r := newTestRegistry(t, cfg)
+	replica := &gorm.DB{}
+	r.pools["bi_replica"] = &dataSourcePool{db: replica, fingerprint: models.DataSourceOriginConfig}
+	for i := 0; i < defaultFailureThreshold; i++ {
+		r.health.Record("bi", healthSourcePing, 0, context.DeadlineExceeded)
+	}
+
+	db, served, err := r.Acquire(context.Background(), "bi")
+	require.NoError(t, err)
+	assert.Same(t, replica, db)
+	assert.Equal(t, "bi_replica", served)
+
+	// 所有候选都熔断时返回请求的数据源的错误
+	for _, name := range []string{"bi_replica", "bi_backup"} {
+		for i := 0; i < defaultFailureThreshold; i++ {
+			r.health.Record(name, healthSourcePing, 0, context.DeadlineExceeded)
+		}
+	}
+	_, _, err = r.Acquire(context.Background(), "bi")
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Contains(t, err.Error(), "data source bi is unhealthy")
+
+	// 数据源不存在时不切换
+	_, _, err = r.Acquire(context.Background(), "unknown")
+	assert.True(t, errors.Is(err, ErrDataSourceNotFound))
+}
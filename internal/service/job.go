@@ -0,0 +1,523 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	jobKeyPrefix     = "bisub:job:"
+	jobCancelChannel = "bisub:job:cancel"
+	// jobPushBatch 结果每批写入Redis的行数
+	jobPushBatch        = 500
+	defaultJobPageLimit = 1000
+	// jobSubscribeMaxBackoff 订阅取消消息失败时重试间隔的上限
+	jobSubscribeMaxBackoff = 30 * time.Second
+	// jobHeartbeatInterval 实例刷新所持任务心跳的间隔，心跳超过 jobLeaseTimeout 未刷新的任务视为实例已退出
+	jobHeartbeatInterval = 30 * time.Second
+	jobLeaseTimeout      = 3 * time.Minute
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobQueueFull     = errors.New("job queue is full, try again later")
+	ErrJobNotFinished   = errors.New("job has not finished yet")
+	ErrJobNotSucceeded  = errors.New("job did not succeed, no results available")
+	ErrJobFinished      = errors.New("job has already finished")
+	ErrJobResultExpired = errors.New("job results have expired")
+
+	errJobCanceled    = errors.New("canceled by user")
+	errServerStopping = errors.New("server shutting down")
+	errJobInterrupted = errors.New("interrupted by server restart")
+	errJobAbandoned   = errors.New("abandoned: the executing instance stopped sending heartbeats")
+)
+
+// queuedJob 内存队列中的任务，携带提交时已校验好的执行计划
+type queuedJob struct {
+	job      *models.ExecutionJob
+	plan     *executionPlan
+	req      *models.ExecuteSubscriptionRequest
+	clientIP string
+	apiURL   string
+}
+
+// JobService 异步执行任务：有界工作池执行，状态存MySQL，结果存Redis
+// 取消请求通过Redis发布订阅广播，由实际执行任务的实例中断查询
+type JobService struct {
+	repo          *repository.JobRepository
+	subscriptions *SubscriptionService
+	redis         *redis.Client
+	config        config.JobConfig
+	instance      string // 任务记录的执行实例，据此刷新心跳、重启后回收遗留任务
+
+	queue   chan *queuedJob
+	ctx     context.Context
+	stop    context.CancelCauseFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[uint64]context.CancelCauseFunc
+}
+
+func NewJobService(repo *repository.JobRepository, subscriptions *SubscriptionService, client *redis.Client, cfg *config.Config) *JobService {
+	jobCfg := cfg.Jobs
+	if jobCfg.Workers <= 0 {
+		jobCfg.Workers = 4
+	}
+	if jobCfg.QueueSize <= 0 {
+		jobCfg.QueueSize = 100
+	}
+	if jobCfg.Timeout <= 0 {
+		jobCfg.Timeout = 30 * time.Minute
+	}
+	if jobCfg.ResultTTL <= 0 {
+		jobCfg.ResultTTL = 24 * time.Hour
+	}
+	if jobCfg.MaxResultRows <= 0 {
+		jobCfg.MaxResultRows = 100000
+	}
+	if jobCfg.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			slog.Warn("Failed to get hostname for job instance", "error", err)
+		}
+		jobCfg.Instance = hostname
+	}
+
+	ctx, stop := context.WithCancelCause(context.Background())
+	return &JobService{
+		repo:          repo,
+		subscriptions: subscriptions,
+		redis:         client,
+		config:        jobCfg,
+		instance:      jobCfg.Instance,
+		queue:         make(chan *queuedJob, jobCfg.QueueSize),
+		ctx:           ctx,
+		stop:          stop,
+		running:       make(map[uint64]context.CancelCauseFunc),
+	}
+}
+
+// Start 回收上次退出时遗留的任务，启动工作协程和取消消息监听
+// Redis 不可用不影响启动，取消消息的订阅在后台重试
+func (s *JobService) Start(ctx context.Context) error {
+	// 进程退出时内存队列和执行中的查询都已丢失，本实例名下未结束的任务不会再有结果
+	if s.instance != "" {
+		count, err := s.repo.FailUnfinished(ctx, s.instance, errJobInterrupted.Error())
+		if err != nil {
+			slog.Error("Failed to fail interrupted jobs", "instance", s.instance, "error", err)
+		} else if count > 0 {
+			slog.Warn("Interrupted jobs marked as failed", "instance", s.instance, "count", count)
+		}
+	}
+
+	// 主机名随部署变化时上面无法找回旧实例的任务，按心跳回收
+	s.sweepAbandoned(ctx)
+
+	s.wg.Add(2)
+	go s.listenCancel()
+	go s.keepAlive()
+
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+
+	slog.Info("Job workers started", "workers", s.config.Workers, "queue_size", s.config.QueueSize, "instance", s.instance)
+	return nil
+}
+
+// keepAlive 定期刷新本实例所持任务的心跳，并回收心跳过期的任务
+func (s *JobService) keepAlive() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if s.instance != "" {
+				if err := s.repo.Heartbeat(s.ctx, s.instance, time.Now()); err != nil {
+					slog.Warn("Failed to refresh job heartbeats", "instance", s.instance, "error", err)
+				}
+			}
+			s.sweepAbandoned(s.ctx)
+		}
+	}
+}
+
+// sweepAbandoned 将心跳过期的未结束任务标记为失败，执行实例已退出或被替换时这些任务不会再有结果
+func (s *JobService) sweepAbandoned(ctx context.Context) {
+	count, err := s.repo.FailStale(ctx, time.Now().Add(-jobLeaseTimeout), errJobAbandoned.Error())
+	if err != nil {
+		slog.Error("Failed to fail abandoned jobs", "error", err)
+	} else if count > 0 {
+		slog.Warn("Abandoned jobs marked as failed", "count", count)
+	}
+}
+
+// listenCancel 订阅取消消息，订阅失败时退避重试；订阅成功后断线由客户端自动重连
+// 未订阅期间本实例仍能取消自己执行的任务，只是收不到其他实例转发的取消请求
+func (s *JobService) listenCancel() {
+	defer s.wg.Done()
+	backoff := time.Second
+	for {
+		pubsub := s.redis.Subscribe(s.ctx, jobCancelChannel)
+		if _, err := pubsub.Receive(s.ctx); err != nil {
+			pubsub.Close()
+			if s.ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to subscribe job cancel channel, retrying", "error", err, "retry_in", backoff)
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, jobSubscribeMaxBackoff)
+			continue
+		}
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-s.ctx.Done():
+				pubsub.Close()
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					pubsub.Close()
+					return
+				}
+				if id, err := strconv.ParseUint(msg.Payload, 10, 64); err == nil {
+					s.cancelRunning(id)
+				}
+			}
+		}
+	}
+}
+
+// Stop 中断执行中的任务，并将仍在排队的任务标记为失败
+func (s *JobService) Stop(ctx context.Context) error {
+	s.stop(errServerStopping)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		select {
+		case qj := <-s.queue:
+			if _, err := s.repo.FinishPending(ctx, qj.job.ID, models.JobStatusFailed, errServerStopping.Error()); err != nil {
+				slog.Error("Failed to fail pending job", "job_id", qj.job.ID, "error", err)
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// SubmitJob 校验并创建任务，立即返回排队中的任务
+func (s *JobService) SubmitJob(ctx context.Context, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string) (*models.ExecutionJob, error) {
+	if req.Timeout == 0 {
+		req.Timeout = int(s.config.Timeout.Milliseconds())
+	}
+
+	if err := rejectPagination(req); err != nil {
+		return nil, err
+	}
+
+	// 提交时即完成变量绑定和SQL校验，错误同步返回
+	plan, err := s.subscriptions.prepareExecution(ctx, subType, key, version, req)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &models.ExecutionJob{
+		Type:        subType,
+		SubKey:      plan.subscription.SubKey,
+		Version:     plan.subscription.Version,
+		DataSource:  plan.dataSource,
+		Status:      models.JobStatusPending,
+		Params:      s.subscriptions.marshalRequestParams(req),
+		RequestIP:   clientIP,
+		Instance:    s.instance,
+		HeartbeatAt: &now,
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.queue <- &queuedJob{job: job, plan: plan, req: req, clientIP: clientIP, apiURL: apiURL}:
+		return job, nil
+	default:
+		if _, err := s.repo.FinishPending(ctx, job.ID, models.JobStatusFailed, ErrJobQueueFull.Error()); err != nil {
+			slog.ErrorContext(ctx, "Failed to fail rejected job", "job_id", job.ID, "error", err)
+		}
+		return nil, ErrJobQueueFull
+	}
+}
+
+// GetJob 获取任务，调用方需要对任务所属订阅有 execute 权限
+func (s *JobService) GetJob(ctx context.Context, id uint64) (*models.ExecutionJob, error) {
+	job, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.subscriptions.access.Require(ctx, job.Type, job.SubKey, models.PermExecute); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetJobResults 分页读取已成功任务的结果
+func (s *JobService) GetJobResults(ctx context.Context, id uint64, req *models.JobResultsRequest) (*models.JobResultPage, error) {
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !job.Finished() {
+		return nil, ErrJobNotFinished
+	}
+	if job.Status != models.JobStatusSucceeded {
+		return nil, ErrJobNotSucceeded
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultJobPageLimit
+	}
+	page := &models.JobResultPage{
+		Rows:   []map[string]interface{}{},
+		Total:  job.RowCount,
+		Offset: req.Offset,
+		Limit:  limit,
+	}
+
+	columnsJSON, err := s.redis.Get(ctx, jobColumnsKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobResultExpired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(columnsJSON, &page.Columns); err != nil {
+		return nil, err
+	}
+
+	items, err := s.redis.LRange(ctx, jobRowsKey(id), req.Offset, req.Offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		decoder := json.NewDecoder(strings.NewReader(item))
+		decoder.UseNumber()
+		var values []interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(page.Columns))
+		for i, col := range page.Columns {
+			if i < len(values) {
+				row[col] = values[i]
+			}
+		}
+		page.Rows = append(page.Rows, row)
+	}
+
+	return page, nil
+}
+
+// CancelJob 取消任务：排队中的直接取消，执行中的通知执行实例中断查询
+func (s *JobService) CancelJob(ctx context.Context, id uint64) (*models.ExecutionJob, error) {
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Finished() {
+		return nil, ErrJobFinished
+	}
+
+	canceled, err := s.repo.FinishPending(ctx, id, models.JobStatusCanceled, errJobCanceled.Error())
+	if err != nil {
+		return nil, err
+	}
+	if !canceled && !s.cancelRunning(id) {
+		// 任务已开始执行，且不在本实例上
+		if err := s.redis.Publish(ctx, jobCancelChannel, strconv.FormatUint(id, 10)).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.GetJob(ctx, id)
+}
+
+func (s *JobService) worker() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case qj := <-s.queue:
+			s.run(qj)
+		}
+	}
+}
+
+func (s *JobService) run(qj *queuedJob) {
+	id := qj.job.ID
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(nil)
+
+	// 先登记再置为执行中，保证收到的取消消息不会丢失
+	s.mu.Lock()
+	s.running[id] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, id)
+		s.mu.Unlock()
+	}()
+
+	started, err := s.repo.MarkRunning(context.Background(), id, time.Now())
+	if err != nil {
+		slog.Error("Failed to start job", "job_id", id, "error", err)
+		return
+	}
+	if !started {
+		// 排队期间已被取消
+		return
+	}
+
+	writer := newJobResultWriter(s.redis, id, s.config.ResultTTL, s.config.MaxResultRows)
+	rowCount, err := s.subscriptions.streamPlan(ctx, qj.plan, qj.req, qj.clientIP, qj.apiURL, writer)
+
+	status, errorMsg := models.JobStatusSucceeded, ""
+	if err != nil {
+		writer.discard()
+		status, errorMsg = models.JobStatusFailed, err.Error()
+		if cause := context.Cause(ctx); cause != nil {
+			errorMsg = cause.Error()
+			if errors.Is(cause, errJobCanceled) {
+				status = models.JobStatusCanceled
+			}
+		}
+		slog.Warn("Job finished with error", "job_id", id, "status", status, "error", err)
+	}
+
+	if err := s.repo.Finish(context.Background(), id, status, rowCount, errorMsg); err != nil {
+		slog.Error("Failed to finish job", "job_id", id, "error", err)
+	}
+}
+
+// cancelRunning 中断本实例上执行中的任务，任务不在本实例上时返回 false
+func (s *JobService) cancelRunning(id uint64) bool {
+	s.mu.Lock()
+	cancel, ok := s.running[id]
+	s.mu.Unlock()
+	if ok {
+		cancel(errJobCanceled)
+	}
+	return ok
+}
+
+func jobColumnsKey(id uint64) string {
+	return fmt.Sprintf("%s%d:columns", jobKeyPrefix, id)
+}
+
+func jobRowsKey(id uint64) string {
+	return fmt.Sprintf("%s%d:rows", jobKeyPrefix, id)
+}
+
+// jobResultWriter 将结果按行写入Redis列表，每行为按列顺序的JSON数组
+type jobResultWriter struct {
+	redis   *redis.Client
+	id      uint64
+	ttl     time.Duration
+	maxRows int64
+	rows    int64
+	batch   []interface{}
+}
+
+func newJobResultWriter(client *redis.Client, id uint64, ttl time.Duration, maxRows int64) *jobResultWriter {
+	return &jobResultWriter{redis: client, id: id, ttl: ttl, maxRows: maxRows}
+}
+
+func (w *jobResultWriter) WriteHeader(columns []string) error {
+	data, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	return w.redis.Set(context.Background(), jobColumnsKey(w.id), data, w.ttl).Err()
+}
+
+func (w *jobResultWriter) WriteRow(values []interface{}) error {
+	w.rows++
+	if w.rows > w.maxRows {
+		return fmt.Errorf("result exceeds %d rows, use streaming output instead", w.maxRows)
+	}
+
+	// values 会被复用，需立即序列化
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	w.batch = append(w.batch, data)
+	if len(w.batch) >= jobPushBatch {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *jobResultWriter) Close() error {
+	return w.flush()
+}
+
+// flush 追加一批结果并刷新过期时间，进程中途退出时部分结果也会过期
+func (w *jobResultWriter) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	key := jobRowsKey(w.id)
+	_, err := w.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, w.batch...)
+		pipe.Expire(ctx, key, w.ttl)
+		return nil
+	})
+	w.batch = w.batch[:0]
+	return err
+}
+
+// discard 任务失败时清理已写入的部分结果
+func (w *jobResultWriter) discard() {
+	if err := w.redis.Del(context.Background(), jobColumnsKey(w.id), jobRowsKey(w.id)).Err(); err != nil {
+		slog.Error("Failed to discard job results", "job_id", w.id, "error", err)
+	}
+}
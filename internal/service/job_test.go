@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newExecutionTestService 可以实际执行的服务：元数据库和 default 数据源都是临时目录中的 SQLite 文件
+// default 数据源中有 orders 表，元数据库中有生效的订阅 orders
+func newExecutionTestService(t *testing.T) (*SubscriptionService, *gorm.DB) {
+	require.NoError(t, utils.InitSnowflake(1))
+	dir := t.TempDir()
+
+	source, err := gorm.Open(sqlite.Open(filepath.Join(dir, "source.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, source.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, amount INTEGER)").Error)
+	require.NoError(t, source.Exec("INSERT INTO orders (id, amount) VALUES (1, 10), (2, 20), (3, 30)").Error)
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "bisub.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Subscription{}, &models.SubscriptionRevision{}, &models.SubscriptionACL{}, &models.SubscriptionStats{}, &models.ExecutionJob{}))
+
+	cfg := &config.Config{}
+	cfg.Server.Timeout = 10 * time.Second
+	cfg.Security.AllowedSQLTypes = []string{"SELECT"}
+	cfg.Database.DataSources = map[string]config.DBConfig{"default": {Driver: "sqlite", Database: filepath.Join(dir, "source.db")}}
+	repo := repository.NewSubscriptionRepository(db)
+	s := &SubscriptionService{
+		repo:        repo,
+		statsRepo:   repository.NewStatsRepository(db),
+		config:      cfg,
+		dataSources: newTestRegistry(t, cfg),
+		access:      NewAccessControl(repository.NewACLRepository(db), cfg),
+		refs:        newTestRefs(t, db),
+	}
+
+	ctx := adminContext()
+	require.NoError(t, repo.Create(ctx, syncVersion(t, "orders", 1, models.StatusActive, "订单", "SELECT id, amount FROM orders ORDER BY id"), revisionMeta(ctx, models.RevisionCreate)))
+	return s, db
+}
+
+func newJobTestService(t *testing.T, client *redis.Client, instance string) (*JobService, *repository.JobRepository) {
+	subscriptions, db := newExecutionTestService(t)
+	repo := repository.NewJobRepository(db)
+	cfg := &config.Config{}
+	cfg.Jobs.Instance = instance
+	return NewJobService(repo, subscriptions, client, cfg), repo
+}
+
+func waitJob(t *testing.T, s *JobService, id uint64) *models.ExecutionJob {
+	var job *models.ExecutionJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = s.GetJob(adminContext(), id)
+		require.NoError(t, err)
+		return job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestJobSubmitAndResults(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s, _ := newJobTestService(t, redis.NewClient(&redis.Options{Addr: mr.Addr()}), "bisub-1")
+	require.NoError(t, s.Start(context.Background()))
+	t.Cleanup(func() { require.NoError(t, s.Stop(context.Background())) })
+	ctx := adminContext()
+
+	job, err := s.SubmitJob(ctx, models.TypeAnalysisData, "orders", nil, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusPending, job.Status)
+	assert.Equal(t, "bisub-1", job.Instance)
+
+	job = waitJob(t, s, job.ID)
+	require.Equal(t, models.JobStatusSucceeded, job.Status, job.ErrorMsg)
+	assert.Equal(t, int64(3), job.RowCount)
+	assert.NotNil(t, job.StartedAt)
+	assert.NotNil(t, job.FinishedAt)
+
+	page, err := s.GetJobResults(ctx, job.ID, &models.JobResultsRequest{Offset: 1, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "amount"}, page.Columns)
+	assert.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Rows, 1)
+	assert.Equal(t, map[string]interface{}{"id": json.Number("2"), "amount": json.Number("20")}, page.Rows[0])
+
+	page, err = s.GetJobResults(ctx, job.ID, &models.JobResultsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, page.Rows, 3)
+	assert.Equal(t, int64(defaultJobPageLimit), page.Limit)
+
+	// 已结束的任务不能取消
+	_, err = s.CancelJob(ctx, job.ID)
+	assert.True(t, errors.Is(err, ErrJobFinished))
+
+	// 结果过期
+	mr.FastForward(25 * time.Hour)
+	_, err = s.GetJobResults(ctx, job.ID, &models.JobResultsRequest{})
+	assert.True(t, errors.Is(err, ErrJobResultExpired))
+
+	_, err = s.GetJob(ctx, 1)
+	assert.True(t, errors.Is(err, ErrJobNotFound))
+}
+
+func TestCancelJob(t *testing.T) {
+	mr := miniredis.RunT(t)
+	// 不启动工作协程，任务保持排队
+	s, repo := newJobTestService(t, redis.NewClient(&redis.Options{Addr: mr.Addr()}), "bisub-1")
+	ctx := adminContext()
+
+	job, err := s.SubmitJob(ctx, models.TypeAnalysisData, "orders", nil, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "")
+	require.NoError(t, err)
+	job, err = s.CancelJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusCanceled, job.Status)
+	assert.Equal(t, errJobCanceled.Error(), job.ErrorMsg)
+
+	_, err = s.GetJobResults(ctx, job.ID, &models.JobResultsRequest{})
+	assert.True(t, errors.Is(err, ErrJobNotSucceeded))
+	_, err = s.CancelJob(ctx, job.ID)
+	assert.True(t, errors.Is(err, ErrJobFinished))
+
+	// 本实例上执行中的任务直接中断，不经过Redis
+	running := &models.ExecutionJob{Type: models.TypeAnalysisData, SubKey: "orders", Version: 1, Status: models.JobStatusPending, Instance: "bisub-1"}
+	require.NoError(t, repo.Create(ctx, running))
+	started, err := repo.MarkRunning(ctx, running.ID, time.Now())
+	require.NoError(t, err)
+	require.True(t, started)
+	runCtx, cancel := context.WithCancelCause(context.Background())
+	s.running[running.ID] = cancel
+
+	mr.Close()
+	_, err = s.CancelJob(ctx, running.ID)
+	require.NoError(t, err)
+	assert.True(t, errors.Is(context.Cause(runCtx), errJobCanceled))
+
+	// 在其他实例上执行的任务通过Redis转发
+	delete(s.running, running.ID)
+	_, err = s.CancelJob(ctx, running.ID)
+	assert.Error(t, err)
+
+	// 提交时即校验，分页参数不能用于异步任务
+	_, err = s.SubmitJob(ctx, models.TypeAnalysisData, "orders", nil, &models.ExecuteSubscriptionRequest{PageSize: 10}, "127.0.0.1", "")
+	var pageErr *PaginationError
+	assert.True(t, errors.As(err, &pageErr))
+}
+
+func TestJobStartRecoversInterruptedJobs(t *testing.T) {
+	// Redis 不可用不影响启动
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mr.Close()
+	s, repo := newJobTestService(t, client, "bisub-1")
+	ctx := adminContext()
+
+	stale, fresh := time.Now().Add(-2*jobLeaseTimeout), time.Now()
+	jobs := map[string]*models.ExecutionJob{}
+	for name, job := range map[string]*models.ExecutionJob{
+		"pending":   {Status: models.JobStatusPending, Instance: "bisub-1"},
+		"running":   {Status: models.JobStatusRunning, Instance: "bisub-1"},
+		"succeeded": {Status: models.JobStatusSucceeded, Instance: "bisub-1"},
+		"other":     {Status: models.JobStatusRunning, Instance: "bisub-2", HeartbeatAt: &fresh},
+		// 主机名随部署变化，旧实例不会再启动，按心跳回收
+		"abandoned": {Status: models.JobStatusRunning, Instance: "bisub-7d9f", HeartbeatAt: &stale},
+		"legacy":    {Status: models.JobStatusPending, Instance: "bisub-7d9f", CreatedAt: stale},
+	} {
+		job.Type, job.SubKey, job.Version = models.TypeAnalysisData, "orders", 1
+		require.NoError(t, repo.Create(ctx, job))
+		jobs[name] = job
+	}
+
+	require.NoError(t, s.Start(context.Background()))
+	t.Cleanup(func() { require.NoError(t, s.Stop(context.Background())) })
+
+	for name, want := range map[string]string{
+		"pending":   models.JobStatusFailed,
+		"running":   models.JobStatusFailed,
+		"succeeded": models.JobStatusSucceeded,
+		"other":     models.JobStatusRunning,
+		"abandoned": models.JobStatusFailed,
+		"legacy":    models.JobStatusFailed,
+	} {
+		job, err := repo.GetByID(ctx, jobs[name].ID)
+		require.NoError(t, err)
+		assert.Equal(t, want, job.Status, name)
+	}
+	job, err := repo.GetByID(ctx, jobs["running"].ID)
+	require.NoError(t, err)
+	assert.Equal(t, errJobInterrupted.Error(), job.ErrorMsg)
+	job, err = repo.GetByID(ctx, jobs["abandoned"].ID)
+	require.NoError(t, err)
+	assert.Equal(t, errJobAbandoned.Error(), job.ErrorMsg)
+
+	// 心跳只刷新本实例的任务
+	require.NoError(t, repo.Heartbeat(ctx, "bisub-2", fresh.Add(time.Minute)))
+	job, err = repo.GetByID(ctx, jobs["other"].ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, fresh.Add(time.Minute), *job.HeartbeatAt, time.Second)
+
+	// 工作协程照常运行，Redis 不可用时任务因无法保存结果而失败
+	submitted, err := s.SubmitJob(ctx, models.TypeAnalysisData, "orders", nil, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusFailed, waitJob(t, s, submitted.ID).Status)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+)
+
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrActivationFailed  = errors.New("activation test execution failed")
+)
+
+// UpdateStatus 按状态机迁移订阅版本状态，激活前试执行SQL，force 时忽略输出结构的不兼容变化
+func (s *SubscriptionService) UpdateStatus(ctx context.Context, subType, key string, version uint32, status string, force bool) error {
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return err
+	}
+
+	current, err := s.repo.GetByKeyAndVersion(ctx, subType, key, version)
+	if err != nil {
+		return fmt.Errorf("subscription not found: %w", err)
+	}
+
+	if err := s.transition(ctx, current, status, force); err != nil {
+		return err
+	}
+	s.invalidateCache(ctx, subType, key)
+	return nil
+}
+
+// transition 校验迁移并写入新状态，subscription 为迁移前的版本
+func (s *SubscriptionService) transition(ctx context.Context, subscription *models.Subscription, status string, force bool) error {
+	if err := s.checkTransition(ctx, subscription, status, force); err != nil {
+		return err
+	}
+	return s.applyTransition(ctx, s.repo, subscription, status)
+}
+
+// checkTransition 校验迁移是否允许，由非生效状态激活时检查审核、试执行SQL并检查输出结构兼容性
+func (s *SubscriptionService) checkTransition(ctx context.Context, subscription *models.Subscription, status string, force bool) error {
+	if !models.CanTransition(subscription.Status, status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, subscription.Status, status)
+	}
+	if models.IsServingStatus(status) && !models.IsServingStatus(subscription.Status) {
+		if err := s.requireApproval(ctx, subscription); err != nil {
+			return err
+		}
+		return s.verifyActivation(ctx, subscription, force)
+	}
+	return nil
+}
+
+// applyTransition 以迁移前状态为条件写入新状态，repo 为写入使用的仓储，以便与其他修改在同一事务中写入
+func (s *SubscriptionService) applyTransition(ctx context.Context, repo *repository.SubscriptionRepository, subscription *models.Subscription, status string) error {
+	changed, err := repo.TransitionStatus(ctx, subscription.Type, subscription.SubKey, subscription.Version, subscription.Status, status, revisionMeta(ctx, models.RevisionStatus))
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return fmt.Errorf("%w: status of version %d was changed concurrently", ErrInvalidTransition, subscription.Version)
+	}
+	subscription.Status = status
+	return nil
+}
+
+// checkInitialStatus 新版本只能以待生效或生效中状态创建，生效中需通过试执行，开启审核时只能以待生效创建
+func (s *SubscriptionService) checkInitialStatus(ctx context.Context, subscription *models.Subscription, force bool) error {
+	switch subscription.Status {
+	case models.StatusPending:
+		return nil
+	case models.StatusActive, models.StatusActiveForceCompatible:
+		if s.config.Security.RequireReview {
+			return fmt.Errorf("%w: create the version as pending and submit it for review", ErrReviewRequired)
+		}
+		return s.verifyActivation(ctx, subscription, force)
+	default:
+		return fmt.Errorf("%w: cannot create a version in status %s", ErrInvalidTransition, subscription.Status)
+	}
+}
+
+// verifyActivation 激活版本前试执行SQL，并与当前生效版本比较输出结构
+func (s *SubscriptionService) verifyActivation(ctx context.Context, subscription *models.Subscription, force bool) error {
+	observed, err := s.testExecute(ctx, subscription)
+	if err != nil {
+		return err
+	}
+	return s.checkSchemaCompatibility(ctx, subscription, observed, force)
+}
+
+// testExecute 用 example 中的示例变量试执行SQL，只读取第一行，返回结果集的输出结构
+// example 不是JSON对象时只使用变量默认值；声明了严格模式的输出结构时，结果列不一致视为失败
+func (s *SubscriptionService) testExecute(ctx context.Context, subscription *models.Subscription) (*models.OutputSchema, error) {
+	var extraConfig models.ExtraConfig
+	if err := json.Unmarshal(subscription.ExtraConfig, &extraConfig); err != nil {
+		return nil, fmt.Errorf("%w: invalid extra_config: %v", ErrActivationFailed, err)
+	}
+
+	var variables map[string]interface{}
+	if example := strings.TrimSpace(extraConfig.Example); strings.HasPrefix(example, "{") {
+		if err := json.Unmarshal([]byte(example), &variables); err != nil {
+			return nil, fmt.Errorf("%w: example is not valid JSON: %v", ErrActivationFailed, err)
+		}
+	}
+
+	dataSource, err := resolveDataSource(&extraConfig, "", s.config.Security.AllowPrimaryDataSource)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrActivationFailed, err)
+	}
+	boundSQL, args, err := bindVariables(extraConfig.SQLContent, s.dataSourceDriver(dataSource), variables, extraConfig.SQLReplace)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrActivationFailed, err)
+	}
+	if err := s.access.RequireDataSource(ctx, dataSource); err != nil {
+		return nil, err
+	}
+	db, served, err := s.dataSources.Acquire(ctx, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrActivationFailed, err)
+	}
+	if err := sqlguard.Validate(boundSQL, s.sqlPolicy(dataSource)); err != nil {
+		return nil, fmt.Errorf("SQL validation failed: %w", err)
+	}
+
+	plan := &executionPlan{subscription: subscription, db: db, dataSource: dataSource, served: served, sql: boundSQL, args: args}
+	if err := s.checkGuardrails(ctx, plan); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrActivationFailed, err)
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, s.config.Server.Timeout)
+	defer cancel()
+
+	rows, err := s.query(execCtx, plan)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrActivationFailed, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrActivationFailed, err)
+	}
+	if checker := newSchemaChecker(extraConfig.OutputSchema); checker != nil {
+		if err := checker.checkColumns(columnTypes); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrActivationFailed, err)
+		}
+	}
+
+	rows.Next()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrActivationFailed, err)
+	}
+	return observedSchema(columnTypes), nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/bundle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{models.StatusPending, models.StatusActive, true},
+		{models.StatusPending, models.StatusActiveForceCompatible, true},
+		{models.StatusPending, models.StatusExpired, true},
+		{models.StatusActive, models.StatusActiveForceCompatible, true},
+		{models.StatusActive, models.StatusExpired, true},
+		{models.StatusActive, models.StatusPending, false},
+		{models.StatusActiveForceCompatible, models.StatusActive, false},
+		{models.StatusActiveForceCompatible, models.StatusExpired, true},
+		{models.StatusExpired, models.StatusActive, true},
+		{models.StatusExpired, models.StatusPending, false},
+		{models.StatusActive, models.StatusActive, false},
+		{models.StatusActive, "X", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, models.CanTransition(tt.from, tt.to), "%s -> %s", tt.from, tt.to)
+	}
+}
+
+func TestCheckTransition(t *testing.T) {
+	cfg := &config.Config{}
+	s := &SubscriptionService{
+		access:      &AccessControl{},
+		config:      cfg,
+		dataSources: &DataSourceRegistry{config: cfg},
+	}
+	ctx := auth.WithPrincipal(context.Background(), auth.System)
+
+	sub := &models.Subscription{Status: models.StatusActiveForceCompatible}
+	err := s.checkTransition(ctx, sub, models.StatusActive, false)
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+
+	// 失效不需要试执行
+	sub = &models.Subscription{Status: models.StatusActive}
+	assert.NoError(t, s.checkTransition(ctx, sub, models.StatusExpired, false))
+
+	// 激活需要试执行，缺少示例变量时失败
+	sub = &models.Subscription{
+		Status:      models.StatusPending,
+		ExtraConfig: json.RawMessage(`{"sql_content": "SELECT * FROM houses WHERE id = house_id_replace", "sql_replace": {"house_id_replace": {"type": "int"}}}`),
+	}
+	err = s.checkTransition(ctx, sub, models.StatusActive, false)
+	assert.True(t, errors.Is(err, ErrActivationFailed), "got %v", err)
+
+	// 示例变量齐全但数据源不存在
+	sub.ExtraConfig = json.RawMessage(`{"sql_content": "SELECT * FROM houses WHERE id = house_id_replace", "sql_replace": {"house_id_replace": {"type": "int"}}, "example": "{\"house_id_replace\": 1}"}`)
+	err = s.checkTransition(ctx, sub, models.StatusActive, false)
+	assert.True(t, errors.Is(err, ErrActivationFailed))
+	assert.Contains(t, err.Error(), "data source default not found")
+
+	// 新版本不能直接以失效状态创建
+	err = s.checkInitialStatus(ctx, &models.Subscription{Status: models.StatusExpired}, false)
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+	assert.NoError(t, s.checkInitialStatus(ctx, &models.Subscription{Status: models.StatusPending}, false))
+}
+
+func TestUpdateSubscriptionRollsBackContentWhenTransitionFails(t *testing.T) {
+	s, db := newExecutionTestService(t)
+	ctx := adminContext()
+
+	// 状态写入失败时，同一请求中的内容修改不能单独生效
+	require.NoError(t, db.Exec("CREATE TRIGGER reject_status BEFORE UPDATE OF status ON sub_subscription_theme BEGIN SELECT RAISE(ABORT, 'status is locked'); END").Error)
+	_, err := s.UpdateSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.UpdateSubscriptionRequest{Title: "订单（改）", Status: models.StatusExpired})
+	assert.ErrorContains(t, err, "status is locked")
+
+	current, err := s.repo.GetByKeyAndVersion(ctx, models.TypeAnalysisData, "orders", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "订单", current.Title)
+	assert.Equal(t, models.StatusActive, current.Status)
+	_, total, err := s.repo.ListRevisions(ctx, models.TypeAnalysisData, "orders", 1, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	require.NoError(t, db.Exec("DROP TRIGGER reject_status").Error)
+	updated, err := s.UpdateSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.UpdateSubscriptionRequest{Title: "订单（改）", Status: models.StatusExpired})
+	require.NoError(t, err)
+	assert.Equal(t, "订单（改）", updated.Title)
+	assert.Equal(t, models.StatusExpired, updated.Status)
+	_, total, err = s.repo.ListRevisions(ctx, models.TypeAnalysisData, "orders", 1, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+}
+
+func TestChangingActiveVersionChecksOutputSchema(t *testing.T) {
+	s, _ := newExecutionTestService(t)
+	ctx := adminContext()
+	extraConfig := func(sql string) json.RawMessage {
+		return syncVersion(t, "orders", 1, models.StatusActive, "订单", sql).ExtraConfig
+	}
+	current := func() string {
+		subscription, err := s.repo.GetByKeyAndVersion(ctx, models.TypeAnalysisData, "orders", 1)
+		require.NoError(t, err)
+		return string(subscription.ExtraConfig)
+	}
+	var schemaErr *SchemaChangeError
+
+	// 修改生效中版本的SQL时与它已保存的内容比较，删除列需要 force
+	_, err := s.UpdateSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.UpdateSubscriptionRequest{ExtraConfig: extraConfig("SELECT id FROM orders ORDER BY id")})
+	require.True(t, errors.As(err, &schemaErr), "%v", err)
+	assert.Equal(t, uint32(1), schemaErr.ActiveVersion)
+	assert.Equal(t, string(extraConfig("SELECT id, amount FROM orders ORDER BY id")), current())
+
+	// 新增列不是破坏性变更
+	widened := extraConfig("SELECT id, amount, amount * 2 AS doubled FROM orders ORDER BY id")
+	_, err = s.UpdateSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.UpdateSubscriptionRequest{ExtraConfig: widened})
+	require.NoError(t, err)
+
+	// 回滚到没有 doubled 列的修订同样需要 force
+	_, err = s.Rollback(ctx, models.TypeAnalysisData, "orders", 1, &models.RollbackRequest{Revision: 1})
+	require.True(t, errors.As(err, &schemaErr), "%v", err)
+	assert.Equal(t, string(widened), current())
+	_, err = s.Rollback(ctx, models.TypeAnalysisData, "orders", 1, &models.RollbackRequest{Revision: 1, Force: true})
+	require.NoError(t, err)
+
+	// 导入时覆盖生效中版本
+	b := bundle.New([]bundle.Subscription{{Type: models.TypeAnalysisData, SubKey: "orders", Versions: []bundle.Version{
+		{Version: 1, Title: "订单", Abstract: "订单", Status: models.StatusActive, ExtraConfig: extraConfig("SELECT amount FROM orders ORDER BY id")},
+	}}}, nil, nil, "alice")
+	_, err = s.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportOverwrite})
+	require.True(t, errors.As(err, &schemaErr), "%v", err)
+	_, err = s.ImportBundle(ctx, b, &models.ImportRequest{Strategy: models.ImportOverwrite, Force: true})
+	require.NoError(t, err)
+	assert.Equal(t, string(extraConfig("SELECT amount FROM orders ORDER BY id")), current())
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+// 结果限制默认值
+const (
+	defaultMaxRows          = 10000
+	defaultMaxResponseBytes = 16 << 20
+	defaultPageSize         = 100
+	defaultMaxPageSize      = 1000
+)
+
+// 结果被截断的原因
+const (
+	TruncatedByRows  = "max_rows"
+	TruncatedByBytes = "max_response_bytes"
+)
+
+// pageKeyPattern 分页键只允许普通列名，避免拼接到包装SQL时注入
+var pageKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// PaginationError 分页参数或游标无效
+type PaginationError struct {
+	Reason string
+}
+
+func (e *PaginationError) Error() string {
+	return "invalid pagination: " + e.Reason
+}
+
+// ResultTruncatedError 流式输出达到订阅配置的上限，此前的行已写出
+type ResultTruncatedError struct {
+	Limit string // max_rows 或 max_response_bytes
+	Max   int64
+}
+
+func (e *ResultTruncatedError) Error() string {
+	return fmt.Sprintf("result truncated: %s of %d reached", e.Limit, e.Max)
+}
+
+// resultLimits 单次响应的行数和字节数上限
+type resultLimits struct {
+	maxRows  int
+	maxBytes int64
+}
+
+// pageRequest 已应用到执行计划的分页参数
+type pageRequest struct {
+	keys []string
+	size int
+}
+
+// pageCursor 游标内容，绑定签发时的版本和分页键，防止跨版本翻页
+type pageCursor struct {
+	Version uint32        `json:"v"`
+	Keys    []string      `json:"k"`
+	Values  []interface{} `json:"x"`
+}
+
+// resultLimits 订阅配置的限制只能收紧全局限制
+func (s *SubscriptionService) resultLimits(extraConfig *models.ExtraConfig) resultLimits {
+	execution := s.settings().Execution
+	limits := resultLimits{
+		maxRows:  execution.MaxRows,
+		maxBytes: execution.MaxResponseBytes,
+	}
+	if limits.maxRows <= 0 {
+		limits.maxRows = defaultMaxRows
+	}
+	if limits.maxBytes <= 0 {
+		limits.maxBytes = defaultMaxResponseBytes
+	}
+	if extraConfig.MaxRows > 0 && extraConfig.MaxRows < limits.maxRows {
+		limits.maxRows = extraConfig.MaxRows
+	}
+	if extraConfig.MaxResponseBytes > 0 && extraConfig.MaxResponseBytes < limits.maxBytes {
+		limits.maxBytes = extraConfig.MaxResponseBytes
+	}
+	return limits
+}
+
+// paginate 按分页键包装订阅SQL：从游标位置之后按键升序读取 size+1 行，多出的一行用于判断是否还有下一页
+func (s *SubscriptionService) paginate(plan *executionPlan, keys []string, req *models.ExecuteSubscriptionRequest) error {
+	if req.PageSize == 0 && req.Cursor == "" {
+		return nil
+	}
+	if len(keys) == 0 {
+		return &PaginationError{Reason: "subscription does not declare page_keys"}
+	}
+
+	maxPageSize := s.settings().Execution.MaxPageSize
+	if maxPageSize <= 0 {
+		maxPageSize = defaultMaxPageSize
+	}
+	if maxPageSize > plan.limits.maxRows {
+		maxPageSize = plan.limits.maxRows
+	}
+	size := req.PageSize
+	if size == 0 {
+		size = defaultPageSize
+	}
+	if size > maxPageSize {
+		return &PaginationError{Reason: fmt.Sprintf("page_size exceeds the maximum of %d", maxPageSize)}
+	}
+
+	columns := make([]string, len(keys))
+	for i, key := range keys {
+		columns[i] = quoteIdentifier(plan.db, key)
+	}
+
+	var where string
+	args := plan.args
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return err
+		}
+		if cursor.Version != plan.subscription.Version {
+			return &PaginationError{Reason: fmt.Sprintf("cursor was issued for version %d", cursor.Version)}
+		}
+		if strings.Join(cursor.Keys, ",") != strings.Join(keys, ",") || len(cursor.Values) != len(keys) {
+			return &PaginationError{Reason: "cursor does not match the subscription page_keys"}
+		}
+
+		// 行构造器比较保证多列键的字典序
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+		where = fmt.Sprintf(" WHERE (%s) > (%s)", strings.Join(columns, ", "), placeholders)
+		args = append(append([]interface{}{}, plan.args...), cursor.Values...)
+	}
+
+	// 去掉结尾的分号，换行避免SQL末尾的单行注释吞掉右括号
+	// LIMIT 作为参数绑定，使分页大小参与结果缓存键
+	inner := strings.TrimRight(strings.TrimSpace(plan.sql), "; \t\r\n")
+	plan.sql = fmt.Sprintf("SELECT * FROM (%s\n) AS _page%s ORDER BY %s LIMIT ?",
+		inner, where, strings.Join(columns, ", "))
+	plan.args = append(args, size+1)
+	plan.page = &pageRequest{keys: keys, size: size}
+	return nil
+}
+
+// nextCursor 由本页最后一行的分页键生成下一页游标
+func nextCursor(version uint32, keys []string, row map[string]interface{}) (string, error) {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, ok := row[key]
+		if !ok {
+			return "", &PaginationError{Reason: fmt.Sprintf("page key %s is not in the result columns", key)}
+		}
+		// 时间按数据库可比较的字面量保存，避免时区后缀影响比较
+		if t, ok := value.(time.Time); ok {
+			value = t.Format("2006-01-02 15:04:05.999999")
+		}
+		values[i] = value
+	}
+
+	data, err := json.Marshal(pageCursor{Version: version, Keys: keys, Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(encoded string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, &PaginationError{Reason: "malformed cursor"}
+	}
+
+	// 整数按 int64 绑定，避免大整数键经浮点比较丢失精度
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	var cursor pageCursor
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, &PaginationError{Reason: "malformed cursor"}
+	}
+	for i, value := range cursor.Values {
+		if n, ok := value.(json.Number); ok {
+			if v, err := n.Int64(); err == nil {
+				cursor.Values[i] = v
+			} else {
+				cursor.Values[i] = n.String()
+			}
+		}
+	}
+	return &cursor, nil
+}
+
+// validatePageKeys 校验分页键为普通列名且不重复
+func validatePageKeys(keys []string) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !pageKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid page key %q", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate page key %q", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// quoteIdentifier 按数据源方言引用列名
+func quoteIdentifier(db *gorm.DB, name string) string {
+	var sb strings.Builder
+	db.Dialector.QuoteTo(&sb, name)
+	return sb.String()
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestResultLimits(t *testing.T) {
+	cfg := &config.Config{}
+	s := &SubscriptionService{config: cfg}
+
+	limits := s.resultLimits(&models.ExtraConfig{})
+	assert.Equal(t, resultLimits{maxRows: defaultMaxRows, maxBytes: defaultMaxResponseBytes}, limits)
+
+	// 订阅配置只能收紧全局限制
+	cfg.Execution.MaxRows = 500
+	limits = s.resultLimits(&models.ExtraConfig{MaxRows: 1000, MaxResponseBytes: 1024})
+	assert.Equal(t, 500, limits.maxRows)
+	assert.Equal(t, int64(1024), limits.maxBytes)
+}
+
+func TestResultCollector(t *testing.T) {
+	row := map[string]interface{}{"id": 1}
+
+	c := &resultCollector{maxRows: 2}
+	assert.True(t, c.add(row))
+	assert.False(t, c.full())
+	assert.True(t, c.add(row))
+	assert.True(t, c.full())
+
+	// {"id":1} 加换行共 9 字节
+	c = &resultCollector{maxBytes: 20}
+	assert.True(t, c.add(row))
+	assert.True(t, c.add(row))
+	assert.False(t, c.add(row))
+	assert.Equal(t, TruncatedByBytes, c.truncatedBy)
+	assert.Len(t, c.rows, 2)
+}
+
+func TestPaginate(t *testing.T) {
+	s := &SubscriptionService{config: &config.Config{}}
+	newPlan := func() *executionPlan {
+		return &executionPlan{
+			subscription: &models.Subscription{Version: 3},
+			db:           &gorm.DB{Config: &gorm.Config{Dialector: mysql.New(mysql.Config{})}},
+			sql:          "SELECT id, city FROM houses WHERE city = ?;",
+			args:         []interface{}{"London"},
+			limits:       resultLimits{maxRows: 500},
+		}
+	}
+
+	// 未分页时不改写SQL
+	plan := newPlan()
+	require.NoError(t, s.paginate(plan, []string{"id"}, &models.ExecuteSubscriptionRequest{}))
+	assert.Nil(t, plan.page)
+
+	plan = newPlan()
+	require.NoError(t, s.paginate(plan, []string{"city", "id"}, &models.ExecuteSubscriptionRequest{PageSize: 50}))
+	assert.Equal(t, "SELECT * FROM (SELECT id, city FROM houses WHERE city = ?\n) AS _page ORDER BY `city`, `id` LIMIT ?", plan.sql)
+	assert.Equal(t, []interface{}{"London", 51}, plan.args)
+
+	cursor, err := nextCursor(3, []string{"city", "id"}, map[string]interface{}{"city": "London", "id": int64(9007199254740993)})
+	require.NoError(t, err)
+
+	plan = newPlan()
+	require.NoError(t, s.paginate(plan, []string{"city", "id"}, &models.ExecuteSubscriptionRequest{PageSize: 50, Cursor: cursor}))
+	assert.Contains(t, plan.sql, "AS _page WHERE (`city`, `id`) > (?, ?) ORDER BY")
+	assert.Equal(t, []interface{}{"London", "London", int64(9007199254740993), 51}, plan.args)
+
+	tests := []struct {
+		name string
+		keys []string
+		req  models.ExecuteSubscriptionRequest
+	}{
+		{name: "no_page_keys", req: models.ExecuteSubscriptionRequest{PageSize: 10}},
+		{name: "page_size_above_max_rows", keys: []string{"id"}, req: models.ExecuteSubscriptionRequest{PageSize: 501}},
+		{name: "malformed_cursor", keys: []string{"id"}, req: models.ExecuteSubscriptionRequest{Cursor: "!!"}},
+		{name: "keys_changed", keys: []string{"id"}, req: models.ExecuteSubscriptionRequest{Cursor: cursor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pageErr *PaginationError
+			assert.True(t, errors.As(s.paginate(newPlan(), tt.keys, &tt.req), &pageErr))
+		})
+	}
+
+	// 游标绑定签发时的版本
+	plan = newPlan()
+	plan.subscription.Version = 4
+	var pageErr *PaginationError
+	assert.True(t, errors.As(s.paginate(plan, []string{"city", "id"}, &models.ExecuteSubscriptionRequest{Cursor: cursor}), &pageErr))
+}
+
+func TestNextCursorFormatsTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	encoded, err := nextCursor(1, []string{"created_at"}, map[string]interface{}{"created_at": at})
+	require.NoError(t, err)
+
+	cursor, err := decodeCursor(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"2024-05-01 08:30:00"}, cursor.Values)
+
+	_, err = nextCursor(1, []string{"id"}, map[string]interface{}{"created_at": at})
+	assert.Error(t, err)
+}
+
+func TestExecuteSubscriptionPageBytes(t *testing.T) {
+	s, _ := newExecutionTestService(t)
+	ctx := adminContext()
+	// {"amount":10,"id":1} 加换行共 21 字节
+	for version, maxBytes := range map[uint32]string{1: "30", 2: "10"} {
+		require.NoError(t, s.repo.Create(ctx, &models.Subscription{
+			Type: models.TypeAnalysisData, SubKey: "paged", Version: version, Title: "分页", Abstract: "分页", Status: models.StatusActive,
+			ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id, amount FROM orders", "page_keys": ["id"], "max_response_bytes": ` + maxBytes + `}`),
+		}, revisionMeta(ctx, models.RevisionCreate)))
+	}
+	execute := func(version uint32, req *models.ExecuteSubscriptionRequest) (*ExecutionResult, error) {
+		return s.ExecuteSubscription(ctx, models.TypeAnalysisData, "paged", &version, req, "127.0.0.1", "/v1/subscriptions/paged")
+	}
+
+	// 字节数上限截断的页带游标，从下一行继续
+	result, err := execute(1, &models.ExecuteSubscriptionRequest{PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, result.Rows, 1)
+	assert.True(t, result.HasMore)
+	assert.Equal(t, TruncatedByBytes, result.TruncatedBy)
+	require.NotEmpty(t, result.NextCursor)
+	result, err = execute(1, &models.ExecuteSubscriptionRequest{PageSize: 2, Cursor: result.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, result.Rows, 1)
+	assert.Equal(t, int64(2), result.Rows[0]["id"])
+
+	// 第一行就超出上限时报错，而不是返回没有游标的空页
+	_, err = execute(2, &models.ExecuteSubscriptionRequest{PageSize: 2})
+	var pageErr *PaginationError
+	require.True(t, errors.As(err, &pageErr), "%v", err)
+	assert.Equal(t, "a single row exceeds max_response_bytes of 10", pageErr.Reason)
+}
+
+// rowRecorder 在内存中记录流式输出的行
+type rowRecorder struct {
+	columns []string
+	rows    [][]interface{}
+	closed  bool
+}
+
+func (r *rowRecorder) WriteHeader(columns []string) error {
+	r.columns = columns
+	return nil
+}
+
+func (r *rowRecorder) WriteRow(values []interface{}) error {
+	r.rows = append(r.rows, append([]interface{}{}, values...))
+	return nil
+}
+
+func (r *rowRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestStreamSubscriptionLimits(t *testing.T) {
+	s, _ := newExecutionTestService(t)
+	ctx := adminContext()
+	// 全局上限只约束JSON响应，流式输出按订阅配置的上限截断
+	s.config.Execution.MaxRows = 1
+	for version, limits := range map[uint32]string{1: `"max_rows": 2`, 2: `"max_rows": 3`, 3: `"max_response_bytes": 30`} {
+		require.NoError(t, s.repo.Create(ctx, &models.Subscription{
+			Type: models.TypeAnalysisData, SubKey: "limited", Version: version, Title: "限制", Abstract: "限制", Status: models.StatusActive,
+			ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id, amount FROM orders ORDER BY id", ` + limits + `}`),
+		}, revisionMeta(ctx, models.RevisionCreate)))
+	}
+	stream := func(version uint32) (*rowRecorder, int64, error) {
+		w := &rowRecorder{}
+		rowCount, err := s.StreamSubscription(ctx, models.TypeAnalysisData, "limited", &version, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "/v1/subscriptions/limited", w)
+		return w, rowCount, err
+	}
+
+	w, rowCount, err := stream(1)
+	var truncated *ResultTruncatedError
+	require.True(t, errors.As(err, &truncated), "%v", err)
+	assert.Equal(t, &ResultTruncatedError{Limit: TruncatedByRows, Max: 2}, truncated)
+	assert.Equal(t, int64(2), rowCount)
+	assert.Len(t, w.rows, 2)
+	assert.True(t, w.closed)
+
+	// 行数恰好等于上限时不算截断
+	w, rowCount, err = stream(2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rowCount)
+	assert.Len(t, w.rows, 3)
+
+	// {"amount":10,"id":1} 加换行共 21 字节
+	w, rowCount, err = stream(3)
+	require.True(t, errors.As(err, &truncated), "%v", err)
+	assert.Equal(t, TruncatedByBytes, truncated.Limit)
+	assert.Equal(t, int64(1), rowCount)
+	assert.Equal(t, []interface{}{int64(1), int64(10)}, w.rows[0])
+}
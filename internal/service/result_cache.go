@@ -0,0 +1,89 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	resultCachePrefix = "bisub:result:"
+	// maxCachedResultBytes 超过该大小的结果不写入缓存
+	maxCachedResultBytes = 8 << 20
+)
+
+// ResultCache 基于Redis的订阅执行结果缓存
+// 每个 type+sub_key 维护一个代数，订阅变更时递增代数使旧缓存整体失效
+type ResultCache struct {
+	redis *redis.Client
+}
+
+func NewResultCache(client *redis.Client) *ResultCache {
+	return &ResultCache{redis: client}
+}
+
+// CacheKey 由订阅、版本、数据源和规范化后的变量（绑定参数）计算缓存键
+func (c *ResultCache) CacheKey(ctx context.Context, subType, subKey string, version uint32, dataSource string, args []interface{}) (string, error) {
+	generation, err := c.redis.Get(ctx, c.generationKey(subType, subKey)).Int64()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+
+	normalized, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(normalized)
+
+	return fmt.Sprintf("%s%s:%s:%d:%d:%s:%s",
+		resultCachePrefix, subType, subKey, generation, version, dataSource, hex.EncodeToString(sum[:])), nil
+}
+
+// Get 读取缓存，未命中时返回 false
+func (c *ResultCache) Get(ctx context.Context, key string) ([]map[string]interface{}, bool, error) {
+	data, err := c.redis.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 使用 json.Number 避免大整数在反序列化时丢失精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var results []map[string]interface{}
+	if err := decoder.Decode(&results); err != nil {
+		return nil, false, err
+	}
+	return results, true, nil
+}
+
+// Set 写入缓存，结果过大时跳过
+func (c *ResultCache) Set(ctx context.Context, key string, results []map[string]interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxCachedResultBytes {
+		slog.WarnContext(ctx, "Result too large to cache", "key", key, "bytes", len(data))
+		return nil
+	}
+	return c.redis.Set(ctx, key, data, ttl).Err()
+}
+
+// Invalidate 使订阅key下所有版本的缓存失效
+func (c *ResultCache) Invalidate(ctx context.Context, subType, subKey string) error {
+	return c.redis.Incr(ctx, c.generationKey(subType, subKey)).Err()
+}
+
+func (c *ResultCache) generationKey(subType, subKey string) string {
+	return fmt.Sprintf("%sgen:%s:%s", resultCachePrefix, subType, subKey)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestResultCacheKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c := NewResultCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	key, err := c.CacheKey(ctx, "A", "orders", 1, "default", []interface{}{int64(1), "london"})
+	require.NoError(t, err)
+	same, err := c.CacheKey(ctx, "A", "orders", 1, "default", []interface{}{int64(1), "london"})
+	require.NoError(t, err)
+	assert.Equal(t, key, same)
+
+	// 版本、数据源、参数任一不同都不共用缓存
+	for _, other := range []struct {
+		version    uint32
+		dataSource string
+		args       []interface{}
+	}{
+		{2, "default", []interface{}{int64(1), "london"}},
+		{1, "report", []interface{}{int64(1), "london"}},
+		{1, "default", []interface{}{"london", int64(1)}},
+		{1, "default", []interface{}{"1", "london"}},
+	} {
+		otherKey, err := c.CacheKey(ctx, "A", "orders", other.version, other.dataSource, other.args)
+		require.NoError(t, err)
+		assert.NotEqual(t, key, otherKey, other)
+	}
+
+	results := []map[string]interface{}{{"id": 9007199254740993, "name": "a"}}
+	require.NoError(t, c.Set(ctx, key, results, time.Minute))
+	cached, hit, err := c.Get(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, hit)
+	// 大整数不丢失精度
+	assert.Equal(t, json.Number("9007199254740993"), cached[0]["id"])
+
+	// 失效后同样的请求得到新的缓存键，其他key不受影响
+	otherKey, err := c.CacheKey(ctx, "A", "houses", 1, "default", nil)
+	require.NoError(t, err)
+	require.NoError(t, c.Invalidate(ctx, "A", "orders"))
+	renewed, err := c.CacheKey(ctx, "A", "orders", 1, "default", []interface{}{int64(1), "london"})
+	require.NoError(t, err)
+	assert.NotEqual(t, key, renewed)
+	_, hit, err = c.Get(ctx, renewed)
+	require.NoError(t, err)
+	assert.False(t, hit)
+	unchanged, err := c.CacheKey(ctx, "A", "houses", 1, "default", nil)
+	require.NoError(t, err)
+	assert.Equal(t, otherKey, unchanged)
+
+	// 过大的结果不写入
+	large := []map[string]interface{}{{"data": strings.Repeat("x", maxCachedResultBytes)}}
+	require.NoError(t, c.Set(ctx, renewed, large, time.Minute))
+	_, hit, err = c.Get(ctx, renewed)
+	require.NoError(t, err)
+	assert.False(t, hit)
+}
+
+// cacheHitStats 等待统计写入 want 条后，返回其中命中缓存的条数；统计异步写入，顺序不确定
+func cacheHitStats(t *testing.T, db *gorm.DB, key string, want int) int {
+	var stats []models.SubscriptionStats
+	require.Eventually(t, func() bool {
+		stats = nil
+		require.NoError(t, db.Where("sub_key = ?", key).Find(&stats).Error)
+		return len(stats) >= want
+	}, 5*time.Second, 10*time.Millisecond)
+
+	hits := 0
+	for _, stat := range stats {
+		var rr models.RequestResponse
+		require.NoError(t, json.Unmarshal(stat.RequestResponse, &rr))
+		if rr.CacheHit {
+			hits++
+		}
+	}
+	return hits
+}
+
+func TestExecuteSubscriptionResultCache(t *testing.T) {
+	s, db := newExecutionTestService(t)
+	mr := miniredis.RunT(t)
+	s.cache = NewResultCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := adminContext()
+
+	extraConfig := `{"sql_content": "SELECT id, amount FROM orders WHERE amount >= min_replace AND id <= max_replace ORDER BY id", "sql_replace": {"min_replace": {"type": "int"}, "max_replace": {"type": "int"}}, "cache_ttl": 60}`
+	for _, version := range []uint32{1, 2} {
+		require.NoError(t, s.repo.Create(ctx, &models.Subscription{
+			Type: models.TypeAnalysisData, SubKey: "cached", Version: version, Title: "缓存", Abstract: "缓存",
+			Status: models.StatusActive, ExtraConfig: json.RawMessage(extraConfig),
+		}, revisionMeta(ctx, models.RevisionCreate)))
+	}
+
+	execute := func(variables string, version uint32) *ExecutionResult {
+		t.Helper()
+		req := &models.ExecuteSubscriptionRequest{}
+		require.NoError(t, json.Unmarshal([]byte(`{"variables": `+variables+`}`), req))
+		result, err := s.ExecuteSubscription(ctx, models.TypeAnalysisData, "cached", &version, req, "127.0.0.1", "/v1/subscriptions/cached")
+		require.NoError(t, err)
+		return result
+	}
+	hitsBefore := testutil.ToFloat64(metrics.GetMetrics().CacheLookupTotal.WithLabelValues(metricsService, "cached", "hit"))
+
+	first := execute(`{"min_replace": 20, "max_replace": 3}`, 1)
+	assert.False(t, first.CacheHit)
+	assert.Len(t, first.Rows, 2)
+
+	// 变量顺序不影响缓存键
+	second := execute(`{"max_replace": 3, "min_replace": 20}`, 1)
+	assert.True(t, second.CacheHit)
+	assert.Equal(t, first.Rows[1]["amount"], toInt64(t, second.Rows[1]["amount"]))
+
+	// 变量值或版本不同时不命中
+	assert.False(t, execute(`{"min_replace": 10, "max_replace": 3}`, 1).CacheHit)
+	assert.False(t, execute(`{"min_replace": 20, "max_replace": 3}`, 2).CacheHit)
+	assert.True(t, execute(`{"min_replace": 20, "max_replace": 3}`, 2).CacheHit)
+
+	assert.Equal(t, hitsBefore+2, testutil.ToFloat64(metrics.GetMetrics().CacheLookupTotal.WithLabelValues(metricsService, "cached", "hit")))
+	assert.Equal(t, 2, cacheHitStats(t, db, "cached", 5))
+
+	// 修改、状态变更、删除都使缓存失效
+	for _, change := range []struct {
+		name  string
+		apply func() error
+	}{
+		{"update", func() error {
+			_, err := s.UpdateSubscription(ctx, models.TypeAnalysisData, "cached", 2, &models.UpdateSubscriptionRequest{Title: "缓存（改）"})
+			return err
+		}},
+		{"status", func() error {
+			return s.UpdateStatus(ctx, models.TypeAnalysisData, "cached", 1, models.StatusExpired, false)
+		}},
+		{"delete", func() error {
+			return s.DeleteSubscription(ctx, models.TypeAnalysisData, "cached", 1)
+		}},
+	} {
+		assert.True(t, execute(`{"min_replace": 20, "max_replace": 3}`, 2).CacheHit, change.name)
+		require.NoError(t, change.apply(), change.name)
+		assert.False(t, execute(`{"min_replace": 20, "max_replace": 3}`, 2).CacheHit, change.name)
+	}
+}
+
+func toInt64(t *testing.T, v interface{}) int64 {
+	n, ok := v.(json.Number)
+	require.True(t, ok, "%T", v)
+	i, err := n.Int64()
+	require.NoError(t, err)
+	return i
+}
+
+func TestResultCacheSkipsSchemaWarnings(t *testing.T) {
+	s, _ := newExecutionTestService(t)
+	mr := miniredis.RunT(t)
+	s.cache = NewResultCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := adminContext()
+
+	// amount 未声明，每次执行都有输出结构告警，结果不缓存，否则命中缓存时告警会丢失
+	require.NoError(t, s.repo.Create(ctx, &models.Subscription{
+		Type: models.TypeAnalysisData, SubKey: "warned", Version: 1, Title: "告警", Abstract: "告警", Status: models.StatusActive,
+		ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id, amount FROM orders", "cache_ttl": 60, "output_schema": {"columns": [{"name": "id", "type": "integer"}]}}`),
+	}, revisionMeta(ctx, models.RevisionCreate)))
+
+	for i := 0; i < 2; i++ {
+		result, err := s.ExecuteSubscription(ctx, models.TypeAnalysisData, "warned", nil, &models.ExecuteSubscriptionRequest{}, "127.0.0.1", "/v1/subscriptions/warned")
+		require.NoError(t, err)
+		assert.False(t, result.CacheHit)
+		assert.NotEmpty(t, result.SchemaWarnings)
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReviewNotFound = errors.New("review not found")
+	ErrReviewRequired = errors.New("an approved review is required")
+	ErrReviewClosed   = errors.New("review is no longer pending")
+	ErrReviewOutdated = errors.New("version content changed after the review was submitted")
+	ErrSelfReview     = errors.New("reviewer must be different from the submitter")
+	ErrSharedReviewer = errors.New("review decisions require a personal identity: the shared Web UI account cannot approve or reject, use /v1 with a JWT or API key")
+)
+
+// ReviewService 订阅版本上线审核
+// 提交和审核都需要订阅的 edit 权限，审核人不能是提交人
+type ReviewService struct {
+	repo    *repository.ReviewRepository
+	subRepo *repository.SubscriptionRepository
+	access  *AccessControl
+}
+
+func NewReviewService(repo *repository.ReviewRepository, subRepo *repository.SubscriptionRepository, access *AccessControl) *ReviewService {
+	return &ReviewService{
+		repo:    repo,
+		subRepo: subRepo,
+		access:  access,
+	}
+}
+
+// Submit 提交未生效的版本（待生效或已失效）等待审核
+func (s *ReviewService) Submit(ctx context.Context, subType, key string, version uint32, req *models.SubmitReviewRequest) (*models.SubscriptionReview, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return nil, err
+	}
+
+	subscription, err := s.subRepo.GetByKeyAndVersion(ctx, subType, key, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d", ErrSubscriptionNotFound, version)
+		}
+		return nil, err
+	}
+	if models.IsServingStatus(subscription.Status) {
+		return nil, fmt.Errorf("%w: version %d is already active", ErrInvalidTransition, version)
+	}
+
+	review := &models.SubscriptionReview{
+		Type:            subType,
+		SubKey:          key,
+		Version:         version,
+		ContentHash:     contentHash(subscription.ExtraConfig),
+		Status:          models.ReviewPending,
+		Comment:         req.Comment,
+		SubmittedBy:     principal.UserID,
+		SubmittedByName: principal.Name(),
+	}
+	if err := s.repo.Create(ctx, review); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// ListByVersion 获取订阅版本的审核记录
+func (s *ReviewService) ListByVersion(ctx context.Context, subType, key string, version uint32) ([]*models.SubscriptionReview, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermView); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByVersion(ctx, subType, key, version)
+}
+
+// List 获取调用方可见的审核记录，默认只返回待审核的
+func (s *ReviewService) List(ctx context.Context, status string, limit, offset int) ([]*models.SubscriptionReview, int64, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if status == "" {
+		status = models.ReviewPending
+	}
+
+	access, err := s.access.Filter(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.repo.List(ctx, status, limit, offset, access)
+}
+
+// Get 获取审核详情及待审核内容相对当前生效版本的差异
+func (s *ReviewService) Get(ctx context.Context, id uint64) (*models.ReviewView, error) {
+	review, err := s.load(ctx, id, models.PermView)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &models.ReviewView{SubscriptionReview: review}
+	subscription, err := s.subRepo.GetByKeyAndVersion(ctx, review.Type, review.SubKey, review.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 版本已删除，只返回审核记录
+			return view, nil
+		}
+		return nil, err
+	}
+	view.Outdated = contentHash(subscription.ExtraConfig) != review.ContentHash
+
+	// 没有生效版本时与空内容比较
+	base := &models.SubscriptionRevision{ExtraConfig: json.RawMessage(`{}`)}
+	active, err := s.subRepo.GetActiveByKey(ctx, review.Type, review.SubKey)
+	switch {
+	case err == nil:
+		view.ActiveVersion = active.Version
+		base = models.NewSubscriptionRevision(active, models.RevisionMeta{})
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	view.Diff = diffRevisions(base, models.NewSubscriptionRevision(subscription, models.RevisionMeta{}))
+	return view, nil
+}
+
+// Approve 审核通过，版本内容在提交后被修改时拒绝
+func (s *ReviewService) Approve(ctx context.Context, id uint64, req *models.ReviewDecisionRequest) (*models.SubscriptionReview, error) {
+	return s.decide(ctx, id, models.ReviewApproved, req.Comment)
+}
+
+// Reject 驳回审核，必须填写意见
+func (s *ReviewService) Reject(ctx context.Context, id uint64, req *models.ReviewDecisionRequest) (*models.SubscriptionReview, error) {
+	if req.Comment == "" {
+		return nil, &ReviewError{Reason: "comment is required when rejecting"}
+	}
+	return s.decide(ctx, id, models.ReviewRejected, req.Comment)
+}
+
+// ReviewError 审核请求参数错误
+type ReviewError struct {
+	Reason string
+}
+
+func (e *ReviewError) Error() string {
+	return "invalid review: " + e.Reason
+}
+
+func (s *ReviewService) decide(ctx context.Context, id uint64, status, comment string) (*models.SubscriptionReview, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	// /api 的调用方都是同一个 Web UI 账号，无法区分提交人和审核人
+	if principal.Shared {
+		return nil, ErrSharedReviewer
+	}
+	review, err := s.load(ctx, id, models.PermEdit)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status != models.ReviewPending {
+		return nil, fmt.Errorf("%w: %s", ErrReviewClosed, review.Status)
+	}
+	if samePrincipal(principal, review.SubmittedBy, review.SubmittedByName) {
+		return nil, ErrSelfReview
+	}
+
+	if status == models.ReviewApproved {
+		subscription, err := s.subRepo.GetByKeyAndVersion(ctx, review.Type, review.SubKey, review.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%w: version %d", ErrSubscriptionNotFound, review.Version)
+		}
+		if contentHash(subscription.ExtraConfig) != review.ContentHash {
+			return nil, ErrReviewOutdated
+		}
+	}
+
+	review.ReviewComment = comment
+	review.ReviewedBy = principal.UserID
+	review.ReviewedByName = principal.Name()
+	decided, err := s.repo.Decide(ctx, review, status)
+	if err != nil {
+		return nil, err
+	}
+	if !decided {
+		return nil, fmt.Errorf("%w: review was decided or superseded concurrently", ErrReviewClosed)
+	}
+	return review, nil
+}
+
+// load 读取审核并校验调用方对所属订阅的权限
+func (s *ReviewService) load(ctx context.Context, id uint64, permission string) (*models.SubscriptionReview, error) {
+	review, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	if err := s.access.Require(ctx, review.Type, review.SubKey, permission); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// requireApproval 开启审核时，激活版本前要求存在与当前内容一致的已通过审核
+func (s *SubscriptionService) requireApproval(ctx context.Context, subscription *models.Subscription) error {
+	if !s.config.Security.RequireReview {
+		return nil
+	}
+	approved, err := s.reviews.HasApproval(ctx, subscription.Type, subscription.SubKey, subscription.Version, contentHash(subscription.ExtraConfig))
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return fmt.Errorf("%w: version %d", ErrReviewRequired, subscription.Version)
+	}
+	return nil
+}
+
+// contentHash 审核绑定的内容摘要，只覆盖影响执行结果的 extra_config
+func contentHash(extraConfig json.RawMessage) string {
+	sum := sha256.Sum256([]byte(compactJSON(extraConfig)))
+	return hex.EncodeToString(sum[:])
+}
+
+// samePrincipal 调用方是否为记录中的同一身份，用户按ID比较，其他按名称比较
+func samePrincipal(p *auth.Principal, userID uint64, name string) bool {
+	if p.Kind == auth.KindUser && p.UserID != 0 && p.UserID == userID {
+		return true
+	}
+	return p.Name() == name
+}
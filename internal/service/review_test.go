@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamePrincipal(t *testing.T) {
+	alice := &auth.Principal{Kind: auth.KindUser, UserID: 1, Username: "alice"}
+	bob := &auth.Principal{Kind: auth.KindUser, UserID: 2, Username: "bob"}
+	crm := &auth.Principal{Kind: auth.KindClient, ClientID: "crm"}
+
+	assert.True(t, samePrincipal(alice, 1, "alice"))
+	// 用户名变化仍按ID识别
+	assert.True(t, samePrincipal(alice, 1, "alice.old"))
+	assert.False(t, samePrincipal(bob, 1, "alice"))
+	assert.True(t, samePrincipal(crm, 0, "client:crm"))
+	assert.False(t, samePrincipal(crm, 0, "crm"))
+}
+
+func TestContentHashIgnoresFormatting(t *testing.T) {
+	a := contentHash(json.RawMessage(`{"sql_content": "SELECT 1", "example": ""}`))
+	b := contentHash(json.RawMessage(`{"sql_content":"SELECT 1","example":""}`))
+	c := contentHash(json.RawMessage(`{"sql_content":"SELECT 2","example":""}`))
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func TestReviewEnforcement(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Security.RequireReview = true
+	s := &SubscriptionService{access: &AccessControl{}, config: cfg}
+	ctx := auth.WithPrincipal(context.Background(), auth.System)
+
+	// 开启审核后不能直接以生效状态创建
+	err := s.checkInitialStatus(ctx, &models.Subscription{Status: models.StatusActive}, false)
+	assert.True(t, errors.Is(err, ErrReviewRequired))
+	assert.NoError(t, s.checkInitialStatus(ctx, &models.Subscription{Status: models.StatusPending}, false))
+
+	// 关闭审核时不查询审核记录
+	cfg.Security.RequireReview = false
+	assert.NoError(t, s.requireApproval(ctx, &models.Subscription{}))
+}
+
+func TestRejectRequiresComment(t *testing.T) {
+	s := &ReviewService{}
+	_, err := s.Reject(context.Background(), 1, &models.ReviewDecisionRequest{})
+	var reviewErr *ReviewError
+	assert.True(t, errors.As(err, &reviewErr))
+}
+
+func TestSharedAccountCannotDecide(t *testing.T) {
+	s := &ReviewService{}
+	// Web 管理界面的共用账号可以提交审核，但通过和驳回必须来自个人身份
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindUser, Username: "admin", Admin: true, Shared: true})
+	_, err := s.Approve(ctx, 1, &models.ReviewDecisionRequest{})
+	assert.True(t, errors.Is(err, ErrSharedReviewer))
+	_, err = s.Reject(ctx, 1, &models.ReviewDecisionRequest{Comment: "列名错误"})
+	assert.True(t, errors.Is(err, ErrSharedReviewer))
+}
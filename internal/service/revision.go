@@ -0,0 +1,231 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// ListRevisions 获取订阅版本的修订历史，每个修订附带相对上一修订的差异
+func (s *SubscriptionService) ListRevisions(ctx context.Context, subType, key string, version uint32, limit, offset int) ([]*models.RevisionView, int64, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermView); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	revisions, total, err := s.repo.ListRevisions(ctx, subType, key, version, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	views := make([]*models.RevisionView, len(revisions))
+	for i, revision := range revisions {
+		// 按修订号倒序，上一修订是列表中的下一项；本页最后一项单独查询
+		var previous *models.SubscriptionRevision
+		if i+1 < len(revisions) {
+			previous = revisions[i+1]
+		} else if revision.Revision > 1 {
+			previous, err = s.repo.GetRevision(ctx, subType, key, version, revision.Revision-1)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, 0, err
+			}
+		}
+
+		views[i] = &models.RevisionView{SubscriptionRevision: revision}
+		if previous != nil {
+			views[i].Diff = diffRevisions(previous, revision)
+		}
+	}
+	return views, total, nil
+}
+
+// Rollback 将订阅版本的内容恢复为指定修订，按普通修改流程校验SQL和输出结构；状态保持不变
+func (s *SubscriptionService) Rollback(ctx context.Context, subType, key string, version uint32, req *models.RollbackRequest) (*models.Subscription, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return nil, err
+	}
+
+	target, err := s.repo.GetRevision(ctx, subType, key, version, req.Revision)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, req.Revision)
+		}
+		return nil, err
+	}
+
+	return s.updateSubscription(ctx, subType, key, version, &models.UpdateSubscriptionRequest{
+		Title:       target.Title,
+		Abstract:    target.Abstract,
+		ExtraConfig: target.ExtraConfig,
+		Force:       req.Force,
+	}, models.RevisionRollback)
+}
+
+// revisionMeta 以当前调用方作为修订的操作人
+func revisionMeta(ctx context.Context, action string) models.RevisionMeta {
+	meta := models.RevisionMeta{Action: action}
+	if p, ok := auth.FromContext(ctx); ok {
+		meta.ChangedBy = p.UserID
+		meta.ChangedByName = p.Name()
+	}
+	return meta
+}
+
+// diffRevisions 计算两个修订之间的差异
+func diffRevisions(from, to *models.SubscriptionRevision) *models.RevisionDiff {
+	diff := &models.RevisionDiff{
+		Fields: fieldChanges(
+			[3]string{"title", from.Title, to.Title},
+			[3]string{"abstract", from.Abstract, to.Abstract},
+			[3]string{"status", from.Status, to.Status},
+		),
+	}
+	if !bytes.Equal(from.ExtraConfig, to.ExtraConfig) {
+		diff.ExtraConfig = diffExtraConfig(from.ExtraConfig, to.ExtraConfig)
+	}
+	return diff
+}
+
+// diffExtraConfig 对比SQL文本、sql_replace 变量和其他配置项，无法解析时只比较原始文本
+func diffExtraConfig(from, to json.RawMessage) *models.ExtraConfigDiff {
+	var fromConfig, toConfig models.ExtraConfig
+	var fromFields, toFields map[string]json.RawMessage
+	if json.Unmarshal(from, &fromConfig) != nil || json.Unmarshal(to, &toConfig) != nil ||
+		json.Unmarshal(from, &fromFields) != nil || json.Unmarshal(to, &toFields) != nil {
+		return &models.ExtraConfigDiff{
+			Fields: fieldChanges([3]string{"extra_config", string(from), string(to)}),
+		}
+	}
+
+	diff := &models.ExtraConfigDiff{}
+	if fromConfig.SQLContent != toConfig.SQLContent {
+		diff.SQL = diffLines(splitLines(fromConfig.SQLContent), splitLines(toConfig.SQLContent))
+	}
+
+	for name, spec := range toConfig.SQLReplace {
+		previous, ok := fromConfig.SQLReplace[name]
+		switch {
+		case !ok:
+			diff.AddedVariables = append(diff.AddedVariables, name)
+		case !reflect.DeepEqual(previous, spec):
+			diff.ChangedVariables = append(diff.ChangedVariables, name)
+		}
+	}
+	for name := range fromConfig.SQLReplace {
+		if _, ok := toConfig.SQLReplace[name]; !ok {
+			diff.RemovedVariables = append(diff.RemovedVariables, name)
+		}
+	}
+	sort.Strings(diff.AddedVariables)
+	sort.Strings(diff.RemovedVariables)
+	sort.Strings(diff.ChangedVariables)
+
+	// 其他配置项按键比较，新增的配置项无需在这里逐个列出
+	keys := make(map[string]struct{})
+	for k := range fromFields {
+		keys[k] = struct{}{}
+	}
+	for k := range toFields {
+		keys[k] = struct{}{}
+	}
+	var names []string
+	for k := range keys {
+		if k != "sql_content" && k != "sql_replace" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		diff.Fields = append(diff.Fields, fieldChanges([3]string{k, compactJSON(fromFields[k]), compactJSON(toFields[k])})...)
+	}
+
+	return diff
+}
+
+// fieldChanges 返回取值不同的字段，每项为 {字段, 原值, 新值}
+func fieldChanges(fields ...[3]string) []models.FieldChange {
+	var changes []models.FieldChange
+	for _, f := range fields {
+		if f[1] != f[2] {
+			changes = append(changes, models.FieldChange{Field: f[0], From: f[1], To: f[2]})
+		}
+	}
+	return changes
+}
+
+func compactJSON(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines 基于最长公共子序列的逐行差异
+func diffLines(a, b []string) []models.DiffLine {
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []models.DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, models.DiffLine{Op: "equal", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, models.DiffLine{Op: "delete", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, models.DiffLine{Op: "insert", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, models.DiffLine{Op: "delete", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, models.DiffLine{Op: "insert", Text: b[j]})
+	}
+	return lines
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLines(t *testing.T) {
+	lines := diffLines(
+		[]string{"SELECT id", "FROM houses", "WHERE id = house_id_replace"},
+		[]string{"SELECT id, title", "FROM houses", "WHERE id = house_id_replace", "LIMIT 10"},
+	)
+	assert.Equal(t, []models.DiffLine{
+		{Op: "delete", Text: "SELECT id"},
+		{Op: "insert", Text: "SELECT id, title"},
+		{Op: "equal", Text: "FROM houses"},
+		{Op: "equal", Text: "WHERE id = house_id_replace"},
+		{Op: "insert", Text: "LIMIT 10"},
+	}, lines)
+
+	assert.Empty(t, diffLines(nil, nil))
+}
+
+func TestDiffRevisions(t *testing.T) {
+	from := &models.SubscriptionRevision{
+		Title:  "房源报表",
+		Status: models.StatusPending,
+		ExtraConfig: json.RawMessage(`{
+			"sql_content": "SELECT * FROM houses\nWHERE id = house_id_replace",
+			"sql_replace": {"house_id_replace": "房源ID", "city_replace": {"type": "string"}},
+			"example": "{}"
+		}`),
+	}
+	to := &models.SubscriptionRevision{
+		Title:  "房源报表",
+		Status: models.StatusActive,
+		ExtraConfig: json.RawMessage(`{
+			"sql_content": "SELECT * FROM houses\nWHERE id = house_id_replace AND status = status_replace",
+			"sql_replace": {"house_id_replace": {"type": "int"}, "status_replace": {"type": "string"}},
+			"example": "{}",
+			"cache_ttl": 60
+		}`),
+	}
+
+	diff := diffRevisions(from, to)
+	assert.Equal(t, []models.FieldChange{{Field: "status", From: "A", To: "B"}}, diff.Fields)
+
+	require.NotNil(t, diff.ExtraConfig)
+	assert.Equal(t, []string{"status_replace"}, diff.ExtraConfig.AddedVariables)
+	assert.Equal(t, []string{"city_replace"}, diff.ExtraConfig.RemovedVariables)
+	assert.Equal(t, []string{"house_id_replace"}, diff.ExtraConfig.ChangedVariables)
+	assert.Equal(t, []models.FieldChange{{Field: "cache_ttl", From: "", To: "60"}}, diff.ExtraConfig.Fields)
+	assert.Equal(t, []models.DiffLine{
+		{Op: "equal", Text: "SELECT * FROM houses"},
+		{Op: "delete", Text: "WHERE id = house_id_replace"},
+		{Op: "insert", Text: "WHERE id = house_id_replace AND status = status_replace"},
+	}, diff.ExtraConfig.SQL)
+
+	// 内容相同时没有 extra_config 差异
+	assert.Nil(t, diffRevisions(to, to).ExtraConfig)
+}
@@ -0,0 +1,314 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+
+	errScheduleNoOwner = errors.New("schedule has no recorded owner, save it again to resume delivery")
+)
+
+// ScheduleError 定时投递计划配置错误
+type ScheduleError struct {
+	Reason string
+}
+
+func (e *ScheduleError) Error() string {
+	return "invalid schedule: " + e.Reason
+}
+
+func scheduleErrorf(format string, args ...interface{}) error {
+	return &ScheduleError{Reason: fmt.Sprintf(format, args...)}
+}
+
+type ScheduleService struct {
+	repo    *repository.ScheduleRepository
+	subRepo *repository.SubscriptionRepository
+	access  *AccessControl
+	sources *DataSourceRegistry
+	config  *config.Config
+}
+
+func NewScheduleService(repo *repository.ScheduleRepository, subRepo *repository.SubscriptionRepository, access *AccessControl, sources *DataSourceRegistry, cfg *config.Config) *ScheduleService {
+	return &ScheduleService{
+		repo:    repo,
+		subRepo: subRepo,
+		access:  access,
+		sources: sources,
+		config:  cfg,
+	}
+}
+
+// 计划的查看需要订阅的 view 权限，创建、修改、删除需要 edit 权限
+func (s *ScheduleService) CreateSchedule(ctx context.Context, subType, key string, req *models.ScheduleRequest) (*models.SubscriptionSchedule, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return nil, err
+	}
+
+	exists, err := s.subRepo.ExistsByKey(ctx, subType, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, scheduleErrorf("subscription %s not found", key)
+	}
+
+	schedule := &models.SubscriptionSchedule{
+		Type:      subType,
+		SubKey:    key,
+		CreatedBy: principal.UserID,
+	}
+	if err := s.apply(ctx, schedule, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) ListSchedules(ctx context.Context, subType, key string) ([]*models.SubscriptionSchedule, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermView); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByKey(ctx, subType, key)
+}
+
+func (s *ScheduleService) GetSchedule(ctx context.Context, id uint64) (*models.SubscriptionSchedule, error) {
+	return s.getSchedule(ctx, id, models.PermView)
+}
+
+func (s *ScheduleService) getSchedule(ctx context.Context, id uint64, permission string) (*models.SubscriptionSchedule, error) {
+	schedule, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.access.Require(ctx, schedule.Type, schedule.SubKey, permission); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, id uint64, req *models.ScheduleRequest) (*models.SubscriptionSchedule, error) {
+	schedule, err := s.getSchedule(ctx, id, models.PermEdit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(ctx, schedule, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) DeleteSchedule(ctx context.Context, id uint64) error {
+	if _, err := s.getSchedule(ctx, id, models.PermEdit); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *ScheduleService) ListRuns(ctx context.Context, id uint64, req *models.ScheduleRunsRequest) ([]*models.ScheduleRun, int64, error) {
+	if _, err := s.GetSchedule(ctx, id); err != nil {
+		return nil, 0, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset := req.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListRuns(ctx, id, limit, offset)
+}
+
+// apply 校验请求并写入计划，同时重新计算下次触发时间；保存计划的调用方成为触发时使用的身份
+func (s *ScheduleService) apply(ctx context.Context, schedule *models.SubscriptionSchedule, req *models.ScheduleRequest) error {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if err := s.validateTarget(&req.Target); err != nil {
+		return err
+	}
+	if req.DataSource != "" && !s.sources.Exists(req.DataSource) {
+		return scheduleErrorf("data source %s not found", req.DataSource)
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	var nextRunAt *time.Time
+	next, err := nextRunTime(req.CronExpr, req.Timezone, time.Now())
+	if err != nil {
+		return err
+	}
+	if enabled {
+		nextRunAt = &next
+	}
+
+	variables, err := json.Marshal(req.Variables)
+	if err != nil {
+		return err
+	}
+	target, err := json.Marshal(req.Target)
+	if err != nil {
+		return err
+	}
+	runAs, err := json.Marshal(newScheduleIdentity(principal))
+	if err != nil {
+		return err
+	}
+
+	schedule.Name = req.Name
+	schedule.CronExpr = req.CronExpr
+	schedule.Timezone = req.Timezone
+	schedule.Variables = variables
+	schedule.DataSource = req.DataSource
+	schedule.Target = target
+	schedule.Enabled = enabled
+	schedule.NextRunAt = nextRunAt
+	schedule.RunAs = runAs
+	return nil
+}
+
+func (s *ScheduleService) validateTarget(target *models.DeliveryTarget) error {
+	switch target.Type {
+	case models.TargetWebhook:
+		u, err := url.Parse(target.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return scheduleErrorf("webhook target requires an http(s) url")
+		}
+		if err := checkWebhookHost(u.Hostname(), s.config.Scheduler.Webhook.AllowedHosts); err != nil {
+			return scheduleErrorf("%v", err)
+		}
+	case models.TargetEmail:
+		if s.config.Scheduler.SMTP.Host == "" {
+			return scheduleErrorf("email target requires scheduler.smtp to be configured")
+		}
+		if len(target.To) == 0 {
+			return scheduleErrorf("email target requires at least one recipient")
+		}
+		// 只保存地址部分，投递时直接用于 RCPT 和 To 头
+		for i, to := range target.To {
+			addr, err := mail.ParseAddress(to)
+			if err != nil {
+				return scheduleErrorf("invalid recipient %q", to)
+			}
+			target.To[i] = addr.Address
+		}
+	case models.TargetFile:
+		if s.config.Scheduler.OutputDir == "" {
+			return scheduleErrorf("file target requires scheduler.output_dir to be configured")
+		}
+		if strings.ContainsAny(target.FileName, `/\`) || strings.Contains(target.FileName, "..") {
+			return scheduleErrorf("file_name must not contain path separators")
+		}
+	default:
+		return scheduleErrorf("unsupported target type %q", target.Type)
+	}
+	return nil
+}
+
+// scheduleIdentity 保存计划的调用方身份，触发时以该身份重新校验订阅和数据源权限
+type scheduleIdentity struct {
+	Kind        string   `json:"kind"`
+	UserID      uint64   `json:"user_id,string,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Admin       bool     `json:"admin,omitempty"`
+	APIKeyID    uint64   `json:"api_key_id,string,omitempty"`
+	SubKeys     []string `json:"sub_keys,omitempty"`
+	DataSources []string `json:"data_sources,omitempty"`
+}
+
+func newScheduleIdentity(p *auth.Principal) *scheduleIdentity {
+	return &scheduleIdentity{
+		Kind:        p.Kind,
+		UserID:      p.UserID,
+		Username:    p.Username,
+		ClientID:    p.ClientID,
+		Roles:       p.Roles,
+		Admin:       p.Admin,
+		APIKeyID:    p.APIKeyID,
+		SubKeys:     p.SubKeys,
+		DataSources: p.DataSources,
+	}
+}
+
+// schedulePrincipal 触发计划时使用的身份；升级前保存的计划没有身份快照，按创建人的用户身份执行
+func schedulePrincipal(schedule *models.SubscriptionSchedule) (*auth.Principal, error) {
+	if len(schedule.RunAs) == 0 {
+		if schedule.CreatedBy == 0 {
+			return nil, errScheduleNoOwner
+		}
+		return &auth.Principal{Kind: auth.KindUser, UserID: schedule.CreatedBy}, nil
+	}
+
+	var identity scheduleIdentity
+	if err := json.Unmarshal(schedule.RunAs, &identity); err != nil {
+		return nil, fmt.Errorf("invalid run_as: %w", err)
+	}
+	return &auth.Principal{
+		Kind:        identity.Kind,
+		UserID:      identity.UserID,
+		Username:    identity.Username,
+		ClientID:    identity.ClientID,
+		Roles:       identity.Roles,
+		Admin:       identity.Admin,
+		APIKeyID:    identity.APIKeyID,
+		SubKeys:     identity.SubKeys,
+		DataSources: identity.DataSources,
+	}, nil
+}
+
+// nextRunTime 按计划时区计算 after 之后的下次触发时间
+func nextRunTime(expr, timezone string, after time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, scheduleErrorf("invalid cron expression: %v", err)
+	}
+
+	loc := time.Local
+	if timezone != "" {
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return time.Time{}, scheduleErrorf("invalid timezone %q", timezone)
+		}
+	}
+
+	next := sched.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, scheduleErrorf("cron expression %q never fires", expr)
+	}
+	return next, nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextRunTime(t *testing.T) {
+	after := time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC)
+
+	// 上海 08:00 即 UTC 00:00
+	next, err := nextRunTime("0 8 * * *", "Asia/Shanghai", after)
+	require.NoError(t, err)
+	assert.True(t, next.Equal(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)), "got %s", next)
+
+	_, err = nextRunTime("not a cron", "", after)
+	var scheduleErr *ScheduleError
+	assert.True(t, errors.As(err, &scheduleErr))
+
+	_, err = nextRunTime("0 8 * * *", "Mars/Base", after)
+	assert.True(t, errors.As(err, &scheduleErr))
+}
+
+func TestValidateTarget(t *testing.T) {
+	s := &ScheduleService{config: &config.Config{}}
+
+	tests := []struct {
+		name    string
+		target  models.DeliveryTarget
+		wantErr bool
+	}{
+		{name: "webhook", target: models.DeliveryTarget{Type: models.TargetWebhook, URL: "https://example.com/hook"}},
+		{name: "webhook_bad_scheme", target: models.DeliveryTarget{Type: models.TargetWebhook, URL: "file:///etc/passwd"}, wantErr: true},
+		{name: "webhook_metadata_ip", target: models.DeliveryTarget{Type: models.TargetWebhook, URL: "http://169.254.169.254/latest"}, wantErr: true},
+		{name: "webhook_loopback_ip", target: models.DeliveryTarget{Type: models.TargetWebhook, URL: "http://[::1]:8080/hook"}, wantErr: true},
+		{name: "email_without_smtp", target: models.DeliveryTarget{Type: models.TargetEmail, To: []string{"bi@example.com"}}, wantErr: true},
+		{name: "file_without_output_dir", target: models.DeliveryTarget{Type: models.TargetFile}, wantErr: true},
+		{name: "unknown", target: models.DeliveryTarget{Type: "ftp"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateTarget(&tt.target)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// 配置 allowed_hosts 后只能投递到列出的主机
+	s.config.Scheduler.Webhook.AllowedHosts = []string{"*.example.com", "10.0.0.8"}
+	assert.NoError(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetWebhook, URL: "https://hooks.example.com/x"}))
+	assert.NoError(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetWebhook, URL: "http://10.0.0.8/x"}))
+	assert.ErrorContains(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetWebhook, URL: "https://example.org/x"}), "allowed_hosts")
+
+	// 收件人只保存地址部分
+	s.config.Scheduler.SMTP.Host = "smtp.example.com"
+	target := models.DeliveryTarget{Type: models.TargetEmail, To: []string{"BI Team <bi@example.com>", "ops@example.com"}}
+	require.NoError(t, s.validateTarget(&target))
+	assert.Equal(t, []string{"bi@example.com", "ops@example.com"}, target.To)
+	assert.Error(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetEmail, To: []string{"bi@example.com\r\nBcc: x@example.com"}}))
+
+	s.config.Scheduler.OutputDir = "/tmp"
+	assert.Error(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetFile, FileName: "../x.csv"}))
+	assert.NoError(t, s.validateTarget(&models.DeliveryTarget{Type: models.TargetFile, FileName: "{sub_key}.csv"}))
+}
+
+func testDelivery(target *models.DeliveryTarget) *delivery {
+	return &delivery{
+		schedule:     &models.SubscriptionSchedule{ID: 42, Name: "daily"},
+		subscription: &models.Subscription{Type: "A", SubKey: "house_report", Version: 2, Title: "房源日报"},
+		target:       target,
+		result: &collectedResult{
+			columns: []string{"id", "name"},
+			rows:    [][]interface{}{{int64(1), "a,b"}, {int64(2), nil}},
+		},
+		scheduledAt: time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := config.SchedulerConfig{Webhook: config.WebhookConfig{Timeout: time.Second, AllowedHosts: []string{"127.0.0.1"}}}
+	s := &Scheduler{config: cfg, webhook: newWebhookClient(cfg.Webhook)}
+	d := testDelivery(&models.DeliveryTarget{Type: models.TargetWebhook, URL: server.URL, Headers: map[string]string{"X-Token": "secret"}})
+
+	require.NoError(t, s.deliver(context.Background(), d))
+	assert.Equal(t, "house_report", payload.SubKey)
+	assert.Equal(t, []string{"id", "name"}, payload.Columns)
+	assert.Equal(t, 2, payload.RowCount)
+	assert.Equal(t, "a,b", payload.Rows[0]["name"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	d.target.URL = failing.URL
+	assert.Error(t, s.deliver(context.Background(), d))
+
+	// 不跟随重定向
+	redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirect.Close()
+	d.target.URL = redirect.URL
+	assert.ErrorContains(t, s.deliver(context.Background(), d), "status 302")
+
+	// 未配置 allowed_hosts 时，域名解析到内网地址也在连接时拒绝
+	cfg.Webhook.AllowedHosts = nil
+	s = &Scheduler{config: cfg, webhook: newWebhookClient(cfg.Webhook)}
+	d.target.URL = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	assert.True(t, errors.Is(s.deliver(context.Background(), d), ErrWebhookHostDenied))
+	d.target.URL = server.URL
+	assert.True(t, errors.Is(s.deliver(context.Background(), d), ErrWebhookHostDenied))
+}
+
+func TestScheduleRunsAsOwner(t *testing.T) {
+	subscriptions, db := newExecutionTestService(t)
+	s := &Scheduler{subscriptions: subscriptions, config: config.SchedulerConfig{MaxRows: 100, OutputDir: t.TempDir()}, ctx: context.Background()}
+	target, err := json.Marshal(models.DeliveryTarget{Type: models.TargetFile, FileName: "orders.csv"})
+	require.NoError(t, err)
+	runAs, err := json.Marshal(newScheduleIdentity(&auth.Principal{Kind: auth.KindUser, UserID: 7, Username: "bob"}))
+	require.NoError(t, err)
+	schedule := &models.SubscriptionSchedule{ID: 1, Type: models.TypeAnalysisData, SubKey: "orders", Target: target, RunAs: runAs}
+
+	// 保存计划的用户没有 execute 权限时投递失败
+	_, _, err = s.runOnce(schedule, time.Now())
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	require.NoError(t, repository.NewACLRepository(db).Create(context.Background(), &models.SubscriptionACL{
+		Type: models.TypeAnalysisData, SubKey: "orders", SubjectType: models.SubjectUser, Subject: "7", Permission: models.PermExecute,
+	}))
+	version, rowCount, err := s.runOnce(schedule, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), version)
+	assert.Equal(t, int64(3), rowCount)
+
+	// 数据源作用域同样生效
+	runAs, err = json.Marshal(newScheduleIdentity(&auth.Principal{Kind: auth.KindUser, UserID: 7, DataSources: []string{"report"}}))
+	require.NoError(t, err)
+	schedule.RunAs = runAs
+	_, _, err = s.runOnce(schedule, time.Now())
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	// 升级前保存的计划按创建人执行，没有创建人时不执行
+	schedule.RunAs, schedule.CreatedBy = nil, 7
+	_, _, err = s.runOnce(schedule, time.Now())
+	assert.NoError(t, err)
+	schedule.CreatedBy = 0
+	_, _, err = s.runOnce(schedule, time.Now())
+	assert.True(t, errors.Is(err, errScheduleNoOwner))
+}
+
+func TestDeliverFile(t *testing.T) {
+	dir := t.TempDir()
+	s := &Scheduler{config: config.SchedulerConfig{OutputDir: dir}}
+	d := testDelivery(&models.DeliveryTarget{Type: models.TargetFile})
+
+	require.NoError(t, s.deliver(context.Background(), d))
+
+	data, err := os.ReadFile(filepath.Join(dir, "house_report_20260302_080000.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "id,name\n1,\"a,b\"\n2,\n", string(data))
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const schedulerLeaderKey = "bisub:scheduler:leader"
+
+// renewLeaderScript 仅当锁仍由本实例持有时续期
+var renewLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseLeaderScript 仅当锁仍由本实例持有时释放
+var releaseLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Scheduler 定时投递调度器
+// 各实例通过Redis锁选主，只有主实例扫描到期计划；触发前以 next_run_at 为条件推进，避免重复触发
+type Scheduler struct {
+	repo          *repository.ScheduleRepository
+	subscriptions *SubscriptionService
+	redis         *redis.Client
+	config        config.SchedulerConfig
+	webhook       *http.Client
+	instanceID    string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(repo *repository.ScheduleRepository, subscriptions *SubscriptionService, client *redis.Client, cfg *config.Config) *Scheduler {
+	schedCfg := cfg.Scheduler
+	if schedCfg.TickInterval <= 0 {
+		schedCfg.TickInterval = 15 * time.Second
+	}
+	if schedCfg.MaxAttempts <= 0 {
+		schedCfg.MaxAttempts = 3
+	}
+	if schedCfg.RetryBackoff <= 0 {
+		schedCfg.RetryBackoff = 30 * time.Second
+	}
+	if schedCfg.MaxRows <= 0 {
+		schedCfg.MaxRows = 100000
+	}
+	if schedCfg.Webhook.Timeout <= 0 {
+		schedCfg.Webhook.Timeout = 30 * time.Second
+	}
+
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		repo:          repo,
+		subscriptions: subscriptions,
+		redis:         client,
+		config:        schedCfg,
+		webhook:       newWebhookClient(schedCfg.Webhook),
+		instanceID:    hostname + "-" + uuid.New().String(),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start 启动调度循环，未启用时不做任何事
+func (s *Scheduler) Start(ctx context.Context) error {
+	if !s.config.Enabled {
+		slog.Info("Scheduler disabled")
+		return nil
+	}
+
+	s.wg.Add(1)
+	go s.loop()
+
+	slog.Info("Scheduler started", "instance", s.instanceID, "tick", s.config.TickInterval)
+	return nil
+}
+
+// Stop 停止调度并等待进行中的投递结束，释放主节点锁
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if s.config.Enabled {
+		if err := releaseLeaderScript.Run(ctx, s.redis, []string{schedulerLeaderKey}, s.instanceID).Err(); err != nil {
+			slog.Error("Failed to release scheduler leadership", "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.TickInterval)
+	defer ticker.Stop()
+
+	for {
+		s.tick()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick() {
+	leader, err := s.acquireLeadership()
+	if err != nil {
+		slog.Error("Scheduler leader election failed", "error", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	now := time.Now()
+	due, err := s.repo.ListDue(s.ctx, now)
+	if err != nil {
+		slog.Error("Failed to list due schedules", "error", err)
+		return
+	}
+
+	for _, schedule := range due {
+		scheduledAt := *schedule.NextRunAt
+
+		// 停机期间错过的触发只补一次，下次时间从当前时间起算
+		next, err := nextRunTime(schedule.CronExpr, schedule.Timezone, now)
+		if err != nil {
+			slog.Error("Invalid schedule", "schedule_id", schedule.ID, "error", err)
+			continue
+		}
+
+		claimed, err := s.repo.ClaimRun(s.ctx, schedule.ID, scheduledAt, next)
+		if err != nil {
+			slog.Error("Failed to claim schedule run", "schedule_id", schedule.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(schedule *models.SubscriptionSchedule) {
+			defer s.wg.Done()
+			s.execute(schedule, scheduledAt)
+		}(schedule)
+	}
+}
+
+// acquireLeadership 获取或续期主节点锁，锁有效期为三个检查间隔
+func (s *Scheduler) acquireLeadership() (bool, error) {
+	ttl := 3 * s.config.TickInterval
+
+	ok, err := s.redis.SetNX(s.ctx, schedulerLeaderKey, s.instanceID, ttl).Result()
+	if err != nil || ok {
+		return ok, err
+	}
+
+	renewed, err := renewLeaderScript.Run(s.ctx, s.redis, []string{schedulerLeaderKey}, s.instanceID, ttl.Milliseconds()).Int()
+	return renewed == 1, err
+}
+
+// execute 执行一次触发，失败时按指数退避重试，每次尝试都更新执行记录
+func (s *Scheduler) execute(schedule *models.SubscriptionSchedule, scheduledAt time.Time) {
+	run := &models.ScheduleRun{
+		ScheduleID:  schedule.ID,
+		SubKey:      schedule.SubKey,
+		Status:      models.RunStatusRunning,
+		ScheduledAt: scheduledAt,
+	}
+	if err := s.repo.CreateRun(s.ctx, run); err != nil {
+		slog.Error("Failed to record schedule run", "schedule_id", schedule.ID, "error", err)
+		return
+	}
+
+	backoff := s.config.RetryBackoff
+	for {
+		run.Attempts++
+		version, rowCount, err := s.runOnce(schedule, scheduledAt)
+		run.Version = version
+		run.RowCount = rowCount
+		if err == nil {
+			run.Status = models.RunStatusSucceeded
+			run.ErrorMsg = ""
+			break
+		}
+
+		run.ErrorMsg = err.Error()
+		slog.Warn("Schedule run failed", "schedule_id", schedule.ID, "attempt", run.Attempts, "error", err)
+		if run.Attempts >= s.config.MaxAttempts || s.ctx.Err() != nil {
+			run.Status = models.RunStatusFailed
+			break
+		}
+
+		if err := s.repo.UpdateRun(s.ctx, run); err != nil {
+			slog.Error("Failed to update schedule run", "run_id", run.ID, "error", err)
+		}
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	// 停机时 s.ctx 已取消，仍需写入最终状态
+	if err := s.repo.UpdateRun(context.Background(), run); err != nil {
+		slog.Error("Failed to update schedule run", "run_id", run.ID, "error", err)
+	}
+}
+
+// runOnce 以保存计划的调用方身份执行订阅并投递结果，返回实际执行的版本和行数
+// 每次触发都重新校验权限，调用方失去订阅或数据源权限后投递失败
+func (s *Scheduler) runOnce(schedule *models.SubscriptionSchedule, scheduledAt time.Time) (uint32, int64, error) {
+	principal, err := schedulePrincipal(schedule)
+	if err != nil {
+		return 0, 0, err
+	}
+	ctx := auth.WithPrincipal(s.ctx, principal)
+
+	var target models.DeliveryTarget
+	if err := json.Unmarshal(schedule.Target, &target); err != nil {
+		return 0, 0, fmt.Errorf("invalid target: %w", err)
+	}
+
+	req := &models.ExecuteSubscriptionRequest{DataSource: schedule.DataSource}
+	if len(schedule.Variables) > 0 {
+		if err := json.Unmarshal(schedule.Variables, &req.Variables); err != nil {
+			return 0, 0, fmt.Errorf("invalid variables: %w", err)
+		}
+	}
+
+	plan, err := s.subscriptions.prepareExecution(ctx, schedule.Type, schedule.SubKey, nil, req)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result := &collectedResult{maxRows: s.config.MaxRows}
+	apiURL := fmt.Sprintf("schedule://%d", schedule.ID)
+	rowCount, err := s.subscriptions.streamPlan(ctx, plan, req, "scheduler", apiURL, result)
+	if err != nil {
+		return plan.subscription.Version, rowCount, err
+	}
+
+	delivery := &delivery{
+		schedule:     schedule,
+		subscription: plan.subscription,
+		target:       &target,
+		result:       result,
+		scheduledAt:  scheduledAt,
+	}
+	return plan.subscription.Version, rowCount, s.deliver(ctx, delivery)
+}
+
+// collectedResult 在内存中收集投递所需的结果
+type collectedResult struct {
+	maxRows int64
+	columns []string
+	rows    [][]interface{}
+}
+
+func (r *collectedResult) WriteHeader(columns []string) error {
+	r.columns = append([]string(nil), columns...)
+	return nil
+}
+
+func (r *collectedResult) WriteRow(values []interface{}) error {
+	if int64(len(r.rows)) >= r.maxRows {
+		return fmt.Errorf("result exceeds %d rows", r.maxRows)
+	}
+	// values 会被复用，需复制
+	r.rows = append(r.rows, append([]interface{}(nil), values...))
+	return nil
+}
+
+func (r *collectedResult) Close() error {
+	return nil
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"gorm.io/gorm"
+)
+
+// SchemaChangeError 待激活版本的输出结构与当前生效版本不兼容
+type SchemaChangeError struct {
+	ActiveVersion uint32
+	Changes       []models.SchemaChange
+}
+
+func (e *SchemaChangeError) Error() string {
+	messages := make([]string, len(e.Changes))
+	for i, c := range e.Changes {
+		messages[i] = describeSchemaChange(c)
+	}
+	return fmt.Sprintf("breaking output schema changes against active version %d: %s", e.ActiveVersion, strings.Join(messages, "; "))
+}
+
+// SchemaMismatchError 严格模式下执行结果与声明的输出结构不一致
+type SchemaMismatchError struct {
+	Violations []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return "result does not match the declared output schema: " + strings.Join(e.Violations, "; ")
+}
+
+var logicalTypes = map[string]bool{
+	models.ColumnString: true, models.ColumnInteger: true, models.ColumnNumber: true, models.ColumnBoolean: true,
+	models.ColumnDate: true, models.ColumnDatetime: true, models.ColumnJSON: true,
+}
+
+// databaseTypes 数据库列类型到逻辑类型的映射，未列出的类型不做类型校验
+var databaseTypes = map[string]string{
+	"TINYINT": models.ColumnInteger, "SMALLINT": models.ColumnInteger, "MEDIUMINT": models.ColumnInteger,
+	"INT": models.ColumnInteger, "INTEGER": models.ColumnInteger, "BIGINT": models.ColumnInteger,
+	"INT2": models.ColumnInteger, "INT4": models.ColumnInteger, "INT8": models.ColumnInteger,
+	"DECIMAL": models.ColumnNumber, "NUMERIC": models.ColumnNumber, "FLOAT": models.ColumnNumber,
+	"DOUBLE": models.ColumnNumber, "REAL": models.ColumnNumber, "FLOAT4": models.ColumnNumber, "FLOAT8": models.ColumnNumber,
+	"BOOL": models.ColumnBoolean, "BOOLEAN": models.ColumnBoolean,
+	"DATE":     models.ColumnDate,
+	"DATETIME": models.ColumnDatetime, "TIMESTAMP": models.ColumnDatetime, "TIMESTAMPTZ": models.ColumnDatetime,
+	"JSON": models.ColumnJSON, "JSONB": models.ColumnJSON,
+	"CHAR": models.ColumnString, "VARCHAR": models.ColumnString, "BPCHAR": models.ColumnString,
+	"TEXT": models.ColumnString, "TINYTEXT": models.ColumnString, "MEDIUMTEXT": models.ColumnString,
+	"LONGTEXT": models.ColumnString, "ENUM": models.ColumnString, "SET": models.ColumnString, "TIME": models.ColumnString,
+	"UUID": models.ColumnString,
+	// ClickHouse
+	"INT16": models.ColumnInteger, "INT32": models.ColumnInteger, "INT64": models.ColumnInteger,
+	"UINT8": models.ColumnInteger, "UINT16": models.ColumnInteger, "UINT32": models.ColumnInteger, "UINT64": models.ColumnInteger,
+	"FLOAT32": models.ColumnNumber, "FLOAT64": models.ColumnNumber,
+	"DECIMAL32": models.ColumnNumber, "DECIMAL64": models.ColumnNumber, "DECIMAL128": models.ColumnNumber,
+	"DATE32": models.ColumnDate, "DATETIME64": models.ColumnDatetime,
+	"STRING": models.ColumnString, "FIXEDSTRING": models.ColumnString, "ENUM8": models.ColumnString, "ENUM16": models.ColumnString,
+}
+
+// widenings 不破坏调用方的类型放宽，反向即为收窄
+var widenings = map[string]string{
+	models.ColumnInteger: models.ColumnNumber,
+	models.ColumnDate:    models.ColumnDatetime,
+}
+
+// logicalType 将驱动返回的列类型名映射为逻辑类型，无法识别时返回空
+// 去掉 ClickHouse 的 Nullable(...)、LowCardinality(...) 包装和类型参数，如 Decimal(10, 2)、VARCHAR(20)
+func logicalType(databaseType string) string {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(databaseType)), "UNSIGNED ")
+	for _, wrapper := range []string{"LOWCARDINALITY(", "NULLABLE("} {
+		if strings.HasPrefix(name, wrapper) && strings.HasSuffix(name, ")") {
+			name = name[len(wrapper) : len(name)-1]
+		}
+	}
+	if i := strings.IndexByte(name, '('); i > 0 {
+		name = name[:i]
+	}
+	return databaseTypes[strings.TrimSpace(name)]
+}
+
+// validateOutputSchema 校验声明的输出结构：列名非空且不重复，类型和模式合法
+func validateOutputSchema(schema *models.OutputSchema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Mode != "" && schema.Mode != models.SchemaModeWarn && schema.Mode != models.SchemaModeStrict {
+		return fmt.Errorf("invalid output_schema mode %q", schema.Mode)
+	}
+	if len(schema.Columns) == 0 {
+		return errors.New("output_schema must declare at least one column")
+	}
+	seen := make(map[string]bool, len(schema.Columns))
+	for _, column := range schema.Columns {
+		if column.Name == "" {
+			return errors.New("output_schema column name is required")
+		}
+		if seen[column.Name] {
+			return fmt.Errorf("duplicate output_schema column %q", column.Name)
+		}
+		seen[column.Name] = true
+		if !logicalTypes[column.Type] {
+			return fmt.Errorf("invalid type %q for output_schema column %q", column.Type, column.Name)
+		}
+	}
+	return nil
+}
+
+// observedSchema 由结果集的列信息推断输出结构
+func observedSchema(columnTypes []*sql.ColumnType) *models.OutputSchema {
+	schema := &models.OutputSchema{Columns: make([]models.SchemaColumn, len(columnTypes))}
+	for i, ct := range columnTypes {
+		nullable, _ := ct.Nullable()
+		schema.Columns[i] = models.SchemaColumn{
+			Name:     ct.Name(),
+			Type:     logicalType(ct.DatabaseTypeName()),
+			Nullable: nullable,
+		}
+	}
+	return schema
+}
+
+// compareSchemas 比较两个版本的输出结构，checkNullable 为 false 时忽略可空性
+// 推断出的可空性不可靠（表达式列通常被报告为可空），只有双方都是声明的结构时才比较
+func compareSchemas(from, to *models.OutputSchema, checkNullable bool) []models.SchemaChange {
+	next := make(map[string]models.SchemaColumn, len(to.Columns))
+	for _, column := range to.Columns {
+		next[column.Name] = column
+	}
+
+	var changes []models.SchemaChange
+	previous := make(map[string]bool, len(from.Columns))
+	for _, old := range from.Columns {
+		previous[old.Name] = true
+		column, ok := next[old.Name]
+		if !ok {
+			changes = append(changes, models.SchemaChange{Column: old.Name, Kind: models.SchemaColumnRemoved, From: old.Type, Breaking: true})
+			continue
+		}
+
+		switch {
+		case old.Type == "" || column.Type == "" || old.Type == column.Type:
+		case widenings[old.Type] == column.Type:
+			changes = append(changes, models.SchemaChange{Column: old.Name, Kind: models.SchemaTypeWidened, From: old.Type, To: column.Type})
+		case widenings[column.Type] == old.Type:
+			changes = append(changes, models.SchemaChange{Column: old.Name, Kind: models.SchemaTypeNarrowed, From: old.Type, To: column.Type, Breaking: true})
+		default:
+			changes = append(changes, models.SchemaChange{Column: old.Name, Kind: models.SchemaTypeChanged, From: old.Type, To: column.Type, Breaking: true})
+		}
+
+		if checkNullable && !old.Nullable && column.Nullable {
+			changes = append(changes, models.SchemaChange{Column: old.Name, Kind: models.SchemaBecameNullable, Breaking: true})
+		}
+	}
+	for _, column := range to.Columns {
+		if !previous[column.Name] {
+			changes = append(changes, models.SchemaChange{Column: column.Name, Kind: models.SchemaColumnAdded, To: column.Type})
+		}
+	}
+	return changes
+}
+
+func describeSchemaChange(c models.SchemaChange) string {
+	switch c.Kind {
+	case models.SchemaColumnRemoved:
+		return fmt.Sprintf("column %s removed", c.Column)
+	case models.SchemaColumnAdded:
+		return fmt.Sprintf("column %s added", c.Column)
+	case models.SchemaBecameNullable:
+		return fmt.Sprintf("column %s became nullable", c.Column)
+	default:
+		return fmt.Sprintf("column %s type %s -> %s", c.Column, c.From, c.To)
+	}
+}
+
+// checkSchemaCompatibility 激活版本前与当前生效版本比较输出结构，有不兼容变化时拒绝，force 时只记录告警
+// observed 为待激活版本试执行得到的结构，未声明结构时使用
+func (s *SubscriptionService) checkSchemaCompatibility(ctx context.Context, subscription *models.Subscription, observed *models.OutputSchema, force bool) error {
+	// 修改生效中版本的内容时与该版本已保存的内容比较，激活其他版本时与当前生效版本比较
+	active, err := s.repo.GetByKeyAndVersion(ctx, subscription.Type, subscription.SubKey, subscription.Version)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil || !models.IsServingStatus(active.Status) {
+		active, err = s.repo.GetActiveByKey(ctx, subscription.Type, subscription.SubKey)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	next, nextDeclared := declaredSchema(subscription)
+	if !nextDeclared {
+		next = observed
+	}
+	current, currentDeclared := declaredSchema(active)
+	if !currentDeclared {
+		// 生效版本未声明结构时试执行获取，失败时无法比较，不阻止激活
+		current, err = s.testExecute(ctx, active)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to observe output schema of active version", "sub_key", active.SubKey, "version", active.Version, "error", err)
+			return nil
+		}
+	}
+	if next == nil || current == nil {
+		return nil
+	}
+
+	var breaking []models.SchemaChange
+	for _, change := range compareSchemas(current, next, nextDeclared && currentDeclared) {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	if len(breaking) == 0 {
+		return nil
+	}
+
+	schemaErr := &SchemaChangeError{ActiveVersion: active.Version, Changes: breaking}
+	if force {
+		slog.WarnContext(ctx, "Activating version with breaking output schema changes", "sub_key", subscription.SubKey, "version", subscription.Version, "error", schemaErr.Error())
+		return nil
+	}
+	return schemaErr
+}
+
+// declaredSchema 获取版本声明的输出结构
+func declaredSchema(subscription *models.Subscription) (*models.OutputSchema, bool) {
+	var extraConfig models.ExtraConfig
+	if err := json.Unmarshal(subscription.ExtraConfig, &extraConfig); err != nil || extraConfig.OutputSchema == nil {
+		return nil, false
+	}
+	return extraConfig.OutputSchema, true
+}
+
+// schemaChecker 按声明的输出结构校验执行结果
+type schemaChecker struct {
+	schema     *models.OutputSchema
+	notNull    []string // 结果列中声明为非空的列名，按结果列顺序，可空或未声明的列为空
+	reported   map[string]bool
+	violations []string
+}
+
+// newSchemaChecker 未声明输出结构时返回 nil
+func newSchemaChecker(schema *models.OutputSchema) *schemaChecker {
+	if schema == nil {
+		return nil
+	}
+	return &schemaChecker{schema: schema, reported: make(map[string]bool)}
+}
+
+func (c *schemaChecker) strict() bool {
+	return c.schema.Mode == models.SchemaModeStrict
+}
+
+// checkColumns 校验结果列与声明是否一致，观测类型可放宽为声明类型
+func (c *schemaChecker) checkColumns(columnTypes []*sql.ColumnType) error {
+	declared := make(map[string]models.SchemaColumn, len(c.schema.Columns))
+	for _, column := range c.schema.Columns {
+		declared[column.Name] = column
+	}
+
+	present := make(map[string]bool, len(columnTypes))
+	c.notNull = make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		name := ct.Name()
+		present[name] = true
+		column, ok := declared[name]
+		if !ok {
+			c.violations = append(c.violations, fmt.Sprintf("column %s is not declared", name))
+			continue
+		}
+		if !column.Nullable {
+			c.notNull[i] = name
+		}
+		actual := logicalType(ct.DatabaseTypeName())
+		if actual != "" && actual != column.Type && widenings[actual] != column.Type {
+			c.violations = append(c.violations, fmt.Sprintf("column %s is %s, declared %s", name, actual, column.Type))
+		}
+	}
+	for _, column := range c.schema.Columns {
+		if !present[column.Name] {
+			c.violations = append(c.violations, fmt.Sprintf("declared column %s is missing", column.Name))
+		}
+	}
+	return c.err()
+}
+
+// checkRow 校验非空列，每列只报告一次
+func (c *schemaChecker) checkRow(values []interface{}) error {
+	for i, name := range c.notNull {
+		if name != "" && values[i] == nil && !c.reported[name] {
+			c.reported[name] = true
+			c.violations = append(c.violations, fmt.Sprintf("column %s contains null", name))
+			if err := c.err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *schemaChecker) err() error {
+	if c.strict() && len(c.violations) > 0 {
+		return &SchemaMismatchError{Violations: c.violations}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogicalType(t *testing.T) {
+	assert.Equal(t, models.ColumnInteger, logicalType("UNSIGNED BIGINT"))
+	assert.Equal(t, models.ColumnNumber, logicalType("decimal"))
+	assert.Equal(t, models.ColumnDatetime, logicalType("TIMESTAMP"))
+	assert.Equal(t, models.ColumnString, logicalType("VARCHAR"))
+	assert.Equal(t, models.ColumnNumber, logicalType("Decimal(10, 2)"))
+	assert.Equal(t, models.ColumnInteger, logicalType("Nullable(UInt64)"))
+	assert.Equal(t, models.ColumnString, logicalType("LowCardinality(Nullable(String))"))
+	assert.Equal(t, models.ColumnDatetime, logicalType("DateTime64(3, 'UTC')"))
+	assert.Equal(t, "", logicalType("GEOMETRY"))
+}
+
+func TestValidateOutputSchema(t *testing.T) {
+	assert.NoError(t, validateOutputSchema(nil))
+	assert.NoError(t, validateOutputSchema(&models.OutputSchema{
+		Mode:    models.SchemaModeStrict,
+		Columns: []models.SchemaColumn{{Name: "id", Type: models.ColumnInteger}},
+	}))
+
+	invalid := []*models.OutputSchema{
+		{},
+		{Mode: "loose", Columns: []models.SchemaColumn{{Name: "id", Type: models.ColumnInteger}}},
+		{Columns: []models.SchemaColumn{{Name: "id", Type: "int"}}},
+		{Columns: []models.SchemaColumn{{Name: "id", Type: models.ColumnInteger}, {Name: "id", Type: models.ColumnString}}},
+	}
+	for _, schema := range invalid {
+		assert.Error(t, validateOutputSchema(schema))
+	}
+}
+
+func TestCompareSchemas(t *testing.T) {
+	from := &models.OutputSchema{Columns: []models.SchemaColumn{
+		{Name: "id", Type: models.ColumnInteger},
+		{Name: "price", Type: models.ColumnNumber},
+		{Name: "day", Type: models.ColumnDate},
+		{Name: "city", Type: models.ColumnString},
+		{Name: "legacy", Type: models.ColumnString},
+	}}
+	to := &models.OutputSchema{Columns: []models.SchemaColumn{
+		{Name: "id", Type: models.ColumnNumber},
+		{Name: "price", Type: models.ColumnInteger},
+		{Name: "day", Type: models.ColumnBoolean},
+		{Name: "city", Type: models.ColumnString, Nullable: true},
+		{Name: "country", Type: models.ColumnString},
+	}}
+
+	changes := compareSchemas(from, to, true)
+	assert.Equal(t, []models.SchemaChange{
+		{Column: "id", Kind: models.SchemaTypeWidened, From: models.ColumnInteger, To: models.ColumnNumber},
+		{Column: "price", Kind: models.SchemaTypeNarrowed, From: models.ColumnNumber, To: models.ColumnInteger, Breaking: true},
+		{Column: "day", Kind: models.SchemaTypeChanged, From: models.ColumnDate, To: models.ColumnBoolean, Breaking: true},
+		{Column: "city", Kind: models.SchemaBecameNullable, Breaking: true},
+		{Column: "legacy", Kind: models.SchemaColumnRemoved, From: models.ColumnString, Breaking: true},
+		{Column: "country", Kind: models.SchemaColumnAdded, To: models.ColumnString},
+	}, changes)
+
+	// 推断的结构不比较可空性，未识别的类型不比较类型
+	observed := &models.OutputSchema{Columns: []models.SchemaColumn{{Name: "city", Nullable: true}}}
+	assert.Empty(t, compareSchemas(&models.OutputSchema{Columns: []models.SchemaColumn{{Name: "city", Type: models.ColumnString}}}, observed, false))
+}
+
+func TestSchemaCheckerNulls(t *testing.T) {
+	warn := newSchemaChecker(&models.OutputSchema{Columns: []models.SchemaColumn{{Name: "id", Type: models.ColumnInteger}}})
+	warn.notNull = []string{"id", ""}
+	assert.NoError(t, warn.checkRow([]interface{}{nil, nil}))
+	assert.NoError(t, warn.checkRow([]interface{}{nil, 1}))
+	assert.Equal(t, []string{"column id contains null"}, warn.violations)
+
+	strict := newSchemaChecker(&models.OutputSchema{Mode: models.SchemaModeStrict, Columns: []models.SchemaColumn{{Name: "id", Type: models.ColumnInteger}}})
+	strict.notNull = []string{"id"}
+	var mismatch *SchemaMismatchError
+	assert.True(t, errors.As(strict.checkRow([]interface{}{nil}), &mismatch))
+
+	assert.Nil(t, newSchemaChecker(nil))
+}
@@ -0,0 +1,591 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+)
+
+const (
+	variableSuffix      = "_replace"
+	defaultListMaxItems = 1000
+)
+
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+// VariableError SQL变量校验错误，可直接返回给调用方
+type VariableError struct {
+	Name   string
+	Reason string
+}
+
+func (e *VariableError) Error() string {
+	return fmt.Sprintf("invalid variable %s: %s", e.Name, e.Reason)
+}
+
+func variableErrorf(name, format string, args ...interface{}) error {
+	return &VariableError{Name: name, Reason: fmt.Sprintf(format, args...)}
+}
+
+// validateVariableSpecs 校验 sql_replace 中声明的变量类型
+func validateVariableSpecs(specs map[string]models.VariableSpec) error {
+	for name, spec := range specs {
+		if !strings.HasSuffix(name, variableSuffix) {
+			return variableErrorf(name, "variable name must end with %s", variableSuffix)
+		}
+
+		switch spec.Type {
+		case "", models.VarTypeInt, models.VarTypeDecimal, models.VarTypeDate,
+			models.VarTypeDatetime, models.VarTypeString:
+		case models.VarTypeEnum:
+			if len(spec.Options) == 0 {
+				return variableErrorf(name, "enum requires options")
+			}
+		case models.VarTypeList:
+			switch spec.ItemType {
+			case "", models.VarTypeInt, models.VarTypeDecimal, models.VarTypeDate,
+				models.VarTypeDatetime, models.VarTypeString:
+			default:
+				return variableErrorf(name, "unsupported list item_type %q", spec.ItemType)
+			}
+		default:
+			return variableErrorf(name, "unsupported type %q", spec.Type)
+		}
+
+		if spec.Default != nil {
+			if _, err := resolveVariable(name, spec, spec.Default, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bindVariables 将SQL中的 xxx_replace 变量转换为 ? 占位符，返回参数化SQL和参数列表
+// 注释会被移除；字符串字面量内的变量会被拆分为字符串拼接以保证值不进入SQL文本
+// 注释、引号和转义按 driver 的方言识别；? 由 gorm 按驱动改写为实际的占位符（如 PostgreSQL 的 $n）
+func bindVariables(sqlContent, driver string, variables map[string]interface{}, specs map[string]models.VariableSpec) (string, []interface{}, error) {
+	resolved := make(map[string]interface{})
+	lookup := func(name string, quoted bool) (interface{}, error) {
+		key := name
+		if quoted {
+			key = name + "'"
+		}
+		if v, ok := resolved[key]; ok {
+			return v, nil
+		}
+
+		value, exists := variables[name]
+		spec := specs[name]
+		if !exists || value == nil {
+			if spec.Default == nil {
+				return nil, variableErrorf(name, "missing required variable")
+			}
+			value = spec.Default
+		}
+
+		v, err := resolveVariable(name, spec, value, quoted)
+		if err != nil {
+			return nil, err
+		}
+		resolved[key] = v
+		return v, nil
+	}
+
+	return bindSQL(sqlContent, driver, lookup)
+}
+
+// parameterizeSQL 不校验变量值，仅将变量替换为 ? 占位符，用于SQL模板的语法和安全校验
+func parameterizeSQL(sqlContent, driver string) (string, error) {
+	sql, _, err := bindSQL(sqlContent, driver, func(string, bool) (interface{}, error) {
+		return int64(0), nil
+	})
+	return sql, err
+}
+
+func bindSQL(sqlContent, driver string, lookup func(name string, quoted bool) (interface{}, error)) (string, []interface{}, error) {
+	var (
+		out  strings.Builder
+		args []interface{}
+	)
+
+	n := len(sqlContent)
+	for i := 0; i < n; {
+		c := sqlContent[i]
+
+		switch {
+		case c == '-' && dashComment(sqlContent[i+1:], driver), c == '#' && dialect.HashComments(driver):
+			end := strings.IndexByte(sqlContent[i:], '\n')
+			if end < 0 {
+				i = n
+			} else {
+				i += end
+			}
+			out.WriteByte(' ')
+
+		case c == '/' && i+1 < n && sqlContent[i+1] == '*':
+			end := strings.Index(sqlContent[i+2:], "*/")
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated comment in SQL")
+			}
+			i += end + 4
+			out.WriteByte(' ')
+
+		case c == '`' && driver != dialect.Postgres, c == '"' && dialect.DoubleQuotedIdentifiers(driver):
+			end := strings.IndexByte(sqlContent[i+1:], c)
+			if end < 0 {
+				return "", nil, fmt.Errorf("unterminated identifier in SQL")
+			}
+			out.WriteString(sqlContent[i : i+end+2])
+			i += end + 2
+
+		case c == '\'' || c == '"':
+			end, err := scanStringLiteral(sqlContent, i, dialect.BackslashEscapes(driver))
+			if err != nil {
+				return "", nil, err
+			}
+			literal, literalArgs, err := bindStringLiteral(sqlContent[i:end], driver, lookup)
+			if err != nil {
+				return "", nil, err
+			}
+			out.WriteString(literal)
+			args = append(args, literalArgs...)
+			i = end
+
+		case c == '?':
+			return "", nil, fmt.Errorf("SQL must not contain '?' placeholders, use xxx_replace variables instead")
+
+		case isIdentByte(c):
+			start := i
+			for i < n && isIdentByte(sqlContent[i]) {
+				i++
+			}
+			word := sqlContent[start:i]
+			if !isVariableName(word) {
+				out.WriteString(word)
+				continue
+			}
+
+			value, err := lookup(word, false)
+			if err != nil {
+				return "", nil, err
+			}
+			if list, ok := value.([]interface{}); ok {
+				placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(list)), ", ")
+				if strings.HasSuffix(strings.TrimRight(out.String(), " \t\r\n"), "(") {
+					out.WriteString(placeholders)
+				} else {
+					out.WriteString("(" + placeholders + ")")
+				}
+				args = append(args, list...)
+			} else {
+				out.WriteByte('?')
+				args = append(args, value)
+			}
+
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+
+	return strings.TrimSpace(out.String()), args, nil
+}
+
+// dashComment rest 为 - 之后的内容，判断是否为 -- 注释
+func dashComment(rest, driver string) bool {
+	if !strings.HasPrefix(rest, "-") {
+		return false
+	}
+	if !dialect.DashCommentNeedsSpace(driver) {
+		return true
+	}
+	return len(rest) == 1 || rest[1] <= ' '
+}
+
+// scanStringLiteral 返回以 start 处引号开始的字符串字面量的结束位置（不含），backslash 表示反斜杠为转义符
+func scanStringLiteral(sqlContent string, start int, backslash bool) (int, error) {
+	quote := sqlContent[start]
+	for i := start + 1; i < len(sqlContent); i++ {
+		switch sqlContent[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case quote:
+			if i+1 < len(sqlContent) && sqlContent[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated string literal in SQL")
+}
+
+// bindStringLiteral 处理字符串字面量中的变量
+// 'xxx_replace' 直接替换为 ?，'%xxx_replace%' 拆分为 CONCAT('%', ?, '%')，PostgreSQL 和 SQLite 使用 ||
+// 字面量中的 ? 会被当作占位符，同样拆出并以 "?" 作为参数绑定
+func bindStringLiteral(literal, driver string, lookup func(string, bool) (interface{}, error)) (string, []interface{}, error) {
+	quote := literal[0]
+	body := literal[1 : len(literal)-1]
+	backslash := dialect.BackslashEscapes(driver)
+
+	type segment struct {
+		text     string
+		variable bool
+		mark     bool // 字面量中的 ?
+	}
+	var segments []segment
+	hasVariable := false
+
+	for i := 0; i < len(body); {
+		if n := questionMark(body[i:], backslash); n > 0 {
+			segments = append(segments, segment{text: body[i : i+n], mark: true})
+			hasVariable = true
+			i += n
+			continue
+		}
+		if !isIdentByte(body[i]) {
+			j := i
+			for j < len(body) && !isIdentByte(body[j]) && questionMark(body[j:], backslash) == 0 {
+				if backslash && body[j] == '\\' && j+1 < len(body) {
+					j++
+				}
+				j++
+			}
+			segments = append(segments, segment{text: body[i:j]})
+			i = j
+			continue
+		}
+
+		j := i
+		for j < len(body) && isIdentByte(body[j]) {
+			j++
+		}
+		word := body[i:j]
+		if isVariableName(word) {
+			segments = append(segments, segment{text: word, variable: true})
+			hasVariable = true
+		} else {
+			segments = append(segments, segment{text: word})
+		}
+		i = j
+	}
+
+	if !hasVariable {
+		return literal, nil, nil
+	}
+
+	var (
+		parts []string
+		args  []interface{}
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			parts = append(parts, string(quote)+text.String()+string(quote))
+			text.Reset()
+		}
+	}
+	for _, seg := range segments {
+		if seg.mark {
+			flush()
+			parts = append(parts, "?")
+			args = append(args, "?")
+			continue
+		}
+		if !seg.variable {
+			text.WriteString(seg.text)
+			continue
+		}
+		value, err := lookup(seg.text, true)
+		if err != nil {
+			return "", nil, err
+		}
+		flush()
+		parts = append(parts, "?")
+		args = append(args, value)
+	}
+	flush()
+
+	if len(parts) == 1 {
+		return parts[0], args, nil
+	}
+	return dialect.Concat(driver, parts), args, nil
+}
+
+// resolveVariable 按声明类型校验并转换变量值
+// quoted 表示变量位于字符串字面量中，此时只允许标量值且统一按字符串绑定
+func resolveVariable(name string, spec models.VariableSpec, value interface{}, quoted bool) (interface{}, error) {
+	if spec.Type == models.VarTypeList {
+		if quoted {
+			return nil, variableErrorf(name, "list variable cannot be used inside a string literal")
+		}
+		return resolveList(name, spec, value)
+	}
+
+	if spec.Type == "" {
+		if quoted {
+			return coerceString(name, value)
+		}
+		return inferValue(name, value)
+	}
+
+	v, err := coerceScalar(name, spec.Type, spec.Options, value)
+	if err != nil {
+		return nil, err
+	}
+	if quoted {
+		return fmt.Sprint(v), nil
+	}
+	return v, nil
+}
+
+func resolveList(name string, spec models.VariableSpec, value interface{}) (interface{}, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	default:
+		return nil, variableErrorf(name, "expected a list")
+	}
+
+	if len(items) == 0 {
+		return nil, variableErrorf(name, "list must not be empty")
+	}
+	maxItems := spec.MaxItems
+	if maxItems <= 0 {
+		maxItems = defaultListMaxItems
+	}
+	if len(items) > maxItems {
+		return nil, variableErrorf(name, "list exceeds %d items", maxItems)
+	}
+
+	itemType := spec.ItemType
+	if itemType == "" {
+		itemType = models.VarTypeString
+	}
+
+	result := make([]interface{}, len(items))
+	for i, item := range items {
+		v, err := coerceScalar(name, itemType, nil, item)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// inferValue 未声明类型的变量（旧配置）按传入值推断类型
+// 兼容旧的文本替换语义：数字字符串按数字绑定，逗号分隔的字符串按列表展开
+func inferValue(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, variableErrorf(name, "list must not be empty")
+		}
+		if len(v) > defaultListMaxItems {
+			return nil, variableErrorf(name, "list exceeds %d items", defaultListMaxItems)
+		}
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			inferred, err := inferValue(name, item)
+			if err != nil {
+				return nil, err
+			}
+			if _, nested := inferred.([]interface{}); nested {
+				return nil, variableErrorf(name, "nested lists are not supported")
+			}
+			result[i] = inferred
+		}
+		return result, nil
+	case string:
+		if strings.Contains(v, ",") {
+			var items []interface{}
+			for _, item := range strings.Split(v, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+			return inferValue(name, items)
+		}
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.String(), nil
+	case bool, int, int64:
+		return v, nil
+	default:
+		return nil, variableErrorf(name, "unsupported value type %T", value)
+	}
+}
+
+func coerceScalar(name, varType string, options []string, value interface{}) (interface{}, error) {
+	switch varType {
+	case models.VarTypeInt:
+		return coerceInt(name, value)
+	case models.VarTypeDecimal:
+		return coerceDecimal(name, value)
+	case models.VarTypeDate:
+		return coerceTime(name, value, []string{"2006-01-02"}, "2006-01-02")
+	case models.VarTypeDatetime:
+		return coerceTime(name, value,
+			[]string{"2006-01-02 15:04:05", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"},
+			"2006-01-02 15:04:05")
+	case models.VarTypeString:
+		return coerceString(name, value)
+	case models.VarTypeEnum:
+		s, err := coerceString(name, value)
+		if err != nil {
+			return nil, err
+		}
+		for _, option := range options {
+			if s == option {
+				return s, nil
+			}
+		}
+		return nil, variableErrorf(name, "value %q is not one of %v", s, options)
+	default:
+		return nil, variableErrorf(name, "unsupported type %q", varType)
+	}
+}
+
+func coerceInt(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		if v != math.Trunc(v) || math.Abs(v) >= 1<<53 {
+			return nil, variableErrorf(name, "expected an integer")
+		}
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return nil, variableErrorf(name, "expected an integer")
+		}
+		return i, nil
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return nil, variableErrorf(name, "expected an integer")
+		}
+		return i, nil
+	default:
+		return nil, variableErrorf(name, "expected an integer")
+	}
+}
+
+func coerceDecimal(name string, value interface{}) (interface{}, error) {
+	var s string
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, variableErrorf(name, "expected a decimal")
+		}
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return nil, variableErrorf(name, "expected a decimal")
+	}
+
+	// 以字符串绑定，避免浮点精度损失
+	if !decimalPattern.MatchString(s) {
+		return nil, variableErrorf(name, "expected a decimal")
+	}
+	return s, nil
+}
+
+func coerceTime(name string, value interface{}, layouts []string, format string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, variableErrorf(name, "expected a %s string", format)
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if layout == time.RFC3339 {
+			t = t.In(time.Local)
+		}
+		return t.Format(format), nil
+	}
+	return nil, variableErrorf(name, "expected format %s", format)
+}
+
+func coerceString(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", variableErrorf(name, "expected a scalar value")
+	}
+}
+
+// questionMark 返回 s 开头的 ? 或转义的 \? 的长度，不是时返回 0
+func questionMark(s string, backslash bool) int {
+	switch {
+	case strings.HasPrefix(s, "?"):
+		return 1
+	case backslash && strings.HasPrefix(s, `\?`):
+		return 2
+	}
+	return 0
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isVariableName(word string) bool {
+	return len(word) > len(variableSuffix) && strings.HasSuffix(word, variableSuffix)
+}
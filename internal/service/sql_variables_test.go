@@ -0,0 +1,201 @@
+package service
+
+import (
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindVariables(t *testing.T) {
+	tests := []struct {
+		name      string
+		driver    string
+		sql       string
+		variables map[string]interface{}
+		specs     map[string]models.VariableSpec
+		wantSQL   string
+		wantArgs  []interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "typed_int",
+			sql:       "SELECT * FROM houses WHERE id = house_id_replace",
+			variables: map[string]interface{}{"house_id_replace": float64(12)},
+			specs:     map[string]models.VariableSpec{"house_id_replace": {Type: models.VarTypeInt}},
+			wantSQL:   "SELECT * FROM houses WHERE id = ?",
+			wantArgs:  []interface{}{int64(12)},
+		},
+		{
+			name:      "int_rejects_injection",
+			sql:       "SELECT * FROM houses WHERE id = house_id_replace",
+			variables: map[string]interface{}{"house_id_replace": "1 OR 1=1"},
+			specs:     map[string]models.VariableSpec{"house_id_replace": {Type: models.VarTypeInt}},
+			wantErr:   true,
+		},
+		{
+			name:      "quoted_string_allows_apostrophe",
+			sql:       "SELECT * FROM users WHERE name = 'name_replace'",
+			variables: map[string]interface{}{"name_replace": "O'Brien"},
+			specs:     map[string]models.VariableSpec{"name_replace": {Type: models.VarTypeString}},
+			wantSQL:   "SELECT * FROM users WHERE name = ?",
+			wantArgs:  []interface{}{"O'Brien"},
+		},
+		{
+			name:      "like_pattern_split_into_concat",
+			sql:       "SELECT * FROM users WHERE name LIKE '%kw_replace%'",
+			variables: map[string]interface{}{"kw_replace": "abc"},
+			wantSQL:   "SELECT * FROM users WHERE name LIKE CONCAT('%', ?, '%')",
+			wantArgs:  []interface{}{"abc"},
+		},
+		{
+			name:      "list_expands_inside_parentheses",
+			sql:       "SELECT * FROM houses WHERE id IN (ids_replace)",
+			variables: map[string]interface{}{"ids_replace": []interface{}{float64(1), float64(2), "3"}},
+			specs:     map[string]models.VariableSpec{"ids_replace": {Type: models.VarTypeList, ItemType: models.VarTypeInt}},
+			wantSQL:   "SELECT * FROM houses WHERE id IN (?, ?, ?)",
+			wantArgs:  []interface{}{int64(1), int64(2), int64(3)},
+		},
+		{
+			name:      "list_rejects_empty",
+			sql:       "SELECT * FROM houses WHERE id IN (ids_replace)",
+			variables: map[string]interface{}{"ids_replace": []interface{}{}},
+			specs:     map[string]models.VariableSpec{"ids_replace": {Type: models.VarTypeList}},
+			wantErr:   true,
+		},
+		{
+			name:      "legacy_comma_string_expands",
+			sql:       "SELECT * FROM houses WHERE id IN (ids_replace)",
+			variables: map[string]interface{}{"ids_replace": "1, 2"},
+			specs:     map[string]models.VariableSpec{"ids_replace": {Description: "房源ID"}},
+			wantSQL:   "SELECT * FROM houses WHERE id IN (?, ?)",
+			wantArgs:  []interface{}{int64(1), int64(2)},
+		},
+		{
+			name:      "date_normalized",
+			sql:       "SELECT * FROM t WHERE ts BETWEEN 'start_at_replace' AND 'end_at_replace'",
+			variables: map[string]interface{}{"start_at_replace": "2025-01-01", "end_at_replace": "2025-01-31"},
+			specs: map[string]models.VariableSpec{
+				"start_at_replace": {Type: models.VarTypeDate},
+				"end_at_replace":   {Type: models.VarTypeDate},
+			},
+			wantSQL:  "SELECT * FROM t WHERE ts BETWEEN ? AND ?",
+			wantArgs: []interface{}{"2025-01-01", "2025-01-31"},
+		},
+		{
+			name:      "enum_rejects_unknown_option",
+			sql:       "SELECT * FROM t WHERE status = status_replace",
+			variables: map[string]interface{}{"status_replace": "X"},
+			specs:     map[string]models.VariableSpec{"status_replace": {Type: models.VarTypeEnum, Options: []string{"A", "B"}}},
+			wantErr:   true,
+		},
+		{
+			name:     "default_used_when_missing",
+			sql:      "SELECT * FROM t LIMIT limit_replace",
+			specs:    map[string]models.VariableSpec{"limit_replace": {Type: models.VarTypeInt, Default: float64(10)}},
+			wantSQL:  "SELECT * FROM t LIMIT ?",
+			wantArgs: []interface{}{int64(10)},
+		},
+		{
+			name:    "missing_variable",
+			sql:     "SELECT * FROM t WHERE id = id_replace",
+			wantErr: true,
+		},
+		{
+			name:      "comments_removed",
+			sql:       "SELECT * FROM t -- other_replace\nWHERE id = id_replace /* x_replace */",
+			variables: map[string]interface{}{"id_replace": float64(1)},
+			wantSQL:   "SELECT * FROM t  \nWHERE id = ?",
+			wantArgs:  []interface{}{int64(1)},
+		},
+		{
+			// MySQL 中 -- 后必须有空白才是注释
+			name:      "mysql_double_dash_without_space",
+			sql:       "SELECT 5--1 AS x FROM t WHERE id = id_replace --\n-- note",
+			variables: map[string]interface{}{"id_replace": float64(1)},
+			wantSQL:   "SELECT 5--1 AS x FROM t WHERE id = ?",
+			wantArgs:  []interface{}{int64(1)},
+		},
+		{
+			name:     "postgres_double_dash_comment",
+			driver:   dialect.Postgres,
+			sql:      "SELECT 5--1 AS x FROM t",
+			wantSQL:  "SELECT 5",
+			wantArgs: nil,
+		},
+		{
+			name:     "question_mark_in_literal_bound",
+			sql:      `SELECT REPLACE(url, '?', '') AS path FROM t WHERE note LIKE 'a\?b%'`,
+			wantSQL:  "SELECT REPLACE(url, ?, '') AS path FROM t WHERE note LIKE CONCAT('a', ?, 'b%')",
+			wantArgs: []interface{}{"?", "?"},
+		},
+		{
+			name:      "question_mark_with_variables",
+			driver:    dialect.Postgres,
+			sql:       "SELECT split_part(url, '?', 1) FROM t WHERE id = id_replace",
+			variables: map[string]interface{}{"id_replace": float64(1)},
+			wantSQL:   "SELECT split_part(url, ?, 1) FROM t WHERE id = ?",
+			wantArgs:  []interface{}{"?", int64(1)},
+		},
+		{
+			name:    "raw_placeholder_rejected",
+			sql:     "SELECT * FROM t WHERE id = ?",
+			wantErr: true,
+		},
+		{
+			name:      "postgres_like_uses_pipes",
+			driver:    dialect.Postgres,
+			sql:       `SELECT "name_replace" FROM users WHERE name LIKE '%kw_replace%' AND a # b = 0`,
+			variables: map[string]interface{}{"kw_replace": "abc"},
+			wantSQL:   `SELECT "name_replace" FROM users WHERE name LIKE ('%' || ? || '%') AND a # b = 0`,
+			wantArgs:  []interface{}{"abc"},
+		},
+		{
+			name:      "postgres_backslash_not_escape",
+			driver:    dialect.Postgres,
+			sql:       `SELECT * FROM t WHERE path = 'C:\' AND id = id_replace`,
+			variables: map[string]interface{}{"id_replace": float64(1)},
+			wantSQL:   `SELECT * FROM t WHERE path = 'C:\' AND id = ?`,
+			wantArgs:  []interface{}{int64(1)},
+		},
+		{
+			name:      "clickhouse_double_quoted_identifier",
+			driver:    dialect.ClickHouse,
+			sql:       `SELECT "id_replace", count() FROM events WHERE id = id_replace # note`,
+			variables: map[string]interface{}{"id_replace": float64(1)},
+			wantSQL:   `SELECT "id_replace", count() FROM events WHERE id = ?`,
+			wantArgs:  []interface{}{int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := bindVariables(tt.sql, tt.driver, tt.variables, tt.specs)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestValidateVariableSpecs(t *testing.T) {
+	assert.NoError(t, validateVariableSpecs(map[string]models.VariableSpec{
+		"id_replace":   {Type: models.VarTypeInt},
+		"name_replace": {Description: "名称"},
+	}))
+	assert.Error(t, validateVariableSpecs(map[string]models.VariableSpec{
+		"id_replace": {Type: "uuid"},
+	}))
+	assert.Error(t, validateVariableSpecs(map[string]models.VariableSpec{
+		"status_replace": {Type: models.VarTypeEnum},
+	}))
+	assert.Error(t, validateVariableSpecs(map[string]models.VariableSpec{
+		"limit_replace": {Type: models.VarTypeInt, Default: "ten"},
+	}))
+}
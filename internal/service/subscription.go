@@ -1,16 +1,22 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
-	"strings"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"git.uhomes.net/uhs-go/go-bisub/internal/config"
 	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/dialect"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/metrics"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/sqlguard"
 	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
 	"gorm.io/gorm"
 )
@@ -18,29 +24,82 @@ import (
 type SubscriptionService struct {
 	repo        *repository.SubscriptionRepository
 	statsRepo   *repository.StatsRepository
-	dataSources map[string]*gorm.DB
+	dataSources *DataSourceRegistry
 	config      *config.Config
+	cache       *ResultCache
+	access      *AccessControl
+	reviews     *repository.ReviewRepository
+	refs        *RefsService
+
+	live atomic.Pointer[config.Config] // 重新加载后的配置，SQL策略和结果限制从这里读取
 }
 
-func NewSubscriptionService(repo *repository.SubscriptionRepository, statsRepo *repository.StatsRepository, dataSources map[string]*gorm.DB, cfg *config.Config) *SubscriptionService {
+func NewSubscriptionService(repo *repository.SubscriptionRepository, statsRepo *repository.StatsRepository, dataSources *DataSourceRegistry, cfg *config.Config, cache *ResultCache, access *AccessControl, reviews *repository.ReviewRepository, refs *RefsService) *SubscriptionService {
 	return &SubscriptionService{
 		repo:        repo,
 		statsRepo:   statsRepo,
 		dataSources: dataSources,
 		config:      cfg,
+		cache:       cache,
+		access:      access,
+		reviews:     reviews,
+		refs:        refs,
 	}
 }
 
-func (s *SubscriptionService) CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest, creatorID uint64) (*models.Subscription, error) {
-	// 解析并校验extra_config
-	var extraConfig models.ExtraConfig
-	if err := json.Unmarshal(req.ExtraConfig, &extraConfig); err != nil {
-		return nil, fmt.Errorf("invalid extra_config: %w", err)
+// ApplyConfig 应用重新加载的配置，执行中的请求继续使用开始时读取的值
+func (s *SubscriptionService) ApplyConfig(cfg *config.Config) {
+	s.live.Store(cfg)
+}
+
+// settings 当前生效的配置，未重新加载过时为启动配置
+func (s *SubscriptionService) settings() *config.Config {
+	if cfg := s.live.Load(); cfg != nil {
+		return cfg
 	}
+	return s.config
+}
 
-	// SQL安全校验
-	if err := s.validateSQL(extraConfig.SQLContent); err != nil {
-		return nil, fmt.Errorf("SQL validation failed: %w", err)
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// metricsService 业务指标中的服务名
+const metricsService = "go-bisub"
+
+// ExecutionResult 订阅执行结果
+type ExecutionResult struct {
+	Rows        []map[string]interface{}
+	CacheHit    bool   // 是否命中结果缓存
+	Truncated   bool   // 结果是否因行数或字节数上限被截断
+	TruncatedBy string // 截断原因：max_rows 或 max_response_bytes
+	HasMore     bool   // 分页时是否还有下一页
+	NextCursor  string // 分页时下一页的游标
+
+	SchemaWarnings []string // 结果与声明的输出结构不一致之处（warn 模式）
+	ServedBy       string   // 切换到备用数据源时实际执行的数据源
+}
+
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, req *models.CreateSubscriptionRequest) (*models.Subscription, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	// 已有key发布新版本需要 edit 权限，新key需在调用方作用域内，由创建者获得 admin 权限
+	exists, err := s.repo.ExistsByKey(ctx, req.Type, req.SubKey)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		err = s.access.Require(ctx, req.Type, req.SubKey, models.PermEdit)
+	} else {
+		err = s.access.RequireScope(ctx, req.SubKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateExtraConfig(req.ExtraConfig); err != nil {
+		return nil, err
 	}
 
 	subscription := &models.Subscription{
@@ -50,18 +109,336 @@ func (s *SubscriptionService) CreateSubscription(ctx context.Context, req *model
 		Title:       req.Title,
 		Abstract:    req.Abstract,
 		Status:      req.Status,
-		CreatedBy:   creatorID,
+		CreatedBy:   principal.UserID,
 		ExtraConfig: req.ExtraConfig,
 	}
+	if err := s.checkInitialStatus(ctx, subscription, req.Force); err != nil {
+		return nil, err
+	}
+
+	// 版本和创建者权限在同一事务中写入；事务内重新确认key是否存在，避免并发创建同一新key时双方都获得 admin 权限
+	meta := revisionMeta(ctx, models.RevisionCreate)
+	err = s.repo.Transaction(ctx, func(repo *repository.SubscriptionRepository) error {
+		existsNow, err := repo.LockKey(ctx, req.Type, req.SubKey)
+		if err != nil {
+			return err
+		}
+		if existsNow && !exists {
+			return fmt.Errorf("%w: %s was created concurrently, edit permission is required to publish a new version", ErrForbidden, req.SubKey)
+		}
+		if err := repo.Create(ctx, subscription, meta); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		if err := s.access.GrantCreator(ctx, repo.ACL(), req.Type, req.SubKey); err != nil {
+			return fmt.Errorf("grant creator permission: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.repo.Create(ctx, subscription); err != nil {
+	return subscription, nil
+}
+
+// ForkSubscription 复制已有版本为新的待生效版本，版本号自动分配，req 中填写的字段覆盖来源版本
+func (s *SubscriptionService) ForkSubscription(ctx context.Context, subType, key string, version uint32, req *models.ForkSubscriptionRequest) (*models.Subscription, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return nil, err
+	}
+
+	parent, err := s.repo.GetByKeyAndVersion(ctx, subType, key, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d", ErrSubscriptionNotFound, version)
+		}
+		return nil, err
+	}
+
+	subscription := &models.Subscription{
+		Type:          parent.Type,
+		SubKey:        parent.SubKey,
+		Title:         parent.Title,
+		Abstract:      parent.Abstract,
+		Status:        models.StatusPending,
+		CreatedBy:     principal.UserID,
+		ExtraConfig:   parent.ExtraConfig,
+		ParentVersion: parent.Version,
+	}
+	if req.Title != "" {
+		subscription.Title = req.Title
+	}
+	if req.Abstract != "" {
+		subscription.Abstract = req.Abstract
+	}
+	if len(req.ExtraConfig) > 0 {
+		subscription.ExtraConfig = req.ExtraConfig
+	}
+	// 来源版本可能早于当前的SQL策略，派生时按普通创建流程重新校验
+	if err := s.validateExtraConfig(subscription.ExtraConfig); err != nil {
 		return nil, err
 	}
 
+	if err := s.repo.Create(ctx, subscription, revisionMeta(ctx, models.RevisionFork)); err != nil {
+		return nil, err
+	}
 	return subscription, nil
 }
 
-func (s *SubscriptionService) ExecuteSubscription(ctx context.Context, subType, key string, version *uint8, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string) ([]map[string]interface{}, error) {
+// executionPlan 一次订阅执行所需的上下文
+type executionPlan struct {
+	subscription *models.Subscription
+	db           *gorm.DB
+	dataSource   string
+	served       string // 实际执行的数据源，切换到备用数据源时与 dataSource 不同
+	sql          string
+	args         []interface{}
+	timeout      time.Duration
+	cacheTTL     time.Duration
+	limits       resultLimits
+	streamLimits resultLimits         // 订阅 extra_config 中的上限，流式输出、异步任务和定时投递只受此约束
+	page         *pageRequest         // 游标分页参数，未分页时为空
+	schema       *models.OutputSchema // 声明的输出结构，未声明时为空
+}
+
+// RowWriter 流式输出执行结果，列顺序与SQL结果保持一致
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+func (s *SubscriptionService) ExecuteSubscription(ctx context.Context, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string) (*ExecutionResult, error) {
+	plan, err := s.prepareExecution(ctx, subType, key, version, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 查询结果缓存，缓存不可用时降级为直接执行
+	var cacheKey string
+	if plan.cacheTTL > 0 && s.cache != nil {
+		lookupStart := time.Now()
+		cacheKey, err = s.cache.CacheKey(ctx, subType, plan.subscription.SubKey, plan.subscription.Version, plan.dataSource, plan.args)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to build result cache key", "sub_key", key, "error", err)
+		} else if results, hit, err := s.cache.Get(ctx, cacheKey); err != nil {
+			slog.WarnContext(ctx, "Failed to read result cache", "sub_key", key, "error", err)
+		} else {
+			metrics.RecordCacheLookup(metricsService, plan.subscription.SubKey, hit)
+			if hit {
+				s.recordExecution(plan, req, clientIP, apiURL, time.Since(lookupStart), int64(len(results)), true)
+				return &ExecutionResult{Rows: results, CacheHit: true}, nil
+			}
+		}
+	}
+
+	if err := s.checkGuardrails(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, plan.timeout)
+	defer cancel()
+
+	// 执行SQL
+	startTime := time.Now()
+	rows, err := s.query(execCtx, plan)
+	if err != nil {
+		return nil, fmt.Errorf("SQL execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	// 处理结果，分页时多读的一行只用于判断是否还有下一页
+	maxRows := plan.limits.maxRows
+	if plan.page != nil {
+		maxRows = plan.page.size
+	}
+	collector := &resultCollector{maxRows: maxRows, maxBytes: plan.limits.maxBytes, schema: newSchemaChecker(plan.schema)}
+	if err := s.processRows(rows, plan.db.Dialector.Name(), collector); err != nil {
+		return nil, err
+	}
+	results, truncatedBy := collector.rows, collector.truncatedBy
+	// 一行都放不下时无法签发游标，继续翻页会一直停在同一位置
+	if plan.page != nil && truncatedBy == TruncatedByBytes && len(results) == 0 {
+		return nil, &PaginationError{Reason: fmt.Sprintf("a single row exceeds max_response_bytes of %d", plan.limits.maxBytes)}
+	}
+	if truncatedBy != "" {
+		// 提前取消查询，避免关闭结果集时继续读取剩余的行
+		cancel()
+	}
+
+	s.recordExecution(plan, req, clientIP, apiURL, time.Since(startTime), int64(len(results)), false)
+
+	result := &ExecutionResult{Rows: results}
+	if plan.served != plan.dataSource {
+		result.ServedBy = plan.served
+	}
+	if collector.schema != nil && len(collector.schema.violations) > 0 {
+		result.SchemaWarnings = collector.schema.violations
+		slog.WarnContext(ctx, "Subscription result does not match declared output schema", "sub_key", key, "version", plan.subscription.Version, "violations", result.SchemaWarnings)
+	}
+	if plan.page != nil {
+		result.HasMore = truncatedBy != ""
+		if truncatedBy == TruncatedByBytes {
+			result.Truncated, result.TruncatedBy = true, truncatedBy
+		}
+		if result.HasMore && len(results) > 0 {
+			result.NextCursor, err = nextCursor(plan.subscription.Version, plan.page.keys, results[len(results)-1])
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if truncatedBy != "" {
+		result.Truncated, result.TruncatedBy = true, truncatedBy
+		slog.WarnContext(ctx, "Subscription result truncated", "sub_key", key, "version", plan.subscription.Version, "limit", truncatedBy, "rows", len(results))
+	}
+
+	// 只缓存完整、无附加信息的结果：截断、分页、输出结构告警和备用数据源执行的结果不缓存，否则命中缓存时会丢失这些信息
+	if cacheKey != "" && !result.Truncated && !result.HasMore && len(result.SchemaWarnings) == 0 && result.ServedBy == "" {
+		if err := s.cache.Set(ctx, cacheKey, results, plan.cacheTTL); err != nil {
+			slog.WarnContext(ctx, "Failed to write result cache", "sub_key", key, "error", err)
+		}
+	}
+
+	return result, nil
+}
+
+// query 执行计划中的SQL，首行返回前的耗时和错误计入数据源健康状态
+func (s *SubscriptionService) query(ctx context.Context, plan *executionPlan) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := plan.db.WithContext(ctx).Raw(plan.sql, plan.args...).Rows()
+	s.dataSources.Report(plan.served, time.Since(start), err)
+	return rows, err
+}
+
+// StreamSubscription 执行订阅并逐行写出结果，不在内存中保留结果集，返回写出的行数
+func (s *SubscriptionService) StreamSubscription(ctx context.Context, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string, w RowWriter) (int64, error) {
+	if err := rejectPagination(req); err != nil {
+		return 0, err
+	}
+
+	plan, err := s.prepareExecution(ctx, subType, key, version, req)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.streamPlan(ctx, plan, req, clientIP, apiURL, w)
+}
+
+// streamPlan 执行已准备好的计划并逐行写出，供同步流式输出和异步任务共用
+// 达到订阅配置的 max_rows/max_response_bytes 时停止读取，已写出的行保留并返回 *ResultTruncatedError
+func (s *SubscriptionService) streamPlan(ctx context.Context, plan *executionPlan, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string, w RowWriter) (int64, error) {
+	if err := s.checkGuardrails(ctx, plan); err != nil {
+		return 0, err
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, plan.timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	rows, err := s.query(execCtx, plan)
+	if err != nil {
+		return 0, fmt.Errorf("SQL execution failed: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	checker := newSchemaChecker(plan.schema)
+	if checker != nil {
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return 0, err
+		}
+		if err := checker.checkColumns(columnTypes); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.WriteHeader(columns); err != nil {
+		return 0, err
+	}
+
+	var rowCount int64
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	driver := plan.db.Dialector.Name()
+	limits := plan.streamLimits
+	var size int64
+	var truncated error
+	for rows.Next() {
+		if limits.maxRows > 0 && rowCount >= int64(limits.maxRows) {
+			truncated = &ResultTruncatedError{Limit: TruncatedByRows, Max: int64(limits.maxRows)}
+			break
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return rowCount, err
+		}
+		for i, val := range values {
+			values[i] = dialect.Decode(driver, val)
+		}
+		if checker != nil {
+			if err := checker.checkRow(values); err != nil {
+				return rowCount, err
+			}
+		}
+		if limits.maxBytes > 0 {
+			// 与JSON响应相同，按序列化后的对象加换行计算
+			row := make(map[string]interface{}, len(columns))
+			for i, col := range columns {
+				row[col] = values[i]
+			}
+			data, _ := json.Marshal(row)
+			if size+int64(len(data))+1 > limits.maxBytes {
+				truncated = &ResultTruncatedError{Limit: TruncatedByBytes, Max: limits.maxBytes}
+				break
+			}
+			size += int64(len(data)) + 1
+		}
+		if err := w.WriteRow(values); err != nil {
+			return rowCount, err
+		}
+		rowCount++
+	}
+	if truncated != nil {
+		// 提前取消查询，避免关闭结果集时继续读取剩余的行
+		cancel()
+	} else if err := rows.Err(); err != nil {
+		return rowCount, err
+	}
+	if err := w.Close(); err != nil {
+		return rowCount, err
+	}
+
+	if checker != nil && len(checker.violations) > 0 {
+		slog.WarnContext(ctx, "Subscription result does not match declared output schema", "sub_key", plan.subscription.SubKey, "version", plan.subscription.Version, "violations", checker.violations)
+	}
+
+	s.recordExecution(plan, req, clientIP, apiURL, time.Since(startTime), rowCount, false)
+
+	if truncated != nil {
+		slog.WarnContext(ctx, "Subscription stream truncated", "sub_key", plan.subscription.SubKey, "version", plan.subscription.Version, "error", truncated, "rows", rowCount)
+	}
+	return rowCount, truncated
+}
+
+// prepareExecution 解析订阅版本、绑定变量并选择数据源
+func (s *SubscriptionService) prepareExecution(ctx context.Context, subType, key string, version *uint32, req *models.ExecuteSubscriptionRequest) (*executionPlan, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermExecute); err != nil {
+		return nil, err
+	}
+
 	// 获取订阅
 	var subscription *models.Subscription
 	var err error
@@ -88,21 +465,31 @@ func (s *SubscriptionService) ExecuteSubscription(ctx context.Context, subType,
 		return nil, fmt.Errorf("invalid extra_config: %w", err)
 	}
 
-	// 替换SQL变量
-	executedSQL, err := s.replaceVariables(extraConfig.SQLContent, req.Variables, extraConfig.SQLReplace)
+	// 选择数据源，只能使用订阅声明允许的数据源
+	dataSource, err := resolveDataSource(&extraConfig, req.DataSource, s.config.Security.AllowPrimaryDataSource)
 	if err != nil {
 		return nil, err
 	}
 
-	// 选择数据源
-	dataSource := req.DataSource
-	if dataSource == "" {
-		dataSource = "default"
+	if err := s.access.RequireDataSource(ctx, dataSource); err != nil {
+		return nil, err
+	}
+
+	// 按数据源的方言绑定SQL变量
+	boundSQL, args, err := bindVariables(extraConfig.SQLContent, s.dataSourceDriver(dataSource), req.Variables, extraConfig.SQLReplace)
+	if err != nil {
+		return nil, err
 	}
 
-	db, exists := s.dataSources[dataSource]
-	if !exists {
-		return nil, fmt.Errorf("data source %s not found", dataSource)
+	// 按目标数据源的策略校验实际执行的SQL
+	if err := sqlguard.Validate(boundSQL, s.sqlPolicy(dataSource)); err != nil {
+		return nil, fmt.Errorf("SQL validation failed: %w", err)
+	}
+
+	// 数据源熔断或不可用时切换到备用数据源，表策略和护栏仍按请求的数据源
+	db, served, err := s.dataSources.Acquire(ctx, dataSource)
+	if err != nil {
+		return nil, err
 	}
 
 	// 设置超时
@@ -111,96 +498,145 @@ func (s *SubscriptionService) ExecuteSubscription(ctx context.Context, subType,
 		timeout = s.config.Server.Timeout
 	}
 
-	execCtx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	// 执行SQL
-	startTime := time.Now()
-	rows, err := db.WithContext(execCtx).Raw(executedSQL).Rows()
-	if err != nil {
-		return nil, fmt.Errorf("SQL execution failed: %w", err)
-	}
-	defer rows.Close()
-
-	// 处理结果
-	results, err := s.processRows(rows)
-	if err != nil {
+	plan := &executionPlan{
+		subscription: subscription,
+		db:           db,
+		dataSource:   dataSource,
+		served:       served,
+		sql:          boundSQL,
+		args:         args,
+		timeout:      timeout,
+		cacheTTL:     time.Duration(extraConfig.CacheTTL) * time.Second,
+		limits:       s.resultLimits(&extraConfig),
+		streamLimits: resultLimits{maxRows: extraConfig.MaxRows, maxBytes: extraConfig.MaxResponseBytes},
+		schema:       extraConfig.OutputSchema,
+	}
+	if err := s.paginate(plan, extraConfig.PageKeys, req); err != nil {
 		return nil, err
 	}
+	return plan, nil
+}
 
-	executionDuration := uint32(time.Since(startTime).Milliseconds())
+// rejectPagination 流式输出和异步任务一次读取全部结果，不支持游标分页
+func rejectPagination(req *models.ExecuteSubscriptionRequest) error {
+	if req.PageSize != 0 || req.Cursor != "" {
+		return &PaginationError{Reason: "pagination is only supported for JSON responses"}
+	}
+	return nil
+}
 
-	// 异步记录统计
+// recordExecution 异步记录执行统计
+func (s *SubscriptionService) recordExecution(plan *executionPlan, req *models.ExecuteSubscriptionRequest, clientIP, apiURL string, duration time.Duration, rowCount int64, cacheHit bool) {
+	// 实例SQL仅用于展示，由驱动方言渲染参数
 	requestResponse := models.RequestResponse{
 		Params:         req.Variables,
-		InstanceSQL:    executedSQL,
-		InstanceSource: dataSource,
+		InstanceSQL:    plan.db.Dialector.Explain(plan.sql, plan.args...),
+		InstanceSource: plan.served,
 		RequestIP:      clientIP,
-		Version:        subscription.Version,
+		Version:        plan.subscription.Version,
+		RowCount:       rowCount,
+		CacheHit:       cacheHit,
 	}
 	requestResponseJSON, _ := json.Marshal(requestResponse)
 
 	go s.recordStats(context.Background(), &models.SubscriptionStats{
-		SubKey:            subscription.SubKey,
-		Version:           subscription.Version,
-		ExecutionDuration: executionDuration,
+		SubKey:            plan.subscription.SubKey,
+		Version:           plan.subscription.Version,
+		ExecutionDuration: uint32(duration.Milliseconds()),
 		RequestURL:        apiURL,
 		RequestResponse:   requestResponseJSON,
-		InstanceSource:    dataSource,
+		InstanceSource:    plan.dataSource,
 	})
-
-	return results, nil
 }
 
-func (s *SubscriptionService) validateSQL(sqlContent string) error {
-	// 移除注释和多余空格
-	cleaned := strings.TrimSpace(regexp.MustCompile(`--.*|/\*[\s\S]*?\*/`).ReplaceAllString(sqlContent, ""))
-
-	// 检查是否为允许的SQL类型
-	for _, allowedType := range s.config.Security.AllowedSQLTypes {
-		if strings.HasPrefix(strings.ToUpper(cleaned), strings.ToUpper(allowedType)) {
-			return nil
+// validateExtraConfig 解析 extra_config 并校验SQL和变量定义
+func (s *SubscriptionService) validateExtraConfig(raw json.RawMessage) error {
+	var extraConfig models.ExtraConfig
+	if err := json.Unmarshal(raw, &extraConfig); err != nil {
+		return fmt.Errorf("invalid extra_config: %w", err)
+	}
+	if err := validateDataSourceBinding(&extraConfig, s.config.Security.AllowPrimaryDataSource); err != nil {
+		return fmt.Errorf("invalid extra_config: %w", err)
+	}
+	// 订阅可在任一允许的数据源上执行，SQL需满足每个数据源的策略
+	for _, dataSource := range subscriptionDataSources(&extraConfig) {
+		if err := s.validateSQL(extraConfig.SQLContent, dataSource); err != nil {
+			return fmt.Errorf("SQL validation failed: %w", err)
 		}
 	}
-
-	return fmt.Errorf("SQL type not allowed, only %v are permitted", s.config.Security.AllowedSQLTypes)
+	if extraConfig.MaxRows < 0 || extraConfig.MaxResponseBytes < 0 {
+		return fmt.Errorf("invalid extra_config: max_rows and max_response_bytes must not be negative")
+	}
+	if err := validatePageKeys(extraConfig.PageKeys); err != nil {
+		return fmt.Errorf("invalid extra_config: %w", err)
+	}
+	if err := validateOutputSchema(extraConfig.OutputSchema); err != nil {
+		return fmt.Errorf("invalid extra_config: %w", err)
+	}
+	return validateVariableSpecs(extraConfig.SQLReplace)
 }
 
-func (s *SubscriptionService) replaceVariables(sqlContent string, variables map[string]interface{}, sqlReplace map[string]string) (string, error) {
-
-	result := sqlContent
-
-	// 查找所有变量占位符
-	re := regexp.MustCompile(`(\w+_replace)`)
-	matches := re.FindAllString(sqlContent, -1)
-
-	for _, match := range matches {
-		value, exists := variables[match]
-		if !exists {
-			return "", fmt.Errorf("missing required variable: %s", match)
-		}
+// validateSQL 将SQL模板按数据源的方言参数化后校验
+func (s *SubscriptionService) validateSQL(sqlContent, dataSource string) error {
+	parameterized, err := parameterizeSQL(sqlContent, s.dataSourceDriver(dataSource))
+	if err != nil {
+		return err
+	}
+	return sqlguard.Validate(parameterized, s.sqlPolicy(dataSource))
+}
 
-		// 简单的SQL注入防护
-		valueStr := fmt.Sprintf("%v", value)
-		if strings.Contains(valueStr, "'") || strings.Contains(valueStr, ";") || strings.Contains(valueStr, "--") {
-			return "", fmt.Errorf("invalid variable value: %s", match)
-		}
+// sqlPolicy 组合全局SQL策略和数据源的表白名单/黑名单，按数据源驱动选择方言
+func (s *SubscriptionService) sqlPolicy(dataSource string) sqlguard.Policy {
+	settings := s.settings()
+	policy := sqlguard.Policy{
+		AllowedStatements: settings.Security.AllowedSQLTypes,
+		DeniedFunctions:   settings.Security.DeniedSQLFunctions,
+	}
 
-		result = strings.ReplaceAll(result, match, valueStr)
+	if dbConfig, ok := s.dataSourceConfig(dataSource); ok {
+		policy.AllowedTables = dbConfig.AllowedTables
+		policy.DeniedTables = dbConfig.DeniedTables
+		policy.DefaultSchema = dialect.DefaultSchema(dbConfig.Driver, dbConfig.Database)
+		policy.Dialect = dbConfig.Driver
 	}
+	return policy
+}
 
-	return result, nil
+// dataSourceDriver 数据源的驱动，未定义的数据源按 MySQL 处理，执行时再报告数据源不存在
+func (s *SubscriptionService) dataSourceDriver(dataSource string) string {
+	dbConfig, _ := s.dataSourceConfig(dataSource)
+	return dialect.Normalize(dbConfig.Driver)
+}
+
+// dataSourceConfig 获取数据源配置，primary 未单独配置时使用主库配置
+func (s *SubscriptionService) dataSourceConfig(dataSource string) (config.DBConfig, bool) {
+	return s.dataSources.Config(dataSource)
 }
 
-func (s *SubscriptionService) processRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+// processRows 读取结果直到达到 collector 的行数或字节数上限，声明了输出结构时同时校验
+// 扫描出的值按 driver 转换为可序列化的类型
+func (s *SubscriptionService) processRows(rows *sql.Rows, driver string, collector *resultCollector) error {
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if collector.schema != nil {
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		if err := collector.schema.checkColumns(columnTypes); err != nil {
+			return err
+		}
 	}
-
-	var results []map[string]interface{}
 
 	for rows.Next() {
+		// 已读满时还能取到下一行，说明结果被截断
+		if collector.full() {
+			collector.truncatedBy = TruncatedByRows
+			break
+		}
+
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
 
@@ -209,23 +645,57 @@ func (s *SubscriptionService) processRows(rows *sql.Rows) ([]map[string]interfac
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, err
+			return err
+		}
+		for i, val := range values {
+			values[i] = dialect.Decode(driver, val)
+		}
+		if collector.schema != nil {
+			if err := collector.schema.checkRow(values); err != nil {
+				return err
+			}
 		}
 
 		row := make(map[string]interface{})
 		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = val
-			}
+			row[col] = values[i]
 		}
 
-		results = append(results, row)
+		if !collector.add(row) {
+			break
+		}
 	}
 
-	return results, rows.Err()
+	return rows.Err()
+}
+
+// resultCollector 按行数和序列化后的字节数上限收集结果，上限为 0 表示不限制
+type resultCollector struct {
+	maxRows     int
+	maxBytes    int64
+	schema      *schemaChecker // 未声明输出结构时为空
+	bytes       int64
+	rows        []map[string]interface{}
+	truncatedBy string
+}
+
+func (c *resultCollector) full() bool {
+	return c.maxRows > 0 && len(c.rows) >= c.maxRows
+}
+
+// add 加入一行，超出字节数上限时丢弃该行并返回 false
+func (c *resultCollector) add(row map[string]interface{}) bool {
+	if c.maxBytes > 0 {
+		data, _ := json.Marshal(row)
+		size := int64(len(data)) + 1
+		if c.bytes+size > c.maxBytes {
+			c.truncatedBy = TruncatedByBytes
+			return false
+		}
+		c.bytes += size
+	}
+	c.rows = append(c.rows, row)
+	return true
 }
 
 func (s *SubscriptionService) recordStats(ctx context.Context, stats *models.SubscriptionStats) {
@@ -267,7 +737,12 @@ func (s *SubscriptionService) GetStats(ctx context.Context, req *models.StatsQue
 		offset = 0
 	}
 
-	return s.statsRepo.GetStats(ctx, startTime, endTime, limit, offset)
+	access, err := s.access.Filter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.statsRepo.GetStats(ctx, startTime, endTime, limit, offset, access)
 }
 
 func (s *SubscriptionService) GetSubscriptions(ctx context.Context, limit, offset int, subKey, title, status string) ([]*models.Subscription, int64, error) {
@@ -278,31 +753,45 @@ func (s *SubscriptionService) GetSubscriptions(ctx context.Context, limit, offse
 		offset = 0
 	}
 
-	return s.repo.List(ctx, limit, offset, subKey, title, status)
+	access, err := s.access.Filter(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.repo.List(ctx, limit, offset, subKey, title, status, access)
 }
 
-func (s *SubscriptionService) GetSubscription(ctx context.Context, subType, key string, version *uint8) (*models.Subscription, error) {
+func (s *SubscriptionService) GetSubscription(ctx context.Context, subType, key string, version *uint32) (*models.Subscription, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermView); err != nil {
+		return nil, err
+	}
 	if version != nil {
 		return s.repo.GetByKeyAndVersion(ctx, subType, key, *version)
 	}
 	return s.repo.GetActiveByKey(ctx, subType, key)
 }
 
-func (s *SubscriptionService) UpdateSubscription(ctx context.Context, subType, key string, version uint8, req *models.UpdateSubscriptionRequest) (*models.Subscription, error) {
+func (s *SubscriptionService) UpdateSubscription(ctx context.Context, subType, key string, version uint32, req *models.UpdateSubscriptionRequest) (*models.Subscription, error) {
+	return s.updateSubscription(ctx, subType, key, version, req, models.RevisionUpdate)
+}
+
+// updateSubscription 修改订阅内容和状态，action 为内容修订的操作类型
+func (s *SubscriptionService) updateSubscription(ctx context.Context, subType, key string, version uint32, req *models.UpdateSubscriptionRequest, action string) (*models.Subscription, error) {
+	if err := s.access.Require(ctx, subType, key, models.PermEdit); err != nil {
+		return nil, err
+	}
+
 	// 获取现有订阅
 	subscription, err := s.repo.GetByKeyAndVersion(ctx, subType, key, version)
 	if err != nil {
 		return nil, fmt.Errorf("subscription not found: %w", err)
 	}
+	original := *subscription
 
 	// 如果更新了extra_config，需要验证SQL
 	if len(req.ExtraConfig) > 0 {
-		var extraConfig models.ExtraConfig
-		if err := json.Unmarshal(req.ExtraConfig, &extraConfig); err != nil {
-			return nil, fmt.Errorf("invalid extra_config: %w", err)
-		}
-		if err := s.validateSQL(extraConfig.SQLContent); err != nil {
-			return nil, fmt.Errorf("SQL validation failed: %w", err)
+		if err := s.validateExtraConfig(req.ExtraConfig); err != nil {
+			return nil, err
 		}
 		subscription.ExtraConfig = req.ExtraConfig
 	}
@@ -314,49 +803,84 @@ func (s *SubscriptionService) UpdateSubscription(ctx context.Context, subType, k
 	if req.Abstract != "" {
 		subscription.Abstract = req.Abstract
 	}
+	contentChanged := subscription.Title != original.Title || subscription.Abstract != original.Abstract ||
+		!bytes.Equal(subscription.ExtraConfig, original.ExtraConfig)
+
+	// 状态变更走状态机，先校验迁移，再保存其他字段
+	targetStatus := subscription.Status
 	if req.Status != "" {
-		subscription.Status = req.Status
+		targetStatus = req.Status
+	}
+	statusChanged := targetStatus != subscription.Status
+	if statusChanged && !models.CanTransition(subscription.Status, targetStatus) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, subscription.Status, targetStatus)
+	}
+	// 开启审核时，激活需要已通过的审核，生效中的版本不能直接修改SQL
+	if models.IsServingStatus(targetStatus) && !models.IsServingStatus(subscription.Status) {
+		if err := s.requireApproval(ctx, subscription); err != nil {
+			return nil, err
+		}
+	}
+	if s.config.Security.RequireReview && models.IsServingStatus(subscription.Status) && !bytes.Equal(subscription.ExtraConfig, original.ExtraConfig) {
+		return nil, fmt.Errorf("%w: extra_config of an active version cannot be changed, fork a new version instead", ErrReviewRequired)
+	}
+	// 激活或修改生效中版本的SQL时试执行，并检查输出结构兼容性
+	if models.IsServingStatus(targetStatus) && (!models.IsServingStatus(subscription.Status) || !bytes.Equal(subscription.ExtraConfig, original.ExtraConfig)) {
+		if err := s.verifyActivation(ctx, subscription, req.Force); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.repo.Update(ctx, subscription); err != nil {
+	// 内容和状态在同一事务中写入，状态已被并发修改时内容修改一并回滚；内容未变化时不写入，避免产生空修订
+	err = s.repo.Transaction(ctx, func(repo *repository.SubscriptionRepository) error {
+		if contentChanged {
+			if err := repo.Update(ctx, subscription, revisionMeta(ctx, action)); err != nil {
+				return err
+			}
+		}
+		if statusChanged {
+			return s.applyTransition(ctx, repo, subscription, targetStatus)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.invalidateCache(ctx, subType, key)
 
 	return subscription, nil
 }
 
-func (s *SubscriptionService) UpdateStatus(ctx context.Context, subType, key string, version uint8, status string) error {
-	// 验证目标状态是否有效
-	validStatuses := map[string]bool{
-		models.StatusPending:               true, // A
-		models.StatusActive:                true, // B
-		models.StatusActiveForceCompatible: true, // C
-		models.StatusExpired:               true, // D
-	}
-	if !validStatuses[status] {
-		return fmt.Errorf("invalid status: %s", status)
-	}
-
-	// 获取当前订阅信息
-	currentSub, err := s.repo.GetByKeyAndVersion(ctx, subType, key, version)
-	if err != nil {
-		return fmt.Errorf("subscription not found: %w", err)
+func (s *SubscriptionService) DeleteSubscription(ctx context.Context, subType, key string, version uint32) error {
+	if err := s.access.Require(ctx, subType, key, models.PermAdmin); err != nil {
+		return err
 	}
-
-	// 检查是否为相同状态
-	if currentSub.Status == status {
-		return fmt.Errorf("subscription is already in status: %s", status)
+	if err := s.repo.Delete(ctx, subType, key, version, revisionMeta(ctx, models.RevisionDelete)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: version %d", ErrSubscriptionNotFound, version)
+		}
+		return err
 	}
+	s.invalidateCache(ctx, subType, key)
+	return nil
+}
 
-	// 状态转换规则验证
-	// 注意：从 A(待生效) 或 D(已失效) 变更为 B(生效中) 或 C(强制兼容) 时
-	// 前端应该先调用执行接口验证 SQL，这里只做基本的状态转换检查
-	// 实际的 SQL 验证由前端在调用此接口前完成
+// GetACL 获取订阅ACL，需要 admin 权限
+func (s *SubscriptionService) GetACL(ctx context.Context, subType, key string) ([]*models.SubscriptionACL, error) {
+	return s.access.ListACL(ctx, subType, key)
+}
 
-	// 执行状态更新
-	return s.repo.UpdateStatus(ctx, subType, key, version, status)
+// SetACL 替换订阅ACL，需要 admin 权限
+func (s *SubscriptionService) SetACL(ctx context.Context, subType, key string, entries []models.ACLEntry) ([]*models.SubscriptionACL, error) {
+	return s.access.SetACL(ctx, subType, key, entries)
 }
 
-func (s *SubscriptionService) DeleteSubscription(ctx context.Context, subType, key string, version uint8) error {
-	return s.repo.Delete(ctx, subType, key, version)
+// invalidateCache 订阅变更后使该key下的结果缓存失效，失败只记录日志
+func (s *SubscriptionService) invalidateCache(ctx context.Context, subType, key string) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Invalidate(ctx, subType, key); err != nil {
+		slog.ErrorContext(ctx, "Failed to invalidate result cache", "type", subType, "sub_key", key, "error", err)
+	}
 }
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkSubscription(t *testing.T) {
+	s, repo := newStoreTestService(t)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindUser, UserID: 7, Username: "alice", Admin: true})
+	// 版本号不连续时，新版本排在最高版本之后
+	for _, sub := range []*models.Subscription{
+		syncVersion(t, "orders", 1, models.StatusActive, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 3, models.StatusExpired, "订单（旧）", "SELECT id, amount FROM orders"),
+	} {
+		require.NoError(t, repo.Create(ctx, sub, revisionMeta(ctx, models.RevisionCreate)))
+	}
+	parent, err := repo.GetByKeyAndVersion(ctx, models.TypeAnalysisData, "orders", 1)
+	require.NoError(t, err)
+
+	// 未填写的字段沿用来源版本，新版本待生效
+	forked, err := s.ForkSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.ForkSubscriptionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), forked.Version)
+	assert.Equal(t, uint32(1), forked.ParentVersion)
+	assert.Equal(t, models.StatusPending, forked.Status)
+	assert.Equal(t, uint64(7), forked.CreatedBy)
+	assert.Equal(t, parent.Title, forked.Title)
+	assert.Equal(t, parent.Abstract, forked.Abstract)
+	assert.JSONEq(t, string(parent.ExtraConfig), string(forked.ExtraConfig))
+
+	stored, err := repo.GetByKeyAndVersion(ctx, models.TypeAnalysisData, "orders", 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), stored.ParentVersion)
+	revisions, _, err := repo.ListRevisions(ctx, models.TypeAnalysisData, "orders", 4, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, models.RevisionFork, revisions[0].Action)
+	assert.Equal(t, "alice", revisions[0].ChangedByName)
+
+	// 填写的字段覆盖来源版本，来源版本不变
+	forked, err = s.ForkSubscription(ctx, models.TypeAnalysisData, "orders", 3, &models.ForkSubscriptionRequest{
+		Title:       "订单（含金额）",
+		ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id, amount, city FROM orders"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), forked.Version)
+	assert.Equal(t, uint32(3), forked.ParentVersion)
+	assert.Equal(t, "订单（含金额）", forked.Title)
+	assert.Equal(t, "订单", forked.Abstract)
+	assert.JSONEq(t, `{"sql_content": "SELECT id, amount, city FROM orders"}`, string(forked.ExtraConfig))
+	source, err := repo.GetByKeyAndVersion(ctx, models.TypeAnalysisData, "orders", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "订单（旧）", source.Title)
+	assert.Equal(t, models.StatusExpired, source.Status)
+
+	// 覆盖的SQL按当前策略校验，失败时不创建版本
+	_, err = s.ForkSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.ForkSubscriptionRequest{
+		ExtraConfig: json.RawMessage(`{"sql_content": "DELETE FROM orders"}`),
+	})
+	assert.ErrorContains(t, err, "SQL validation failed")
+	_, err = s.ForkSubscription(ctx, models.TypeAnalysisData, "orders", 2, &models.ForkSubscriptionRequest{})
+	assert.True(t, errors.Is(err, ErrSubscriptionNotFound))
+
+	// 派生需要 edit 权限
+	_, err = s.ForkSubscription(auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindUser, UserID: 8}), models.TypeAnalysisData, "orders", 1, &models.ForkSubscriptionRequest{})
+	assert.True(t, errors.Is(err, ErrForbidden))
+
+	versions, err := repo.ListVersions(ctx, models.TypeAnalysisData, "orders")
+	require.NoError(t, err)
+	numbers := make([]uint32, 0, len(versions))
+	for _, v := range versions {
+		numbers = append(numbers, v.Version)
+	}
+	assert.ElementsMatch(t, []uint32{1, 3, 4, 5}, numbers)
+
+	// 最高版本删除后，编号从剩余的最高版本继续
+	require.NoError(t, s.DeleteSubscription(ctx, models.TypeAnalysisData, "orders", 5))
+	forked, err = s.ForkSubscription(ctx, models.TypeAnalysisData, "orders", 1, &models.ForkSubscriptionRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), forked.Version)
+
+	// 新key从版本 1 开始
+	created, err := s.CreateSubscription(ctx, &models.CreateSubscriptionRequest{
+		Type: models.TypeAnalysisData, SubKey: "houses", Title: "房源", Abstract: "房源", Status: models.StatusPending,
+		ExtraConfig: json.RawMessage(`{"sql_content": "SELECT id FROM houses"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), created.Version)
+}
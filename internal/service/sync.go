@@ -0,0 +1,322 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/definition"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+)
+
+var ErrSyncNotConfigured = errors.New("gitops.definitions_dir is not configured")
+
+// syncStep 计划中一项变更的执行参数
+type syncStep struct {
+	change  models.SyncChange
+	desired *models.Subscription // create、update 的目标内容，status 的激活校验内容
+	current *models.Subscription // update、status、prune 的库中版本
+	path    []string             // status 依次迁移的状态，不能直接迁移时经由 D
+}
+
+// syncID 订阅版本的标识
+type syncID struct {
+	subType string
+	key     string
+	version uint32
+}
+
+func idOf(s *models.Subscription) syncID {
+	return syncID{s.Type, s.SubKey, s.Version}
+}
+
+// SyncDefinitions 按配置的 gitops.definitions_dir 同步，需要管理员权限
+func (s *SubscriptionService) SyncDefinitions(ctx context.Context, req *models.SyncRequest) (*models.SyncPlan, error) {
+	dir := s.settings().GitOps.DefinitionsDir
+	if dir == "" {
+		return nil, ErrSyncNotConfigured
+	}
+	return s.SyncDirectory(ctx, dir, req)
+}
+
+// SyncDirectory 读取定义目录并同步，需要管理员权限
+func (s *SubscriptionService) SyncDirectory(ctx context.Context, dir string, req *models.SyncRequest) (*models.SyncPlan, error) {
+	if _, err := requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	desired, err := definition.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sync(ctx, desired, req)
+}
+
+// Sync 比较期望版本与库中版本生成计划，req.Apply 时在同一事务中执行
+// 计划按修改内容、停用、创建、激活、删除的顺序执行；激活前按普通流程试执行SQL，
+// 同步视为管理员操作，不经过上线审核（审核在定义仓库的代码评审中完成）
+func (s *SubscriptionService) Sync(ctx context.Context, desired []*models.Subscription, req *models.SyncRequest) (*models.SyncPlan, error) {
+	p, err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := s.repo.SyncedRevisionSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, steps, err := s.planSync(ctx, desired, current, summaries, req.Prune)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Apply || len(steps) == 0 {
+		return plan, nil
+	}
+
+	// 激活试执行在事务外完成，任一版本失败时不做任何修改
+	for _, step := range steps {
+		if activates(step) {
+			if err := s.verifyActivation(ctx, step.desired, req.Force); err != nil {
+				return nil, fmt.Errorf("%s/%s version %d: %w", step.change.Type, step.change.SubKey, step.change.Version, err)
+			}
+		}
+	}
+
+	existing := make(map[[2]string]bool, len(current))
+	for _, sub := range current {
+		existing[[2]string{sub.Type, sub.SubKey}] = true
+	}
+	touched := make(map[[2]string]bool)
+	meta := revisionMeta(ctx, models.RevisionSync)
+	err = s.repo.Transaction(ctx, func(repo *repository.SubscriptionRepository) error {
+		for _, step := range steps {
+			if err := applySyncStep(ctx, repo, step, meta, p.UserID); err != nil {
+				return fmt.Errorf("%s %s/%s version %d: %w", step.change.Action, step.change.Type, step.change.SubKey, step.change.Version, err)
+			}
+			// 新key的同步人获得 admin 权限，与版本在同一事务中写入
+			key := [2]string{step.change.Type, step.change.SubKey}
+			if step.change.Action == models.SyncCreate && !existing[key] && !touched[key] {
+				if err := s.access.GrantCreator(ctx, repo.ACL(), key[0], key[1]); err != nil {
+					return fmt.Errorf("grant creator permission on %s/%s: %w", key[0], key[1], err)
+				}
+			}
+			touched[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.Applied = true
+
+	for key := range touched {
+		s.invalidateCache(ctx, key[0], key[1])
+	}
+
+	slog.InfoContext(ctx, "Subscription definitions synced", "changes", len(plan.Changes), "drift", len(plan.Drift), "operator", p.Name())
+	return plan, nil
+}
+
+// planSync 生成计划，create、update 的内容按当前SQL策略校验
+func (s *SubscriptionService) planSync(ctx context.Context, desired, current []*models.Subscription, summaries []repository.RevisionSummary, prune bool) (*models.SyncPlan, []syncStep, error) {
+	currentByID := make(map[syncID]*models.Subscription, len(current))
+	for _, sub := range current {
+		currentByID[idOf(sub)] = sub
+	}
+	desiredByID := make(map[syncID]*models.Subscription, len(desired))
+	for _, sub := range desired {
+		desiredByID[idOf(sub)] = sub
+	}
+	drifted := make(map[syncID]repository.RevisionSummary)
+	for _, summary := range summaries {
+		if summary.Latest > summary.Synced {
+			drifted[syncID{summary.Type, summary.SubKey, summary.Version}] = summary
+		}
+	}
+
+	plan := &models.SyncPlan{Changes: []models.SyncChange{}}
+	var updates, deactivations, creates, activations, prunes []syncStep
+	driftReported := make(map[syncID]bool)
+	markDrift := func(step *syncStep, id syncID) error {
+		summary, ok := drifted[id]
+		if !ok {
+			return nil
+		}
+		step.change.Drift = true
+		if driftReported[id] {
+			return nil
+		}
+		driftReported[id] = true
+		revision, err := s.repo.GetRevision(ctx, id.subType, id.key, id.version, summary.Latest)
+		if err != nil {
+			return err
+		}
+		plan.Drift = append(plan.Drift, models.SyncDrift{
+			Type:      id.subType,
+			SubKey:    id.key,
+			Version:   id.version,
+			Revision:  revision.Revision,
+			Action:    revision.Action,
+			ChangedBy: revision.ChangedByName,
+			ChangedAt: revision.CreatedAt,
+			Deleted:   revision.Action == models.RevisionDelete,
+		})
+		return nil
+	}
+
+	for _, want := range desired {
+		id := idOf(want)
+		change := models.SyncChange{Type: want.Type, SubKey: want.SubKey, Version: want.Version}
+		have, ok := currentByID[id]
+		if !ok {
+			if err := s.validateVersionContent(want); err != nil {
+				return nil, nil, err
+			}
+			change.Action = models.SyncCreate
+			change.Fields = fieldChanges([3]string{"status", "", want.Status})
+			step := syncStep{change: change, desired: want}
+			if err := markDrift(&step, id); err != nil {
+				return nil, nil, err
+			}
+			creates = append(creates, step)
+			continue
+		}
+
+		// 库中内容无法解析时视为与定义不同
+		haveConfig, err := definition.CanonicalExtraConfig(have.ExtraConfig)
+		if err != nil {
+			haveConfig = have.ExtraConfig
+		}
+		// 激活校验使用同步后的内容
+		target := *have
+		target.Title, target.Abstract, target.ExtraConfig = want.Title, want.Abstract, want.ExtraConfig
+
+		if have.Title != want.Title || have.Abstract != want.Abstract || !bytes.Equal(haveConfig, want.ExtraConfig) {
+			if err := s.validateVersionContent(want); err != nil {
+				return nil, nil, err
+			}
+			change.Action = models.SyncUpdate
+			change.Fields = fieldChanges(
+				[3]string{"title", have.Title, want.Title},
+				[3]string{"abstract", have.Abstract, want.Abstract},
+			)
+			if !bytes.Equal(haveConfig, want.ExtraConfig) {
+				change.ExtraConfig = diffExtraConfig(haveConfig, want.ExtraConfig)
+			}
+			step := syncStep{change: change, desired: &target, current: have}
+			if err := markDrift(&step, id); err != nil {
+				return nil, nil, err
+			}
+			updates = append(updates, step)
+		}
+
+		if have.Status != want.Status {
+			path, ok := statusPath(have.Status, want.Status)
+			if !ok {
+				return nil, nil, fmt.Errorf("%w: %s/%s version %d cannot move from %s to %s", ErrInvalidTransition, want.Type, want.SubKey, want.Version, have.Status, want.Status)
+			}
+			change.Action = models.SyncStatus
+			change.Fields = fieldChanges([3]string{"status", have.Status, want.Status})
+			change.ExtraConfig = nil
+			step := syncStep{change: change, desired: &target, current: have, path: path}
+			if err := markDrift(&step, id); err != nil {
+				return nil, nil, err
+			}
+			if models.IsServingStatus(want.Status) {
+				activations = append(activations, step)
+			} else {
+				deactivations = append(deactivations, step)
+			}
+		}
+	}
+
+	for _, have := range current {
+		if _, ok := desiredByID[idOf(have)]; ok {
+			continue
+		}
+		if !prune {
+			plan.Unmanaged = append(plan.Unmanaged, models.SyncVersionRef{Type: have.Type, SubKey: have.SubKey, Version: have.Version, Status: have.Status})
+			continue
+		}
+		prunes = append(prunes, syncStep{
+			change:  models.SyncChange{Action: models.SyncPrune, Type: have.Type, SubKey: have.SubKey, Version: have.Version},
+			current: have,
+		})
+	}
+
+	var steps []syncStep
+	for _, phase := range [][]syncStep{updates, deactivations, creates, activations, prunes} {
+		for _, step := range phase {
+			steps = append(steps, step)
+			plan.Changes = append(plan.Changes, step.change)
+		}
+	}
+	return plan, steps, nil
+}
+
+// validateVersionContent 按普通创建流程校验 extra_config，错误中附带版本
+func (s *SubscriptionService) validateVersionContent(sub *models.Subscription) error {
+	if err := s.validateExtraConfig(sub.ExtraConfig); err != nil {
+		return fmt.Errorf("%s/%s version %d: %w", sub.Type, sub.SubKey, sub.Version, err)
+	}
+	return nil
+}
+
+// statusPath 从 from 到 to 依次经过的状态，不能直接迁移时尝试经由失效状态（如 C -> D -> B）
+func statusPath(from, to string) ([]string, bool) {
+	if models.CanTransition(from, to) {
+		return []string{to}, true
+	}
+	if models.CanTransition(from, models.StatusExpired) && models.CanTransition(models.StatusExpired, to) {
+		return []string{models.StatusExpired, to}, true
+	}
+	return nil, false
+}
+
+// activates 执行后版本是否由非生效变为生效，需要试执行
+func activates(step syncStep) bool {
+	switch step.change.Action {
+	case models.SyncCreate:
+		return models.IsServingStatus(step.desired.Status)
+	case models.SyncStatus:
+		return models.IsServingStatus(step.path[len(step.path)-1]) && !models.IsServingStatus(step.current.Status)
+	}
+	return false
+}
+
+// applySyncStep 在同步事务中执行一项变更
+func applySyncStep(ctx context.Context, repo *repository.SubscriptionRepository, step syncStep, meta models.RevisionMeta, operatorID uint64) error {
+	switch step.change.Action {
+	case models.SyncCreate:
+		subscription := *step.desired
+		subscription.CreatedBy = operatorID
+		return repo.Create(ctx, &subscription, meta)
+	case models.SyncUpdate:
+		subscription := *step.current
+		subscription.Title, subscription.Abstract, subscription.ExtraConfig = step.desired.Title, step.desired.Abstract, step.desired.ExtraConfig
+		return repo.Update(ctx, &subscription, meta)
+	case models.SyncStatus:
+		from := step.current.Status
+		for _, to := range step.path {
+			changed, err := repo.TransitionStatus(ctx, step.current.Type, step.current.SubKey, step.current.Version, from, to, meta)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				return fmt.Errorf("%w: status was changed concurrently", ErrInvalidTransition)
+			}
+			from = to
+		}
+		return nil
+	case models.SyncPrune:
+		return repo.Delete(ctx, step.current.Type, step.current.SubKey, step.current.Version, meta)
+	}
+	return fmt.Errorf("unknown sync action %q", step.change.Action)
+}
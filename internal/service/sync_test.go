@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"git.uhomes.net/uhs-go/go-bisub/internal/config"
+	"git.uhomes.net/uhs-go/go-bisub/internal/models"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/auth"
+	"git.uhomes.net/uhs-go/go-bisub/internal/pkg/definition"
+	"git.uhomes.net/uhs-go/go-bisub/internal/repository"
+	"git.uhomes.net/uhs-go/go-bisub/internal/utils"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newStoreTestService 使用内存 SQLite 保存订阅、修订、ACL和订阅类型的服务
+func newStoreTestService(t *testing.T) (*SubscriptionService, *repository.SubscriptionRepository) {
+	require.NoError(t, utils.InitSnowflake(1))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Subscription{}, &models.SubscriptionRevision{}, &models.SubscriptionACL{}))
+
+	cfg := &config.Config{}
+	cfg.Security.AllowedSQLTypes = []string{"SELECT"}
+	cfg.Database.DataSources = map[string]config.DBConfig{"default": {Driver: "mysql"}}
+	repo := repository.NewSubscriptionRepository(db)
+	return &SubscriptionService{
+		repo:        repo,
+		config:      cfg,
+		dataSources: &DataSourceRegistry{config: cfg},
+		access:      NewAccessControl(repository.NewACLRepository(db), cfg),
+		refs:        newTestRefs(t, db),
+	}, repo
+}
+
+// newTestRefs 定义了分析数据类型的订阅类型表，与 init.sql 的初始数据一致
+func newTestRefs(t *testing.T, db *gorm.DB) *RefsService {
+	require.NoError(t, db.AutoMigrate(&models.SubRefs{}))
+	require.NoError(t, db.Create(&models.SubRefs{RefField: "SUBSCRIPTION_TYPE", RefValue: models.TypeAnalysisData, RefName: "分析数据"}).Error)
+	return NewRefsService(repository.NewRefsRepository(db))
+}
+
+func syncVersion(t *testing.T, key string, version uint32, status, title, sql string) *models.Subscription {
+	raw, err := json.Marshal(map[string]string{"sql_content": sql})
+	require.NoError(t, err)
+	extraConfig, err := definition.CanonicalExtraConfig(raw)
+	require.NoError(t, err)
+	return &models.Subscription{
+		Type:        models.TypeAnalysisData,
+		SubKey:      key,
+		Version:     version,
+		Title:       title,
+		Abstract:    "订单",
+		Status:      status,
+		ExtraConfig: extraConfig,
+	}
+}
+
+func adminContext() context.Context {
+	return auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindSystem, Username: "gitops", Admin: true})
+}
+
+func TestSyncPlan(t *testing.T) {
+	s, repo := newStoreTestService(t)
+	ctx := adminContext()
+	meta := revisionMeta(ctx, models.RevisionSync)
+	for _, sub := range []*models.Subscription{
+		syncVersion(t, "orders", 1, models.StatusActive, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 2, models.StatusPending, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 3, models.StatusPending, "订单", "SELECT id FROM orders"),
+	} {
+		require.NoError(t, repo.Create(ctx, sub, meta))
+	}
+
+	desired := []*models.Subscription{
+		syncVersion(t, "orders", 1, models.StatusExpired, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 2, models.StatusActiveForceCompatible, "订单（新）", "SELECT id, amount FROM orders"),
+		syncVersion(t, "orders", 4, models.StatusPending, "订单", "SELECT id FROM orders"),
+	}
+	plan, err := s.Sync(ctx, desired, &models.SyncRequest{})
+	require.NoError(t, err)
+	assert.False(t, plan.Applied)
+	assert.Empty(t, plan.Drift)
+	assert.Equal(t, []models.SyncVersionRef{{Type: "A", SubKey: "orders", Version: 3, Status: models.StatusPending}}, plan.Unmanaged)
+
+	// 按修改内容、停用、创建、激活的顺序
+	require.Len(t, plan.Changes, 4)
+	assert.Equal(t, models.SyncUpdate, plan.Changes[0].Action)
+	assert.Equal(t, uint32(2), plan.Changes[0].Version)
+	assert.Equal(t, []models.FieldChange{{Field: "title", From: "订单", To: "订单（新）"}}, plan.Changes[0].Fields)
+	require.NotNil(t, plan.Changes[0].ExtraConfig)
+	assert.NotEmpty(t, plan.Changes[0].ExtraConfig.SQL)
+
+	assert.Equal(t, models.SyncStatus, plan.Changes[1].Action)
+	assert.Equal(t, []models.FieldChange{{Field: "status", From: "B", To: "D"}}, plan.Changes[1].Fields)
+	assert.Equal(t, models.SyncCreate, plan.Changes[2].Action)
+	assert.Equal(t, uint32(4), plan.Changes[2].Version)
+	assert.Equal(t, models.SyncStatus, plan.Changes[3].Action)
+	assert.Equal(t, uint32(2), plan.Changes[3].Version)
+
+	// prune 时删除定义中不存在的版本
+	plan, err = s.Sync(ctx, desired, &models.SyncRequest{Prune: true})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Unmanaged)
+	assert.Equal(t, models.SyncPrune, plan.Changes[len(plan.Changes)-1].Action)
+	assert.Equal(t, uint32(3), plan.Changes[len(plan.Changes)-1].Version)
+
+	// 非管理员不能同步
+	_, err = s.Sync(auth.WithPrincipal(context.Background(), &auth.Principal{Kind: auth.KindUser, UserID: 7}), desired, &models.SyncRequest{})
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
+
+func TestSyncApplyAndDrift(t *testing.T) {
+	s, repo := newStoreTestService(t)
+	ctx := adminContext()
+	require.NoError(t, repo.Create(ctx, syncVersion(t, "orders", 1, models.StatusPending, "订单", "SELECT id FROM orders"), revisionMeta(ctx, models.RevisionCreate)))
+	require.NoError(t, repo.Create(ctx, syncVersion(t, "orders", 2, models.StatusPending, "订单", "SELECT id FROM orders"), revisionMeta(ctx, models.RevisionCreate)))
+
+	desired := []*models.Subscription{
+		syncVersion(t, "orders", 1, models.StatusExpired, "订单", "SELECT id FROM orders"),
+		syncVersion(t, "orders", 3, models.StatusPending, "订单", "SELECT id, amount FROM orders"),
+	}
+	plan, err := s.Sync(ctx, desired, &models.SyncRequest{Apply: true, Prune: true})
+	require.NoError(t, err)
+	assert.True(t, plan.Applied)
+	require.Len(t, plan.Changes, 3)
+	// 从未同步过的版本不视为带外修改
+	assert.Empty(t, plan.Drift)
+
+	current, err := repo.ListAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, current, 2)
+	assert.Equal(t, models.StatusExpired, current[0].Status)
+	assert.Equal(t, uint32(3), current[1].Version)
+
+	// 再次同步没有变更
+	plan, err = s.Sync(ctx, desired, &models.SyncRequest{Apply: true, Prune: true})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	// 同步后在界面上修改的版本报告为带外修改，计划会覆盖它
+	edited := *current[1]
+	edited.Title = "订单（手工修改）"
+	require.NoError(t, repo.Update(ctx, &edited, models.RevisionMeta{Action: models.RevisionUpdate, ChangedBy: 9, ChangedByName: "alice"}))
+
+	plan, err = s.Sync(ctx, desired, &models.SyncRequest{})
+	require.NoError(t, err)
+	require.Len(t, plan.Drift, 1)
+	assert.Equal(t, uint32(3), plan.Drift[0].Version)
+	assert.Equal(t, "alice", plan.Drift[0].ChangedBy)
+	assert.Equal(t, models.RevisionUpdate, plan.Drift[0].Action)
+	require.Len(t, plan.Changes, 1)
+	assert.True(t, plan.Changes[0].Drift)
+	assert.Equal(t, []models.FieldChange{{Field: "title", From: "订单（手工修改）", To: "订单"}}, plan.Changes[0].Fields)
+
+	// 不能迁移的状态在计划阶段报错
+	desired[0] = syncVersion(t, "orders", 1, models.StatusPending, "订单", "SELECT id FROM orders")
+	_, err = s.Sync(ctx, desired, &models.SyncRequest{})
+	assert.True(t, errors.Is(err, ErrInvalidTransition))
+}